@@ -6,16 +6,37 @@ import (
 	"flag"
 	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
 // Структура для хранения конфигурации из JSON-файла.
+// Параметры, для которых нулевое значение имеет смысл (например, отключает кэш),
+// хранятся указателями, чтобы отличать явный ноль от отсутствующего параметра.
 type Config struct {
-	ServerAddress   string `json:"server_address"`
-	BaseURL         string `json:"base_url"`
-	FileStoragePath string `json:"file_storage_path"`
-	DatabaseDSN     string `json:"database_dsn"`
-	EnableHTTPS     bool   `json:"enable_https"`
-	TrustedSubnet   string `json:"trusted_subnet"`
+	ServerAddress       string `json:"server_address"`
+	BaseURL             string `json:"base_url"`
+	FileStoragePath     string `json:"file_storage_path"`
+	DatabaseDSN         string `json:"database_dsn"`
+	EnableHTTPS         bool   `json:"enable_https"`
+	TrustedSubnet       string `json:"trusted_subnet"`
+	DedupMode           string `json:"dedup_mode"`
+	ShortIDStrategy     string `json:"short_id_strategy"`
+	ShortIDLength       int    `json:"short_id_length"`
+	ReapInterval        string `json:"reap_interval"`
+	DeletedRetention    string `json:"deleted_retention"`
+	DeleteFlushSize     int    `json:"delete_flush_size"`
+	DeleteFlushInterval string `json:"delete_flush_interval"`
+	CacheSize           *int   `json:"cache_size"`
+	CacheTTL            string `json:"cache_ttl"`
+	CacheNegativeTTL    string `json:"cache_negative_ttl"`
+	FileSync            string `json:"file_sync"`
+	FileSyncInterval    string `json:"file_sync_interval"`
+	FileCompactSize     *int64 `json:"file_compact_size"`
+	BoltStoragePath     string `json:"bolt_storage_path"`
+	JWTSecret           string `json:"jwt_secret"`
+	JWTKeysFile         string `json:"jwt_keys_file"`
+	IPHashSecret        string `json:"ip_hash_secret"`
 }
 
 // Переменные для хранения значений env и флагов.
@@ -36,6 +57,48 @@ var (
 	ConfigFilePath string
 	// TrustedSubnet добавляет проверку, что переданный IP-адрес клиента входит в доверенную подсеть
 	TrustedSubnet string
+	// DedupMode задаёт режим дедупликации оригинальных URL: global, user или none.
+	DedupMode string
+	// ShortIDStrategy задаёт стратегию генерации коротких идентификаторов: random, sequential или hash.
+	ShortIDStrategy string
+	// ShortIDLength задаёт длину генерируемых коротких идентификаторов.
+	ShortIDLength int
+	// ReapInterval задаёт период фоновой пометки ссылок с истёкшим сроком действия.
+	// Нулевое значение отключает фоновую обработку.
+	ReapInterval time.Duration
+	// DeletedRetention задаёт срок, в течение которого удалённые ссылки можно
+	// восстановить. Затем они удаляются окончательно. Нулевое значение отключает удаление.
+	DeletedRetention time.Duration
+	// DeleteFlushSize задаёт количество идентификаторов, при накоплении которого
+	// удаления записываются в хранилище одной операцией, не дожидаясь интервала.
+	DeleteFlushSize int
+	// DeleteFlushInterval задаёт максимальный интервал накопления удалений.
+	DeleteFlushInterval time.Duration
+	// CacheSize задаёт максимальное количество ссылок в кэше переходов.
+	// Нулевое значение отключает кэш.
+	CacheSize int
+	// CacheTTL задаёт время хранения найденной ссылки в кэше переходов.
+	CacheTTL time.Duration
+	// CacheNegativeTTL задаёт время хранения в кэше отметки об отсутствии ссылки.
+	// Нулевое значение отключает кэширование отсутствия.
+	CacheNegativeTTL time.Duration
+	// FileSync задаёт политику сброса файлового хранилища на диск: always, interval или never.
+	FileSync string
+	// FileSyncInterval задаёт период сброса файлового хранилища на диск для политики interval.
+	FileSyncInterval time.Duration
+	// FileCompactSize задаёт размер журнала файлового хранилища в байтах,
+	// при достижении которого журнал сжимается. Нулевое значение отключает сжатие.
+	FileCompactSize int64
+	// BoltStoragePath определяет путь к файлу встроенной базы bbolt.
+	BoltStoragePath string
+	// JWTSecret задаёт секрет подписи токенов алгоритмом HS256.
+	JWTSecret string
+	// JWTKeysFile определяет путь к файлу связки ключей подписи токенов
+	// с текущим и предыдущими ключами. Имеет приоритет над JWTSecret.
+	// При работе с базой данных должен быть задан JWTKeysFile или JWTSecret.
+	JWTKeysFile string
+	// IPHashSecret задаёт секрет, которым хешируются IP-адреса клиентов в статистике переходов.
+	IPHashSecret string
 )
 
 // ParseFlags читает флаги командной строки и переменные окружения.
@@ -50,6 +113,23 @@ func ParseFlags() {
 	flag.BoolVar(&EnableHTTPS, "s", false, "connection type")
 	flag.StringVar(&ConfigFilePath, "c", "", "path to configuration JSON file")
 	flag.StringVar(&TrustedSubnet, "t", "", "trusted subnet check")
+	flag.StringVar(&DedupMode, "dedup", "user", "original URL deduplication mode: global, user or none")
+	flag.StringVar(&ShortIDStrategy, "id-strategy", "random", "short ID generation strategy: random, sequential or hash")
+	flag.IntVar(&ShortIDLength, "id-length", 8, "short ID length")
+	flag.DurationVar(&ReapInterval, "reap-interval", time.Minute, "interval between expired link sweeps, 0 to disable")
+	flag.DurationVar(&DeletedRetention, "deleted-retention", 30*24*time.Hour, "how long deleted links stay restorable, 0 to keep forever")
+	flag.IntVar(&DeleteFlushSize, "delete-flush-size", 1000, "number of buffered deletions that triggers a flush")
+	flag.DurationVar(&DeleteFlushInterval, "delete-flush-interval", 100*time.Millisecond, "maximum time deletions stay buffered")
+	flag.IntVar(&CacheSize, "cache-size", 10000, "maximum number of links in the redirect cache, 0 to disable")
+	flag.DurationVar(&CacheTTL, "cache-ttl", 5*time.Minute, "how long a found link stays in the redirect cache")
+	flag.DurationVar(&CacheNegativeTTL, "cache-negative-ttl", 30*time.Second, "how long a missing link stays in the redirect cache, 0 to disable")
+	flag.StringVar(&BoltStoragePath, "bolt-path", "", "embedded bbolt database path")
+	flag.StringVar(&JWTSecret, "jwt-secret", "", "HS256 secret for signing auth tokens")
+	flag.StringVar(&JWTKeysFile, "jwt-keys-file", "", "path to JSON keyring with current and previous token signing keys")
+	flag.StringVar(&IPHashSecret, "ip-hash-secret", "", "secret for hashing client IP addresses in click analytics")
+	flag.StringVar(&FileSync, "file-sync", "interval", "file storage fsync policy: always, interval or never")
+	flag.DurationVar(&FileSyncInterval, "file-sync-interval", time.Second, "interval between file storage fsyncs for the interval policy")
+	flag.Int64Var(&FileCompactSize, "file-compact-size", 64<<20, "file storage log size in bytes that triggers compaction, 0 to disable")
 	flag.Parse()
 
 	// Чтение значений из файла конфигурации, если он указан.
@@ -65,6 +145,57 @@ func ParseFlags() {
 		DatabaseDSN = configData.DatabaseDSN
 		EnableHTTPS = configData.EnableHTTPS
 		TrustedSubnet = configData.TrustedSubnet
+		if configData.DedupMode != "" {
+			DedupMode = configData.DedupMode
+		}
+		if configData.ShortIDStrategy != "" {
+			ShortIDStrategy = configData.ShortIDStrategy
+		}
+		if configData.ShortIDLength != 0 {
+			ShortIDLength = configData.ShortIDLength
+		}
+		if configData.ReapInterval != "" {
+			setDuration(&ReapInterval, "reap interval", configData.ReapInterval)
+		}
+		if configData.DeletedRetention != "" {
+			setDuration(&DeletedRetention, "deleted retention", configData.DeletedRetention)
+		}
+		if configData.DeleteFlushSize != 0 {
+			DeleteFlushSize = configData.DeleteFlushSize
+		}
+		if configData.DeleteFlushInterval != "" {
+			setDuration(&DeleteFlushInterval, "delete flush interval", configData.DeleteFlushInterval)
+		}
+		if configData.CacheSize != nil {
+			CacheSize = *configData.CacheSize
+		}
+		if configData.CacheTTL != "" {
+			setDuration(&CacheTTL, "cache TTL", configData.CacheTTL)
+		}
+		if configData.CacheNegativeTTL != "" {
+			setDuration(&CacheNegativeTTL, "cache negative TTL", configData.CacheNegativeTTL)
+		}
+		if configData.BoltStoragePath != "" {
+			BoltStoragePath = configData.BoltStoragePath
+		}
+		if configData.JWTSecret != "" {
+			JWTSecret = configData.JWTSecret
+		}
+		if configData.JWTKeysFile != "" {
+			JWTKeysFile = configData.JWTKeysFile
+		}
+		if configData.IPHashSecret != "" {
+			IPHashSecret = configData.IPHashSecret
+		}
+		if configData.FileSync != "" {
+			FileSync = configData.FileSync
+		}
+		if configData.FileSyncInterval != "" {
+			setDuration(&FileSyncInterval, "file sync interval", configData.FileSyncInterval)
+		}
+		if configData.FileCompactSize != nil {
+			FileCompactSize = *configData.FileCompactSize
+		}
 	}
 
 	// Переопределение значений флагов переменными окружения (если они заданы).
@@ -91,6 +222,105 @@ func ParseFlags() {
 	if trustedSubnet := os.Getenv("TRUSTED_SUBNET"); trustedSubnet != "" {
 		TrustedSubnet = trustedSubnet
 	}
+
+	if dedupMode := os.Getenv("DEDUP_MODE"); dedupMode != "" {
+		DedupMode = dedupMode
+	}
+
+	if shortIDStrategy := os.Getenv("SHORT_ID_STRATEGY"); shortIDStrategy != "" {
+		ShortIDStrategy = shortIDStrategy
+	}
+
+	if shortIDLength := os.Getenv("SHORT_ID_LENGTH"); shortIDLength != "" {
+		length, err := strconv.Atoi(shortIDLength)
+		if err != nil {
+			log.Printf("Warning: invalid SHORT_ID_LENGTH %q: %v", shortIDLength, err)
+		} else {
+			ShortIDLength = length
+		}
+	}
+
+	if reapInterval := os.Getenv("REAP_INTERVAL"); reapInterval != "" {
+		setDuration(&ReapInterval, "reap interval", reapInterval)
+	}
+
+	if deletedRetention := os.Getenv("DELETED_RETENTION"); deletedRetention != "" {
+		setDuration(&DeletedRetention, "deleted retention", deletedRetention)
+	}
+
+	if deleteFlushSize := os.Getenv("DELETE_FLUSH_SIZE"); deleteFlushSize != "" {
+		size, err := strconv.Atoi(deleteFlushSize)
+		if err != nil {
+			log.Printf("Warning: invalid DELETE_FLUSH_SIZE %q: %v", deleteFlushSize, err)
+		} else {
+			DeleteFlushSize = size
+		}
+	}
+
+	if deleteFlushInterval := os.Getenv("DELETE_FLUSH_INTERVAL"); deleteFlushInterval != "" {
+		setDuration(&DeleteFlushInterval, "delete flush interval", deleteFlushInterval)
+	}
+
+	if cacheSize := os.Getenv("CACHE_SIZE"); cacheSize != "" {
+		size, err := strconv.Atoi(cacheSize)
+		if err != nil {
+			log.Printf("Warning: invalid CACHE_SIZE %q: %v", cacheSize, err)
+		} else {
+			CacheSize = size
+		}
+	}
+
+	if cacheTTL := os.Getenv("CACHE_TTL"); cacheTTL != "" {
+		setDuration(&CacheTTL, "cache TTL", cacheTTL)
+	}
+
+	if cacheNegativeTTL := os.Getenv("CACHE_NEGATIVE_TTL"); cacheNegativeTTL != "" {
+		setDuration(&CacheNegativeTTL, "cache negative TTL", cacheNegativeTTL)
+	}
+
+	if boltStoragePath := os.Getenv("BOLT_STORAGE_PATH"); boltStoragePath != "" {
+		BoltStoragePath = boltStoragePath
+	}
+
+	if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
+		JWTSecret = jwtSecret
+	}
+
+	if jwtKeysFile := os.Getenv("JWT_KEYS_FILE"); jwtKeysFile != "" {
+		JWTKeysFile = jwtKeysFile
+	}
+
+	if ipHashSecret := os.Getenv("IP_HASH_SECRET"); ipHashSecret != "" {
+		IPHashSecret = ipHashSecret
+	}
+
+	if fileSync := os.Getenv("FILE_SYNC"); fileSync != "" {
+		FileSync = fileSync
+	}
+
+	if fileSyncInterval := os.Getenv("FILE_SYNC_INTERVAL"); fileSyncInterval != "" {
+		setDuration(&FileSyncInterval, "file sync interval", fileSyncInterval)
+	}
+
+	if fileCompactSize := os.Getenv("FILE_COMPACT_SIZE"); fileCompactSize != "" {
+		size, err := strconv.ParseInt(fileCompactSize, 10, 64)
+		if err != nil {
+			log.Printf("Warning: invalid FILE_COMPACT_SIZE %q: %v", fileCompactSize, err)
+		} else {
+			FileCompactSize = size
+		}
+	}
+}
+
+// setDuration разбирает длительность value и сохраняет её в dst.
+// При ошибке разбора значение dst не меняется.
+func setDuration(dst *time.Duration, name, value string) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q: %v", name, value, err)
+		return
+	}
+	*dst = d
 }
 
 // функция загрузки конфига из файла
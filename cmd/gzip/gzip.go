@@ -45,6 +45,19 @@ func (c *CompressWriter) WriteHeader(statusCode int) {
 	c.w.WriteHeader(statusCode)
 }
 
+// Flush отправляет клиенту уже сжатые данные, не завершая поток gzip.
+// Позволяет потоковым обработчикам отдавать ответ по частям.
+func (c *CompressWriter) Flush() {
+	if err := c.zw.Flush(); err == nil {
+		http.NewResponseController(c.w).Flush()
+	}
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController.
+func (c *CompressWriter) Unwrap() http.ResponseWriter {
+	return c.w
+}
+
 // Close завершает работу с gzip.Writer и отправляет данные в ResponseWriter.
 func (c *CompressWriter) Close() error {
 	return c.zw.Close()
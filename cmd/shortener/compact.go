@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sol1corejz/go-url-shortener/cmd/config"
+	"github.com/sol1corejz/go-url-shortener/internal/file"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+)
+
+// runCompact выполняет подкоманду compact:
+//
+//	shortener [флаги] compact — сжать журнал файлового хранилища в снимок.
+//
+// Работающий сервер сжимает журнал сам; подкоманда предназначена для
+// остановленного сервиса, так как файлы хранилища не должны изменяться
+// двумя процессами одновременно.
+func runCompact(ctx context.Context) error {
+	if config.FileStoragePath == "" {
+		return errors.New("file storage path is required for compact")
+	}
+
+	dedup, err := storage.ParseDedupMode(config.DedupMode)
+	if err != nil {
+		return err
+	}
+	s, err := storage.NewFileStorage(config.FileStoragePath,
+		storage.WithDedupMode(dedup),
+		storage.WithFileSync(file.SyncAlways, 0),
+		storage.WithCompactSize(0),
+	)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.Compact(); err != nil {
+		return err
+	}
+	count, err := s.GetURLsCount(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Compacted %d links into %s\n", count, config.FileStoragePath)
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/auth"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	"github.com/sol1corejz/go-url-shortener/pkg/handlers"
+	pb "github.com/sol1corejz/go-url-shortener/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestProtectedMethodsExist(t *testing.T) {
+	methods := make(map[string]bool)
+	for _, m := range pb.Shortener_ServiceDesc.Methods {
+		methods["/"+pb.Shortener_ServiceDesc.ServiceName+"/"+m.MethodName] = true
+	}
+	for _, s := range pb.Shortener_ServiceDesc.Streams {
+		methods["/"+pb.Shortener_ServiceDesc.ServiceName+"/"+s.StreamName] = true
+	}
+
+	// Метод с опечаткой в имени не совпадёт ни с одним запросом
+	// и останется без проверки авторизации.
+	for method := range protectedMethods {
+		assert.True(t, methods[method], "unknown gRPC method %s", method)
+	}
+	for _, method := range adminMethods {
+		assert.True(t, methods[method], "unknown gRPC method %s", method)
+	}
+}
+
+// importStream — двунаправленный поток StreamPost, сообщения которого
+// передаются через каналы.
+type importStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	reqs  chan *pb.StreamPostRequest
+	resps chan *pb.StreamPostResponse
+}
+
+func (s *importStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *importStream) Recv() (*pb.StreamPostRequest, error) {
+	req, ok := <-s.reqs
+	if !ok {
+		return nil, io.EOF
+	}
+	return req, nil
+}
+
+func (s *importStream) Send(resp *pb.StreamPostResponse) error {
+	s.resps <- resp
+	return nil
+}
+
+func TestStreamPost(t *testing.T) {
+	server := handlers.NewShortenerServer(handlers.NewHandler(storage.NewMemoryStorage()))
+	stream := &importStream{
+		ctx:   auth.WithUserID(context.Background(), "user"),
+		reqs:  make(chan *pb.StreamPostRequest),
+		resps: make(chan *pb.StreamPostResponse),
+	}
+	done := make(chan error, 1)
+	go func() { done <- server.StreamPost(stream) }()
+
+	next := func(t *testing.T) *pb.BatchResponse {
+		select {
+		case resp := <-stream.resps:
+			return resp.GetUrl()
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no response for the row")
+			return nil
+		}
+	}
+
+	// Результат строки приходит, не дожидаясь заполнения пакета и конца потока.
+	stream.reqs <- &pb.StreamPostRequest{Url: &pb.BatchRequest{CorrelationId: "1", OriginalUrl: "https://example.com/stream"}}
+	res := next(t)
+	assert.Equal(t, "1", res.CorrelationId)
+	assert.Equal(t, string(models.BatchCreated), res.Status)
+	assert.NotEmpty(t, res.ShortUrl)
+
+	stream.reqs <- &pb.StreamPostRequest{Url: &pb.BatchRequest{CorrelationId: "2"}}
+	res = next(t)
+	assert.Equal(t, "2", res.CorrelationId)
+	assert.Equal(t, string(models.BatchInvalid), res.Status)
+	assert.NotEmpty(t, res.Error)
+
+	close(stream.reqs)
+	require.NoError(t, <-done)
+}
+
+func TestBatchPostAtomicRejected(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	server := handlers.NewShortenerServer(handlers.NewHandler(store))
+	ctx := auth.WithUserID(context.Background(), "user")
+
+	resp, err := server.BatchPost(ctx, &pb.BatchPostRequest{
+		Atomic: true,
+		Urls: []*pb.BatchRequest{
+			{CorrelationId: "ok", OriginalUrl: "https://example.com/atomic"},
+			{CorrelationId: "bad"},
+		},
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.Rejected)
+	require.Len(t, resp.Urls, 2)
+	assert.Equal(t, "bad", resp.Urls[1].CorrelationId)
+	assert.NotEmpty(t, resp.Urls[1].Error)
+
+	urls, err := store.GetURLsByUser(ctx, "user")
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+}
@@ -3,13 +3,19 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/sol1corejz/go-url-shortener/cmd/config"
+	"github.com/sol1corejz/go-url-shortener/internal/analytics"
+	"github.com/sol1corejz/go-url-shortener/internal/auth"
 	"github.com/sol1corejz/go-url-shortener/internal/cert"
+	"github.com/sol1corejz/go-url-shortener/internal/jobs"
 	"github.com/sol1corejz/go-url-shortener/internal/logger"
 	"github.com/sol1corejz/go-url-shortener/internal/middlewares"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/shortid"
 	"github.com/sol1corejz/go-url-shortener/internal/storage"
 	"github.com/sol1corejz/go-url-shortener/pkg/handlers"
 	pb "github.com/sol1corejz/go-url-shortener/proto"
@@ -22,6 +28,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 // Глобальные переменные для информации о версии сборки.
@@ -31,6 +38,31 @@ var (
 	buildCommit  = "N/A" // Коммит сборки, передается на этапе компиляции.
 )
 
+// protectedMethods — полные имена методов gRPC, которые требуют авторизации,
+// и права, необходимые для них ключу API.
+var protectedMethods = map[string]string{
+	"/proto.Shortener/CreateShortURL":     models.ScopeCreate,
+	"/proto.Shortener/CreateJSONShortURL": models.ScopeCreate,
+	"/proto.Shortener/BatchPost":          models.ScopeCreate,
+	"/proto.Shortener/StreamPost":         models.ScopeCreate,
+	"/proto.Shortener/UpdateURL":          models.ScopeCreate,
+	"/proto.Shortener/GetUserURLs":        models.ScopeRead,
+	"/proto.Shortener/GetURLStats":        models.ScopeRead,
+	"/proto.Shortener/GetJob":             models.ScopeRead,
+	"/proto.Shortener/BatchDelete":        models.ScopeDelete,
+	"/proto.Shortener/BatchRestore":       models.ScopeDelete,
+}
+
+// adminMethods — методы gRPC администратора, доступные только из доверенной подсети.
+var adminMethods = []string{"/proto.Shortener/RevokeUserTokens"}
+
+// jobsShutdownTimeout ограничивает ожидание фоновых задач при остановке сервиса.
+const jobsShutdownTimeout = 30 * time.Second
+
+// revocationsSyncInterval — период, с которым список отозванных токенов
+// перечитывается из базы данных.
+const revocationsSyncInterval = 10 * time.Second
+
 // main — основная функция, которая запускает приложение.
 // Здесь производится обработка флагов конфигурации, инициализация хранилища и вызов функции запуска сервера.
 func main() {
@@ -52,44 +84,184 @@ func main() {
 	// Считывает флаги конфигурации и обновляет параметры запуска.
 	config.ParseFlags()
 
+	// Подкоманда migrate управляет схемой базы данных и не запускает сервер.
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(ctx, flag.Args()[1:]); err != nil {
+			log.Fatalf("migrate failed: %v", err)
+		}
+		return
+	}
+
+	// Подкоманда compact сжимает журнал файлового хранилища и не запускает сервер.
+	if flag.Arg(0) == "compact" {
+		if err := runCompact(ctx); err != nil {
+			log.Fatalf("compact failed: %v", err)
+		}
+		return
+	}
+
+	// Ключи подписи токенов авторизации. С базой данных сервис может работать
+	// в нескольких экземплярах, и случайный ключ каждого из них отвергал бы
+	// токены, выданные другими, поэтому ключ обязателен.
+	keyring, err := auth.LoadKeyring(config.JWTSecret, config.JWTKeysFile)
+	if err != nil {
+		log.Fatalf("failed to load token signing keys: %v", err)
+	}
+	switch {
+	case keyring != nil:
+		auth.SetKeyring(keyring)
+	case config.DatabaseDSN != "":
+		log.Fatalf("token signing key is required with a database: set -jwt-secret or -jwt-keys-file")
+	default:
+		log.Printf("Warning: token signing key is not configured, tokens will not survive a restart")
+	}
+
+	// Ключ хеширования IP-адресов в статистике переходов.
+	if config.IPHashSecret != "" {
+		analytics.SetIPHashKey([]byte(config.IPHashSecret))
+	} else {
+		log.Printf("Warning: IP hash secret is not configured, client IP hashes will not match across restarts")
+	}
+
 	// Инициализирует хранилище на основе параметров конфигурации.
-	storage.InitializeStorage(ctx)
+	store, err := storage.New(ctx)
+	if err != nil {
+		log.Fatalf("failed to initialize storage: %v", err)
+	}
+	defer store.Close()
 
-	lis, err := net.Listen("tcp", ":8081")
+	// Список отозванных токенов доступа. Если хранилище общее для нескольких
+	// экземпляров сервиса, список периодически перечитывается из него.
+	revocations := auth.NewRevocations(store)
+	if err := revocations.Load(ctx); err != nil {
+		log.Fatalf("failed to load token revocations: %v", err)
+	}
+	auth.SetRevocations(revocations)
+	if config.DatabaseDSN != "" {
+		go revocations.Sync(ctx, revocationsSyncInterval)
+	}
+
+	// Генератор коротких идентификаторов выбранной стратегии.
+	generator, err := newShortIDGenerator(ctx, store)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		log.Fatalf("failed to initialize short ID generator: %v", err)
 	}
 
-	// Список методов, которые требуют авторизации.
-	protectedMethods := []string{
-		"/proto.URLShortener/BatchDelete",
-		"/proto.URLShortener/BatchPost",
-		"/proto.URLShortener/CreateShortURL",
-		"/proto.URLShortener/CreateJSONShortURL",
-		"/proto.URLShortener/GetUserURLs",
+	// Обработчики HTTP- и gRPC-запросов, работающие с выбранным хранилищем.
+	h := handlers.NewHandler(store)
+	h.Generator = generator
+	h.Jobs = jobs.NewQueue(store, jobs.DefaultWorkers,
+		jobs.WithFlushSize(config.DeleteFlushSize),
+		jobs.WithFlushInterval(config.DeleteFlushInterval),
+	)
+
+	// Асинхронная запись переходов по ссылкам. Закрывается до хранилища,
+	// чтобы успеть записать накопленные события.
+	h.Clicks = analytics.NewRecorder(store, analytics.DefaultBufferSize, analytics.DefaultBatchSize, analytics.DefaultFlushInterval)
+	defer h.Clicks.Close()
+
+	// Продолжение задач, не завершённых до предыдущей остановки.
+	if err := h.Jobs.Resume(ctx); err != nil {
+		log.Fatalf("failed to resume jobs: %v", err)
 	}
 
-	// Создание GRPC-сервера с перехватчиком авторизации.
+	// Фоновая пометка ссылок с истёкшим сроком действия и окончательное
+	// удаление ссылок, срок хранения которых после удаления истёк.
+	if config.ReapInterval > 0 {
+		go storage.RunReaper(ctx, store, config.ReapInterval, config.DeletedRetention)
+	}
+
+	// Сброс кэша переходов при изменении ссылок другими экземплярами сервиса.
+	if cache, ok := store.(*storage.CachedStorage); ok && config.DatabaseDSN != "" {
+		go storage.ListenInvalidations(ctx, config.DatabaseDSN, cache)
+	}
+
+	lis, err := net.Listen("tcp", ":8081")
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	// Создание GRPC-сервера с перехватчиками авторизации.
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(middlewares.AuthInterceptor(protectedMethods)),
+		grpc.ChainUnaryInterceptor(
+			middlewares.TrustedSubnetInterceptor(config.TrustedSubnet, adminMethods),
+			middlewares.AuthInterceptor(protectedMethods, h.AuthenticateAPIKey),
+		),
+		grpc.StreamInterceptor(middlewares.AuthStreamInterceptor(protectedMethods, h.AuthenticateAPIKey)),
 	)
-	pb.RegisterShortenerServer(grpcServer, &handlers.ShortenerServer{})
+	pb.RegisterShortenerServer(grpcServer, handlers.NewShortenerServer(h))
 
-	log.Println("gRPC server is running on port 50051")
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
-	}
+	// Запускает gRPC-сервер в отдельной горутине, чтобы не блокировать HTTP-сервер.
+	go func() {
+		log.Println("gRPC server is running on port 8081")
+		if err := grpcServer.Serve(lis); err != nil {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
 
 	// Запускает сервер, передавая канал `sigint` для обработки сигналов.
-	if err := run(ctx, sigint, idleConnsClosed); err != nil {
+	if err := run(ctx, h, sigint, idleConnsClosed); err != nil {
 		logger.Log.Error("Failed to run server", zap.Error(err))
 	}
 
 	<-idleConnsClosed
+
+	// Останавливаем gRPC-сервер до очереди задач и хранилища, дождавшись
+	// текущих вызовов, чтобы новые вызовы не попадали в закрытую очередь.
+	grpcServer.GracefulStop()
+
+	// Дожидаемся выполнения поставленных задач. Незавершённые задачи
+	// сохраняются и продолжаются после перезапуска.
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), jobsShutdownTimeout)
+	defer cancelShutdown()
+	if err := h.Jobs.Shutdown(shutdownCtx); err != nil {
+		logger.Log.Warn("Job queue was not drained", zap.Error(err))
+	}
+
 	// Сообщение о закрытии соединения
 	logger.Log.Info("Server Shutdown gracefully")
 }
 
+// newShortIDGenerator создаёт генератор коротких идентификаторов по конфигурации.
+// Счётчик последовательной стратегии продолжается с наибольшего сохранённого
+// идентификатора, чтобы после перезапуска не повторять выданные идентификаторы,
+// даже если часть ссылок уже удалена окончательно.
+func newShortIDGenerator(ctx context.Context, store storage.Storage) (shortid.Generator, error) {
+	var seed uint64
+	if config.ShortIDStrategy == shortid.StrategySequential {
+		var err error
+		if seed, err = sequentialSeed(ctx, store, config.ShortIDLength); err != nil {
+			return nil, err
+		}
+	}
+	return shortid.New(config.ShortIDStrategy, config.ShortIDLength, seed)
+}
+
+// sequentialSeed возвращает значение счётчика последовательной стратегии,
+// соответствующее наибольшему сохранённому идентификатору. Когда счётчик
+// перерастает длину length, идентификаторы удлиняются, поэтому проверяются
+// и более длинные идентификаторы, пока они есть. Идентификаторы, значение
+// которых не помещается в счётчик, последовательная стратегия выдать не может,
+// и они не учитываются.
+//
+// Экземпляры сервиса с общим хранилищем продолжают одну последовательность
+// независимо друг от друга: их коллизии разрешаются повторными попытками,
+// при каждой из которых счётчик продвигается дальше.
+func sequentialSeed(ctx context.Context, store storage.Storage, length int) (uint64, error) {
+	var seed uint64
+	for ; ; length++ {
+		last, err := store.MaxShortURL(ctx, length)
+		if err != nil {
+			return 0, err
+		}
+		n, ok := shortid.Decode(last)
+		if !ok {
+			return seed, nil
+		}
+		seed = max(seed, n)
+	}
+}
+
 // run запускает HTTP-сервер, определяет маршруты и подключает middleware.
 // Если запуск сервера завершается с ошибкой, функция возвращает её.
 //
@@ -100,12 +272,24 @@ func main() {
 // - "/api/shorten/batch" (POST): Обработчик для пакетного сокращения URL.
 // - "/api/user/urls" (GET): Обработчик для получения URL текущего пользователя.
 // - "/api/user/urls" (DELETE): Обработчик для удаления списка URL.
+// - "/api/user/urls/restore" (POST): Обработчик для восстановления удалённых URL.
+// - "/api/user/urls/{id}" (PATCH): Обработчик для изменения оригинального URL.
+// - "/api/user/urls/{id}/stats" (GET): Обработчик для получения статистики переходов по URL.
+// - "/api/jobs/{id}" (GET): Обработчик для получения состояния фоновой задачи.
+// - "/api/auth/refresh" (POST): Обработчик для обновления токена доступа по токену обновления.
+// - "/api/auth/register" (POST): Обработчик для регистрации учётной записи.
+// - "/api/auth/login" (POST): Обработчик для входа в учётную запись.
+// - "/api/auth/logout" (POST): Обработчик для выхода с отзывом токенов сессии.
+// - "/api/user/keys" (POST): Обработчик для создания ключа API.
+// - "/api/user/keys" (GET): Обработчик для получения ключей API пользователя.
+// - "/api/user/keys/{id}" (DELETE): Обработчик для отзыва ключа API.
+// - "/api/internal/users/{id}/revoke-tokens" (POST): Обработчик для отзыва всех токенов и ключей API пользователя (доверенная подсеть).
 // - "/ping" (GET): Обработчик для проверки доступности сервера.
 //
 // Middleware:
 // - GzipMiddleware: Сжатие/распаковка данных для оптимизации запросов.
 // - RequestLogger: Логирование каждого входящего запроса.
-func run(ctx context.Context, sigint chan os.Signal, idleConnsClosed chan struct{}) error {
+func run(ctx context.Context, h *handlers.Handler, sigint chan os.Signal, idleConnsClosed chan struct{}) error {
 	// Инициализирует логгер с заданным уровнем логирования.
 	if err := logger.Initialize(config.FlagLogLevel); err != nil {
 		return err
@@ -126,31 +310,47 @@ func run(ctx context.Context, sigint chan os.Signal, idleConnsClosed chan struct
 
 	// Определяет основные маршруты для обработки запросов.
 	r.Route("/", func(r chi.Router) {
-		r.Post("/", logger.RequestLogger(middlewares.GzipMiddleware(handlers.HandlePost)))
-		r.Get("/{shortURL}", logger.RequestLogger(middlewares.GzipMiddleware(handlers.HandleGet)))
+		r.Post("/", logger.RequestLogger(middlewares.GzipMiddleware(h.HandlePost)))
+		r.Get("/{shortURL}", logger.RequestLogger(middlewares.GzipMiddleware(h.HandleGet)))
 	})
 
 	// Определяет маршруты для API.
 	r.Route("/api", func(r chi.Router) {
-		r.Post("/shorten", logger.RequestLogger(middlewares.GzipMiddleware(handlers.HandleJSONPost)))
-		r.Post("/shorten/batch", logger.RequestLogger(middlewares.GzipMiddleware(handlers.HandleBatchPost)))
-		r.Get("/user/urls", logger.RequestLogger(middlewares.GzipMiddleware(handlers.HandleGetUserURLs)))
-		r.Delete("/user/urls", logger.RequestLogger(middlewares.GzipMiddleware(handlers.HandleDeleteURLs)))
+		r.Post("/shorten", logger.RequestLogger(middlewares.GzipMiddleware(h.HandleJSONPost)))
+		r.Post("/shorten/batch", logger.RequestLogger(middlewares.GzipMiddleware(h.HandleBatchPost)))
+		r.Post("/shorten/stream", logger.RequestLogger(middlewares.GzipMiddleware(h.HandleStreamPost)))
+		r.Get("/user/urls", logger.RequestLogger(middlewares.GzipMiddleware(h.HandleGetUserURLs)))
+		r.Get("/user/urls/export", logger.RequestLogger(middlewares.GzipMiddleware(h.HandleExportUserURLs)))
+		r.Delete("/user/urls", logger.RequestLogger(middlewares.GzipMiddleware(h.HandleDeleteURLs)))
+		r.Post("/user/urls/restore", logger.RequestLogger(middlewares.GzipMiddleware(h.HandleRestoreURLs)))
+		r.Patch("/user/urls/{id}", logger.RequestLogger(middlewares.GzipMiddleware(h.HandleUpdateURL)))
+		r.Get("/user/urls/{id}/stats", logger.RequestLogger(middlewares.GzipMiddleware(h.HandleGetURLStats)))
+		r.Get("/jobs/{id}", logger.RequestLogger(middlewares.GzipMiddleware(h.HandleGetJob)))
+		r.Post("/user/keys", logger.RequestLogger(h.HandleCreateAPIKey))
+		r.Get("/user/keys", logger.RequestLogger(h.HandleListAPIKeys))
+		r.Delete("/user/keys/{id}", logger.RequestLogger(h.HandleDeleteAPIKey))
+		r.Post("/auth/refresh", logger.RequestLogger(h.HandleRefresh))
+		r.Post("/auth/register", logger.RequestLogger(h.HandleRegister))
+		r.Post("/auth/login", logger.RequestLogger(h.HandleLogin))
+		r.Post("/auth/logout", logger.RequestLogger(h.HandleLogout))
 	})
 
-	// Маршрут для получения статистики
+	// Маршруты для получения статистики и отзыва токенов
 	r.Route("/api/internal", func(r chi.Router) {
 		if config.TrustedSubnet != "" {
-			r.Get("/stats", logger.RequestLogger(middlewares.TrustedSubnetMiddleware(config.TrustedSubnet, middlewares.GzipMiddleware(handlers.HandleGetInternalStats))))
+			r.Get("/stats", logger.RequestLogger(middlewares.TrustedSubnetMiddleware(config.TrustedSubnet, middlewares.GzipMiddleware(h.HandleGetInternalStats))))
+			r.Post("/users/{id}/revoke-tokens", logger.RequestLogger(middlewares.TrustedSubnetMiddleware(config.TrustedSubnet, h.HandleRevokeUserTokens)))
 		} else {
-			r.Get("/stats", func(w http.ResponseWriter, r *http.Request) {
+			forbidden := func(w http.ResponseWriter, r *http.Request) {
 				http.Error(w, "Forbidden", http.StatusForbidden)
-			})
+			}
+			r.Get("/stats", forbidden)
+			r.Post("/users/{id}/revoke-tokens", forbidden)
 		}
 	})
 
 	// Добавляет маршрут для проверки доступности сервера.
-	r.Get("/ping", logger.RequestLogger(handlers.HandlePing))
+	r.Get("/ping", logger.RequestLogger(h.HandlePing))
 
 	// Создаем сервер
 	srv := &http.Server{
@@ -4,16 +4,22 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/sol1corejz/go-url-shortener/cmd/config"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sol1corejz/go-url-shortener/internal/analytics"
+	"github.com/sol1corejz/go-url-shortener/internal/auth"
 	"github.com/sol1corejz/go-url-shortener/internal/models"
 	"github.com/sol1corejz/go-url-shortener/internal/storage"
 	"github.com/sol1corejz/go-url-shortener/pkg/handlers"
@@ -27,7 +33,13 @@ func testRequest(t *testing.T, ts *httptest.Server, method,
 	req, err := http.NewRequest(method, ts.URL+path, nil)
 	require.NoError(t, err)
 
-	resp, err := ts.Client().Do(req)
+	// Не следуем редиректам, чтобы проверять ответ самого сервиса.
+	client := ts.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := client.Do(req)
 	require.NoError(t, err)
 	defer resp.Body.Close()
 
@@ -37,14 +49,18 @@ func testRequest(t *testing.T, ts *httptest.Server, method,
 	return resp, string(respBody)
 }
 
-func initFile(t *testing.T) {
+func initFile(t *testing.T) *handlers.Handler {
 	tmpFile, err := os.CreateTemp("", "test_file_*.json")
 	if err != nil {
 		t.Fatalf("Failed to create temp file: %v", err)
 	}
-	defer os.Remove(tmpFile.Name())
+	tmpFile.Close()
+	t.Cleanup(func() { os.Remove(tmpFile.Name()) })
+
+	store, err := storage.NewFileStorage(tmpFile.Name())
+	require.NoError(t, err)
 
-	config.FileStoragePath = tmpFile.Name()
+	return handlers.NewHandler(store)
 }
 
 func Test_handlePost(t *testing.T) {
@@ -78,12 +94,12 @@ func Test_handlePost(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 
-			initFile(t)
+			h := initFile(t)
 
 			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.inputURL))
 			w := httptest.NewRecorder()
 
-			handlers.HandlePost(w, req)
+			h.HandlePost(w, req)
 
 			res := w.Result()
 			defer res.Body.Close()
@@ -101,26 +117,27 @@ func Test_handlePost(t *testing.T) {
 				shortID := shortURLs[len(shortURLs)-1]
 				assert.Len(t, shortID, 8)
 
-				// Проверка сохранения в локальное хранилище
-				storage.Mu.Lock()
-				_, ok := storage.URLStore[shortID]
-				storage.Mu.Unlock()
-				assert.True(t, ok)
+				// Проверка сохранения в хранилище
+				_, err = h.Storage.GetOriginalURL(context.Background(), shortID)
+				assert.NoError(t, err)
 			}
 		})
 	}
 }
 
 func Test_handleGet(t *testing.T) {
+	h := handlers.NewHandler(storage.NewMemoryStorage())
+	_, err := h.Storage.SaveURL(context.Background(), &models.URLData{
+		ShortURL:    "abc123",
+		OriginalURL: "https://www.google.com",
+	})
+	require.NoError(t, err)
+
 	r := chi.NewRouter()
-	r.Get("/{shortURL}", handlers.HandleGet)
+	r.Get("/{shortURL}", h.HandleGet)
 	ts := httptest.NewServer(r)
 	defer ts.Close()
 
-	storage.Mu.Lock()
-	storage.URLStore["abc123"] = "https://www.google.com"
-	storage.Mu.Unlock()
-
 	type want struct {
 		code     int
 		location string
@@ -133,7 +150,7 @@ func Test_handleGet(t *testing.T) {
 		{
 			name:         "Test valid short URL",
 			inputShortID: "abc123",
-			want:         want{code: http.StatusOK, location: "https://www.google.com"},
+			want:         want{code: http.StatusTemporaryRedirect, location: "https://www.google.com"},
 		},
 		{
 			name:         "Test invalid short URL",
@@ -193,10 +210,10 @@ func Test_handleJSONPost(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 
-			initFile(t)
+			h := initFile(t)
 
 			r := chi.NewRouter()
-			r.Post("/api/shorten", handlers.HandleJSONPost)
+			r.Post("/api/shorten", h.HandleJSONPost)
 
 			ts := httptest.NewServer(r)
 			defer ts.Close()
@@ -207,7 +224,7 @@ func Test_handleJSONPost(t *testing.T) {
 
 			rr := httptest.NewRecorder()
 
-			handler := http.HandlerFunc(handlers.HandleJSONPost)
+			handler := http.HandlerFunc(h.HandleJSONPost)
 			handler.ServeHTTP(rr, req)
 
 			assert.Equal(t, test.want.code, rr.Code)
@@ -224,3 +241,1168 @@ func Test_handleJSONPost(t *testing.T) {
 		})
 	}
 }
+
+func Test_handlePostDedupModes(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        storage.DedupMode
+		sameUser    bool
+		wantCode    int
+		wantSameURL bool
+	}{
+		{name: "global, same user", mode: storage.DedupGlobal, sameUser: true, wantCode: http.StatusConflict, wantSameURL: true},
+		{name: "global, other user", mode: storage.DedupGlobal, sameUser: false, wantCode: http.StatusConflict, wantSameURL: true},
+		{name: "per user, same user", mode: storage.DedupPerUser, sameUser: true, wantCode: http.StatusConflict, wantSameURL: true},
+		{name: "per user, other user", mode: storage.DedupPerUser, sameUser: false, wantCode: http.StatusCreated},
+		{name: "none, same user", mode: storage.DedupNone, sameUser: true, wantCode: http.StatusCreated},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := handlers.NewHandler(storage.NewMemoryStorage(storage.WithDedupMode(test.mode)))
+
+			first := httptest.NewRecorder()
+			h.HandlePost(first, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com")))
+			firstRes := first.Result()
+			defer firstRes.Body.Close()
+			require.Equal(t, http.StatusCreated, firstRes.StatusCode)
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com"))
+			if test.sameUser {
+				for _, cookie := range firstRes.Cookies() {
+					req.AddCookie(cookie)
+				}
+			}
+			second := httptest.NewRecorder()
+			h.HandlePost(second, req)
+
+			assert.Equal(t, test.wantCode, second.Code)
+			if test.wantSameURL {
+				assert.Equal(t, first.Body.String(), second.Body.String())
+			} else {
+				assert.NotEqual(t, first.Body.String(), second.Body.String())
+			}
+		})
+	}
+}
+
+func Test_handleJSONPostAlias(t *testing.T) {
+	h := handlers.NewHandler(storage.NewMemoryStorage(storage.WithDedupMode(storage.DedupGlobal)))
+
+	tests := []struct {
+		name     string
+		reqBody  models.Request
+		wantCode int
+	}{
+		{name: "valid alias", reqBody: models.Request{URL: "https://example.com/1", Alias: "promo-2024"}, wantCode: http.StatusCreated},
+		{name: "alias taken", reqBody: models.Request{URL: "https://example.com/2", Alias: "promo-2024"}, wantCode: http.StatusConflict},
+		{name: "alias for shortened URL", reqBody: models.Request{URL: "https://example.com/1", Alias: "spring"}, wantCode: http.StatusCreated},
+		{name: "reserved alias", reqBody: models.Request{URL: "https://example.com/3", Alias: "API"}, wantCode: http.StatusBadRequest},
+		{name: "invalid characters", reqBody: models.Request{URL: "https://example.com/4", Alias: "promo/2024"}, wantCode: http.StatusBadRequest},
+		{name: "too short", reqBody: models.Request{URL: "https://example.com/5", Alias: "ab"}, wantCode: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reqBodyJSON, _ := json.Marshal(test.reqBody)
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBuffer(reqBodyJSON))
+			rr := httptest.NewRecorder()
+
+			h.HandleJSONPost(rr, req)
+
+			assert.Equal(t, test.wantCode, rr.Code)
+			if test.wantCode == http.StatusCreated {
+				var resp models.Response
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+				assert.True(t, strings.HasSuffix(resp.Result, "/"+test.reqBody.Alias))
+			}
+		})
+	}
+}
+
+// stubGenerator выдаёт идентификаторы из заранее заданного списка.
+type stubGenerator struct {
+	ids []string
+}
+
+func (g *stubGenerator) Generate(_ string, attempt int) (string, error) {
+	return g.ids[attempt%len(g.ids)], nil
+}
+
+func Test_handlePostCollisionRetry(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	_, err := store.SaveURL(context.Background(), &models.URLData{ShortURL: "taken", OriginalURL: "https://example.com/taken"})
+	require.NoError(t, err)
+
+	h := handlers.NewHandler(store)
+
+	t.Run("retries on collision", func(t *testing.T) {
+		h.Generator = &stubGenerator{ids: []string{"taken", "free"}}
+		w := httptest.NewRecorder()
+		h.HandlePost(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/1")))
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.True(t, strings.HasSuffix(w.Body.String(), "/free"))
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		h.Generator = &stubGenerator{ids: []string{"taken"}}
+		w := httptest.NewRecorder()
+		h.HandlePost(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/2")))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func Test_sequentialSeed(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	seed, err := sequentialSeed(ctx, store, 4)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), seed)
+
+	// Счётчик продолжается с наибольшего идентификатора из символов base62,
+	// в том числе удлинившегося, а не с количества ссылок.
+	for _, id := range []string{"0010", "00zz", "zz-z", "go-promo", "10000"} {
+		_, err = store.SaveURL(ctx, &models.URLData{ShortURL: id, OriginalURL: "https://example.com/" + id})
+		require.NoError(t, err)
+	}
+	// Псевдонимы из символов base62 счётчик не сдвигают.
+	for _, id := range []string{"zzzz", "zzzzzz"} {
+		_, err = store.SaveURL(ctx, &models.URLData{ShortURL: id, OriginalURL: "https://example.com/" + id, Alias: true})
+		require.NoError(t, err)
+	}
+	seed, err = sequentialSeed(ctx, store, 4)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(62*62*62*62), seed)
+}
+
+func Test_handleJSONPostExpiry(t *testing.T) {
+	h := handlers.NewHandler(storage.NewMemoryStorage())
+	past := time.Now().Add(-time.Hour)
+	farFuture := time.Now().AddDate(200, 0, 0)
+
+	tests := []struct {
+		name     string
+		reqBody  models.Request
+		wantCode int
+	}{
+		{name: "ttl", reqBody: models.Request{URL: "https://example.com/ttl", TTL: 60}, wantCode: http.StatusCreated},
+		{name: "negative ttl", reqBody: models.Request{URL: "https://example.com/negative", TTL: -1}, wantCode: http.StatusBadRequest},
+		{name: "ttl overflows duration", reqBody: models.Request{URL: "https://example.com/overflow", TTL: 10_000_000_000}, wantCode: http.StatusBadRequest},
+		{name: "expires too far", reqBody: models.Request{URL: "https://example.com/far", ExpiresAt: &farFuture}, wantCode: http.StatusBadRequest},
+		{name: "expires in past", reqBody: models.Request{URL: "https://example.com/past", ExpiresAt: &past}, wantCode: http.StatusBadRequest},
+		{name: "both set", reqBody: models.Request{URL: "https://example.com/both", TTL: 60, ExpiresAt: &past}, wantCode: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reqBodyJSON, _ := json.Marshal(test.reqBody)
+			rr := httptest.NewRecorder()
+			h.HandleJSONPost(rr, httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBuffer(reqBodyJSON)))
+
+			assert.Equal(t, test.wantCode, rr.Code)
+		})
+	}
+}
+
+func Test_handleGetExpired(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	past := time.Now().Add(-time.Minute)
+	_, err := store.SaveURL(context.Background(), &models.URLData{
+		ShortURL:    "expired",
+		OriginalURL: "https://example.com/expired",
+		ExpiresAt:   &past,
+	})
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Get("/{shortURL}", handlers.NewHandler(store).HandleGet)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	resp, _ := testRequest(t, ts, http.MethodGet, "/expired")
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+}
+
+func Test_handleGetURLStats(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	h := handlers.NewHandler(store)
+	h.Clicks = analytics.NewRecorder(store, 10, 10, time.Hour)
+
+	token, err := auth.GenerateToken()
+	require.NoError(t, err)
+	userID := auth.GetUserID(token)
+
+	for _, data := range []*models.URLData{
+		{ShortURL: "mine", OriginalURL: "https://example.com/mine", UserUUID: userID},
+		{ShortURL: "theirs", OriginalURL: "https://example.com/theirs", UserUUID: "other"},
+	} {
+		_, err = store.SaveURL(context.Background(), data)
+		require.NoError(t, err)
+	}
+
+	r := chi.NewRouter()
+	r.Get("/{shortURL}", h.HandleGet)
+	r.Get("/api/user/urls/{id}/stats", h.HandleGetURLStats)
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, _ := testRequest(t, ts, http.MethodGet, "/mine")
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	}
+	// Закрытие дожидается записи накопленных событий.
+	h.Clicks.Close()
+
+	statsRequest := func(id string) *httptest.ResponseRecorder {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+id+"/stats", nil)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		w := httptest.NewRecorder()
+		h.HandleGetURLStats(w, req)
+		return w
+	}
+
+	w := statsRequest("mine")
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats models.ClickStats
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, 2, stats.Total)
+	require.Len(t, stats.Days, 1)
+	assert.Equal(t, 2, stats.Days[0].Clicks)
+
+	assert.Equal(t, http.StatusNotFound, statsRequest("theirs").Code)
+	assert.Equal(t, http.StatusNotFound, statsRequest("missing").Code)
+}
+
+func Test_handleUpdateURL(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	h := handlers.NewHandler(store)
+
+	token, err := auth.GenerateToken()
+	require.NoError(t, err)
+	userID := auth.GetUserID(token)
+
+	for _, data := range []*models.URLData{
+		{ShortURL: "mine", OriginalURL: "https://example.com/old", UserUUID: userID},
+		{ShortURL: "theirs", OriginalURL: "https://example.com/theirs", UserUUID: "other"},
+	} {
+		_, err = store.SaveURL(context.Background(), data)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name     string
+		id       string
+		body     string
+		cookie   bool
+		wantCode int
+	}{
+		{name: "updated", id: "mine", body: `{"url":"https://example.com/new"}`, cookie: true, wantCode: http.StatusOK},
+		{name: "empty url", id: "mine", body: `{"url":""}`, cookie: true, wantCode: http.StatusBadRequest},
+		{name: "invalid json", id: "mine", body: `{`, cookie: true, wantCode: http.StatusBadRequest},
+		{name: "foreign link", id: "theirs", body: `{"url":"https://example.com/new"}`, cookie: true, wantCode: http.StatusNotFound},
+		{name: "unauthorized", id: "mine", body: `{"url":"https://example.com/new"}`, wantCode: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", test.id)
+			req := httptest.NewRequest(http.MethodPatch, "/api/user/urls/"+test.id, strings.NewReader(test.body))
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			if test.cookie {
+				req.AddCookie(&http.Cookie{Name: "token", Value: token})
+			}
+			w := httptest.NewRecorder()
+			h.HandleUpdateURL(w, req)
+
+			assert.Equal(t, test.wantCode, w.Code)
+			if test.wantCode == http.StatusOK {
+				var resp models.UpdateURLResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, "https://example.com/new", resp.OriginalURL)
+				require.Len(t, resp.History, 1)
+				assert.Equal(t, "https://example.com/old", resp.History[0].OriginalURL)
+			}
+		})
+	}
+
+	data, err := store.GetOriginalURL(context.Background(), "mine")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/new", data.OriginalURL)
+}
+
+func Test_handleRestoreURLs(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	h := handlers.NewHandler(store)
+
+	token, err := auth.GenerateToken()
+	require.NoError(t, err)
+	userID := auth.GetUserID(token)
+
+	_, err = store.SaveURL(context.Background(), &models.URLData{ShortURL: "deleted", OriginalURL: "https://example.com/deleted", UserUUID: userID})
+	require.NoError(t, err)
+	_, err = store.BatchDeleteURLs(context.Background(), userID, []string{"deleted"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		body         string
+		wantCode     int
+		wantRestored int
+	}{
+		{name: "restored", body: `["deleted","missing"]`, wantCode: http.StatusOK, wantRestored: 1},
+		{name: "already active", body: `["deleted"]`, wantCode: http.StatusOK, wantRestored: 0},
+		{name: "empty batch", body: `[]`, wantCode: http.StatusBadRequest},
+		{name: "invalid json", body: `{`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/user/urls/restore", strings.NewReader(test.body))
+			req.AddCookie(&http.Cookie{Name: "token", Value: token})
+			w := httptest.NewRecorder()
+			h.HandleRestoreURLs(w, req)
+
+			require.Equal(t, test.wantCode, w.Code)
+			if test.wantCode == http.StatusOK {
+				var resp models.RestoreResponse
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+				assert.Equal(t, test.wantRestored, resp.Restored)
+			}
+		})
+	}
+
+	data, err := store.GetOriginalURL(context.Background(), "deleted")
+	require.NoError(t, err)
+	assert.False(t, data.DeletedFlag)
+}
+
+func Test_handleDeleteURLsJob(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	h := handlers.NewHandler(store)
+
+	token, err := auth.GenerateToken()
+	require.NoError(t, err)
+	userID := auth.GetUserID(token)
+
+	_, err = store.SaveURL(context.Background(), &models.URLData{ShortURL: "mine", OriginalURL: "https://example.com/mine", UserUUID: userID})
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["mine"]`))
+	req.AddCookie(&http.Cookie{Name: "token", Value: token})
+	w := httptest.NewRecorder()
+	h.HandleDeleteURLs(w, req)
+
+	require.Equal(t, http.StatusAccepted, w.Code)
+	var job models.Job
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, "/api/jobs/"+job.ID, w.Header().Get("Location"))
+
+	// Остановка очереди дожидается выполнения задачи.
+	require.NoError(t, h.Jobs.Shutdown(context.Background()))
+
+	jobRequest := func(cookie string) *httptest.ResponseRecorder {
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", job.ID)
+		req := httptest.NewRequest(http.MethodGet, "/api/jobs/"+job.ID, nil)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		req.AddCookie(&http.Cookie{Name: "token", Value: cookie})
+		w := httptest.NewRecorder()
+		h.HandleGetJob(w, req)
+		return w
+	}
+
+	w = jobRequest(token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	assert.Equal(t, models.JobDone, job.Status)
+	assert.Equal(t, 1, job.Processed)
+
+	otherToken, err := auth.GenerateToken()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, jobRequest(otherToken).Code)
+
+	data, err := store.GetOriginalURL(context.Background(), "mine")
+	require.NoError(t, err)
+	assert.True(t, data.DeletedFlag)
+
+	// Остановленная очередь не принимает новые задачи.
+	req = httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(`["mine"]`))
+	req.AddCookie(&http.Cookie{Name: "token", Value: token})
+	w = httptest.NewRecorder()
+	h.HandleDeleteURLs(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func Test_handleBatchPost(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	h := handlers.NewHandler(store)
+
+	token, err := auth.GenerateToken()
+	require.NoError(t, err)
+
+	post := func(t *testing.T, query string, batch []models.BatchRequest) (int, []models.BatchResponse) {
+		t.Helper()
+		body, _ := json.Marshal(batch)
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch"+query, bytes.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		w := httptest.NewRecorder()
+		h.HandleBatchPost(w, req)
+
+		var res []models.BatchResponse
+		if w.Code != http.StatusBadRequest {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		}
+		return w.Code, res
+	}
+
+	t.Run("statuses in request order", func(t *testing.T) {
+		var batch []models.BatchRequest
+		for i := 0; i < 20; i++ {
+			batch = append(batch, models.BatchRequest{CorrelationID: strconv.Itoa(i), OriginalURL: "https://example.com/" + strconv.Itoa(i)})
+		}
+		batch = append(batch,
+			models.BatchRequest{CorrelationID: "dup", OriginalURL: "https://example.com/0"},
+			models.BatchRequest{CorrelationID: "bad", OriginalURL: "not a url"},
+		)
+
+		code, res := post(t, "", batch)
+		require.Equal(t, http.StatusCreated, code)
+		require.Len(t, res, len(batch))
+		for i, item := range res {
+			assert.Equal(t, batch[i].CorrelationID, item.CorrelationID)
+		}
+		assert.Equal(t, models.BatchCreated, res[0].Status)
+		assert.Equal(t, models.BatchExisting, res[20].Status)
+		assert.Equal(t, res[0].ShortURL, res[20].ShortURL)
+		assert.Equal(t, models.BatchInvalid, res[21].Status)
+		assert.Empty(t, res[21].ShortURL)
+	})
+
+	t.Run("atomic rejects invalid batch", func(t *testing.T) {
+		code, res := post(t, "?atomic=true", []models.BatchRequest{
+			{CorrelationID: "ok", OriginalURL: "https://example.com/atomic"},
+			{CorrelationID: "bad", OriginalURL: ""},
+		})
+		require.Equal(t, http.StatusUnprocessableEntity, code)
+		require.Len(t, res, 2)
+		assert.Equal(t, models.BatchSkipped, res[0].Status)
+		assert.Equal(t, models.BatchInvalid, res[1].Status)
+
+		urls, err := store.GetURLsByUser(context.Background(), auth.GetUserID(token))
+		require.NoError(t, err)
+		for _, u := range urls {
+			assert.NotEqual(t, "https://example.com/atomic", u.OriginalURL)
+		}
+	})
+
+	t.Run("invalid atomic parameter", func(t *testing.T) {
+		code, _ := post(t, "?atomic=maybe", []models.BatchRequest{{OriginalURL: "https://example.com/x"}})
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
+
+func Test_handleStreamPost(t *testing.T) {
+	h := handlers.NewHandler(storage.NewMemoryStorage())
+
+	token, err := auth.GenerateToken()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantCode    int
+		wantStatus  []models.BatchStatus
+	}{
+		{
+			name:        "ndjson",
+			contentType: "application/x-ndjson",
+			body: `{"correlation_id":"1","original_url":"https://example.com/stream/1"}
+{"correlation_id":"2","original_url":"https://example.com/stream/2"}
+
+not json
+{"correlation_id":"3","original_url":"https://example.com/stream/1"}
+{"correlation_id":"4","original_url":""}`,
+			wantCode:   http.StatusOK,
+			wantStatus: []models.BatchStatus{models.BatchCreated, models.BatchCreated, models.BatchInvalid, models.BatchExisting, models.BatchInvalid},
+		},
+		{
+			name:        "csv",
+			contentType: "text/csv",
+			body: `original_url,correlation_id,ttl
+https://example.com/stream/csv,a,60
+https://example.com/stream/2,b,
+https://example.com/stream/3,c,soon
+`,
+			wantCode:   http.StatusOK,
+			wantStatus: []models.BatchStatus{models.BatchCreated, models.BatchExisting, models.BatchInvalid},
+		},
+		{
+			name:        "ndjson with too long line",
+			contentType: "application/x-ndjson",
+			body: `{"correlation_id":"1","original_url":"https://example.com/stream/long/1"}
+{"correlation_id":"2","original_url":"https://example.com/` + strings.Repeat("x", 100*1024) + `"}
+{"correlation_id":"3","original_url":"https://example.com/stream/long/3"}`,
+			wantCode:   http.StatusOK,
+			wantStatus: []models.BatchStatus{models.BatchCreated, models.BatchInvalid, models.BatchCreated},
+		},
+		{name: "csv without url column", contentType: "text/csv", body: "correlation_id\n1\n", wantCode: http.StatusBadRequest},
+		{name: "unsupported type", contentType: "application/xml", body: "<urls/>", wantCode: http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten/stream", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+			req.AddCookie(&http.Cookie{Name: "token", Value: token})
+			w := httptest.NewRecorder()
+			h.HandleStreamPost(w, req)
+
+			require.Equal(t, test.wantCode, w.Code)
+			if test.wantCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+			var statuses []models.BatchStatus
+			dec := json.NewDecoder(w.Body)
+			for dec.More() {
+				var item models.BatchResponse
+				require.NoError(t, dec.Decode(&item))
+				statuses = append(statuses, item.Status)
+			}
+			assert.Equal(t, test.wantStatus, statuses)
+		})
+	}
+}
+
+func Test_handleExportUserURLs(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	h := handlers.NewHandler(store)
+
+	token, err := auth.GenerateToken()
+	require.NoError(t, err)
+	userID := auth.GetUserID(token)
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"first", "second"} {
+		_, err = store.SaveURL(context.Background(), &models.URLData{
+			ShortURL:    id,
+			OriginalURL: "https://example.com/" + id,
+			UserUUID:    userID,
+			CreatedAt:   created.Add(time.Duration(i) * time.Minute),
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, store.SaveClicks(context.Background(), []models.Click{{ShortURL: "first", Timestamp: created}}))
+	_, err = store.BatchDeleteURLs(context.Background(), userID, []string{"second"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		format          string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "csv",
+			format:          "csv",
+			wantCode:        http.StatusOK,
+			wantContentType: "text/csv; charset=utf-8",
+			wantBody: "short_url,original_url,created_at,is_deleted,clicks\n" +
+				"/first,https://example.com/first,2024-05-01T12:00:00Z,false,1\n" +
+				"/second,https://example.com/second,2024-05-01T12:01:00Z,true,0\n",
+		},
+		{
+			name:            "ndjson",
+			format:          "ndjson",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/x-ndjson",
+			wantBody: `{"short_url":"/first","original_url":"https://example.com/first","created_at":"2024-05-01T12:00:00Z","is_deleted":false,"clicks":1}` + "\n" +
+				`{"short_url":"/second","original_url":"https://example.com/second","created_at":"2024-05-01T12:01:00Z","is_deleted":true,"clicks":0}` + "\n",
+		},
+		{
+			name:            "json",
+			format:          "",
+			wantCode:        http.StatusOK,
+			wantContentType: "application/json",
+			wantBody: "[\n" +
+				`{"short_url":"/first","original_url":"https://example.com/first","created_at":"2024-05-01T12:00:00Z","is_deleted":false,"clicks":1},` + "\n" +
+				`{"short_url":"/second","original_url":"https://example.com/second","created_at":"2024-05-01T12:01:00Z","is_deleted":true,"clicks":0}` + "\n]\n",
+		},
+		{name: "unsupported format", format: "xml", wantCode: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls/export?format="+test.format, nil)
+			req.AddCookie(&http.Cookie{Name: "token", Value: token})
+			w := httptest.NewRecorder()
+			h.HandleExportUserURLs(w, req)
+
+			require.Equal(t, test.wantCode, w.Code)
+			if test.wantCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, test.wantContentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, test.wantBody, w.Body.String())
+		})
+	}
+
+	t.Run("json is valid", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls/export?format=json", nil)
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		w := httptest.NewRecorder()
+		h.HandleExportUserURLs(w, req)
+
+		var rows []models.ExportedURL
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rows))
+		assert.Len(t, rows, 2)
+	})
+}
+
+func Test_handleGetUserURLsPagination(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	h := handlers.NewHandler(store)
+
+	token, err := auth.GenerateToken()
+	require.NoError(t, err)
+	userID := auth.GetUserID(token)
+
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, id := range []string{"a", "b", "c"} {
+		_, err = store.SaveURL(context.Background(), &models.URLData{
+			ShortURL:    id,
+			OriginalURL: "https://example.com/" + id,
+			UserUUID:    userID,
+			CreatedAt:   created.Add(time.Duration(i) * time.Minute),
+		})
+		require.NoError(t, err)
+	}
+	_, err = store.BatchDeleteURLs(context.Background(), userID, []string{"b"})
+	require.NoError(t, err)
+
+	get := func(t *testing.T, query string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "token", Value: token})
+		w := httptest.NewRecorder()
+		h.HandleGetUserURLs(w, req)
+		return w
+	}
+	shortIDs := func(t *testing.T, w *httptest.ResponseRecorder) []string {
+		t.Helper()
+		var urls []models.UserURL
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &urls))
+		var ids []string
+		for _, u := range urls {
+			ids = append(ids, strings.TrimPrefix(u.ShortURL, "/"))
+		}
+		return ids
+	}
+
+	t.Run("pages follow cursor", func(t *testing.T) {
+		w := get(t, "?page_size=2")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"c", "b"}, shortIDs(t, w))
+		assert.Equal(t, "3", w.Header().Get("X-Total-Count"))
+		next := w.Header().Get("X-Next-Cursor")
+		require.NotEmpty(t, next)
+		assert.Contains(t, w.Header().Get("Link"), `rel="next"`)
+
+		w = get(t, "?page_size=2&cursor="+next)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"a"}, shortIDs(t, w))
+		assert.Empty(t, w.Header().Get("X-Next-Cursor"))
+	})
+
+	t.Run("filters and order", func(t *testing.T) {
+		w := get(t, "?status=active&order=asc")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"a", "c"}, shortIDs(t, w))
+
+		w = get(t, "?search=EXAMPLE.COM/B")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{"b"}, shortIDs(t, w))
+
+		w = get(t, "?search=missing")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		w := get(t, "?page_size=2")
+		next := w.Header().Get("X-Next-Cursor")
+
+		for _, query := range []string{
+			"?page_size=abc",
+			"?page_size=100000",
+			"?sort=name",
+			"?order=up",
+			"?status=gone",
+			"?cursor=not-a-cursor",
+			"?page_size=2&sort=clicks&cursor=" + next,
+		} {
+			assert.Equal(t, http.StatusBadRequest, get(t, query).Code, query)
+		}
+	})
+}
+
+func Test_handleRefresh(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	h := handlers.NewHandler(store)
+
+	cookieOf := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == name {
+				return c
+			}
+		}
+		return nil
+	}
+	var posted int
+	post := func(cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		posted++
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/"+strconv.Itoa(posted)))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		h.HandlePost(w, req)
+		return w
+	}
+	refresh := func(c *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+		if c != nil {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		h.HandleRefresh(w, req)
+		return w
+	}
+
+	// Новая сессия выдаёт токен доступа и токен обновления.
+	w := post()
+	require.Equal(t, http.StatusCreated, w.Code)
+	access, refreshToken := cookieOf(w, "token"), cookieOf(w, auth.RefreshCookieName)
+	require.NotNil(t, access)
+	require.NotNil(t, refreshToken)
+	userID := auth.GetUserID(access.Value)
+	require.NotEmpty(t, userID)
+
+	// Обмен токена обновления сохраняет пользователя.
+	w = refresh(refreshToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	var res models.RefreshResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, userID, auth.GetUserID(res.Token))
+	assert.Equal(t, res.Token, cookieOf(w, "token").Value)
+	rotated := cookieOf(w, auth.RefreshCookieName)
+	require.NotNil(t, rotated)
+	assert.NotEqual(t, refreshToken.Value, rotated.Value)
+
+	// Только что обменянный токен обновления обменивается ещё один раз,
+	// после чего отклоняется.
+	w = refresh(refreshToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, userID, auth.GetUserID(cookieOf(w, "token").Value))
+	assert.Equal(t, http.StatusUnauthorized, refresh(refreshToken).Code)
+	assert.Equal(t, http.StatusUnauthorized, refresh(nil).Code)
+
+	// Отклонённый токен обновления не начинает новую анонимную сессию.
+	w = post(refreshToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Nil(t, cookieOf(w, "token"))
+
+	// Без токена доступа сессия продолжается по токену обновления.
+	w = post(rotated)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, userID, auth.GetUserID(cookieOf(w, "token").Value))
+	urls, err := store.GetURLsByUser(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Len(t, urls, 2)
+
+	// Токен доступа, срок действия которого подходит к концу, продлевается.
+	expiring, err := auth.CurrentKeyring().Sign(auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+		UserID:           userID,
+	})
+	require.NoError(t, err)
+	w = post(&http.Cookie{Name: "token", Value: expiring})
+	require.Equal(t, http.StatusCreated, w.Code)
+	renewed := cookieOf(w, "token")
+	require.NotNil(t, renewed)
+	assert.Equal(t, userID, auth.GetUserID(renewed.Value))
+	assert.Nil(t, cookieOf(w, auth.RefreshCookieName))
+
+	// Недействительный токен доступа без токена обновления отклоняется.
+	assert.Equal(t, http.StatusUnauthorized, post(&http.Cookie{Name: "token", Value: "invalid"}).Code)
+
+	// Чтение ссылок без токена доступа тоже продолжает сессию по токену обновления.
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	req.AddCookie(rotated)
+	w = httptest.NewRecorder()
+	h.HandleGetUserURLs(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, userID, auth.GetUserID(cookieOf(w, "token").Value))
+	assert.NotNil(t, cookieOf(w, auth.RefreshCookieName))
+}
+
+func Test_handleRefreshConcurrent(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	h := handlers.NewHandler(store)
+
+	cookieOf := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == name {
+				return c
+			}
+		}
+		return nil
+	}
+	post := func(n int, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/"+strconv.Itoa(n)))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		h.HandlePost(w, req)
+		return w
+	}
+
+	w := post(0)
+	require.Equal(t, http.StatusCreated, w.Code)
+	userID := auth.GetUserID(cookieOf(w, "token").Value)
+	refreshToken := cookieOf(w, auth.RefreshCookieName)
+	require.NotNil(t, refreshToken)
+
+	// Два одновременных запроса без токена доступа предъявляют один и тот же
+	// токен обновления, и оба продолжают сессию пользователя.
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 2)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = post(i+1, refreshToken)
+		}()
+	}
+	wg.Wait()
+
+	for _, w := range results {
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, userID, auth.GetUserID(cookieOf(w, "token").Value))
+	}
+	urls, err := store.GetURLsByUser(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Len(t, urls, 3)
+}
+
+func Test_handleRegisterLogin(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	h := handlers.NewHandler(store)
+
+	cookieOf := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == name {
+				return c
+			}
+		}
+		return nil
+	}
+	var posted int
+	post := func(cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		posted++
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/"+strconv.Itoa(posted)))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		h.HandlePost(w, req)
+		return w
+	}
+	authRequest := func(handler http.HandlerFunc, body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+	userURLs := func(userID string) int {
+		urls, err := store.GetURLsByUser(context.Background(), userID)
+		require.NoError(t, err)
+		return len(urls)
+	}
+
+	// Регистрация сохраняет ссылки анонимного пользователя.
+	w := post()
+	require.Equal(t, http.StatusCreated, w.Code)
+	anon := cookieOf(w, "token")
+	anonID := auth.GetUserID(anon.Value)
+
+	w = authRequest(h.HandleRegister, `{"login":" Alice ","password":"correct horse"}`, anon)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var res models.AuthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, anonID, res.UserID)
+	assert.Equal(t, anonID, auth.GetUserID(cookieOf(w, "token").Value))
+	assert.NotNil(t, cookieOf(w, auth.RefreshCookieName))
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{name: "login taken", body: `{"login":"alice","password":"another password"}`, code: http.StatusConflict},
+		{name: "short password", body: `{"login":"bob","password":"short"}`, code: http.StatusBadRequest},
+		{name: "invalid login", body: `{"login":"bob smith","password":"correct horse"}`, code: http.StatusBadRequest},
+		{name: "invalid JSON", body: `{`, code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.code, authRequest(h.HandleRegister, tt.body).Code)
+		})
+	}
+
+	// Вход с неверным паролем или логином отклоняется.
+	assert.Equal(t, http.StatusUnauthorized, authRequest(h.HandleLogin, `{"login":"alice","password":"wrong password"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, authRequest(h.HandleLogin, `{"login":"nobody","password":"correct horse"}`).Code)
+
+	// При входе с claim ссылки другого анонимного пользователя переходят в учётную запись.
+	w = post()
+	require.Equal(t, http.StatusCreated, w.Code)
+	other := cookieOf(w, "token")
+	otherID := auth.GetUserID(other.Value)
+	require.NotEqual(t, anonID, otherID)
+
+	w = authRequest(h.HandleLogin, `{"login":"alice","password":"correct horse"}`, other)
+	require.Equal(t, http.StatusOK, w.Code)
+	res = models.AuthResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, anonID, res.UserID)
+	assert.Zero(t, res.Claimed)
+	assert.Equal(t, 1, userURLs(otherID))
+
+	w = authRequest(h.HandleLogin, `{"login":"alice","password":"correct horse","claim":true}`, other)
+	require.Equal(t, http.StatusOK, w.Code)
+	res = models.AuthResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, 1, res.Claimed)
+	assert.Equal(t, 0, userURLs(otherID))
+	assert.Equal(t, 2, userURLs(anonID))
+
+	// Анонимный пользователь с истёкшим токеном доступа определяется
+	// по токену обновления.
+	w = post()
+	require.Equal(t, http.StatusCreated, w.Code)
+	refreshOnly := cookieOf(w, auth.RefreshCookieName)
+	refreshID := auth.GetUserID(cookieOf(w, "token").Value)
+
+	w = authRequest(h.HandleRegister, `{"login":"carol","password":"correct horse"}`, refreshOnly)
+	require.Equal(t, http.StatusCreated, w.Code)
+	res = models.AuthResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, refreshID, res.UserID)
+	assert.Equal(t, 1, userURLs(refreshID))
+}
+
+func Test_handleRegisterConcurrent(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	h := handlers.NewHandler(store)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("https://example.com/"))
+	w := httptest.NewRecorder()
+	h.HandlePost(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var anon *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "token" {
+			anon = c
+		}
+	}
+	require.NotNil(t, anon)
+
+	// Одновременные регистрации одного анонимного пользователя с разными
+	// логинами: учётная запись создаётся одна, второй запрос получает 409.
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := `{"login":"user` + strconv.Itoa(i) + `","password":"correct horse"}`
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/register", strings.NewReader(body))
+			req.AddCookie(anon)
+			w := httptest.NewRecorder()
+			h.HandleRegister(w, req)
+			codes[i] = w.Code
+		}()
+	}
+	wg.Wait()
+
+	assert.ElementsMatch(t, []int{http.StatusCreated, http.StatusConflict}, codes)
+}
+
+func Test_handleAPIKeys(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	h := handlers.NewHandler(store)
+
+	r := chi.NewRouter()
+	r.Post("/", h.HandlePost)
+	r.Get("/api/user/urls", h.HandleGetUserURLs)
+	r.Post("/api/user/keys", h.HandleCreateAPIKey)
+	r.Get("/api/user/keys", h.HandleListAPIKeys)
+	r.Delete("/api/user/keys/{id}", h.HandleDeleteAPIKey)
+
+	token, err := auth.GenerateToken()
+	require.NoError(t, err)
+	userID := auth.GetUserID(token)
+
+	do := func(method, target, body string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	session := http.Header{"Cookie": {"token=" + token}}
+	createKey := func(body string) models.APIKeyResponse {
+		w := do(http.MethodPost, "/api/user/keys", body, session)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var res models.APIKeyResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		require.NotEmpty(t, res.Key)
+		return res
+	}
+
+	full := createKey(`{"name":"backend"}`)
+	assert.Equal(t, models.Scopes, full.Scopes)
+	readOnly := createKey(`{"name":"reports","scopes":["read"],"ttl":3600}`)
+	require.NotNil(t, readOnly.ExpiresAt)
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for _, body := range []string{`{"name":""}`, `{"name":"x","scopes":["admin"]}`, `{"name":"x","ttl":-1}`, `{`} {
+			assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/user/keys", body, session).Code, body)
+		}
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/user/keys", `{"name":"x"}`, nil).Code)
+		// Ключ API не может создавать другие ключи.
+		assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/user/keys", `{"name":"x"}`, http.Header{"X-Api-Key": {full.Key}}).Code)
+	})
+
+	// Ключ API действует от имени владельца, cookies сессии не выдаются.
+	w := do(http.MethodPost, "/", "https://example.com/api-key", http.Header{"X-Api-Key": {full.Key}})
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Result().Cookies())
+	urls, err := store.GetURLsByUser(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Len(t, urls, 1)
+
+	bearer := http.Header{"Authorization": {"Bearer " + readOnly.Key}}
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/user/urls", "", bearer).Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/", "https://example.com/read-only", bearer).Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/user/urls", "", http.Header{"X-Api-Key": {full.Key + "x"}}).Code)
+
+	// Список не содержит самих ключей.
+	w = do(http.MethodGet, "/api/user/keys", "", session)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), full.Key)
+	var keys []models.APIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	require.Len(t, keys, 2)
+	assert.Equal(t, full.ID, keys[0].ID)
+
+	// Отозванный ключ сразу перестаёт действовать.
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/api/user/keys/"+readOnly.ID, "", session).Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/user/keys/"+readOnly.ID, "", session).Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/api/user/urls", "", bearer).Code)
+}
+
+func Test_handleLogout(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	h := handlers.NewHandler(store)
+	auth.SetRevocations(auth.NewRevocations(store))
+	t.Cleanup(func() { auth.SetRevocations(nil) })
+
+	r := chi.NewRouter()
+	r.Post("/", h.HandlePost)
+	r.Post("/api/auth/refresh", h.HandleRefresh)
+	r.Post("/api/auth/logout", h.HandleLogout)
+	r.Post("/api/internal/users/{id}/revoke-tokens", h.HandleRevokeUserTokens)
+
+	cookieOf := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == name {
+				return c
+			}
+		}
+		return nil
+	}
+	do := func(target, body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	var posted int
+	newSession := func() (*http.Cookie, *http.Cookie) {
+		posted++
+		w := do("/", "https://example.com/"+strconv.Itoa(posted))
+		require.Equal(t, http.StatusCreated, w.Code)
+		access, refreshToken := cookieOf(w, "token"), cookieOf(w, auth.RefreshCookieName)
+		require.NotNil(t, access)
+		require.NotNil(t, refreshToken)
+		return access, refreshToken
+	}
+
+	// Выход отзывает оба токена и удаляет cookies.
+	access, refreshToken := newSession()
+	w := do("/api/auth/logout", "", access, refreshToken)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	for _, name := range []string{"token", auth.RefreshCookieName} {
+		c := cookieOf(w, name)
+		require.NotNil(t, c, name)
+		assert.Negative(t, c.MaxAge, name)
+	}
+	assert.Empty(t, auth.GetUserID(access.Value))
+	assert.Equal(t, http.StatusUnauthorized, do("/", "https://example.com/", access).Code)
+	assert.Equal(t, http.StatusUnauthorized, do("/api/auth/refresh", "", refreshToken).Code)
+
+	// Выход без сессии и повторный выход не считаются ошибкой.
+	assert.Equal(t, http.StatusNoContent, do("/api/auth/logout", "").Code)
+	assert.Equal(t, http.StatusNoContent, do("/api/auth/logout", "", access, refreshToken).Code)
+
+	// Отзыв всех токенов пользователя удаляет и его ключи API,
+	// но не затрагивает других пользователей.
+	access, refreshToken = newSession()
+	otherAccess, _ := newSession()
+	userID, otherID := auth.GetUserID(access.Value), auth.GetUserID(otherAccess.Value)
+	require.NotEmpty(t, userID)
+	ctx := context.Background()
+	for _, owner := range []string{userID, otherID} {
+		_, _, err := h.CreateAPIKey(ctx, owner, models.APIKeyRequest{Name: "ci"})
+		require.NoError(t, err)
+	}
+	require.Equal(t, http.StatusNoContent, do("/api/internal/users/"+userID+"/revoke-tokens", "").Code)
+	assert.Empty(t, auth.GetUserID(access.Value))
+	assert.Equal(t, http.StatusUnauthorized, do("/api/auth/refresh", "", refreshToken).Code)
+	assert.NotEmpty(t, auth.GetUserID(otherAccess.Value))
+	keys, err := store.ListAPIKeys(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	keys, err = store.ListAPIKeys(ctx, otherID)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/sol1corejz/go-url-shortener/cmd/config"
+	"github.com/sol1corejz/go-url-shortener/internal/storage/migrations"
+)
+
+// runMigrate выполняет подкоманду migrate:
+//
+//	shortener [флаги] migrate up         — применить все новые миграции;
+//	shortener [флаги] migrate down [N]   — откатить N последних миграций (по умолчанию одну);
+//	shortener [флаги] migrate version    — вывести текущую версию схемы.
+func runMigrate(ctx context.Context, args []string) error {
+	if config.DatabaseDSN == "" {
+		return errors.New("database DSN is required for migrate")
+	}
+
+	db, err := sql.Open("pgx", config.DatabaseDSN)
+	if err != nil {
+		return fmt.Errorf("failed to open database connection: %w", err)
+	}
+	defer db.Close()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		if err := migrations.Up(ctx, db); err != nil {
+			return err
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		if err := migrations.Down(ctx, db, steps); err != nil {
+			return err
+		}
+	case "version":
+	default:
+		return fmt.Errorf("unknown migrate command %q", command)
+	}
+
+	version, err := migrations.Version(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Schema version: %d\n", version)
+	return nil
+}
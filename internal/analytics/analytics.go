@@ -0,0 +1,183 @@
+// Package analytics собирает события переходов по коротким ссылкам и
+// асинхронно записывает их в хранилище пакетами, не задерживая обработку
+// редиректов.
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"go.uber.org/zap"
+)
+
+// Значения параметров записи событий по умолчанию.
+const (
+	DefaultBufferSize    = 4096
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+)
+
+// flushTimeout ограничивает время записи одного пакета в хранилище.
+const flushTimeout = 5 * time.Second
+
+// Sink принимает пакеты событий переходов. Реализуется storage.Storage.
+type Sink interface {
+	SaveClicks(ctx context.Context, clicks []models.Click) error
+}
+
+// Recorder буферизует события переходов и записывает их в Sink пакетами
+// по достижении batchSize событий или по истечении flushInterval.
+// Если буфер переполнен, новые события отбрасываются.
+type Recorder struct {
+	sink          Sink
+	events        chan models.Click
+	batchSize     int
+	flushInterval time.Duration
+
+	mu      sync.RWMutex // Защищает closed от гонки с закрытием канала events.
+	closed  bool
+	done    chan struct{}
+	dropped atomic.Uint64
+}
+
+// NewRecorder создаёт Recorder и запускает фоновую запись событий.
+// Неположительные параметры заменяются значениями по умолчанию.
+func NewRecorder(sink Sink, bufferSize, batchSize int, flushInterval time.Duration) *Recorder {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlushInterval
+	}
+
+	r := &Recorder{
+		sink:          sink,
+		events:        make(chan models.Click, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		done:          make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record ставит событие в очередь на запись, не блокируя вызывающего.
+// Возвращает false, если событие отброшено из-за переполнения буфера
+// или остановки Recorder.
+func (r *Recorder) Record(click models.Click) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		return false
+	}
+	select {
+	case r.events <- click:
+		return true
+	default:
+		r.dropped.Add(1)
+		return false
+	}
+}
+
+// Dropped возвращает количество событий, отброшенных из-за переполнения буфера.
+func (r *Recorder) Dropped() uint64 {
+	return r.dropped.Load()
+}
+
+// Close прекращает приём событий и дожидается записи уже поставленных в очередь.
+func (r *Recorder) Close() {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.events)
+	}
+	r.mu.Unlock()
+
+	<-r.done
+}
+
+// run накапливает события и записывает их пакетами до закрытия очереди.
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.Click, 0, r.batchSize)
+	for {
+		select {
+		case click, ok := <-r.events:
+			if !ok {
+				r.flush(batch)
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) >= r.batchSize {
+				r.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			r.flush(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// flush записывает пакет событий в Sink. Ошибки записи логируются,
+// а события пакета теряются: аналитика не должна влиять на редиректы.
+func (r *Recorder) flush(batch []models.Click) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	if err := r.sink.SaveClicks(ctx, batch); err != nil {
+		logger.Log.Error("Failed to save clicks", zap.Int("count", len(batch)), zap.Error(err))
+	}
+}
+
+// ipHashKey — секретный ключ HMAC, которым хешируются IP-адреса клиентов.
+// Без ключа адрес восстанавливался бы перебором всех адресов IPv4.
+var ipHashKey atomic.Pointer[[]byte]
+
+func init() {
+	// Пока ключ не задан SetIPHashKey, используется случайный ключ процесса.
+	key := make([]byte, sha256.Size)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	ipHashKey.Store(&key)
+}
+
+// SetIPHashKey задаёт ключ, которым хешируются IP-адреса клиентов. Хеши
+// одного адреса совпадают только при одинаковом ключе, поэтому экземпляры
+// сервиса с общим хранилищем должны использовать один ключ.
+func SetIPHashKey(key []byte) {
+	key = append([]byte(nil), key...)
+	ipHashKey.Store(&key)
+}
+
+// HashIP возвращает HMAC-SHA256 IP-адреса клиента в шестнадцатеричном виде,
+// чтобы не хранить сам адрес. Для пустого адреса возвращает пустую строку.
+func HashIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, *ipHashKey.Load())
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
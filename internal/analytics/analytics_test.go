@@ -0,0 +1,92 @@
+package analytics
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+)
+
+// recordingSink запоминает полученные пакеты событий.
+type recordingSink struct {
+	mu      sync.Mutex
+	batches [][]models.Click
+	block   chan struct{}
+}
+
+func (s *recordingSink) SaveClicks(_ context.Context, clicks []models.Click) error {
+	if s.block != nil {
+		<-s.block
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, append([]models.Click(nil), clicks...))
+	return nil
+}
+
+func (s *recordingSink) sizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sizes []int
+	for _, b := range s.batches {
+		sizes = append(sizes, len(b))
+	}
+	return sizes
+}
+
+func TestRecorderBatchSize(t *testing.T) {
+	sink := &recordingSink{}
+	r := NewRecorder(sink, 10, 3, time.Hour)
+
+	for i := 0; i < 7; i++ {
+		assert.True(t, r.Record(models.Click{ShortURL: "abc"}))
+	}
+	r.Close()
+
+	// Два полных пакета и остаток, записанный при закрытии.
+	assert.Equal(t, []int{3, 3, 1}, sink.sizes())
+	assert.False(t, r.Record(models.Click{ShortURL: "abc"}))
+}
+
+func TestRecorderFlushInterval(t *testing.T) {
+	sink := &recordingSink{}
+	r := NewRecorder(sink, 10, 100, 10*time.Millisecond)
+	defer r.Close()
+
+	r.Record(models.Click{ShortURL: "abc"})
+	assert.Eventually(t, func() bool { return len(sink.sizes()) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestRecorderDropsWhenFull(t *testing.T) {
+	sink := &recordingSink{block: make(chan struct{})}
+	r := NewRecorder(sink, 1, 1, time.Hour)
+
+	// Первое событие забирает фоновая запись и блокируется в Sink,
+	// второе заполняет буфер, остальные отбрасываются.
+	r.Record(models.Click{ShortURL: "abc"})
+	assert.Eventually(t, func() bool { return r.Record(models.Click{ShortURL: "abc"}) }, time.Second, time.Millisecond)
+	assert.False(t, r.Record(models.Click{ShortURL: "abc"}))
+	assert.NotZero(t, r.Dropped())
+
+	close(sink.block)
+	r.Close()
+}
+
+func TestHashIP(t *testing.T) {
+	assert.Empty(t, HashIP(""))
+	assert.Len(t, HashIP("127.0.0.1"), 64)
+	assert.Equal(t, HashIP("127.0.0.1"), HashIP("127.0.0.1"))
+	assert.NotEqual(t, HashIP("127.0.0.1"), HashIP("127.0.0.2"))
+
+	// Хеш зависит от ключа, поэтому адрес нельзя восстановить перебором без него.
+	SetIPHashKey([]byte("first"))
+	first := HashIP("127.0.0.1")
+	SetIPHashKey([]byte("second"))
+	assert.NotEqual(t, first, HashIP("127.0.0.1"))
+	SetIPHashKey([]byte("first"))
+	assert.Equal(t, first, HashIP("127.0.0.1"))
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+)
+
+// APIKeyPrefix — префикс ключей API. Ключ имеет вид usk_<идентификатор>_<секрет>:
+// по идентификатору находится запись ключа, а секрет сверяется с её хэшем.
+const APIKeyPrefix = "usk_"
+
+// Размеры частей ключа API в байтах.
+const (
+	apiKeyIDSize     = 8
+	apiKeySecretSize = 32
+)
+
+// Ошибки ключей API.
+var (
+	// ErrInvalidAPIKey — ключ API не найден, истёк или имеет неверный формат.
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrInsufficientScope — у ключа API нет права на операцию.
+	ErrInsufficientScope = errors.New("insufficient API key scope")
+)
+
+// NewAPIKey создаёт ключ API пользователя userID. Возвращает ключ, который
+// передаётся клиенту один раз, и запись для хранилища, в которой вместо
+// секрета хранится его хэш.
+func NewAPIKey(userID, name string, scopes []string, expiresAt *time.Time) (string, models.APIKey, error) {
+	id := make([]byte, apiKeyIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return "", models.APIKey{}, err
+	}
+	secret := make([]byte, apiKeySecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", models.APIKey{}, err
+	}
+
+	record := models.APIKey{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	record.Hash = HashRefreshToken(encoded)
+	return APIKeyPrefix + record.ID + "_" + encoded, record, nil
+}
+
+// ParseAPIKey разбирает ключ API на идентификатор и секрет.
+func ParseAPIKey(key string) (id, secret string, err error) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return "", "", ErrInvalidAPIKey
+	}
+	id, secret, ok = strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return "", "", ErrInvalidAPIKey
+	}
+	return id, secret, nil
+}
+
+// CheckAPIKey сверяет секрет ключа API с записью record в постоянное время.
+func CheckAPIKey(record models.APIKey, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(record.Hash), []byte(HashRefreshToken(secret))) == 1
+}
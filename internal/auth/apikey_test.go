@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKey(t *testing.T) {
+	key, record, err := NewAPIKey("user", "backend", []string{models.ScopeRead}, nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, APIKeyPrefix+record.ID+"_"))
+
+	id, secret, err := ParseAPIKey(key)
+	require.NoError(t, err)
+	assert.Equal(t, record.ID, id)
+	assert.True(t, CheckAPIKey(record, secret))
+	assert.False(t, CheckAPIKey(record, secret+"x"))
+
+	for _, invalid := range []string{"", "usk_", "usk_id", "usk__secret", "sk_id_secret"} {
+		_, _, err := ParseAPIKey(invalid)
+		assert.ErrorIs(t, err, ErrInvalidAPIKey, invalid)
+	}
+}
@@ -3,12 +3,15 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"go.uber.org/zap"
 )
 
 // Claims структура, содержащая информацию о пользователе,
@@ -20,14 +23,15 @@ type Claims struct {
 	UserID string
 }
 
+// ErrInvalidToken — ошибка, которая возвращается, если токен недействителен.
+var ErrInvalidToken = errors.New("invalid token")
+
 // UserUUID хранит UUID пользователя, который будет использоваться в JWT токенах.
 var UserUUID string
 
-// TokenExp задает срок действия токена. В данном случае - 3 часа.
-const TokenExp = time.Hour * 3
-
-// SecretKey используется для подписи токенов. В реальной разработке следует использовать более безопасные ключи.
-const SecretKey = "supersecretkey"
+// TokenExp задает срок действия токена доступа. Токен короткоживущий:
+// сессия продолжается по токену обновления (см. RefreshTokenExp).
+const TokenExp = 15 * time.Minute
 
 // GenerateToken генерирует новый JWT токен для пользователя.
 // Возвращает строку с токеном и ошибку, если она возникла.
@@ -46,38 +50,58 @@ func BuildJWTString() (string, error) {
 	// Генерируем новый UUID для пользователя
 	UserUUID = uuid.New().String()
 
-	// Создаем новый токен с указанными претензиями (claims)
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+	tokenString, _, err := IssueAccessToken(UserUUID)
+	if err != nil {
+		return "", err
+	}
+	return tokenString, nil
+}
+
+// IssueAccessToken создаёт токен доступа пользователя userID с уникальным
+// идентификатором (jti), по которому токен можно отозвать.
+// Возвращает строку с токеном и момент его истечения.
+func IssueAccessToken(userID string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(TokenExp)
+
+	// Подписываем токен текущим ключом связки
+	tokenString, err := CurrentKeyring().Sign(Claims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(TokenExp)),
+			ID:        uuid.New().String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
-		UserID: UserUUID,
+		UserID: userID,
 	})
-
-	// Подписываем токен с использованием секретного ключа
-	tokenString, err := token.SignedString([]byte(SecretKey))
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
-	return tokenString, nil
+	return tokenString, expiresAt, nil
+}
+
+// ParseToken проверяет токен доступа и возвращает его claims.
+// Если токен отозван, возвращает ErrTokenRevoked.
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	// Проверяем подпись ключом из заголовка kid и извлекаем claims
+	if err := CurrentKeyring().Parse(tokenString, claims); err != nil {
+		return nil, err
+	}
+	if claims.UserID == "" {
+		return nil, ErrInvalidToken
+	}
+	if rv := CurrentRevocations(); rv != nil && rv.TokenRevoked(claims) {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
 }
 
 // GetUserID извлекает UserID из переданного JWT токена.
 // Возвращает строку с UserID, если токен валидный, или пустую строку в случае ошибки.
 func GetUserID(tokenString string) string {
-	claims := &Claims{}
-	// Парсим токен и извлекаем claims
-	token, err := jwt.ParseWithClaims(tokenString, claims,
-		func(t *jwt.Token) (interface{}, error) {
-			return []byte(SecretKey), nil
-		})
+	claims, err := ParseToken(tokenString)
 	if err != nil {
-		return ""
-	}
-
-	// Проверяем валидность токена
-	if !token.Valid {
-		logger.Log.Info("Token is not valid")
+		logger.Log.Info("Token is not valid", zap.Error(err))
 		return ""
 	}
 
@@ -98,7 +122,22 @@ func CheckIsAuthorized(r *http.Request) (string, error) {
 	// Извлекаем UserID из токена
 	userID := GetUserID(cookie.Value)
 	if userID == "" {
-		return "", err
+		return "", ErrInvalidToken
 	}
 	return userID, nil
 }
+
+// contextUserID — тип ключа идентификатора пользователя в контексте.
+type contextUserID struct{}
+
+// WithUserID возвращает контекст с идентификатором аутентифицированного пользователя.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, contextUserID{}, userID)
+}
+
+// UserIDFromContext возвращает идентификатор пользователя, сохранённый WithUserID,
+// или пустую строку, если пользователь не аутентифицирован.
+func UserIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(contextUserID{}).(string)
+	return userID
+}
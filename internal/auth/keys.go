@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// MinSecretLength — минимальная длина секрета HS256 в байтах.
+const MinSecretLength = 32
+
+// Ошибки ключей подписи.
+var (
+	// ErrUnknownKey — токен подписан ключом, которого нет в связке.
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrNoSigningKey — у текущего ключа связки нет закрытой части.
+	ErrNoSigningKey = errors.New("current key cannot sign")
+)
+
+// Key — ключ подписи токенов. Для HS256 один секрет и подписывает,
+// и проверяет токены; для RS256 и EdDSA закрытый ключ подписывает, а открытый
+// проверяет. Ключ без закрытой части годится только для проверки токенов,
+// подписанных до ротации.
+type Key struct {
+	// ID — идентификатор ключа, передаваемый в заголовке kid токена.
+	ID string
+	// Method — алгоритм подписи.
+	Method jwt.SigningMethod
+
+	signKey   any
+	verifyKey any
+}
+
+// NewHMACKey создаёт ключ HS256. Если id пуст, идентификатором становится
+// отпечаток секрета, поэтому смена секрета меняет и идентификатор.
+func NewHMACKey(id string, secret []byte) (Key, error) {
+	if len(secret) < MinSecretLength {
+		return Key{}, fmt.Errorf("HS256 secret must be at least %d bytes", MinSecretLength)
+	}
+	if id == "" {
+		sum := sha256.Sum256(secret)
+		id = hex.EncodeToString(sum[:8])
+	}
+	return Key{ID: id, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}, nil
+}
+
+// NewRSAKey создаёт ключ RS256 из PEM-кодированного закрытого или открытого ключа.
+func NewRSAKey(id string, pem []byte) (Key, error) {
+	key := Key{ID: id, Method: jwt.SigningMethodRS256}
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(pem); err == nil {
+		key.signKey, key.verifyKey = private, &private.PublicKey
+		return key, nil
+	}
+	public, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid RSA key %q: %w", id, err)
+	}
+	key.verifyKey = public
+	return key, nil
+}
+
+// NewEdDSAKey создаёт ключ EdDSA (Ed25519) из PEM-кодированного закрытого или открытого ключа.
+func NewEdDSAKey(id string, pem []byte) (Key, error) {
+	key := Key{ID: id, Method: jwt.SigningMethodEdDSA}
+	if private, err := jwt.ParseEdPrivateKeyFromPEM(pem); err == nil {
+		key.signKey, key.verifyKey = private, private.(ed25519.PrivateKey).Public()
+		return key, nil
+	}
+	public, err := jwt.ParseEdPublicKeyFromPEM(pem)
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid EdDSA key %q: %w", id, err)
+	}
+	key.verifyKey = public
+	return key, nil
+}
+
+// Keyring — связка ключей подписи. Новые токены подписываются текущим ключом,
+// а проверяются ключом из заголовка kid — текущим или одним из предыдущих,
+// поэтому после ротации ранее выданные токены остаются действительными
+// до удаления предыдущего ключа из связки.
+type Keyring struct {
+	current Key
+	keys    map[string]Key
+}
+
+// NewKeyring создаёт связку с текущим ключом current и предыдущими ключами previous.
+func NewKeyring(current Key, previous ...Key) (*Keyring, error) {
+	if current.signKey == nil {
+		return nil, ErrNoSigningKey
+	}
+	k := &Keyring{current: current, keys: make(map[string]Key, len(previous)+1)}
+	for _, key := range append([]Key{current}, previous...) {
+		if key.ID == "" {
+			return nil, errors.New("signing key ID is required")
+		}
+		if _, ok := k.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate signing key ID %q", key.ID)
+		}
+		k.keys[key.ID] = key
+	}
+	return k, nil
+}
+
+// NewRandomKeyring создаёт связку со случайным ключом HS256. Токены, подписанные
+// таким ключом, перестают действовать после перезапуска процесса.
+func NewRandomKeyring() (*Keyring, error) {
+	secret := make([]byte, MinSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	key, err := NewHMACKey("", secret)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(key)
+}
+
+// Sign подписывает claims текущим ключом и указывает его идентификатор в заголовке kid.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.current.Method, claims)
+	token.Header["kid"] = k.current.ID
+	return token.SignedString(k.current.signKey)
+}
+
+// Parse проверяет подпись и срок действия токена и заполняет claims.
+// Токен без заголовка kid, с неизвестным ключом или с алгоритмом,
+// отличным от алгоритма ключа, недействителен.
+func (k *Keyring) Parse(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := k.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q for key %q", t.Method.Alg(), kid)
+		}
+		return key.verifyKey, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !token.Valid {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+// keyringFile — формат файла связки ключей. Пути к файлам ключей
+// указываются относительно каталога файла связки.
+//
+//	{
+//	  "current": "2024-06",
+//	  "keys": [
+//	    {"kid": "2024-06", "alg": "EdDSA", "private_key_file": "jwt-2024-06.pem"},
+//	    {"kid": "2024-01", "alg": "RS256", "public_key_file": "jwt-2024-01.pub.pem"},
+//	    {"kid": "legacy", "alg": "HS256", "secret": "..."}
+//	  ]
+//	}
+type keyringFile struct {
+	Current string `json:"current"`
+	Keys    []struct {
+		ID             string `json:"kid"`
+		Alg            string `json:"alg"`
+		Secret         string `json:"secret"`
+		PrivateKeyFile string `json:"private_key_file"`
+		PublicKeyFile  string `json:"public_key_file"`
+	} `json:"keys"`
+}
+
+// LoadKeyringFile читает связку ключей из файла path.
+func LoadKeyringFile(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f keyringFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid keyring file %s: %w", path, err)
+	}
+
+	var current *Key
+	var previous []Key
+	for _, entry := range f.Keys {
+		var key Key
+		switch entry.Alg {
+		case jwt.SigningMethodHS256.Alg():
+			key, err = NewHMACKey(entry.ID, []byte(entry.Secret))
+		case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg():
+			keyFile := entry.PrivateKeyFile
+			if keyFile == "" {
+				keyFile = entry.PublicKeyFile
+			}
+			if !filepath.IsAbs(keyFile) {
+				keyFile = filepath.Join(filepath.Dir(path), keyFile)
+			}
+			var pem []byte
+			if pem, err = os.ReadFile(keyFile); err != nil {
+				return nil, err
+			}
+			if entry.Alg == jwt.SigningMethodRS256.Alg() {
+				key, err = NewRSAKey(entry.ID, pem)
+			} else {
+				key, err = NewEdDSAKey(entry.ID, pem)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported signing algorithm %q for key %q", entry.Alg, entry.ID)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if entry.ID == f.Current {
+			current = &key
+		} else {
+			previous = append(previous, key)
+		}
+	}
+	if current == nil {
+		return nil, fmt.Errorf("current key %q not found in %s", f.Current, path)
+	}
+	return NewKeyring(*current, previous...)
+}
+
+// LoadKeyring создаёт связку ключей из конфигурации: из файла keysFile,
+// если он указан, иначе из секрета HS256. Возвращает nil, если не задано ни то, ни другое.
+func LoadKeyring(secret, keysFile string) (*Keyring, error) {
+	if keysFile != "" {
+		return LoadKeyringFile(keysFile)
+	}
+	if secret == "" {
+		return nil, nil
+	}
+	key, err := NewHMACKey("", []byte(secret))
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(key)
+}
+
+// keyring — связка ключей, которой подписываются и проверяются токены.
+// До вызова SetKeyring используется случайный ключ.
+var keyring atomic.Pointer[Keyring]
+
+func init() {
+	k, err := NewRandomKeyring()
+	if err != nil {
+		panic(err)
+	}
+	keyring.Store(k)
+}
+
+// SetKeyring задаёт связку ключей, которой подписываются и проверяются токены.
+func SetKeyring(k *Keyring) {
+	keyring.Store(k)
+}
+
+// CurrentKeyring возвращает связку ключей, которой подписываются и проверяются токены.
+func CurrentKeyring() *Keyring {
+	return keyring.Load()
+}
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testClaims(userID string) Claims {
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		UserID: userID,
+	}
+}
+
+func mustHMACKey(t *testing.T, id string) Key {
+	t.Helper()
+	key, err := NewHMACKey(id, []byte(strings.Repeat(id, MinSecretLength)))
+	require.NoError(t, err)
+	return key
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0600))
+}
+
+func TestKeyringRotation(t *testing.T) {
+	old, err := NewKeyring(mustHMACKey(t, "old"))
+	require.NoError(t, err)
+	oldToken, err := old.Sign(testClaims("user-1"))
+	require.NoError(t, err)
+
+	rotated, err := NewKeyring(mustHMACKey(t, "new"), mustHMACKey(t, "old"))
+	require.NoError(t, err)
+	newToken, err := rotated.Sign(testClaims("user-2"))
+	require.NoError(t, err)
+
+	// Токен, подписанный предыдущим ключом, проверяется после ротации.
+	claims := &Claims{}
+	require.NoError(t, rotated.Parse(oldToken, claims))
+	assert.Equal(t, "user-1", claims.UserID)
+
+	claims = &Claims{}
+	require.NoError(t, rotated.Parse(newToken, claims))
+	assert.Equal(t, "user-2", claims.UserID)
+
+	// После удаления предыдущего ключа его токены недействительны.
+	dropped, err := NewKeyring(mustHMACKey(t, "new"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, dropped.Parse(oldToken, &Claims{}), ErrUnknownKey)
+}
+
+func TestKeyringRejectsForgedTokens(t *testing.T) {
+	k, err := NewKeyring(mustHMACKey(t, "current"))
+	require.NoError(t, err)
+
+	t.Run("without kid", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims("user"))
+		s, err := token.SignedString([]byte(strings.Repeat("current", MinSecretLength)))
+		require.NoError(t, err)
+		assert.ErrorIs(t, k.Parse(s, &Claims{}), ErrUnknownKey)
+	})
+
+	t.Run("old hard-coded secret", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims("user"))
+		token.Header["kid"] = "current"
+		s, err := token.SignedString([]byte("supersecretkey"))
+		require.NoError(t, err)
+		assert.Error(t, k.Parse(s, &Claims{}))
+	})
+
+	t.Run("algorithm mismatch", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS512, testClaims("user"))
+		token.Header["kid"] = "current"
+		s, err := token.SignedString([]byte(strings.Repeat("current", MinSecretLength)))
+		require.NoError(t, err)
+		assert.Error(t, k.Parse(s, &Claims{}))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		claims := testClaims("user")
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		s, err := k.Sign(claims)
+		require.NoError(t, err)
+		assert.Error(t, k.Parse(s, &Claims{}))
+	})
+}
+
+func TestNewHMACKey(t *testing.T) {
+	_, err := NewHMACKey("short", []byte("supersecretkey"))
+	assert.Error(t, err)
+
+	secret := []byte(strings.Repeat("s", MinSecretLength))
+	a, err := NewHMACKey("", secret)
+	require.NoError(t, err)
+	b, err := NewHMACKey("", secret)
+	require.NoError(t, err)
+	assert.Equal(t, a.ID, b.ID, "ID derived from the secret must be stable across restarts")
+}
+
+func TestLoadKeyringFile(t *testing.T) {
+	dir := t.TempDir()
+
+	_, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	require.NoError(t, err)
+	writePEM(t, dir, "ed.pem", "PRIVATE KEY", der)
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPrivate))
+	der, err = x509.MarshalPKIXPublicKey(&rsaPrivate.PublicKey)
+	require.NoError(t, err)
+	writePEM(t, dir, "rsa.pub.pem", "PUBLIC KEY", der)
+
+	writeKeyring := func(content string) string {
+		path := filepath.Join(dir, "keys.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		return path
+	}
+
+	// Токен, выданный до ротации ключом RS256.
+	before, err := LoadKeyringFile(writeKeyring(`{
+		"current": "rsa",
+		"keys": [{"kid": "rsa", "alg": "RS256", "private_key_file": "rsa.pem"}]
+	}`))
+	require.NoError(t, err)
+	oldToken, err := before.Sign(testClaims("user-1"))
+	require.NoError(t, err)
+
+	// После ротации на EdDSA у RS256 остаётся только открытый ключ.
+	after, err := LoadKeyring("", writeKeyring(`{
+		"current": "ed",
+		"keys": [
+			{"kid": "ed", "alg": "EdDSA", "private_key_file": "ed.pem"},
+			{"kid": "rsa", "alg": "RS256", "public_key_file": "rsa.pub.pem"},
+			{"kid": "legacy", "alg": "HS256", "secret": "`+strings.Repeat("x", MinSecretLength)+`"}
+		]
+	}`))
+	require.NoError(t, err)
+
+	claims := &Claims{}
+	require.NoError(t, after.Parse(oldToken, claims))
+	assert.Equal(t, "user-1", claims.UserID)
+
+	newToken, err := after.Sign(testClaims("user-2"))
+	require.NoError(t, err)
+	token, _, err := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	require.NoError(t, err)
+	assert.Equal(t, "EdDSA", token.Method.Alg())
+	assert.Equal(t, "ed", token.Header["kid"])
+
+	// Ключ, способный только проверять токены, не может быть текущим.
+	_, err = LoadKeyringFile(writeKeyring(`{
+		"current": "rsa",
+		"keys": [{"kid": "rsa", "alg": "RS256", "public_key_file": "rsa.pub.pem"}]
+	}`))
+	assert.ErrorIs(t, err, ErrNoSigningKey)
+
+	_, err = LoadKeyringFile(writeKeyring(`{"current": "missing", "keys": []}`))
+	assert.Error(t, err)
+}
+
+func TestLoadKeyringDefault(t *testing.T) {
+	k, err := LoadKeyring("", "")
+	require.NoError(t, err)
+	assert.Nil(t, k)
+
+	_, err = LoadKeyring("too-short", "")
+	assert.Error(t, err)
+}
+
+func TestBuildJWTString(t *testing.T) {
+	k, err := NewKeyring(mustHMACKey(t, "current"))
+	require.NoError(t, err)
+	prev := CurrentKeyring()
+	SetKeyring(k)
+	t.Cleanup(func() { SetKeyring(prev) })
+
+	token, err := BuildJWTString()
+	require.NoError(t, err)
+	assert.Equal(t, UserUUID, GetUserID(token))
+	assert.Empty(t, GetUserID("not a token"))
+}
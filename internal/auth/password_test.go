@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$"))
+
+	other, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "salt must be random")
+
+	ok, err := CheckPassword(hash, "correct horse")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = CheckPassword(hash, "battery staple")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = CheckPassword("$2a$10$bcrypt", "correct horse")
+	assert.ErrorIs(t, err, ErrInvalidPasswordHash)
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+)
+
+// RefreshTokenExp задаёт срок действия токена обновления.
+const RefreshTokenExp = 30 * 24 * time.Hour
+
+// RenewBefore — остаток срока действия токена доступа, при котором
+// он продлевается без обращения клиента к обновлению токена.
+const RenewBefore = 5 * time.Minute
+
+// RefreshCookieName — имя cookie с токеном обновления.
+const RefreshCookieName = "refresh_token"
+
+// refreshTokenSize — количество случайных байт токена обновления.
+const refreshTokenSize = 32
+
+// NewRefreshToken создаёт случайный токен обновления пользователя userID.
+// Возвращает токен, который передаётся клиенту, и запись для хранилища,
+// в которой вместо самого токена хранится его хэш.
+func NewRefreshToken(userID string) (string, models.RefreshToken, error) {
+	b := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", models.RefreshToken{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now().UTC()
+	return token, models.RefreshToken{
+		ID:        HashRefreshToken(token),
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(RefreshTokenExp),
+	}, nil
+}
+
+// HashRefreshToken возвращает идентификатор записи токена обновления в хранилище.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
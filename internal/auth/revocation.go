@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"go.uber.org/zap"
+)
+
+// ErrTokenRevoked — ошибка, которая возвращается, если токен доступа отозван.
+var ErrTokenRevoked = errors.New("token revoked")
+
+// RevocationStore — хранилище записей об отзыве токенов.
+type RevocationStore interface {
+	SaveTokenRevocation(ctx context.Context, revocation models.TokenRevocation) error
+	ListTokenRevocations(ctx context.Context, now time.Time) ([]models.TokenRevocation, error)
+}
+
+// Revocations — список отозванных токенов доступа. Записи хранятся в хранилище,
+// а проверка токенов выполняется по их копии в памяти, которую Load и Sync
+// обновляют из хранилища.
+type Revocations struct {
+	store RevocationStore
+
+	mu     sync.RWMutex
+	tokens map[string]time.Time // Идентификатор токена (jti) → момент истечения записи.
+	users  map[string]time.Time // Пользователь → момент отзыва всех его токенов.
+}
+
+// NewRevocations создаёт пустой список отозванных токенов, записи которого
+// сохраняются в store.
+func NewRevocations(store RevocationStore) *Revocations {
+	return &Revocations{
+		store:  store,
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+	}
+}
+
+// Load заменяет копию списка в памяти действующими записями из хранилища.
+func (r *Revocations) Load(ctx context.Context) error {
+	records, err := r.store.ListTokenRevocations(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+
+	tokens := make(map[string]time.Time)
+	users := make(map[string]time.Time)
+	for _, rev := range records {
+		if rev.TokenID != "" {
+			tokens[rev.TokenID] = rev.ExpiresAt
+		} else if rev.RevokedAt.After(users[rev.UserID]) {
+			users[rev.UserID] = rev.RevokedAt
+		}
+	}
+
+	r.mu.Lock()
+	r.tokens, r.users = tokens, users
+	r.mu.Unlock()
+	return nil
+}
+
+// Sync периодически перечитывает список из хранилища, чтобы учитывать токены,
+// отозванные другими экземплярами сервиса. Работает до отмены контекста.
+func (r *Revocations) Sync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Load(ctx); err != nil {
+				logger.Log.Error("Failed to load token revocations", zap.Error(err))
+			}
+		}
+	}
+}
+
+// RevokeToken отзывает токен доступа с claims. Запись хранится до истечения токена.
+func (r *Revocations) RevokeToken(ctx context.Context, claims *Claims) error {
+	if claims.ID == "" {
+		return ErrInvalidToken
+	}
+	now := time.Now().UTC()
+	expiresAt := now.Add(TokenExp)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time.UTC()
+	}
+	if err := r.store.SaveTokenRevocation(ctx, models.TokenRevocation{
+		TokenID:   claims.ID,
+		UserID:    claims.UserID,
+		RevokedAt: now,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.tokens[claims.ID] = expiresAt
+	r.mu.Unlock()
+	return nil
+}
+
+// RevokeUser отзывает все токены доступа и обновления, выданные пользователю userID
+// до этого момента. Запись хранится, пока не истекут все такие токены.
+func (r *Revocations) RevokeUser(ctx context.Context, userID string) error {
+	now := time.Now().UTC()
+	if err := r.store.SaveTokenRevocation(ctx, models.TokenRevocation{
+		UserID:    userID,
+		RevokedAt: now,
+		ExpiresAt: now.Add(RefreshTokenExp),
+	}); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.users[userID] = now
+	r.mu.Unlock()
+	return nil
+}
+
+// TokenRevoked сообщает, отозван ли токен доступа с claims: сам по себе
+// или вместе со всеми токенами пользователя.
+func (r *Revocations) TokenRevoked(claims *Claims) bool {
+	r.mu.RLock()
+	_, revoked := r.tokens[claims.ID]
+	r.mu.RUnlock()
+	if revoked {
+		return true
+	}
+
+	var issuedAt time.Time
+	if claims.IssuedAt != nil {
+		issuedAt = claims.IssuedAt.Time
+	}
+	return r.UserRevoked(claims.UserID, issuedAt)
+}
+
+// UserRevoked сообщает, отозваны ли токены пользователя userID, выданные
+// в момент issuedAt. Момент выдачи токена доступа известен с точностью
+// до секунды, поэтому токены, выданные в ту же секунду, что и отзыв,
+// также считаются отозванными.
+func (r *Revocations) UserRevoked(userID string, issuedAt time.Time) bool {
+	r.mu.RLock()
+	revokedAt, ok := r.users[userID]
+	r.mu.RUnlock()
+	return ok && !issuedAt.After(revokedAt)
+}
+
+// revocations — список отозванных токенов, по которому проверяются токены доступа.
+// До вызова SetRevocations токены не проверяются на отзыв.
+var revocations atomic.Pointer[Revocations]
+
+// SetRevocations задаёт список отозванных токенов, по которому проверяются токены доступа.
+func SetRevocations(r *Revocations) {
+	revocations.Store(r)
+}
+
+// CurrentRevocations возвращает список отозванных токенов или nil, если он не задан.
+func CurrentRevocations() *Revocations {
+	return revocations.Load()
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevocations(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	rv := NewRevocations(store)
+	SetRevocations(rv)
+	t.Cleanup(func() { SetRevocations(nil) })
+
+	issue := func(userID string) (string, *Claims) {
+		token, _, err := IssueAccessToken(userID)
+		require.NoError(t, err)
+		claims, err := ParseToken(token)
+		require.NoError(t, err)
+		require.NotEmpty(t, claims.ID)
+		return token, claims
+	}
+
+	// Отзыв одного токена не затрагивает другие токены пользователя.
+	revoked, claims := issue("alice")
+	kept, _ := issue("alice")
+	require.NoError(t, rv.RevokeToken(ctx, claims))
+	_, err := ParseToken(revoked)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	assert.Equal(t, "alice", GetUserID(kept))
+
+	// Отзыв всех токенов пользователя затрагивает только выданные до него.
+	bobToken, _ := issue("bob")
+	require.NoError(t, rv.RevokeUser(ctx, "bob"))
+	assert.Empty(t, GetUserID(bobToken))
+	assert.Equal(t, "alice", GetUserID(kept))
+	assert.True(t, rv.UserRevoked("bob", time.Now().Add(-time.Minute)))
+	assert.False(t, rv.UserRevoked("bob", time.Now().Add(time.Minute)))
+
+	// Другой экземпляр сервиса получает отзывы из хранилища.
+	other := NewRevocations(store)
+	require.NoError(t, other.Load(ctx))
+	SetRevocations(other)
+	_, err = ParseToken(revoked)
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+	assert.Empty(t, GetUserID(bobToken))
+	assert.Equal(t, "alice", GetUserID(kept))
+}
@@ -0,0 +1,286 @@
+// Package file предоставляет журналы в формате JSON Lines, открытые на дозапись,
+// с восстановлением после сбоя и атомарной заменой содержимого файлов.
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SyncPolicy определяет, когда записи журнала сбрасываются на диск.
+type SyncPolicy string
+
+const (
+	// SyncAlways — после каждой записи. Подтверждённая запись переживает сбой системы.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval — периодически в фоне. При сбое системы теряются записи за последний интервал.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever — по усмотрению операционной системы.
+	SyncNever SyncPolicy = "never"
+)
+
+// ParseSyncPolicy разбирает строковое значение политики сброса на диск.
+// Пустая строка соответствует политике по умолчанию SyncInterval.
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(s); policy {
+	case "":
+		return SyncInterval, nil
+	case SyncAlways, SyncInterval, SyncNever:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown sync policy %q", s)
+	}
+}
+
+// DefaultSyncInterval — период сброса на диск по умолчанию для политики SyncInterval.
+const DefaultSyncInterval = time.Second
+
+// Log — журнал в формате JSON Lines, открытый на дозапись. Каждый вызов
+// Append записывает свои записи одной операцией записи, поэтому при сбое
+// в конце файла может остаться не больше одной оборванной строки,
+// которую отрезает Replay.
+type Log struct {
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	policy SyncPolicy
+	dirty  bool // Есть записи, не сброшенные на диск.
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// OpenLog открывает журнал path на дозапись, создавая файл при необходимости.
+// Для политики SyncInterval записи сбрасываются на диск каждые interval;
+// неположительное значение заменяется DefaultSyncInterval.
+func OpenLog(path string, policy SyncPolicy, interval time.Duration) (*Log, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	l := &Log{file: file, size: info.Size(), policy: policy}
+	if policy == SyncInterval {
+		if interval <= 0 {
+			interval = DefaultSyncInterval
+		}
+		l.stop, l.done = make(chan struct{}), make(chan struct{})
+		go l.syncLoop(interval)
+	}
+	return l, nil
+}
+
+// Append дописывает записи в журнал по одной JSON-строке на запись.
+// Если запись не удалась, частично записанные данные отрезаются.
+func (l *Log) Append(records ...any) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Write(buf.Bytes()); err != nil {
+		l.file.Truncate(l.size)
+		return err
+	}
+	l.size += int64(buf.Len())
+
+	if l.policy == SyncAlways {
+		return l.file.Sync()
+	}
+	l.dirty = true
+	return nil
+}
+
+// Size возвращает размер журнала в байтах.
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.size
+}
+
+// Sync сбрасывает записи журнала на диск.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.sync()
+}
+
+// sync сбрасывает записи на диск, если они есть. Вызывается под блокировкой.
+func (l *Log) sync() error {
+	if !l.dirty {
+		return nil
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.dirty = false
+	return nil
+}
+
+// syncLoop периодически сбрасывает записи на диск до закрытия журнала.
+func (l *Log) syncLoop(interval time.Duration) {
+	defer close(l.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.Sync()
+		}
+	}
+}
+
+// Close сбрасывает записи на диск, если политика это предусматривает, и закрывает журнал.
+func (l *Log) Close() error {
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var err error
+	if l.policy != SyncNever {
+		err = l.sync()
+	}
+	return errors.Join(err, l.file.Close())
+}
+
+// ReplayStats описывает результат чтения журнала.
+type ReplayStats struct {
+	// Records — количество прочитанных записей.
+	Records int
+	// Skipped — количество пропущенных повреждённых строк в середине журнала.
+	Skipped int
+	// Truncated — количество байт оборванной последней строки, отрезанных от журнала.
+	Truncated int64
+}
+
+// Replay читает журнал path и передаёт каждую запись в fn. Оборванная
+// или повреждённая последняя строка — след сбоя во время записи — отрезается
+// от файла, чтобы следующие записи не склеились с ней. Повреждённые строки
+// в середине журнала пропускаются, не прерывая чтение. Ошибка fn прерывает
+// чтение и возвращается вызывающему. Отсутствующий журнал считается пустым.
+func Replay(path string, fn func(record []byte) error) (ReplayStats, error) {
+	var stats ReplayStats
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var offset int64 // Конец последней целой строки.
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(line) > 0 {
+				return truncate(file, offset, int64(len(line)), stats)
+			}
+			return stats, nil
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		record := bytes.TrimSpace(line)
+		switch {
+		case len(record) == 0:
+		case !json.Valid(record):
+			if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+				return truncate(file, offset, int64(len(line)), stats)
+			}
+			stats.Skipped++
+		default:
+			if err := fn(record); err != nil {
+				return stats, err
+			}
+			stats.Records++
+		}
+		offset += int64(len(line))
+	}
+}
+
+// truncate отрезает от журнала оборванный хвост длиной n, начинающийся с offset.
+func truncate(file *os.File, offset, n int64, stats ReplayStats) (ReplayStats, error) {
+	if err := file.Truncate(offset); err != nil {
+		return stats, err
+	}
+	stats.Truncated = n
+	return stats, file.Sync()
+}
+
+// WriteSnapshot атомарно заменяет файл path записями, которые передаёт write:
+// записи пишутся во временный файл, сбрасываются на диск и только затем
+// временный файл переименовывается в path. При сбое path остаётся прежним.
+func WriteSnapshot(path string, write func(enc *json.Encoder) error) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	w := bufio.NewWriter(file)
+	err = write(json.NewEncoder(w))
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if err = errors.Join(err, file.Close()); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return SyncDir(filepath.Dir(path))
+}
+
+// SyncDir сбрасывает на диск содержимое каталога dir, чтобы созданные,
+// переименованные и удалённые в нём файлы пережили сбой системы.
+func SyncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
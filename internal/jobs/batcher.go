@@ -0,0 +1,176 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+)
+
+// Значения параметров DeleteBatcher по умолчанию.
+const (
+	DefaultFlushSize     = 1000
+	DefaultFlushInterval = 100 * time.Millisecond
+)
+
+// flushTimeout ограничивает время записи одного пакета удалений.
+const flushTimeout = 30 * time.Second
+
+// deleteRequest — запрос на удаление, ожидающий записи пакета.
+type deleteRequest struct {
+	ids  []string
+	done chan deleteResult
+}
+
+// deleteResult — результат записи пакета для одного запроса.
+type deleteResult struct {
+	missing []string // Идентификаторы запроса, которых нет среди ссылок пользователя.
+	err     error
+}
+
+// DeleteBatcher накапливает запросы на удаление ссылок от разных задач
+// и записывает их в хранилище одной операцией на пользователя: по истечении
+// интервала или при накоплении заданного количества идентификаторов.
+type DeleteBatcher struct {
+	store         storage.Storage
+	flushSize     int
+	flushInterval time.Duration
+
+	mu      sync.Mutex
+	closed  bool
+	pending map[string][]deleteRequest // Ключ — идентификатор пользователя.
+	size    int                        // Количество идентификаторов в pending.
+
+	full chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewDeleteBatcher создаёт DeleteBatcher и запускает периодическую запись.
+// Неположительные параметры заменяются значениями по умолчанию.
+func NewDeleteBatcher(store storage.Storage, flushSize int, flushInterval time.Duration) *DeleteBatcher {
+	if flushSize <= 0 {
+		flushSize = DefaultFlushSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlushInterval
+	}
+
+	b := &DeleteBatcher{
+		store:         store,
+		flushSize:     flushSize,
+		flushInterval: flushInterval,
+		pending:       make(map[string][]deleteRequest),
+		full:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// FlushSize возвращает количество идентификаторов, при накоплении которого
+// пакет записывается, не дожидаясь интервала.
+func (b *DeleteBatcher) FlushSize() int {
+	return b.flushSize
+}
+
+// Delete ставит идентификаторы ссылок пользователя в пакет на удаление,
+// дожидается записи пакета и возвращает идентификаторы, которых нет среди
+// ссылок пользователя. Если ctx отменяется раньше, возвращает ошибку
+// контекста, но поставленные идентификаторы всё равно будут удалены.
+func (b *DeleteBatcher) Delete(ctx context.Context, userID string, ids []string) ([]string, error) {
+	req := deleteRequest{ids: ids, done: make(chan deleteResult, 1)}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil, ErrClosed
+	}
+	b.pending[userID] = append(b.pending[userID], req)
+	b.size += len(ids)
+	full := b.size >= b.flushSize
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+
+	select {
+	case res := <-req.done:
+		return res.missing, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close прекращает приём запросов и записывает накопленные удаления.
+func (b *DeleteBatcher) Close() {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.stop)
+	}
+	b.mu.Unlock()
+
+	<-b.done
+}
+
+// run записывает накопленные удаления по таймеру, по заполнению и при остановке.
+func (b *DeleteBatcher) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.flush()
+		case <-b.full:
+			b.flush()
+		case <-b.stop:
+			b.flush()
+			return
+		}
+	}
+}
+
+// flush записывает накопленные удаления одной операцией на пользователя
+// и сообщает результат всем ожидающим запросам.
+func (b *DeleteBatcher) flush() {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[string][]deleteRequest)
+	b.size = 0
+	b.mu.Unlock()
+
+	for userID, reqs := range pending {
+		var ids []string
+		for _, req := range reqs {
+			ids = append(ids, req.ids...)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		missing, err := b.store.BatchDeleteURLs(ctx, userID, ids)
+		cancel()
+
+		notFound := make(map[string]bool, len(missing))
+		for _, id := range missing {
+			notFound[id] = true
+		}
+		for _, req := range reqs {
+			res := deleteResult{err: err}
+			for _, id := range req.ids {
+				if notFound[id] {
+					res.missing = append(res.missing, id)
+				}
+			}
+			req.done <- res
+		}
+	}
+}
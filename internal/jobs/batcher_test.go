@@ -0,0 +1,192 @@
+package jobs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	"github.com/sol1corejz/go-url-shortener/internal/storage/storagetest"
+)
+
+// countingStorage считает вызовы пакетного удаления.
+type countingStorage struct {
+	*storage.MemoryStorage
+
+	mu    sync.Mutex
+	calls map[string]int // Ключ — идентификатор пользователя.
+}
+
+func (s *countingStorage) BatchDeleteURLs(ctx context.Context, userID string, ids []string) ([]string, error) {
+	s.mu.Lock()
+	s.calls[userID]++
+	s.mu.Unlock()
+	return s.MemoryStorage.BatchDeleteURLs(ctx, userID, ids)
+}
+
+func TestDeleteBatcherMergesRequests(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStorage{MemoryStorage: storage.NewMemoryStorage(), calls: make(map[string]int)}
+	saveURLs(t, store, "alice", "a1", "a2", "a3")
+	saveURLs(t, store, "bob", "b1")
+
+	// Запись по размеру: три идентификатора alice и два bob заполняют пакет.
+	b := NewDeleteBatcher(store, 5, time.Hour)
+	defer b.Close()
+
+	// Ссылка a1 чужая для bob и возвращается только в его запросе.
+	var wg sync.WaitGroup
+	for user, ids := range map[string][][]string{
+		"alice": {{"a1"}, {"a2", "a3"}},
+		"bob":   {{"b1", "a1"}},
+	} {
+		for _, chunk := range ids {
+			wg.Add(1)
+			go func(user string, chunk []string) {
+				defer wg.Done()
+				missing, err := b.Delete(ctx, user, chunk)
+				assert.NoError(t, err)
+				if user == "bob" {
+					assert.Equal(t, []string{"a1"}, missing)
+				} else {
+					assert.Empty(t, missing)
+				}
+			}(user, chunk)
+		}
+	}
+	wg.Wait()
+
+	assert.Equal(t, map[string]int{"alice": 1, "bob": 1}, store.calls)
+	for _, id := range []string{"a1", "a2", "a3", "b1"} {
+		data, err := store.GetOriginalURL(ctx, id)
+		require.NoError(t, err)
+		assert.True(t, data.DeletedFlag, id)
+	}
+}
+
+func TestDeleteBatcherFlushesOnInterval(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	saveURLs(t, store, "alice", "a1")
+
+	b := NewDeleteBatcher(store, 100, time.Millisecond)
+	_, err := b.Delete(ctx, "alice", []string{"a1"})
+	require.NoError(t, err)
+	b.Close()
+
+	_, err = b.Delete(ctx, "alice", []string{"a1"})
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+// BenchmarkDelete сравнивает три способа удалить одни и те же ссылки:
+// отдельной операцией хранилища на каждый идентификатор, через DeleteBatcher,
+// который копит идентификаторы одновременных запросов в пакеты, и одной
+// пакетной операцией. В первых двух режимах идентификаторы удаляют
+// deleteWorkers горутин по одному.
+func BenchmarkDelete(b *testing.B) {
+	backends := map[string]func(b *testing.B) storage.Storage{
+		"Memory": func(b *testing.B) storage.Storage {
+			return storage.NewMemoryStorage()
+		},
+		"Bolt": func(b *testing.B) storage.Storage {
+			s, err := storage.NewBoltStorage(filepath.Join(b.TempDir(), "storage.db"))
+			require.NoError(b, err)
+			b.Cleanup(func() { s.Close() })
+			return s
+		},
+		"File": func(b *testing.B) storage.Storage {
+			s, err := storage.NewFileStorage(filepath.Join(b.TempDir(), "storage.json"))
+			require.NoError(b, err)
+			b.Cleanup(func() { s.Close() })
+			return s
+		},
+	}
+	if dsn := os.Getenv("TEST_DATABASE_DSN"); dsn != "" {
+		backends["Postgres"] = func(b *testing.B) storage.Storage {
+			s, err := storage.NewPostgresStorage(context.Background(), dsn)
+			require.NoError(b, err)
+			b.Cleanup(func() { s.Close() })
+			return s
+		}
+	}
+
+	const (
+		size          = 1000
+		deleteWorkers = 50
+	)
+	// concurrently вызывает del для каждого идентификатора из deleteWorkers горутин.
+	concurrently := func(ids []string, del func(id string) error) error {
+		queue := make(chan string)
+		errs := make(chan error, len(ids))
+		var wg sync.WaitGroup
+		for w := 0; w < deleteWorkers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for id := range queue {
+					if err := del(id); err != nil {
+						errs <- err
+					}
+				}
+			}()
+		}
+		for _, id := range ids {
+			queue <- id
+		}
+		close(queue)
+		wg.Wait()
+		close(errs)
+		return <-errs
+	}
+	deletes := map[string]func(ctx context.Context, s storage.Storage, userID string, ids []string) error{
+		"PerID": func(ctx context.Context, s storage.Storage, userID string, ids []string) error {
+			return concurrently(ids, func(id string) error {
+				return storagetest.DeleteURL(ctx, s, id, userID)
+			})
+		},
+		"Batcher": func(ctx context.Context, s storage.Storage, userID string, ids []string) error {
+			// Пакет сбрасывается, как только каждая горутина поставила в очередь
+			// свой идентификатор, поэтому результат не зависит от интервала сброса.
+			batcher := NewDeleteBatcher(s, deleteWorkers, DefaultFlushInterval)
+			defer batcher.Close()
+			return concurrently(ids, func(id string) error {
+				_, err := batcher.Delete(ctx, userID, []string{id})
+				return err
+			})
+		},
+		"Bulk": func(ctx context.Context, s storage.Storage, userID string, ids []string) error {
+			_, err := s.BatchDeleteURLs(ctx, userID, ids)
+			return err
+		},
+	}
+
+	for backend, newStorage := range backends {
+		for mode, del := range deletes {
+			b.Run(backend+"/"+mode, func(b *testing.B) {
+				ctx := context.Background()
+				s := newStorage(b)
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					userID := uuid.New().String()
+					ids := make([]string, 0, size)
+					for j := 0; j < size; j++ {
+						data := storagetest.NewURL(userID)
+						_, err := s.SaveURL(ctx, data)
+						require.NoError(b, err)
+						ids = append(ids, data.ShortURL)
+					}
+					b.StartTimer()
+
+					require.NoError(b, del(ctx, s, userID, ids))
+				}
+			})
+		}
+	}
+}
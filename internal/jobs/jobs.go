@@ -0,0 +1,308 @@
+// Package jobs выполняет фоновые задачи над ссылками пользователей.
+// Состояние задач хранится в storage.Storage, поэтому незавершённые задачи
+// переживают перезапуск сервиса и продолжаются с места остановки.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Значения параметров очереди по умолчанию.
+const (
+	DefaultWorkers     = 2
+	DefaultMaxAttempts = 3
+	DefaultRetryDelay  = 100 * time.Millisecond
+)
+
+// queueSize — размер буфера очереди идентификаторов задач.
+const queueSize = 1024
+
+// ErrClosed — ошибка постановки задачи в остановленную очередь.
+var ErrClosed = errors.New("job queue is closed")
+
+// Option настраивает очередь задач.
+type Option func(*Queue)
+
+// WithFlushSize задаёт количество идентификаторов, при накоплении которого
+// удаления записываются в хранилище, не дожидаясь интервала. Задачи
+// обрабатываются частями такого же размера.
+func WithFlushSize(size int) Option {
+	return func(q *Queue) { q.flushSize = size }
+}
+
+// WithFlushInterval задаёт максимальный интервал накопления удалений.
+func WithFlushInterval(interval time.Duration) Option {
+	return func(q *Queue) { q.flushInterval = interval }
+}
+
+// Queue выполняет задачи пакетного удаления ссылок. Каждая задача сохраняется
+// в хранилище до постановки в очередь и обрабатывается частями через
+// DeleteBatcher, объединяющий удаления разных задач. Ошибки повторяются
+// до MaxAttempts раз, а итоговые ошибки по идентификаторам сохраняются в задаче.
+// Обработчики запускаются при постановке первой задачи.
+type Queue struct {
+	// MaxAttempts — максимальное число попыток обработать одну часть задачи.
+	MaxAttempts int
+	// RetryDelay — задержка перед повторной попыткой; растёт линейно с номером попытки.
+	RetryDelay time.Duration
+
+	store         storage.Storage
+	workers       int
+	flushSize     int
+	flushInterval time.Duration
+	batcher       *DeleteBatcher
+	queue         chan string
+
+	mu      sync.RWMutex // Защищает closed от гонки с закрытием канала queue.
+	closed  bool
+	started sync.Once
+	stop    context.CancelFunc
+	ctx     context.Context
+	wg      sync.WaitGroup
+}
+
+// NewQueue создаёт очередь с workers обработчиками.
+// Неположительное значение workers заменяется DefaultWorkers.
+func NewQueue(store storage.Storage, workers int, opts ...Option) *Queue {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	q := &Queue{
+		MaxAttempts: DefaultMaxAttempts,
+		RetryDelay:  DefaultRetryDelay,
+		store:       store,
+		workers:     workers,
+		queue:       make(chan string, queueSize),
+		ctx:         ctx,
+		stop:        stop,
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+// start запускает пакетную запись удалений и обработчики задач. Вызывается под q.mu.
+func (q *Queue) start() {
+	q.started.Do(func() {
+		q.batcher = NewDeleteBatcher(q.store, q.flushSize, q.flushInterval)
+		for i := 0; i < q.workers; i++ {
+			q.wg.Add(1)
+			go q.work()
+		}
+	})
+}
+
+// Resume ставит в очередь задачи, не завершённые до предыдущей остановки сервиса.
+func (q *Queue) Resume(ctx context.Context) error {
+	jobs, err := q.store.GetUnfinishedJobs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if err := q.enqueue(ctx, job.ID); err != nil {
+			return err
+		}
+	}
+	if len(jobs) > 0 {
+		logger.Log.Info("Resumed unfinished jobs", zap.Int("count", len(jobs)))
+	}
+	return nil
+}
+
+// EnqueueDelete создаёт и ставит в очередь задачу удаления ссылок ids пользователя userID.
+// Если очередь остановлена, возвращает ErrClosed, не сохраняя задачу.
+func (q *Queue) EnqueueDelete(ctx context.Context, userID string, ids []string) (models.Job, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return models.Job{}, ErrClosed
+	}
+
+	now := time.Now().UTC()
+	job := models.Job{
+		ID:        uuid.New().String(),
+		Kind:      models.JobKindDelete,
+		UserID:    userID,
+		IDs:       ids,
+		Status:    models.JobPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := q.store.SaveJob(ctx, job); err != nil {
+		return models.Job{}, err
+	}
+	// Очередь не остановится, пока удерживается q.mu, поэтому сохранённая
+	// задача будет поставлена в неё. Если отменится ctx, задачу подхватит
+	// Resume при следующем запуске.
+	return job, q.send(ctx, job.ID)
+}
+
+// enqueue ставит идентификатор задачи в очередь обработки.
+func (q *Queue) enqueue(ctx context.Context, id string) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		return ErrClosed
+	}
+	return q.send(ctx, id)
+}
+
+// send запускает обработчики и передаёт им идентификатор задачи.
+// Вызывается под q.mu в открытой очереди.
+func (q *Queue) send(ctx context.Context, id string) error {
+	q.start()
+	select {
+	case q.queue <- id:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown прекращает приём задач и дожидается выполнения поставленных в очередь.
+// Если ctx отменяется раньше, обработка прерывается, а прогресс задач сохраняется,
+// чтобы продолжить их после перезапуска.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		q.stop()
+		<-done
+		err = ctx.Err()
+	}
+
+	if q.batcher != nil {
+		q.batcher.Close()
+	}
+	return err
+}
+
+// work обрабатывает задачи из очереди до её закрытия.
+func (q *Queue) work() {
+	defer q.wg.Done()
+
+	for id := range q.queue {
+		if q.ctx.Err() != nil {
+			return
+		}
+		if err := q.run(id); err != nil {
+			logger.Log.Error("Failed to run job", zap.String("job", id), zap.Error(err))
+		}
+	}
+}
+
+// run выполняет задачу с идентификатором id частями, начиная с первого
+// необработанного идентификатора ссылки, и сохраняет прогресс после каждой части.
+func (q *Queue) run(id string) error {
+	job, err := q.store.GetJob(q.ctx, id)
+	if err != nil {
+		return err
+	}
+	if job.Finished() {
+		return nil
+	}
+
+	job.Status = models.JobRunning
+	if err := q.save(&job); err != nil {
+		return err
+	}
+
+	for job.Processed < len(job.IDs) {
+		if q.ctx.Err() != nil {
+			// Очередь остановлена: сохраняем прогресс для продолжения после перезапуска.
+			return q.save(&job)
+		}
+
+		end := min(job.Processed+q.batcher.FlushSize(), len(job.IDs))
+		chunk := job.IDs[job.Processed:end]
+		// Отсутствующие и чужие ссылки удалить нельзя, поэтому они тоже
+		// попадают в ошибки задачи.
+		failed, reason := q.process(job, chunk)
+		if reason != nil {
+			if q.ctx.Err() != nil {
+				// Часть не обработана из-за остановки и будет обработана повторно.
+				return q.save(&job)
+			}
+			failed = chunk
+		} else {
+			reason = storage.ErrNotFound
+		}
+		for _, urlID := range failed {
+			if job.Failures == nil {
+				job.Failures = make(map[string]string)
+			}
+			job.Failures[urlID] = reason.Error()
+		}
+		job.Processed = end
+
+		if job.Processed < len(job.IDs) {
+			if err := q.save(&job); err != nil {
+				return err
+			}
+		}
+	}
+
+	job.Status = models.JobDone
+	if len(job.Failures) > 0 {
+		job.Status = models.JobFailed
+	}
+	return q.save(&job)
+}
+
+// process удаляет часть ссылок задачи, повторяя попытки при ошибках,
+// и возвращает идентификаторы, которых нет среди ссылок пользователя.
+func (q *Queue) process(job models.Job, ids []string) ([]string, error) {
+	var err error
+	for attempt := 1; attempt <= q.MaxAttempts; attempt++ {
+		var missing []string
+		if missing, err = q.batcher.Delete(q.ctx, job.UserID, ids); err == nil {
+			return missing, nil
+		}
+		logger.Log.Debug("Job step failed",
+			zap.String("job", job.ID), zap.Int("ids", len(ids)), zap.Int("attempt", attempt), zap.Error(err))
+
+		if attempt < q.MaxAttempts {
+			select {
+			case <-time.After(time.Duration(attempt) * q.RetryDelay):
+			case <-q.ctx.Done():
+				return nil, q.ctx.Err()
+			}
+		}
+	}
+	return nil, err
+}
+
+// save сохраняет текущее состояние задачи. Используется фоновый контекст,
+// чтобы прогресс сохранялся и при прерывании обработки.
+func (q *Queue) save(job *models.Job) error {
+	job.UpdatedAt = time.Now().UTC()
+	return q.store.SaveJob(context.Background(), *job)
+}
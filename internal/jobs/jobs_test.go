@@ -0,0 +1,119 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+)
+
+// flakyStorage отказывает в удалении указанных ссылок заданное число раз.
+type flakyStorage struct {
+	*storage.MemoryStorage
+
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func (s *flakyStorage) BatchDeleteURLs(ctx context.Context, userID string, ids []string) ([]string, error) {
+	s.mu.Lock()
+	for _, id := range ids {
+		if s.failures[id] > 0 {
+			s.failures[id]--
+			s.mu.Unlock()
+			return nil, errors.New("temporary failure")
+		}
+	}
+	s.mu.Unlock()
+	return s.MemoryStorage.BatchDeleteURLs(ctx, userID, ids)
+}
+
+func saveURLs(t *testing.T, s storage.Storage, userID string, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		_, err := s.SaveURL(context.Background(), &models.URLData{ShortURL: id, OriginalURL: "https://example.com/" + id, UserUUID: userID})
+		require.NoError(t, err)
+	}
+}
+
+func TestQueueDelete(t *testing.T) {
+	ctx := context.Background()
+	store := &flakyStorage{
+		MemoryStorage: storage.NewMemoryStorage(),
+		failures:      map[string]int{"retried": 2, "broken": 100},
+	}
+	saveURLs(t, store, "user", "plain", "retried", "broken")
+	saveURLs(t, store, "other", "foreign")
+
+	// Каждая часть задачи состоит из одного идентификатора,
+	// поэтому ошибки не распространяются на соседние ссылки.
+	q := NewQueue(store, 1, WithFlushSize(1), WithFlushInterval(time.Millisecond))
+	q.RetryDelay = time.Millisecond
+
+	job, err := q.EnqueueDelete(ctx, "user", []string{"plain", "retried", "broken", "foreign", "unknown"})
+	require.NoError(t, err)
+	require.NoError(t, q.Shutdown(ctx))
+
+	got, err := store.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobFailed, got.Status)
+	assert.Equal(t, 5, got.Processed)
+	assert.Equal(t, map[string]string{
+		"broken":  "temporary failure",
+		"foreign": storage.ErrNotFound.Error(),
+		"unknown": storage.ErrNotFound.Error(),
+	}, got.Failures)
+
+	for id, deleted := range map[string]bool{"plain": true, "retried": true, "broken": false, "foreign": false} {
+		data, err := store.GetOriginalURL(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, deleted, data.DeletedFlag, id)
+	}
+
+	// Остановленная очередь не сохраняет новые задачи.
+	_, err = q.EnqueueDelete(ctx, "user", []string{"plain"})
+	assert.ErrorIs(t, err, ErrClosed)
+	unfinished, err := store.GetUnfinishedJobs(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, unfinished)
+}
+
+func TestQueueResume(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	saveURLs(t, store, "user", "first", "second")
+
+	// Задача, прерванная остановкой сервиса после обработки первой ссылки.
+	require.NoError(t, store.SaveJob(ctx, models.Job{
+		ID:        "interrupted",
+		Kind:      models.JobKindDelete,
+		UserID:    "user",
+		IDs:       []string{"first", "second"},
+		Status:    models.JobRunning,
+		Processed: 1,
+		CreatedAt: time.Now(),
+	}))
+
+	q := NewQueue(store, 1, WithFlushInterval(time.Millisecond))
+	require.NoError(t, q.Resume(ctx))
+	require.NoError(t, q.Shutdown(ctx))
+
+	job, err := store.GetJob(ctx, "interrupted")
+	require.NoError(t, err)
+	assert.Equal(t, models.JobDone, job.Status)
+	assert.Equal(t, 2, job.Processed)
+
+	first, err := store.GetOriginalURL(ctx, "first")
+	require.NoError(t, err)
+	assert.False(t, first.DeletedFlag, "processed IDs are not repeated")
+	second, err := store.GetOriginalURL(ctx, "second")
+	require.NoError(t, err)
+	assert.True(t, second.DeletedFlag)
+}
@@ -5,12 +5,14 @@ package middlewares
 
 import (
 	"context"
+	"errors"
 	"github.com/sol1corejz/go-url-shortener/internal/auth"
 	"github.com/sol1corejz/go-url-shortener/internal/logger"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"net"
 	"net/http"
@@ -19,12 +21,6 @@ import (
 	"github.com/sol1corejz/go-url-shortener/cmd/gzip"
 )
 
-// Тип для userID в контексте
-type contextUserID string
-
-// Ключ для userID
-const userIDKey contextUserID = "userID"
-
 // GzipMiddleware — это промежуточный обработчик (middleware), который проверяет,
 // поддерживает ли клиент сжатие данных с использованием Gzip, и если поддерживает,
 // применяет сжатие для ответа. Если же запрос содержит сжатые данные, то он их
@@ -100,52 +96,140 @@ func TrustedSubnetMiddleware(subnet string, h http.HandlerFunc) http.HandlerFunc
 	}
 }
 
-// AuthInterceptor проверяет наличие и валидность токена только для определённых методов.
-func AuthInterceptor(protectedMethods []string) grpc.UnaryServerInterceptor {
+// TrustedSubnetInterceptor допускает к методам из methods только клиентов,
+// IP которых входит в доверенную подсеть. IP берётся из адреса соединения,
+// а не из метаданных, которые задаёт сам клиент. Если подсеть не задана
+// или некорректна, эти методы недоступны.
+func TrustedSubnetInterceptor(subnet string, methods []string) grpc.UnaryServerInterceptor {
+	restricted := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		restricted[method] = true
+	}
+	_, trustedNet, err := net.ParseCIDR(subnet)
+
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		// Проверяем, требует ли метод авторизации.
-		if !requiresAuth(info.FullMethod, protectedMethods) {
-			return handler(ctx, req) // Если авторизация не требуется, просто передаем запрос дальше
+		if !restricted[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		if err != nil {
+			return nil, status.Error(codes.PermissionDenied, "forbidden")
 		}
 
-		// Извлечение токена из метаданных запроса.
-		var token string
-		if md, ok := metadata.FromIncomingContext(ctx); ok {
-			values := md.Get("token")
-			if len(values) > 0 {
-				token = values[0]
-			}
+		ip := peerIP(ctx)
+		if ip == nil || !trustedNet.Contains(ip) {
+			logger.Log.Info("Untrusted client", zap.String("method", info.FullMethod))
+			return nil, status.Error(codes.PermissionDenied, "forbidden")
 		}
+		return handler(ctx, req)
+	}
+}
 
-		if len(token) == 0 {
-			// Если токен отсутствует, возвращаем ошибку Unauthorized.
-			logger.Log.Info("Missing token in request", zap.String("method", info.FullMethod))
-			return nil, status.Error(codes.Unauthenticated, "missing token")
+// peerIP возвращает IP-адрес клиента gRPC-соединения или nil, если он неизвестен.
+func peerIP(ctx context.Context) net.IP {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return nil
+	}
+	if addr, ok := p.Addr.(*net.TCPAddr); ok {
+		return addr.IP
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// APIKeyAuthenticator проверяет ключ API и его право scope и возвращает
+// идентификатор пользователя, от имени которого действует ключ.
+type APIKeyAuthenticator func(ctx context.Context, key, scope string) (string, error)
+
+// AuthInterceptor проверяет токен или ключ API для методов из protectedMethods
+// (полное имя метода → право, необходимое ключу API) и передаёт идентификатор
+// пользователя обработчику через контекст (см. auth.UserIDFromContext).
+// Токен доступа передаётся в метаданных token, ключ API — в метаданных
+// x-api-key или authorization со схемой Bearer.
+func AuthInterceptor(protectedMethods map[string]string, apiKeys APIKeyAuthenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, info.FullMethod, protectedMethods, apiKeys)
+		if err != nil {
+			return nil, err
 		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamInterceptor выполняет для потоковых методов ту же проверку, что и AuthInterceptor.
+func AuthStreamInterceptor(protectedMethods map[string]string, apiKeys APIKeyAuthenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), info.FullMethod, protectedMethods, apiKeys)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticatedStream — поток gRPC с контекстом, содержащим идентификатор пользователя.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
 
+// Context возвращает контекст потока с идентификатором пользователя.
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticate проверяет токен или ключ API из метаданных запроса к методу,
+// если метод требует авторизации, и возвращает контекст с идентификатором пользователя.
+func authenticate(ctx context.Context, method string, protectedMethods map[string]string, apiKeys APIKeyAuthenticator) (context.Context, error) {
+	// Проверяем, требует ли метод авторизации.
+	scope, ok := protectedMethods[method]
+	if !ok {
+		return ctx, nil
+	}
+
+	// Извлечение токена или ключа API из метаданных запроса.
+	md, _ := metadata.FromIncomingContext(ctx)
+	if token := firstValue(md, "token"); token != "" {
 		// Проверка токена.
 		userID := auth.GetUserID(token)
 		if userID == "" {
-			// Если токен недействителен, возвращаем ошибку Unauthorized.
-			logger.Log.Info("Invalid token", zap.String("method", info.FullMethod), zap.String("token", token))
+			logger.Log.Info("Invalid token", zap.String("method", method))
 			return nil, status.Error(codes.Unauthenticated, "invalid token")
 		}
+		return auth.WithUserID(ctx, userID), nil
+	}
 
-		// Добавляем userID в контекст, чтобы другие обработчики могли его использовать.
-		ctx = context.WithValue(ctx, userIDKey, userID)
+	key := firstValue(md, "x-api-key")
+	if scheme, value, ok := strings.Cut(firstValue(md, "authorization"), " "); key == "" && ok && strings.EqualFold(scheme, "Bearer") {
+		key = strings.TrimSpace(value)
+	}
+	if key == "" {
+		// Если токен отсутствует, возвращаем ошибку Unauthorized.
+		logger.Log.Info("Missing token in request", zap.String("method", method))
+		return nil, status.Error(codes.Unauthenticated, "missing token")
+	}
 
-		// Пропускаем запрос дальше.
-		return handler(ctx, req)
+	userID, err := apiKeys(ctx, key, scope)
+	switch {
+	case errors.Is(err, auth.ErrInvalidAPIKey):
+		logger.Log.Info("Invalid API key", zap.String("method", method))
+		return nil, status.Error(codes.Unauthenticated, "invalid API key")
+	case errors.Is(err, auth.ErrInsufficientScope):
+		return nil, status.Error(codes.PermissionDenied, "insufficient API key scope")
+	case err != nil:
+		logger.Log.Error("Failed to check API key", zap.String("method", method), zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to check API key")
 	}
+	return auth.WithUserID(ctx, userID), nil
 }
 
-// requiresAuth проверяет, требует ли метод авторизации.
-func requiresAuth(method string, protectedMethods []string) bool {
-	for _, protectedMethod := range protectedMethods {
-		// Проверяем, совпадает ли метод с одним из защищённых.
-		if strings.HasPrefix(method, protectedMethod) {
-			return true
-		}
+// firstValue возвращает первое значение метаданных key или пустую строку.
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
 	}
-	return false
+	return ""
 }
@@ -0,0 +1,97 @@
+package middlewares
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/sol1corejz/go-url-shortener/internal/auth"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthInterceptor(t *testing.T) {
+	apiKeys := func(_ context.Context, key, scope string) (string, error) {
+		switch {
+		case key != "valid-key":
+			return "", auth.ErrInvalidAPIKey
+		case scope != models.ScopeRead:
+			return "", auth.ErrInsufficientScope
+		}
+		return "key-owner", nil
+	}
+	interceptor := AuthInterceptor(map[string]string{
+		"/proto.Shortener/GetUserURLs": models.ScopeRead,
+		"/proto.Shortener/BatchDelete": models.ScopeDelete,
+	}, apiKeys)
+
+	token, err := auth.GenerateToken()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		method   string
+		md       metadata.MD
+		wantUser string
+		wantCode codes.Code
+	}{
+		{name: "public method", method: "/proto.Shortener/GetURL", wantCode: codes.OK},
+		{name: "missing token", method: "/proto.Shortener/GetUserURLs", wantCode: codes.Unauthenticated},
+		{name: "token", method: "/proto.Shortener/GetUserURLs", md: metadata.Pairs("token", token), wantUser: auth.GetUserID(token), wantCode: codes.OK},
+		{name: "invalid token", method: "/proto.Shortener/GetUserURLs", md: metadata.Pairs("token", "invalid"), wantCode: codes.Unauthenticated},
+		{name: "api key", method: "/proto.Shortener/GetUserURLs", md: metadata.Pairs("x-api-key", "valid-key"), wantUser: "key-owner", wantCode: codes.OK},
+		{name: "bearer api key", method: "/proto.Shortener/GetUserURLs", md: metadata.Pairs("authorization", "Bearer valid-key"), wantUser: "key-owner", wantCode: codes.OK},
+		{name: "invalid api key", method: "/proto.Shortener/GetUserURLs", md: metadata.Pairs("x-api-key", "other"), wantCode: codes.Unauthenticated},
+		{name: "insufficient scope", method: "/proto.Shortener/BatchDelete", md: metadata.Pairs("x-api-key", "valid-key"), wantCode: codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			var gotUser string
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, func(ctx context.Context, _ interface{}) (interface{}, error) {
+				gotUser = auth.UserIDFromContext(ctx)
+				return nil, nil
+			})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.wantUser, gotUser)
+		})
+	}
+}
+
+func TestTrustedSubnetInterceptor(t *testing.T) {
+	admin := "/proto.Shortener/RevokeUserTokens"
+	tests := []struct {
+		name     string
+		subnet   string
+		method   string
+		addr     net.Addr
+		md       metadata.MD
+		wantCode codes.Code
+	}{
+		{name: "other method", subnet: "10.0.0.0/8", method: "/proto.Shortener/GetURL", wantCode: codes.OK},
+		{name: "trusted", subnet: "10.0.0.0/8", method: admin, addr: &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 5000}, wantCode: codes.OK},
+		{name: "untrusted", subnet: "10.0.0.0/8", method: admin, addr: &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 5000}, wantCode: codes.PermissionDenied},
+		{name: "spoofed x-real-ip", subnet: "10.0.0.0/8", method: admin, addr: &net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 5000}, md: metadata.Pairs("x-real-ip", "10.1.2.3"), wantCode: codes.PermissionDenied},
+		{name: "missing peer", subnet: "10.0.0.0/8", method: admin, md: metadata.Pairs("x-real-ip", "10.1.2.3"), wantCode: codes.PermissionDenied},
+		{name: "no subnet", method: admin, addr: &net.TCPAddr{IP: net.ParseIP("10.1.2.3"), Port: 5000}, wantCode: codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interceptor := TrustedSubnetInterceptor(tt.subnet, []string{admin})
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			if tt.addr != nil {
+				ctx = peer.NewContext(ctx, &peer.Peer{Addr: tt.addr})
+			}
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, func(context.Context, interface{}) (interface{}, error) {
+				return nil, nil
+			})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
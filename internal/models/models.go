@@ -3,12 +3,24 @@
 // информации о сокращённых URL.
 package models
 
+import "time"
+
 // Request представляет структуру для обработки входящих запросов на создание
 // сокращённого URL. Содержит одно поле URL, которое является оригинальной
 // ссылкой, которую необходимо сократить.
 type Request struct {
 	// URL — оригинальный URL, который нужно сократить.
 	URL string `json:"url"`
+
+	// Alias — необязательный пользовательский идентификатор короткой ссылки.
+	// Если не задан, идентификатор генерируется автоматически.
+	Alias string `json:"alias,omitempty"`
+
+	// ExpiresAt — необязательный момент, после которого ссылка перестаёт действовать.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// TTL — необязательное время жизни ссылки в секундах, не больше 100 лет. Не может быть задано вместе с ExpiresAt.
+	TTL int64 `json:"ttl,omitempty"`
 }
 
 // Response представляет структуру для ответа на запрос создания сокращённого URL.
@@ -42,6 +54,116 @@ type URLData struct {
 	// DeletedFlag — флаг, указывающий на то, был ли удалён этот URL.
 	// Если значение true, URL был удалён.
 	DeletedFlag bool `json:"is_deleted"`
+
+	// CreatedAt — момент создания ссылки.
+	CreatedAt time.Time `json:"created_at"`
+
+	// DeletedAt — момент удаления ссылки. После истечения срока хранения
+	// удалённые ссылки удаляются окончательно.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// ExpiresAt — момент истечения срока действия ссылки.
+	// Если значение nil, ссылка действует бессрочно.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Alias — короткий идентификатор задан пользователем. Ссылка с псевдонимом
+	// сохраняется без поиска дубликатов: пользователь запрашивает именно этот
+	// идентификатор, даже если URL уже сокращён.
+	Alias bool `json:"alias,omitempty"`
+}
+
+// Expired сообщает, истёк ли срок действия ссылки к моменту now.
+func (d URLData) Expired(now time.Time) bool {
+	return d.ExpiresAt != nil && !d.ExpiresAt.After(now)
+}
+
+// Active сообщает, действует ли ссылка в момент now: она не удалена
+// и срок её действия не истёк.
+func (d URLData) Active(now time.Time) bool {
+	return !d.DeletedFlag && !d.Expired(now)
+}
+
+// UserURL — ссылка пользователя с количеством переходов.
+type UserURL struct {
+	URLData
+
+	// Clicks — количество переходов по ссылке.
+	Clicks int `json:"clicks"`
+}
+
+// URLSort — поле сортировки списка ссылок пользователя.
+type URLSort string
+
+// Поля сортировки списка ссылок пользователя.
+const (
+	URLSortCreated URLSort = "created" // По моменту создания.
+	URLSortClicks  URLSort = "clicks"  // По количеству переходов.
+)
+
+// URLStatusFilter — фильтр списка ссылок пользователя по удалению.
+type URLStatusFilter string
+
+// Фильтры списка ссылок пользователя по удалению.
+const (
+	URLStatusAll     URLStatusFilter = "all"     // Все ссылки.
+	URLStatusActive  URLStatusFilter = "active"  // Только неудалённые ссылки.
+	URLStatusDeleted URLStatusFilter = "deleted" // Только удалённые ссылки.
+)
+
+// URLCursor — позиция последней ссылки страницы, после которой
+// начинается следующая страница. Значимо только поле, соответствующее сортировке.
+type URLCursor struct {
+	CreatedAt time.Time
+	Clicks    int
+	ShortURL  string
+	// Total — количество ссылок, посчитанное для первой страницы;
+	// хранилище возвращает его для следующих страниц без повторного подсчёта.
+	Total int
+}
+
+// URLListQuery — параметры постраничного списка ссылок пользователя.
+type URLListQuery struct {
+	// Limit — максимальное количество ссылок на странице.
+	Limit int
+	// Sort — поле сортировки; ссылки с равными значениями упорядочиваются по ShortURL.
+	Sort URLSort
+	// Desc — сортировка по убыванию.
+	Desc bool
+	// Status — фильтр по удалению.
+	Status URLStatusFilter
+	// Search — подстрока оригинального URL без учёта регистра; пустая строка отключает поиск.
+	Search string
+	// After — позиция, после которой начинается страница; nil для первой страницы.
+	After *URLCursor
+}
+
+// URLPage — страница списка ссылок пользователя.
+type URLPage struct {
+	// URLs — ссылки страницы.
+	URLs []UserURL
+	// Total — количество ссылок, удовлетворяющих фильтрам, на всех страницах.
+	// Может быть взято из курсора запроса, то есть посчитано для первой страницы.
+	Total int
+	// Next — позиция для запроса следующей страницы; nil, если страница последняя.
+	Next *URLCursor
+}
+
+// ExportedURL — строка выгрузки ссылок пользователя.
+type ExportedURL struct {
+	// ShortURL — сокращённый URL.
+	ShortURL string `json:"short_url"`
+
+	// OriginalURL — оригинальный URL.
+	OriginalURL string `json:"original_url"`
+
+	// CreatedAt — момент создания ссылки.
+	CreatedAt time.Time `json:"created_at"`
+
+	// DeletedFlag — признак удалённой ссылки.
+	DeletedFlag bool `json:"is_deleted"`
+
+	// Clicks — количество переходов по ссылке.
+	Clicks int `json:"clicks"`
 }
 
 // BatchRequest представляет структуру для пакетных запросов на создание
@@ -53,6 +175,12 @@ type BatchRequest struct {
 
 	// OriginalURL — оригинальный URL, который необходимо сократить в пакетном запросе.
 	OriginalURL string `json:"original_url"`
+
+	// ExpiresAt — необязательный момент, после которого ссылка перестаёт действовать.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// TTL — необязательное время жизни ссылки в секундах, не больше 100 лет. Не может быть задано вместе с ExpiresAt.
+	TTL int64 `json:"ttl,omitempty"`
 }
 
 // BatchResponse представляет структуру для ответа на пакетный запрос,
@@ -63,8 +191,25 @@ type BatchResponse struct {
 
 	// ShortURL — сокращённый URL, который был создан в результате пакетного запроса.
 	ShortURL string `json:"short_url"`
+
+	// Status — результат обработки элемента пакета.
+	Status BatchStatus `json:"status"`
+
+	// Error — причина, по которой элемент пакета признан некорректным.
+	Error string `json:"error,omitempty"`
 }
 
+// BatchStatus — результат обработки элемента пакетного запроса.
+type BatchStatus string
+
+// Результаты обработки элемента пакетного запроса.
+const (
+	BatchCreated  BatchStatus = "created"  // Создана новая ссылка.
+	BatchExisting BatchStatus = "existing" // URL уже сокращён, возвращена существующая ссылка.
+	BatchInvalid  BatchStatus = "invalid"  // Элемент содержит некорректный URL или срок действия.
+	BatchSkipped  BatchStatus = "skipped"  // Элемент не сохранён, так как пакет отклонён целиком.
+)
+
 // InternalStatsResponse представляет структуру для ответа на запрос,
 // возвращая количество сокращенных URL и количество пользователей.
 type InternalStatsResponse struct {
@@ -73,4 +218,346 @@ type InternalStatsResponse struct {
 
 	// URLs — количество пользователей
 	Users int `json:"users"`
+
+	// Cache — счётчики кэша переходов, если он включён.
+	Cache *CacheStats `json:"cache,omitempty"`
+}
+
+// CacheStats содержит счётчики кэша переходов.
+type CacheStats struct {
+	// Hits — количество запросов, обслуженных из кэша, включая кэшированное отсутствие ссылки.
+	Hits int64 `json:"hits"`
+
+	// Misses — количество запросов, потребовавших обращения к хранилищу.
+	Misses int64 `json:"misses"`
+
+	// Evictions — количество записей, вытесненных из-за ограничения размера.
+	Evictions int64 `json:"evictions"`
+
+	// Size — текущее количество записей в кэше.
+	Size int `json:"size"`
+}
+
+// URLChange представляет запись истории изменений короткой ссылки:
+// оригинальный URL, на который она указывала до замены.
+type URLChange struct {
+	// ShortURL — короткий идентификатор изменённой ссылки.
+	ShortURL string `json:"short_url"`
+
+	// OriginalURL — предыдущий оригинальный URL.
+	OriginalURL string `json:"original_url"`
+
+	// ChangedAt — момент замены.
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// UpdateURLResponse представляет ответ на изменение оригинального URL ссылки.
+type UpdateURLResponse struct {
+	// ShortURL — сокращённый URL.
+	ShortURL string `json:"short_url"`
+
+	// OriginalURL — новый оригинальный URL.
+	OriginalURL string `json:"original_url"`
+
+	// History — предыдущие оригинальные URL в порядке их замены.
+	History []URLChange `json:"history"`
+}
+
+// RestoreResponse представляет ответ на восстановление удалённых ссылок.
+type RestoreResponse struct {
+	// Restored — количество восстановленных ссылок.
+	Restored int `json:"restored"`
+}
+
+// Click представляет событие перехода по короткой ссылке.
+type Click struct {
+	// ShortURL — короткий идентификатор ссылки, по которой выполнен переход.
+	ShortURL string `json:"short_url"`
+
+	// Timestamp — момент перехода.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Referrer — значение заголовка Referer запроса.
+	Referrer string `json:"referrer,omitempty"`
+
+	// UserAgent — значение заголовка User-Agent запроса.
+	UserAgent string `json:"user_agent,omitempty"`
+
+	// IPHash — хеш IP-адреса клиента. Сам адрес не сохраняется.
+	IPHash string `json:"ip_hash,omitempty"`
+}
+
+// DailyClicks представляет количество переходов за один день (UTC).
+type DailyClicks struct {
+	// Date — дата в формате YYYY-MM-DD.
+	Date string `json:"date"`
+
+	// Clicks — количество переходов за день.
+	Clicks int `json:"clicks"`
+}
+
+// ClickStats представляет статистику переходов по короткой ссылке.
+type ClickStats struct {
+	// Total — общее количество переходов.
+	Total int `json:"total"`
+
+	// Days — количество переходов по дням в порядке возрастания даты.
+	Days []DailyClicks `json:"days"`
+}
+
+// JobStatus — состояние фоновой задачи.
+type JobStatus string
+
+// Состояния фоновой задачи.
+const (
+	// JobPending — задача поставлена в очередь и ещё не выполнялась.
+	JobPending JobStatus = "pending"
+	// JobRunning — задача выполняется или была прервана остановкой сервиса.
+	JobRunning JobStatus = "running"
+	// JobDone — задача выполнена для всех идентификаторов.
+	JobDone JobStatus = "done"
+	// JobFailed — задача завершена, но часть идентификаторов обработать не удалось.
+	JobFailed JobStatus = "failed"
+)
+
+// JobKindDelete — вид задачи пакетного удаления ссылок.
+const JobKindDelete = "delete"
+
+// Job представляет фоновую задачу над списком коротких ссылок пользователя.
+type Job struct {
+	// ID — уникальный идентификатор задачи.
+	ID string `json:"id"`
+
+	// Kind — вид задачи, например JobKindDelete.
+	Kind string `json:"kind"`
+
+	// UserID — идентификатор пользователя, создавшего задачу.
+	UserID string `json:"user_id"`
+
+	// IDs — короткие идентификаторы ссылок, которые нужно обработать.
+	IDs []string `json:"ids"`
+
+	// Status — текущее состояние задачи.
+	Status JobStatus `json:"status"`
+
+	// Processed — количество уже обработанных идентификаторов.
+	// Идентификаторы обрабатываются по порядку, поэтому обработаны IDs[:Processed].
+	Processed int `json:"processed"`
+
+	// Failures — ошибки по идентификаторам, которые не удалось обработать,
+	// в том числе отсутствующим и чужим ссылкам.
+	Failures map[string]string `json:"failures,omitempty"`
+
+	// CreatedAt — момент создания задачи.
+	CreatedAt time.Time `json:"created_at"`
+
+	// UpdatedAt — момент последнего изменения задачи.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Finished сообщает, завершена ли задача.
+func (j Job) Finished() bool {
+	return j.Status == JobDone || j.Status == JobFailed
+}
+
+// Clone возвращает копию задачи, не разделяющую с ней срезы и словари.
+func (j Job) Clone() Job {
+	j.IDs = append([]string(nil), j.IDs...)
+	if j.Failures != nil {
+		failures := make(map[string]string, len(j.Failures))
+		for id, reason := range j.Failures {
+			failures[id] = reason
+		}
+		j.Failures = failures
+	}
+	return j
+}
+
+// RefreshToken — серверная запись токена обновления. Сам токен выдаётся
+// клиенту один раз и не хранится: запись ищется по его хэшу.
+type RefreshToken struct {
+	// ID — SHA-256 токена в шестнадцатеричной записи.
+	ID string `json:"id"`
+
+	// UserID — идентификатор пользователя, которому выдан токен.
+	UserID string `json:"user_id"`
+
+	// CreatedAt — момент выдачи токена.
+	CreatedAt time.Time `json:"created_at"`
+
+	// ExpiresAt — момент, после которого токен недействителен.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// RevokedAt — момент отзыва токена; nil, если токен не отозван.
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+
+	// Spent — отозванный токен больше нельзя обменять повторно:
+	// он уже обменян второй раз или отозван при выходе.
+	Spent bool `json:"spent,omitempty"`
+}
+
+// Active сообщает, действителен ли токен в момент now.
+func (t RefreshToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && now.Before(t.ExpiresAt)
+}
+
+// Reusable сообщает, можно ли в момент now ещё раз обменять токен,
+// отозванный меньше чем grace назад.
+func (t RefreshToken) Reusable(now time.Time, grace time.Duration) bool {
+	return t.RevokedAt != nil && !t.Spent && now.Before(t.RevokedAt.Add(grace)) && now.Before(t.ExpiresAt)
+}
+
+// RefreshResponse представляет ответ на обновление токена доступа.
+type RefreshResponse struct {
+	// Token — новый токен доступа. Он же устанавливается в cookie.
+	Token string `json:"token"`
+
+	// ExpiresAt — момент истечения токена доступа.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Account представляет зарегистрированную учётную запись пользователя.
+type Account struct {
+	// ID — идентификатор пользователя, которому принадлежат ссылки учётной записи.
+	ID string `json:"id"`
+
+	// Login — логин учётной записи в нижнем регистре.
+	Login string `json:"login"`
+
+	// PasswordHash — соленый хэш пароля.
+	PasswordHash string `json:"password_hash"`
+
+	// CreatedAt — момент регистрации.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Credentials представляет запрос на регистрацию или вход.
+type Credentials struct {
+	// Login — логин учётной записи.
+	Login string `json:"login"`
+
+	// Password — пароль учётной записи.
+	Password string `json:"password"`
+
+	// Claim — при входе перенести в учётную запись ссылки анонимного
+	// пользователя текущей сессии.
+	Claim bool `json:"claim,omitempty"`
+}
+
+// AuthResponse представляет ответ на регистрацию или вход.
+type AuthResponse struct {
+	// UserID — идентификатор пользователя учётной записи.
+	UserID string `json:"user_id"`
+
+	// Claimed — количество ссылок анонимного пользователя, перенесённых в учётную запись.
+	Claimed int `json:"claimed,omitempty"`
+
+	RefreshResponse
+}
+
+// Права ключей API.
+const (
+	// ScopeCreate — создание и изменение ссылок.
+	ScopeCreate = "create"
+	// ScopeRead — чтение ссылок, статистики и состояния задач.
+	ScopeRead = "read"
+	// ScopeDelete — удаление и восстановление ссылок.
+	ScopeDelete = "delete"
+)
+
+// Scopes — все права ключей API. Ключ, созданный без указания прав, получает их все.
+var Scopes = []string{ScopeCreate, ScopeRead, ScopeDelete}
+
+// APIKey — серверная запись ключа API для доступа к сервису без cookie.
+// Сам ключ выдаётся клиенту один раз и не хранится: хранится хэш его секретной части.
+type APIKey struct {
+	// ID — идентификатор ключа, входящий в сам ключ.
+	ID string `json:"id"`
+
+	// UserID — идентификатор пользователя, от имени которого действует ключ.
+	UserID string `json:"user_id"`
+
+	// Name — название ключа, заданное пользователем.
+	Name string `json:"name"`
+
+	// Hash — SHA-256 секретной части ключа в шестнадцатеричной записи.
+	Hash string `json:"hash"`
+
+	// Scopes — права ключа.
+	Scopes []string `json:"scopes"`
+
+	// CreatedAt — момент создания ключа.
+	CreatedAt time.Time `json:"created_at"`
+
+	// ExpiresAt — необязательный момент, после которого ключ недействителен.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired сообщает, истёк ли срок действия ключа к моменту now.
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && !k.ExpiresAt.After(now)
+}
+
+// HasScope сообщает, есть ли у ключа право scope.
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyRequest представляет запрос на создание ключа API.
+type APIKeyRequest struct {
+	// Name — название ключа.
+	Name string `json:"name"`
+
+	// Scopes — необязательные права ключа; по умолчанию все права.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// ExpiresAt — необязательный момент, после которого ключ недействителен.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// TTL — необязательное время жизни ключа в секундах. Не может быть задано вместе с ExpiresAt.
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// APIKeyResponse представляет ключ API в ответах сервиса.
+type APIKeyResponse struct {
+	// ID — идентификатор ключа.
+	ID string `json:"id"`
+
+	// Name — название ключа.
+	Name string `json:"name"`
+
+	// Key — сам ключ. Передаётся только в ответе на создание ключа.
+	Key string `json:"key,omitempty"`
+
+	// Scopes — права ключа.
+	Scopes []string `json:"scopes"`
+
+	// CreatedAt — момент создания ключа.
+	CreatedAt time.Time `json:"created_at"`
+
+	// ExpiresAt — момент, после которого ключ недействителен.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// TokenRevocation — запись об отзыве токенов доступа: одного токена
+// или всех токенов пользователя, выданных до момента отзыва.
+type TokenRevocation struct {
+	// TokenID — идентификатор (jti) отозванного токена. Пустой, если отозваны
+	// все токены пользователя UserID, выданные не позже RevokedAt.
+	TokenID string `json:"token_id,omitempty"`
+
+	// UserID — идентификатор пользователя, которому выданы токены.
+	UserID string `json:"user_id"`
+
+	// RevokedAt — момент отзыва.
+	RevokedAt time.Time `json:"revoked_at"`
+
+	// ExpiresAt — момент, после которого отозванные токены истекают сами
+	// и запись больше не нужна.
+	ExpiresAt time.Time `json:"expires_at"`
 }
@@ -0,0 +1,178 @@
+// Package shortid предоставляет стратегии генерации коротких идентификаторов
+// для сокращённых ссылок: случайную, последовательную и на основе хеша URL.
+package shortid
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync/atomic"
+)
+
+// alphabet — алфавит base62, используемый во всех стратегиях.
+const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// MaxAttempts — максимальное число попыток сгенерировать свободный идентификатор
+// при коллизиях с уже существующими ссылками.
+const MaxAttempts = 5
+
+// DefaultLength — длина идентификатора по умолчанию.
+const DefaultLength = 8
+
+// Названия стратегий генерации, используемые в конфигурации.
+const (
+	StrategyRandom     = "random"
+	StrategySequential = "sequential"
+	StrategyHash       = "hash"
+)
+
+// ErrExhausted — ошибка, которая возвращается, если за MaxAttempts попыток
+// не удалось получить свободный идентификатор.
+var ErrExhausted = errors.New("failed to generate unique short ID")
+
+// Generator генерирует короткие идентификаторы.
+type Generator interface {
+	// Generate возвращает идентификатор для оригинального URL. Номер попытки
+	// attempt начинается с нуля и увеличивается при каждой коллизии, чтобы
+	// детерминированные стратегии могли выдать другой идентификатор.
+	Generate(originalURL string, attempt int) (string, error)
+}
+
+// New создаёт генератор по названию стратегии. Для последовательной стратегии
+// seed задаёт начальное значение счётчика.
+func New(strategy string, length int, seed uint64) (Generator, error) {
+	if length <= 0 {
+		return nil, fmt.Errorf("invalid short ID length %d", length)
+	}
+	switch strategy {
+	case "", StrategyRandom:
+		return &RandomGenerator{Length: length}, nil
+	case StrategySequential:
+		return NewSequentialGenerator(length, seed), nil
+	case StrategyHash:
+		return &HashGenerator{Length: length}, nil
+	default:
+		return nil, fmt.Errorf("unknown short ID strategy %q", strategy)
+	}
+}
+
+// RandomGenerator генерирует случайные идентификаторы base62 заданной длины.
+type RandomGenerator struct {
+	Length int
+}
+
+// Generate возвращает случайный идентификатор. Ошибка возвращается,
+// если источник случайных чисел недоступен.
+func (g *RandomGenerator) Generate(_ string, _ int) (string, error) {
+	id := make([]byte, 0, g.Length)
+	buf := make([]byte, g.Length*2)
+	for len(id) < g.Length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("failed to read random bytes: %w", err)
+		}
+		for _, b := range buf {
+			// Отбрасываем значения, нарушающие равномерность распределения.
+			if int(b) >= 256-256%len(alphabet) {
+				continue
+			}
+			id = append(id, alphabet[int(b)%len(alphabet)])
+			if len(id) == g.Length {
+				break
+			}
+		}
+	}
+	return string(id), nil
+}
+
+// SequentialGenerator выдаёт идентификаторы на основе возрастающего счётчика,
+// закодированного в base62 и дополненного нулями слева до заданной длины.
+type SequentialGenerator struct {
+	Length  int
+	counter atomic.Uint64
+}
+
+// NewSequentialGenerator создаёт последовательный генератор, счётчик
+// которого начинается после значения seed.
+func NewSequentialGenerator(length int, seed uint64) *SequentialGenerator {
+	g := &SequentialGenerator{Length: length}
+	g.counter.Store(seed)
+	return g
+}
+
+// Generate возвращает следующий идентификатор последовательности.
+func (g *SequentialGenerator) Generate(_ string, _ int) (string, error) {
+	id := encode(new(big.Int).SetUint64(g.counter.Add(1)))
+	if len(id) < g.Length {
+		id = strings.Repeat(string(alphabet[0]), g.Length-len(id)) + id
+	}
+	return id, nil
+}
+
+// HashGenerator выдаёт идентификатор на основе хеша SHA-256 оригинального URL,
+// поэтому при первой попытке один и тот же URL получает один и тот же
+// идентификатор. При повторных попытках к хешу добавляется случайное значение:
+// если дедупликация отключена или ведётся по пользователю, идентификатор
+// первой попытки занят ссылкой на тот же URL, и номера попытки было бы
+// недостаточно, чтобы сократить URL больше MaxAttempts раз.
+type HashGenerator struct {
+	Length int
+}
+
+// Generate возвращает идентификатор, вычисленный по хешу URL, а при повторных
+// попытках — по хешу URL и случайного значения.
+func (g *HashGenerator) Generate(originalURL string, attempt int) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(originalURL))
+	if attempt > 0 {
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		h.Write(nonce)
+	}
+	id := encode(new(big.Int).SetBytes(h.Sum(nil)))
+	if len(id) > g.Length {
+		id = id[:g.Length]
+	}
+	return id, nil
+}
+
+// Decode разбирает идентификатор последовательной стратегии и возвращает
+// значение счётчика. Возвращает false, если идентификатор содержит символы
+// вне алфавита base62 или не помещается в uint64.
+func Decode(id string) (uint64, bool) {
+	if id == "" {
+		return 0, false
+	}
+	var n uint64
+	for i := 0; i < len(id); i++ {
+		digit := strings.IndexByte(alphabet, id[i])
+		if digit < 0 || n > (math.MaxUint64-uint64(digit))/uint64(len(alphabet)) {
+			return 0, false
+		}
+		n = n*uint64(len(alphabet)) + uint64(digit)
+	}
+	return n, true
+}
+
+// encode кодирует неотрицательное число в base62.
+func encode(n *big.Int) string {
+	if n.Sign() == 0 {
+		return string(alphabet[0])
+	}
+	base := big.NewInt(int64(len(alphabet)))
+	mod := new(big.Int)
+	var out []byte
+	for n = new(big.Int).Set(n); n.Sign() > 0; {
+		n.DivMod(n, base, mod)
+		out = append(out, alphabet[mod.Int64()])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
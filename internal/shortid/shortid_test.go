@@ -0,0 +1,127 @@
+package shortid
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func assertAlphabet(t *testing.T, id string) {
+	t.Helper()
+	for _, c := range id {
+		assert.True(t, strings.ContainsRune(alphabet, c), "unexpected character %q in %q", c, id)
+	}
+}
+
+func TestRandomGenerator(t *testing.T) {
+	g := &RandomGenerator{Length: 10}
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id, err := g.Generate("https://example.com", 0)
+		require.NoError(t, err)
+		assert.Len(t, id, 10)
+		assertAlphabet(t, id)
+		assert.False(t, seen[id], "duplicate id %q", id)
+		seen[id] = true
+	}
+}
+
+func TestSequentialGenerator(t *testing.T) {
+	g := NewSequentialGenerator(4, 60)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := g.Generate("", 0)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	assert.Equal(t, []string{"000z", "0010", "0011"}, ids)
+
+	// Длинные значения счётчика не обрезаются.
+	g = NewSequentialGenerator(1, 62*62)
+	id, err := g.Generate("", 0)
+	require.NoError(t, err)
+	assert.Equal(t, "101", id)
+}
+
+func TestDecode(t *testing.T) {
+	g := NewSequentialGenerator(4, 0)
+	for want := uint64(1); want <= 200; want++ {
+		id, err := g.Generate("", 0)
+		require.NoError(t, err)
+		got, ok := Decode(id)
+		require.True(t, ok)
+		assert.Equal(t, want, got)
+	}
+
+	_, ok := Decode("promo-2024")
+	assert.False(t, ok)
+	_, ok = Decode("zzzzzzzzzzzz")
+	assert.False(t, ok, "value overflows uint64")
+	_, ok = Decode("")
+	assert.False(t, ok)
+}
+
+func TestHashGenerator(t *testing.T) {
+	g := &HashGenerator{Length: 8}
+
+	first, err := g.Generate("https://example.com", 0)
+	require.NoError(t, err)
+	assert.Len(t, first, 8)
+	assertAlphabet(t, first)
+
+	again, err := g.Generate("https://example.com", 0)
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	retry, err := g.Generate("https://example.com", 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, retry)
+
+	// Повторные попытки не повторяются, поэтому URL можно сократить
+	// больше MaxAttempts раз.
+	again, err = g.Generate("https://example.com", 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, retry, again)
+
+	other, err := g.Generate("https://example.org", 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, other)
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		strategy string
+		length   int
+		want     Generator
+		wantErr  bool
+	}{
+		{strategy: "", length: 8, want: &RandomGenerator{}},
+		{strategy: StrategyRandom, length: 8, want: &RandomGenerator{}},
+		{strategy: StrategySequential, length: 8, want: &SequentialGenerator{}},
+		{strategy: StrategyHash, length: 8, want: &HashGenerator{}},
+		{strategy: "unknown", length: 8, wantErr: true},
+		{strategy: StrategyRandom, length: 0, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.strategy, func(t *testing.T) {
+			g, err := New(test.strategy, test.length, 0)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.IsType(t, test.want, g)
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	assert.Equal(t, "0", encode(big.NewInt(0)))
+	assert.Equal(t, "z", encode(big.NewInt(61)))
+	assert.Equal(t, "10", encode(big.NewInt(62)))
+}
@@ -0,0 +1,1095 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltOpenTimeout ограничивает ожидание блокировки файла базы,
+// открытой другим процессом.
+const boltOpenTimeout = time.Second
+
+// boltSweepBatch — количество ссылок, которые ExpireURLs и PurgeDeletedURLs
+// обрабатывают в одной транзакции, чтобы не задерживать надолго другие изменения.
+const boltSweepBatch = 1000
+
+// Бакеты базы BoltStorage.
+var (
+	urlsBucket       = []byte("urls")           // Короткий идентификатор → запись ссылки в JSON.
+	byOriginalBucket = []byte("by_original")    // Оригинальный URL, 0, короткий идентификатор → пусто.
+	byUserBucket     = []byte("by_user")        // Пользователь, 0, момент создания, короткий идентификатор → пусто.
+	byExpiresBucket  = []byte("by_expires_at")  // Момент истечения срока неудалённой ссылки, короткий идентификатор → пусто.
+	byDeletedBucket  = []byte("by_deleted_at")  // Момент удаления ссылки, короткий идентификатор → пусто.
+	clicksBucket     = []byte("clicks")         // Вложенный бакет ссылки: номер → событие перехода.
+	historyBucket    = []byte("history")        // Вложенный бакет ссылки: номер → изменение в JSON.
+	jobsBucket       = []byte("jobs")           // Идентификатор задачи → задача в JSON.
+	tokensBucket     = []byte("refresh_tokens") // Хэш токена обновления → запись токена в JSON.
+	accountsBucket   = []byte("accounts")       // Идентификатор пользователя → учётная запись в JSON.
+	loginsBucket     = []byte("logins")         // Логин → идентификатор пользователя.
+	apiKeysBucket    = []byte("api_keys")       // Идентификатор ключа API → запись ключа в JSON.
+	revokedBucket    = []byte("revoked")        // Идентификатор токена, 0, пользователь → запись об отзыве в JSON.
+)
+
+// errBatchTaken прерывает транзакцию пакета, в котором занят короткий идентификатор.
+var errBatchTaken = errors.New("batch short URL taken")
+
+// BoltStorage хранит сокращённые URL во встроенной базе bbolt — B-дереве
+// в одном файле. Данные не загружаются в память при запуске: ссылки
+// читаются по первичному ключу (короткому идентификатору), а дубликаты
+// и ссылки пользователя ищутся по индексам оригинального URL и пользователя.
+// Индекс пользователя упорядочен по моменту создания. Ссылки с истёкшим
+// сроком действия и давно удалённые ссылки находятся по индексам моментов
+// истечения срока и удаления. Каждое изменение выполняется в транзакции
+// и сбрасывается на диск при её фиксации.
+type BoltStorage struct {
+	db   *bolt.DB
+	opts options
+}
+
+// NewBoltStorage открывает базу path, создавая её при необходимости.
+func NewBoltStorage(path string, opts ...Option) (*BoltStorage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		// В базах, созданных до появления индексов моментов, они строятся по ссылкам.
+		buildTimeIndexes := tx.Bucket(urlsBucket) != nil && (tx.Bucket(byExpiresBucket) == nil || tx.Bucket(byDeletedBucket) == nil)
+		for _, name := range [][]byte{urlsBucket, byOriginalBucket, byUserBucket, byExpiresBucket, byDeletedBucket, clicksBucket, historyBucket, jobsBucket, tokensBucket, accountsBucket, loginsBucket, apiKeysBucket, revokedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if !buildTimeIndexes {
+			return nil
+		}
+		return scanURLs(tx, func(data models.URLData) error {
+			if bucket, key := timeIndexKey(&data); bucket != nil {
+				return tx.Bucket(bucket).Put(key, nil)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltStorage{db: db, opts: newOptions(opts)}, nil
+}
+
+// originalKey возвращает ключ ссылки в индексе оригинальных URL.
+func originalKey(data *models.URLData) []byte {
+	return append(append([]byte(data.OriginalURL), 0), data.ShortURL...)
+}
+
+// userPrefix возвращает префикс ключей ссылок пользователя в индексе пользователей.
+func userPrefix(userID string) []byte {
+	return append([]byte(userID), 0)
+}
+
+// userKey возвращает ключ ссылки в индексе пользователей.
+func userKey(data *models.URLData) []byte {
+	key := binary.BigEndian.AppendUint64(userPrefix(data.UserUUID), uint64(data.CreatedAt.UnixNano()))
+	return append(key, data.ShortURL...)
+}
+
+// shortIDFromUserKey возвращает короткий идентификатор из ключа индекса пользователей.
+func shortIDFromUserKey(key []byte, prefix []byte) string {
+	return string(key[len(prefix)+8:])
+}
+
+// timeIndexKey возвращает бакет индекса моментов, в который входит ссылка,
+// и её ключ в нём: неудалённая ссылка со сроком действия входит в индекс
+// истечения срока, удалённая — в индекс удаления. Возвращает nil, если
+// ссылка не входит ни в один из них.
+func timeIndexKey(data *models.URLData) (bucket, key []byte) {
+	var at time.Time
+	switch {
+	case data.DeletedFlag && data.DeletedAt != nil:
+		bucket, at = byDeletedBucket, *data.DeletedAt
+	case !data.DeletedFlag && data.ExpiresAt != nil:
+		bucket, at = byExpiresBucket, *data.ExpiresAt
+	default:
+		return nil, nil
+	}
+	key = binary.BigEndian.AppendUint64(nil, uint64(at.UnixNano()))
+	return bucket, append(key, data.ShortURL...)
+}
+
+// dueIndexKeys возвращает не больше boltSweepBatch первых ключей индекса
+// моментов bucket, момент которых раньше until, а если inclusive — не позже until.
+func dueIndexKeys(tx *bolt.Tx, bucket []byte, until time.Time, inclusive bool) [][]byte {
+	limit := until.UnixNano()
+	var keys [][]byte
+	c := tx.Bucket(bucket).Cursor()
+	for k, _ := c.First(); k != nil && len(keys) < boltSweepBatch; k, _ = c.Next() {
+		at := int64(binary.BigEndian.Uint64(k))
+		if at > limit || at == limit && !inclusive {
+			break
+		}
+		keys = append(keys, bytes.Clone(k))
+	}
+	return keys
+}
+
+// getURL читает ссылку по короткому идентификатору.
+func getURL(tx *bolt.Tx, shortID string) (models.URLData, bool, error) {
+	value := tx.Bucket(urlsBucket).Get([]byte(shortID))
+	if value == nil {
+		return models.URLData{}, false, nil
+	}
+	var data models.URLData
+	if err := json.Unmarshal(value, &data); err != nil {
+		return models.URLData{}, false, err
+	}
+	return data, true, nil
+}
+
+// putURL сохраняет ссылку и обновляет индексы. prev — прежняя запись ссылки, если она была.
+func putURL(tx *bolt.Tx, data models.URLData, prev *models.URLData) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if prev != nil {
+		if err := deleteIndexes(tx, prev); err != nil {
+			return err
+		}
+	}
+	if err := tx.Bucket(urlsBucket).Put([]byte(data.ShortURL), value); err != nil {
+		return err
+	}
+	if err := tx.Bucket(byOriginalBucket).Put(originalKey(&data), nil); err != nil {
+		return err
+	}
+	if bucket, key := timeIndexKey(&data); bucket != nil {
+		if err := tx.Bucket(bucket).Put(key, nil); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(byUserBucket).Put(userKey(&data), nil)
+}
+
+// deleteIndexes удаляет ссылку из всех индексов.
+func deleteIndexes(tx *bolt.Tx, data *models.URLData) error {
+	if err := tx.Bucket(byOriginalBucket).Delete(originalKey(data)); err != nil {
+		return err
+	}
+	if bucket, key := timeIndexKey(data); bucket != nil {
+		if err := tx.Bucket(bucket).Delete(key); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(byUserBucket).Delete(userKey(data))
+}
+
+// removeURL окончательно удаляет ссылку вместе с индексами, переходами и историей.
+func removeURL(tx *bolt.Tx, data models.URLData) error {
+	id := []byte(data.ShortURL)
+	for _, name := range [][]byte{clicksBucket, historyBucket} {
+		if err := tx.Bucket(name).DeleteBucket(id); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+	}
+	if err := deleteIndexes(tx, &data); err != nil {
+		return err
+	}
+	return tx.Bucket(urlsBucket).Delete(id)
+}
+
+// findDuplicate ищет по индексу оригинальных URL ранее созданную ссылку
+// с тем же оригинальным URL в соответствии с режимом дедупликации.
+// Удалённые ссылки и ссылки с истёкшим сроком действия не считаются
+// дубликатами; из нескольких
+// подходящих выбирается самая ранняя. Возвращает пустую строку, если дубликата нет.
+func (s *BoltStorage) findDuplicate(tx *bolt.Tx, event *models.URLData, now time.Time) (string, error) {
+	if s.opts.dedup != DedupGlobal && s.opts.dedup != DedupPerUser {
+		return "", nil
+	}
+
+	prefix := append([]byte(event.OriginalURL), 0)
+	var found *models.URLData
+	c := tx.Bucket(byOriginalBucket).Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		data, ok, err := getURL(tx, string(k[len(prefix):]))
+		if err != nil {
+			return "", err
+		}
+		if !ok || !data.Active(now) || (s.opts.dedup == DedupPerUser && data.UserUUID != event.UserUUID) {
+			continue
+		}
+		if found == nil || compareCursors(
+			models.URLCursor{CreatedAt: data.CreatedAt, ShortURL: data.ShortURL},
+			models.URLCursor{CreatedAt: found.CreatedAt, ShortURL: found.ShortURL},
+			models.URLSortCreated,
+		) < 0 {
+			found = &data
+		}
+	}
+	if found == nil {
+		return "", nil
+	}
+	return found.ShortURL, nil
+}
+
+// SaveURL сохраняет сокращённый URL в одной транзакции с поиском дубликата.
+// Для ссылки с псевдонимом (models.URLData.Alias) дубликаты не ищутся.
+func (s *BoltStorage) SaveURL(_ context.Context, event *models.URLData) (string, error) {
+	var existing string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if !event.Alias {
+			var err error
+			if existing, err = s.findDuplicate(tx, event, time.Now()); err != nil || existing != "" {
+				return err
+			}
+		}
+		if tx.Bucket(urlsBucket).Get([]byte(event.ShortURL)) != nil {
+			return ErrShortURLTaken
+		}
+		setCreatedAt(event)
+		return putURL(tx, *event, nil)
+	})
+	if err != nil {
+		return "", err
+	}
+	if existing != "" {
+		return existing, ErrAlreadyExists
+	}
+	return "", nil
+}
+
+// BatchSaveURLs сохраняет пакет ссылок одной транзакцией. Дубликаты ищутся
+// с учётом ссылок, добавленных ранее в этом же пакете. Если занят хотя бы
+// один короткий идентификатор, транзакция откатывается.
+func (s *BoltStorage) BatchSaveURLs(_ context.Context, urls []*models.URLData) ([]error, error) {
+	errs := make([]error, len(urls))
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		now := time.Now()
+		var taken bool
+		for i, data := range urls {
+			existing, err := s.findDuplicate(tx, data, now)
+			if err != nil {
+				return err
+			}
+			if existing != "" {
+				data.ShortURL, errs[i] = existing, ErrAlreadyExists
+				continue
+			}
+			if tx.Bucket(urlsBucket).Get([]byte(data.ShortURL)) != nil {
+				errs[i], taken = ErrShortURLTaken, true
+				continue
+			}
+			setCreatedAt(data)
+			if err := putURL(tx, *data, nil); err != nil {
+				return err
+			}
+		}
+		if taken {
+			return errBatchTaken
+		}
+		return nil
+	})
+	if errors.Is(err, errBatchTaken) {
+		return errs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// GetOriginalURL возвращает запись по короткому идентификатору.
+func (s *BoltStorage) GetOriginalURL(_ context.Context, shortID string) (models.URLData, error) {
+	var data models.URLData
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var ok bool
+		var err error
+		if data, ok, err = getURL(tx, shortID); err != nil {
+			return err
+		}
+		if !ok {
+			return ErrNotFound
+		}
+		return nil
+	})
+	return data, err
+}
+
+// forEachUserURL передаёт в fn ссылки пользователя в порядке создания.
+func forEachUserURL(tx *bolt.Tx, userID string, fn func(models.URLData) error) error {
+	prefix := userPrefix(userID)
+	c := tx.Bucket(byUserBucket).Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		data, ok, err := getURL(tx, shortIDFromUserKey(k, prefix))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countClicks возвращает количество переходов по ссылке.
+func countClicks(tx *bolt.Tx, shortID string) int {
+	b := tx.Bucket(clicksBucket).Bucket([]byte(shortID))
+	if b == nil {
+		return 0
+	}
+	return b.Stats().KeyN
+}
+
+// GetURLsByUser возвращает ссылки пользователя по индексу пользователей.
+func (s *BoltStorage) GetURLsByUser(_ context.Context, userID string) ([]models.URLData, error) {
+	var urls []models.URLData
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return forEachUserURL(tx, userID, func(data models.URLData) error {
+			urls = append(urls, data)
+			return nil
+		})
+	})
+	return urls, err
+}
+
+// ListUserURLs возвращает страницу ссылок пользователя. Ссылки пользователя
+// читаются по индексу, а фильтруются и сортируются при каждом запросе.
+func (s *BoltStorage) ListUserURLs(_ context.Context, userID string, query models.URLListQuery) (models.URLPage, error) {
+	var urls []models.UserURL
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return forEachUserURL(tx, userID, func(data models.URLData) error {
+			if matchesListQuery(data, query) {
+				urls = append(urls, models.UserURL{URLData: data, Clicks: countClicks(tx, data.ShortURL)})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return models.URLPage{}, err
+	}
+	return pageUserURLs(urls, query), nil
+}
+
+// ExportUserURLs передаёт в fn ссылки пользователя в порядке создания.
+// Каждая ссылка читается в отдельной транзакции, чтобы медленный получатель
+// не удерживал транзакцию чтения.
+func (s *BoltStorage) ExportUserURLs(ctx context.Context, userID string, fn func(models.ExportedURL) error) error {
+	var ids []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := userPrefix(userID)
+		c := tx.Bucket(byUserBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			ids = append(ids, shortIDFromUserKey(k, prefix))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var row models.ExportedURL
+		var ok bool
+		err := s.db.View(func(tx *bolt.Tx) error {
+			data, found, err := getURL(tx, id)
+			if err != nil || !found {
+				return err
+			}
+			ok = true
+			row = models.ExportedURL{
+				ShortURL:    data.ShortURL,
+				OriginalURL: data.OriginalURL,
+				CreatedAt:   data.CreatedAt,
+				DeletedFlag: data.DeletedFlag,
+				Clicks:      countClicks(tx, id),
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Ссылка могла быть окончательно удалена после начала выгрузки.
+		if !ok {
+			continue
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateURLs изменяет функцией change перечисленные ссылки пользователя
+// в одной транзакции и возвращает количество изменённых ссылок и идентификаторы,
+// которых нет среди ссылок пользователя. change сообщает, изменила ли она запись.
+func (s *BoltStorage) updateURLs(userID string, ids []string, change func(*bolt.Tx, *models.URLData) (bool, error)) (int, []string, error) {
+	var changed int
+	var missing []string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		missing = nil
+		for _, id := range ids {
+			data, ok, err := getURL(tx, id)
+			if err != nil {
+				return err
+			}
+			if !ok || data.UserUUID != userID {
+				missing = append(missing, id)
+				continue
+			}
+			prev := data
+			if ok, err := change(tx, &data); err != nil || !ok {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if err := putURL(tx, data, &prev); err != nil {
+				return err
+			}
+			changed++
+		}
+		return nil
+	})
+	return changed, missing, err
+}
+
+// ClaimURLs передаёт ссылки пользователя fromUserID пользователю toUserID
+// в одной транзакции.
+func (s *BoltStorage) ClaimURLs(_ context.Context, fromUserID, toUserID string) ([]string, error) {
+	var claimed []string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var urls []models.URLData
+		err := forEachUserURL(tx, fromUserID, func(data models.URLData) error {
+			urls = append(urls, data)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, prev := range urls {
+			data := prev
+			data.UserUUID = toUserID
+			if err := putURL(tx, data, &prev); err != nil {
+				return err
+			}
+			claimed = append(claimed, data.ShortURL)
+		}
+		return nil
+	})
+	return claimed, err
+}
+
+// BatchDeleteURLs помечает удалёнными ссылки пользователя в одной транзакции
+// и возвращает идентификаторы, которых нет среди его ссылок.
+func (s *BoltStorage) BatchDeleteURLs(_ context.Context, userID string, ids []string) ([]string, error) {
+	deletedAt := time.Now().UTC()
+	_, missing, err := s.updateURLs(userID, ids, func(_ *bolt.Tx, data *models.URLData) (bool, error) {
+		if data.DeletedFlag {
+			return false, nil
+		}
+		data.DeletedFlag, data.DeletedAt = true, &deletedAt
+		return true, nil
+	})
+	return missing, err
+}
+
+// RestoreURLs снимает пометку об удалении со ссылок пользователя,
+// срок действия которых не истёк и URL которых не сокращён другой
+// действующей ссылкой.
+func (s *BoltStorage) RestoreURLs(_ context.Context, userID string, ids []string) (int, error) {
+	now := time.Now()
+	restored, _, err := s.updateURLs(userID, ids, func(tx *bolt.Tx, data *models.URLData) (bool, error) {
+		if !data.DeletedFlag || data.Expired(now) {
+			return false, nil
+		}
+		if !data.Alias {
+			if existing, err := s.findDuplicate(tx, data, now); err != nil || existing != "" {
+				return false, err
+			}
+		}
+		data.DeletedFlag, data.DeletedAt = false, nil
+		return true, nil
+	})
+	return restored, err
+}
+
+// scanURLs передаёт в fn все ссылки. Изменять ссылки внутри fn нельзя.
+func scanURLs(tx *bolt.Tx, fn func(models.URLData) error) error {
+	return tx.Bucket(urlsBucket).ForEach(func(_, value []byte) error {
+		var data models.URLData
+		if err := json.Unmarshal(value, &data); err != nil {
+			return err
+		}
+		return fn(data)
+	})
+}
+
+// PurgeDeletedURLs окончательно удаляет ссылки, помеченные удалёнными раньше
+// before, вместе с переходами и историей изменений. Ссылки находятся по индексу
+// моментов удаления и удаляются транзакциями по boltSweepBatch ссылок.
+func (s *BoltStorage) PurgeDeletedURLs(_ context.Context, before time.Time) ([]string, error) {
+	var purged []string
+	for {
+		var keys [][]byte
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			keys = dueIndexKeys(tx, byDeletedBucket, before, false)
+			for _, key := range keys {
+				// Ключ удаляется и тогда, когда он не соответствует записи ссылки,
+				// чтобы следующая транзакция не получила его снова.
+				if err := tx.Bucket(byDeletedBucket).Delete(key); err != nil {
+					return err
+				}
+				data, ok, err := getURL(tx, string(key[8:]))
+				if err != nil {
+					return err
+				}
+				if !ok || !data.DeletedFlag || data.DeletedAt == nil || !data.DeletedAt.Before(before) {
+					continue
+				}
+				if err := removeURL(tx, data); err != nil {
+					return err
+				}
+				purged = append(purged, data.ShortURL)
+			}
+			return nil
+		})
+		if err != nil || len(keys) < boltSweepBatch {
+			return purged, err
+		}
+	}
+}
+
+// UpdateOriginalURL меняет оригинальный URL ссылки пользователя и сохраняет
+// предыдущий URL в истории изменений в одной транзакции.
+func (s *BoltStorage) UpdateOriginalURL(_ context.Context, shortID, userID, originalURL string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		data, ok, err := getURL(tx, shortID)
+		if err != nil {
+			return err
+		}
+		if !ok || data.UserUUID != userID || data.DeletedFlag {
+			return ErrNotFound
+		}
+
+		history, err := tx.Bucket(historyBucket).CreateBucketIfNotExists([]byte(shortID))
+		if err != nil {
+			return err
+		}
+		seq, err := history.NextSequence()
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(models.URLChange{
+			ShortURL:    shortID,
+			OriginalURL: data.OriginalURL,
+			ChangedAt:   time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+		if err := history.Put(binary.BigEndian.AppendUint64(nil, seq), value); err != nil {
+			return err
+		}
+
+		prev := data
+		data.OriginalURL = originalURL
+		return putURL(tx, data, &prev)
+	})
+}
+
+// GetURLHistory возвращает историю изменений оригинального URL ссылки.
+func (s *BoltStorage) GetURLHistory(_ context.Context, shortID string) ([]models.URLChange, error) {
+	var history []models.URLChange
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(historyBucket).Bucket([]byte(shortID))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, value []byte) error {
+			var change models.URLChange
+			if err := json.Unmarshal(value, &change); err != nil {
+				return err
+			}
+			history = append(history, change)
+			return nil
+		})
+	})
+	return history, err
+}
+
+// ExpireURLs помечает удалёнными ссылки с истёкшим сроком действия.
+// Ссылки находятся по индексу моментов истечения срока и изменяются
+// транзакциями по boltSweepBatch ссылок.
+func (s *BoltStorage) ExpireURLs(_ context.Context, now time.Time) (int, error) {
+	deletedAt := now.UTC()
+	var expired int
+	for {
+		var keys [][]byte
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			keys = dueIndexKeys(tx, byExpiresBucket, now, true)
+			for _, key := range keys {
+				// Ключ удаляется и тогда, когда он не соответствует записи ссылки,
+				// чтобы следующая транзакция не получила его снова.
+				if err := tx.Bucket(byExpiresBucket).Delete(key); err != nil {
+					return err
+				}
+				data, ok, err := getURL(tx, string(key[8:]))
+				if err != nil {
+					return err
+				}
+				if !ok || data.DeletedFlag || !data.Expired(now) {
+					continue
+				}
+				prev := data
+				data.DeletedFlag, data.DeletedAt = true, &deletedAt
+				if err := putURL(tx, data, &prev); err != nil {
+					return err
+				}
+				expired++
+			}
+			return nil
+		})
+		if err != nil || len(keys) < boltSweepBatch {
+			return expired, err
+		}
+	}
+}
+
+// SaveClicks сохраняет события переходов во вложенные бакеты ссылок одной транзакцией.
+func (s *BoltStorage) SaveClicks(_ context.Context, clicks []models.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, click := range clicks {
+			b, err := tx.Bucket(clicksBucket).CreateBucketIfNotExists([]byte(click.ShortURL))
+			if err != nil {
+				return err
+			}
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			value, err := json.Marshal(click)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(binary.BigEndian.AppendUint64(nil, seq), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetClickStats возвращает статистику переходов по ссылке.
+func (s *BoltStorage) GetClickStats(_ context.Context, shortID string) (models.ClickStats, error) {
+	perDay := make(map[string]int)
+	var total int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(clicksBucket).Bucket([]byte(shortID))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(_, value []byte) error {
+			var click models.Click
+			if err := json.Unmarshal(value, &click); err != nil {
+				return err
+			}
+			perDay[click.Timestamp.UTC().Format(time.DateOnly)]++
+			total++
+			return nil
+		})
+	})
+	if err != nil {
+		return models.ClickStats{}, err
+	}
+
+	stats := models.ClickStats{Total: total, Days: make([]models.DailyClicks, 0, len(perDay))}
+	for date, clicks := range perDay {
+		stats.Days = append(stats.Days, models.DailyClicks{Date: date, Clicks: clicks})
+	}
+	sort.Slice(stats.Days, func(i, j int) bool { return stats.Days[i].Date < stats.Days[j].Date })
+	return stats, nil
+}
+
+// SaveJob сохраняет состояние задачи, заменяя предыдущее.
+func (s *BoltStorage) SaveJob(_ context.Context, job models.Job) error {
+	value, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).Put([]byte(job.ID), value)
+	})
+}
+
+// GetJob возвращает задачу по идентификатору.
+func (s *BoltStorage) GetJob(_ context.Context, id string) (models.Job, error) {
+	var job models.Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(jobsBucket).Get([]byte(id))
+		if value == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(value, &job)
+	})
+	return job, err
+}
+
+// GetUnfinishedJobs возвращает незавершённые задачи в порядке создания.
+func (s *BoltStorage) GetUnfinishedJobs(_ context.Context) ([]models.Job, error) {
+	var jobs []models.Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(_, value []byte) error {
+			var job models.Job
+			if err := json.Unmarshal(value, &job); err != nil {
+				return err
+			}
+			if !job.Finished() {
+				jobs = append(jobs, job)
+			}
+			return nil
+		})
+	})
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, err
+}
+
+// SaveRefreshToken сохраняет запись токена обновления.
+func (s *BoltStorage) SaveRefreshToken(_ context.Context, token models.RefreshToken) error {
+	value, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(tokensBucket).Put([]byte(token.ID), value)
+	})
+}
+
+// RevokeRefreshToken отзывает действующий токен обновления.
+func (s *BoltStorage) RevokeRefreshToken(_ context.Context, id string, final bool) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(tokensBucket)
+		value := b.Get([]byte(id))
+		if value == nil {
+			return ErrNotFound
+		}
+		if err := json.Unmarshal(value, &token); err != nil {
+			return err
+		}
+		now := time.Now()
+		switch {
+		case token.Active(now):
+			token.RevokedAt = &now
+			token.Spent = final
+		case token.Reusable(now, RefreshReuseGrace):
+			token.Spent = true
+		default:
+			return ErrNotFound
+		}
+		value, err := json.Marshal(token)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(id), value)
+	})
+	if err != nil {
+		return models.RefreshToken{}, err
+	}
+	return token, nil
+}
+
+// PurgeRefreshTokens удаляет записи истёкших и отозванных токенов обновления,
+// перебирая все токены.
+func (s *BoltStorage) PurgeRefreshTokens(_ context.Context, before time.Time) (int, error) {
+	var n int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(tokensBucket).Cursor()
+		for k, value := c.First(); k != nil; k, value = c.Next() {
+			var token models.RefreshToken
+			if err := json.Unmarshal(value, &token); err != nil {
+				return err
+			}
+			if token.ExpiresAt.Before(before) || (token.RevokedAt != nil && token.RevokedAt.Before(before)) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// CreateAccount сохраняет новую учётную запись и индекс её логина.
+func (s *BoltStorage) CreateAccount(_ context.Context, account models.Account) error {
+	value, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		logins, accounts := tx.Bucket(loginsBucket), tx.Bucket(accountsBucket)
+		if logins.Get([]byte(account.Login)) != nil {
+			return ErrLoginTaken
+		}
+		if accounts.Get([]byte(account.ID)) != nil {
+			return ErrAccountExists
+		}
+		if err := accounts.Put([]byte(account.ID), value); err != nil {
+			return err
+		}
+		return logins.Put([]byte(account.Login), []byte(account.ID))
+	})
+}
+
+// getAccount читает учётную запись по идентификатору пользователя.
+func getAccount(tx *bolt.Tx, id []byte) (models.Account, error) {
+	var account models.Account
+	value := tx.Bucket(accountsBucket).Get(id)
+	if value == nil {
+		return account, ErrNotFound
+	}
+	return account, json.Unmarshal(value, &account)
+}
+
+// GetAccount возвращает учётную запись по идентификатору пользователя.
+func (s *BoltStorage) GetAccount(_ context.Context, id string) (models.Account, error) {
+	var account models.Account
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		account, err = getAccount(tx, []byte(id))
+		return err
+	})
+	return account, err
+}
+
+// GetAccountByLogin возвращает учётную запись по логину.
+func (s *BoltStorage) GetAccountByLogin(_ context.Context, login string) (models.Account, error) {
+	var account models.Account
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		id := tx.Bucket(loginsBucket).Get([]byte(login))
+		if id == nil {
+			return ErrNotFound
+		}
+		account, err = getAccount(tx, id)
+		return err
+	})
+	return account, err
+}
+
+// CreateAPIKey сохраняет запись ключа API.
+func (s *BoltStorage) CreateAPIKey(_ context.Context, key models.APIKey) error {
+	value, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(apiKeysBucket)
+		if b.Get([]byte(key.ID)) != nil {
+			return fmt.Errorf("API key %s already exists", key.ID)
+		}
+		return b.Put([]byte(key.ID), value)
+	})
+}
+
+// getAPIKey читает запись ключа API по идентификатору.
+func getAPIKey(tx *bolt.Tx, id string) (models.APIKey, error) {
+	var key models.APIKey
+	value := tx.Bucket(apiKeysBucket).Get([]byte(id))
+	if value == nil {
+		return key, ErrNotFound
+	}
+	return key, json.Unmarshal(value, &key)
+}
+
+// GetAPIKey возвращает запись ключа API по идентификатору.
+func (s *BoltStorage) GetAPIKey(_ context.Context, id string) (models.APIKey, error) {
+	var key models.APIKey
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		key, err = getAPIKey(tx, id)
+		return err
+	})
+	return key, err
+}
+
+// ListAPIKeys возвращает ключи API пользователя в порядке создания.
+// Ключей немного, поэтому бакет просматривается целиком.
+func (s *BoltStorage) ListAPIKeys(_ context.Context, userID string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(apiKeysBucket).ForEach(func(_, value []byte) error {
+			var key models.APIKey
+			if err := json.Unmarshal(value, &key); err != nil {
+				return err
+			}
+			if key.UserID == userID {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+	})
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, err
+}
+
+// DeleteAPIKey удаляет ключ API пользователя.
+func (s *BoltStorage) DeleteAPIKey(_ context.Context, userID, id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		key, err := getAPIKey(tx, id)
+		if err != nil {
+			return err
+		}
+		if key.UserID != userID {
+			return ErrNotFound
+		}
+		return tx.Bucket(apiKeysBucket).Delete([]byte(id))
+	})
+}
+
+// SaveTokenRevocation сохраняет запись об отзыве токенов, заменяя запись
+// с теми же идентификаторами токена и пользователя.
+func (s *BoltStorage) SaveTokenRevocation(_ context.Context, revocation models.TokenRevocation) error {
+	value, err := json.Marshal(revocation)
+	if err != nil {
+		return err
+	}
+	key := append(append([]byte(revocation.TokenID), 0), revocation.UserID...)
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(revokedBucket).Put(key, value)
+	})
+}
+
+// ListTokenRevocations возвращает записи об отзыве токенов, не истёкшие к моменту now.
+func (s *BoltStorage) ListTokenRevocations(_ context.Context, now time.Time) ([]models.TokenRevocation, error) {
+	var revocations []models.TokenRevocation
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(revokedBucket).ForEach(func(_, value []byte) error {
+			var revocation models.TokenRevocation
+			if err := json.Unmarshal(value, &revocation); err != nil {
+				return err
+			}
+			if revocation.ExpiresAt.After(now) {
+				revocations = append(revocations, revocation)
+			}
+			return nil
+		})
+	})
+	return revocations, err
+}
+
+// PurgeTokenRevocations удаляет записи об отзыве токенов, истёкшие раньше before.
+func (s *BoltStorage) PurgeTokenRevocations(_ context.Context, before time.Time) (int, error) {
+	var n int
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		c := tx.Bucket(revokedBucket).Cursor()
+		for k, value := c.First(); k != nil; k, value = c.Next() {
+			var revocation models.TokenRevocation
+			if err := json.Unmarshal(value, &revocation); err != nil {
+				return err
+			}
+			if revocation.ExpiresAt.Before(before) {
+				if err := c.Delete(); err != nil {
+					return err
+				}
+				n++
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// GetURLsCount возвращает количество сокращённых URL.
+func (s *BoltStorage) GetURLsCount(_ context.Context) (int, error) {
+	var count int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(urlsBucket).Stats().KeyN
+		return nil
+	})
+	return count, err
+}
+
+// MaxShortURL возвращает наибольший сгенерированный короткий идентификатор
+// длины length из символов base62. Псевдонимы не учитываются.
+func (s *BoltStorage) MaxShortURL(_ context.Context, length int) (string, error) {
+	var maxID string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// Ключи упорядочены по байтам, поэтому ключи просматриваются в обратном
+		// порядке от наибольшего возможного идентификатора «zz…z» до первого подходящего.
+		upper := bytes.Repeat([]byte{'z'}, length)
+		c := tx.Bucket(urlsBucket).Cursor()
+		k, v := c.Seek(upper)
+		switch {
+		case k == nil:
+			k, v = c.Last()
+		case !bytes.Equal(k, upper):
+			k, v = c.Prev()
+		}
+		for ; k != nil; k, v = c.Prev() {
+			if id := string(k); len(id) != length || !isBase62(id) {
+				continue
+			}
+			var data models.URLData
+			if err := json.Unmarshal(v, &data); err != nil {
+				return err
+			}
+			if !data.Alias {
+				maxID = string(k)
+				return nil
+			}
+		}
+		return nil
+	})
+	return maxID, err
+}
+
+// GetUsersCount возвращает количество уникальных пользователей,
+// перебирая индекс пользователей.
+func (s *BoltStorage) GetUsersCount(_ context.Context) (int, error) {
+	var count int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(byUserBucket).Cursor()
+		for k, _ := c.First(); k != nil; {
+			count++
+			// Переход к первому ключу следующего пользователя.
+			user := k[:bytes.IndexByte(k, 0)]
+			k, _ = c.Seek(append(append([]byte(nil), user...), 1))
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Ping проверяет, что база открыта.
+func (s *BoltStorage) Ping(_ context.Context) error {
+	return s.db.View(func(*bolt.Tx) error { return nil })
+}
+
+// Close закрывает базу.
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+)
+
+// Значения параметров кэша по умолчанию.
+const (
+	DefaultCacheSize        = 10000
+	DefaultCacheTTL         = 5 * time.Minute
+	DefaultCacheNegativeTTL = 30 * time.Second
+)
+
+// cacheEntry — запись кэша: найденная ссылка или отметка об её отсутствии.
+type cacheEntry struct {
+	key       string
+	data      models.URLData
+	found     bool
+	expiresAt time.Time
+}
+
+// CachedStorage кэширует поиск ссылок по короткому идентификатору перед другим
+// хранилищем. Кэш ограничен по размеру (вытесняются давно не использованные
+// записи) и по времени жизни записей; отсутствие ссылки также кэшируется,
+// но на меньший срок. Изменения ссылок через CachedStorage удаляют их из кэша,
+// а остальные методы передаются хранилищу без изменений. ExpireURLs кэш
+// не затрагивает: запись о ссылке со сроком действия и так хранится не дольше этого срока.
+type CachedStorage struct {
+	Storage
+
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Начало списка — недавно использованные записи.
+	// gen увеличивается при каждом удалении записей, чтобы результат
+	// чтения из хранилища, начатого до удаления, не попал в кэш.
+	gen uint64
+	// missingGen увеличивается при сохранении ссылок: отметка об отсутствии,
+	// прочитанная до сохранения, устарела, а найденные ссылки остаются верными.
+	missingGen uint64
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+// NewCachedStorage создаёт кэш размером size записей перед хранилищем s.
+// Найденные ссылки хранятся ttl, отсутствующие — negativeTTL; нулевое
+// значение negativeTTL отключает кэширование отсутствия.
+// Неположительные size и ttl заменяются значениями по умолчанию.
+func NewCachedStorage(s Storage, size int, ttl, negativeTTL time.Duration) *CachedStorage {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &CachedStorage{
+		Storage:     s,
+		size:        size,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+	}
+}
+
+// GetOriginalURL возвращает ссылку из кэша, а при промахе читает её из хранилища
+// и кэширует результат. Запись о ссылке со сроком действия хранится не дольше
+// этого срока.
+func (c *CachedStorage) GetOriginalURL(ctx context.Context, shortID string) (models.URLData, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	if el, ok := c.entries[shortID]; ok {
+		entry := el.Value.(*cacheEntry)
+		if now.Before(entry.expiresAt) {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			c.hits.Add(1)
+			if !entry.found {
+				return models.URLData{}, ErrNotFound
+			}
+			return entry.data, nil
+		}
+		c.remove(el)
+	}
+	gen, missingGen := c.gen, c.missingGen
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	data, err := c.Storage.GetOriginalURL(ctx, shortID)
+	switch {
+	case err == nil:
+		expiresAt := now.Add(c.ttl)
+		if data.ExpiresAt != nil && data.ExpiresAt.Before(expiresAt) {
+			expiresAt = *data.ExpiresAt
+		}
+		c.put(gen, missingGen, &cacheEntry{key: shortID, data: data, found: true, expiresAt: expiresAt})
+	case errors.Is(err, ErrNotFound) && c.negativeTTL > 0:
+		c.put(gen, missingGen, &cacheEntry{key: shortID, expiresAt: now.Add(c.negativeTTL)})
+	}
+	return data, err
+}
+
+// put добавляет запись, если с момента чтения gen записи не удалялись,
+// а для отметки об отсутствии — и если с момента missingGen ссылки
+// не сохранялись. Давно не использованные записи сверх размера кэша вытесняются.
+func (c *CachedStorage) put(gen, missingGen uint64, entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen || !entry.found && missingGen != c.missingGen {
+		return
+	}
+	if el, ok := c.entries[entry.key]; ok {
+		c.remove(el)
+	}
+	c.entries[entry.key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// remove удаляет запись. Вызывается под блокировкой.
+func (c *CachedStorage) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
+
+// Invalidate удаляет из кэша записи о ссылках с указанными короткими идентификаторами.
+func (c *CachedStorage) Invalidate(shortIDs ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	for _, id := range shortIDs {
+		if el, ok := c.entries[id]; ok {
+			c.remove(el)
+		}
+	}
+}
+
+// ForgetMissing удаляет из кэша отметки об отсутствии ссылок с указанными
+// короткими идентификаторами. Записи о найденных ссылках не затрагиваются.
+func (c *CachedStorage) ForgetMissing(shortIDs ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.missingGen++
+	for _, id := range shortIDs {
+		if el, ok := c.entries[id]; ok && !el.Value.(*cacheEntry).found {
+			c.remove(el)
+		}
+	}
+}
+
+// Flush удаляет из кэша все записи.
+func (c *CachedStorage) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// CacheStats возвращает счётчики обращений к кэшу.
+func (c *CachedStorage) CacheStats() models.CacheStats {
+	c.mu.Lock()
+	size := c.order.Len()
+	c.mu.Unlock()
+
+	return models.CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Size:      size,
+	}
+}
+
+// SaveURL сохраняет ссылку и удаляет из кэша отметку о её отсутствии.
+func (c *CachedStorage) SaveURL(ctx context.Context, event *models.URLData) (string, error) {
+	existing, err := c.Storage.SaveURL(ctx, event)
+	if err == nil {
+		c.ForgetMissing(event.ShortURL)
+	}
+	return existing, err
+}
+
+// BatchSaveURLs сохраняет пакет ссылок и удаляет из кэша отметки об отсутствии созданных ссылок.
+func (c *CachedStorage) BatchSaveURLs(ctx context.Context, urls []*models.URLData) ([]error, error) {
+	errs, err := c.Storage.BatchSaveURLs(ctx, urls)
+	if err != nil {
+		return errs, err
+	}
+	var created []string
+	for i, data := range urls {
+		if errs[i] == nil {
+			created = append(created, data.ShortURL)
+		}
+	}
+	c.ForgetMissing(created...)
+	return errs, nil
+}
+
+// BatchDeleteURLs помечает ссылки удалёнными и удаляет их из кэша.
+func (c *CachedStorage) BatchDeleteURLs(ctx context.Context, userID string, ids []string) ([]string, error) {
+	defer c.Invalidate(ids...)
+	return c.Storage.BatchDeleteURLs(ctx, userID, ids)
+}
+
+// RestoreURLs восстанавливает ссылки и удаляет их из кэша.
+func (c *CachedStorage) RestoreURLs(ctx context.Context, userID string, ids []string) (int, error) {
+	defer c.Invalidate(ids...)
+	return c.Storage.RestoreURLs(ctx, userID, ids)
+}
+
+// UpdateOriginalURL меняет оригинальный URL ссылки и удаляет её из кэша.
+func (c *CachedStorage) UpdateOriginalURL(ctx context.Context, shortID, userID, originalURL string) error {
+	defer c.Invalidate(shortID)
+	return c.Storage.UpdateOriginalURL(ctx, shortID, userID, originalURL)
+}
+
+// ClaimURLs передаёт ссылки другому пользователю и удаляет их из кэша.
+func (c *CachedStorage) ClaimURLs(ctx context.Context, fromUserID, toUserID string) ([]string, error) {
+	claimed, err := c.Storage.ClaimURLs(ctx, fromUserID, toUserID)
+	c.Invalidate(claimed...)
+	return claimed, err
+}
+
+// PurgeDeletedURLs окончательно удаляет ссылки и удаляет их из кэша.
+func (c *CachedStorage) PurgeDeletedURLs(ctx context.Context, before time.Time) ([]string, error) {
+	purged, err := c.Storage.PurgeDeletedURLs(ctx, before)
+	c.Invalidate(purged...)
+	return purged, err
+}
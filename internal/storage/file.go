@@ -0,0 +1,766 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/file"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"go.uber.org/zap"
+)
+
+// DefaultCompactSize — размер журнала ссылок, при котором он сжимается по умолчанию.
+const DefaultCompactSize = 64 << 20
+
+// FileStorage хранит сокращённые URL в памяти и записывает каждое изменение
+// ссылок событием в журнал в формате JSON Lines. Журнал сжимается в снимок
+// (файл с суффиксом snapshotFileSuffix) и новый пустой журнал: при загрузке
+// сначала читается снимок, затем журнал. События переходов по ссылкам,
+// история изменений, состояния фоновых задач, токены обновления, учётные
+// записи, ключи API и записи об отзыве токенов доступа дописываются в соседние
+// файлы с суффиксами clicksFileSuffix, historyFileSuffix, jobsFileSuffix,
+// tokensFileSuffix, accountsFileSuffix, apiKeysFileSuffix и revokedFileSuffix;
+// при сжатии журнала ссылок они переписываются из текущего состояния в памяти.
+// Файлы сбрасываются на диск в соответствии с политикой WithFileSync.
+type FileStorage struct {
+	*MemoryStorage
+	path string // Путь к журналу ссылок.
+
+	// wmu упорядочивает изменения ссылок в памяти и их запись в журнал,
+	// чтобы порядок событий в журнале совпадал с порядком изменений.
+	wmu        sync.Mutex
+	urlLog     *file.Log
+	clickLog   *file.Log
+	historyLog *file.Log
+	jobLog     *file.Log
+	tokenLog   *file.Log
+	accountLog *file.Log
+	apiKeyLog  *file.Log
+	revokedLog *file.Log
+
+	// sideMu приостанавливает запись во вспомогательные файлы на время
+	// их сжатия: запись в файл и изменение памяти выполняются под RLock.
+	sideMu sync.RWMutex
+
+	compactMu  sync.Mutex  // Запрещает одновременное сжатие.
+	compacting atomic.Bool // Запущено фоновое сжатие.
+	wg         sync.WaitGroup
+}
+
+// Суффиксы вспомогательных файлов хранилища.
+const (
+	snapshotFileSuffix   = ".snapshot"   // Снимок ссылок на момент последнего сжатия.
+	compactingFileSuffix = ".compacting" // Журнал, сжатие которого не завершено.
+	clicksFileSuffix     = ".clicks"     // События переходов по ссылкам.
+	historyFileSuffix    = ".history"    // Предыдущие оригинальные URL изменённых ссылок.
+	jobsFileSuffix       = ".jobs"       // Состояния фоновых задач; последнее состояние задачи заменяет предыдущие.
+	tokensFileSuffix     = ".tokens"     // Записи токенов обновления; последняя запись токена заменяет предыдущие.
+	accountsFileSuffix   = ".accounts"   // Учётные записи пользователей.
+	apiKeysFileSuffix    = ".keys"       // Записи ключей API и события их удаления.
+	revokedFileSuffix    = ".revoked"    // Записи об отзыве токенов доступа.
+)
+
+// fileOp — тип события журнала ссылок.
+type fileOp string
+
+const (
+	// opSave — создание ссылки. Записи без типа, в том числе записи
+	// прежнего формата, также считаются созданием.
+	opSave fileOp = ""
+	// opUpdate — замена записи ссылки после изменения.
+	opUpdate fileOp = "update"
+	// opDelete — пометка ссылки удалённой.
+	opDelete fileOp = "delete"
+	// opPurge — окончательное удаление ссылки.
+	opPurge fileOp = "purge"
+)
+
+// fileRecord — событие журнала ссылок с полной записью ссылки.
+type fileRecord struct {
+	Op fileOp `json:"op,omitempty"`
+	models.URLData
+}
+
+// fileEvent — событие журнала ссылок, которому нужен только идентификатор.
+// Читается как fileRecord.
+type fileEvent struct {
+	Op        fileOp     `json:"op"`
+	ShortURL  string     `json:"short_url"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// apiKeyRecord — запись файла ключей API: созданный ключ или событие его удаления.
+type apiKeyRecord struct {
+	Deleted bool `json:"deleted,omitempty"`
+	models.APIKey
+}
+
+// NewFileStorage создаёт файловое хранилище и загружает в память
+// ранее сохранённые записи из файлов. Оборванная при сбое последняя
+// запись журнала отрезается; незавершённое сжатие завершается.
+func NewFileStorage(path string, opts ...Option) (*FileStorage, error) {
+	s := &FileStorage{
+		MemoryStorage: NewMemoryStorage(opts...),
+		path:          path,
+	}
+	compacting, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	if compacting {
+		if err := s.Compact(); err != nil {
+			s.Close()
+			return nil, fmt.Errorf("failed to finish compaction: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// load загружает в память снимок, журнал ссылок и вспомогательные файлы
+// и сообщает, осталось ли после сбоя незавершённое сжатие.
+func (s *FileStorage) load() (bool, error) {
+	_, err := os.Stat(s.path + compactingFileSuffix)
+	compacting := err == nil
+
+	// Журнал, сжатие которого не завершено, старше текущего журнала.
+	for _, path := range []string{s.path + snapshotFileSuffix, s.path + compactingFileSuffix, s.path} {
+		if err := replay(path, s.apply); err != nil {
+			return false, err
+		}
+	}
+
+	if err := replay(s.path+clicksFileSuffix, decodeInto(s.putClick)); err != nil {
+		return false, err
+	}
+	if err := replay(s.path+historyFileSuffix, decodeInto(s.putChange)); err != nil {
+		return false, err
+	}
+	if err := replay(s.path+jobsFileSuffix, decodeInto(s.putJob)); err != nil {
+		return false, err
+	}
+	if err := replay(s.path+tokensFileSuffix, decodeInto(s.putRefreshToken)); err != nil {
+		return false, err
+	}
+	if err := replay(s.path+accountsFileSuffix, decodeInto(s.putAccount)); err != nil {
+		return false, err
+	}
+	if err := replay(s.path+apiKeysFileSuffix, decodeInto(s.applyAPIKey)); err != nil {
+		return false, err
+	}
+	if err := replay(s.path+revokedFileSuffix, decodeInto(s.putTokenRevocation)); err != nil {
+		return false, err
+	}
+
+	// Переходы и история окончательно удалённых ссылок остаются
+	// во вспомогательных файлах и отбрасываются при загрузке.
+	for id := range s.clicks {
+		if _, ok := s.urls[id]; !ok {
+			delete(s.clicks, id)
+		}
+	}
+	for id := range s.history {
+		if _, ok := s.urls[id]; !ok {
+			delete(s.history, id)
+		}
+	}
+	// Истёкшие и отозванные токены обновления больше не нужны.
+	now := time.Now()
+	for id, token := range s.tokens {
+		if !token.Active(now) {
+			delete(s.tokens, id)
+		}
+	}
+	// Как и записи об отзыве токенов, которые истекли сами.
+	for key, r := range s.revoked {
+		if !r.ExpiresAt.After(now) {
+			delete(s.revoked, key)
+		}
+	}
+	return compacting, nil
+}
+
+// replay читает файл path и сообщает о восстановленных после сбоя повреждениях.
+func replay(path string, fn func([]byte) error) error {
+	stats, err := file.Replay(path, fn)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	if stats.Truncated > 0 || stats.Skipped > 0 {
+		logger.Log.Warn("Recovered damaged storage file",
+			zap.String("path", path),
+			zap.Int64("truncated_bytes", stats.Truncated),
+			zap.Int("skipped_lines", stats.Skipped))
+	}
+	return nil
+}
+
+// decodeInto возвращает функцию, разбирающую запись вспомогательного файла и передающую её в put.
+func decodeInto[T any](put func(T)) func([]byte) error {
+	return func(data []byte) error {
+		var record T
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		put(record)
+		return nil
+	}
+}
+
+// applyAPIKey применяет запись файла ключей API при загрузке.
+func (s *FileStorage) applyAPIKey(record apiKeyRecord) {
+	if record.Deleted {
+		delete(s.apiKeys, record.ID)
+		return
+	}
+	s.putAPIKey(record.APIKey)
+}
+
+// apply применяет событие журнала ссылок при загрузке.
+func (s *FileStorage) apply(data []byte) error {
+	var record fileRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return err
+	}
+
+	switch record.Op {
+	case opSave, opUpdate:
+		s.put(record.URLData)
+	case opDelete:
+		if data, ok := s.urls[record.ShortURL]; ok {
+			data.DeletedFlag, data.DeletedAt = true, record.DeletedAt
+			s.urls[record.ShortURL] = data
+		}
+	case opPurge:
+		s.remove(record.ShortURL)
+	default:
+		return fmt.Errorf("unknown event %q", record.Op)
+	}
+	return nil
+}
+
+// open открывает файлы хранилища на дозапись.
+func (s *FileStorage) open() error {
+	var err error
+	for _, f := range []struct {
+		log  **file.Log
+		path string
+	}{
+		{&s.urlLog, s.path},
+		{&s.clickLog, s.path + clicksFileSuffix},
+		{&s.historyLog, s.path + historyFileSuffix},
+		{&s.jobLog, s.path + jobsFileSuffix},
+		{&s.tokenLog, s.path + tokensFileSuffix},
+		{&s.accountLog, s.path + accountsFileSuffix},
+		{&s.apiKeyLog, s.path + apiKeysFileSuffix},
+		{&s.revokedLog, s.path + revokedFileSuffix},
+	} {
+		if *f.log, err = s.openLog(f.path); err != nil {
+			s.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// openLog открывает файл path на дозапись с политикой сброса хранилища.
+func (s *FileStorage) openLog(path string) (*file.Log, error) {
+	return file.OpenLog(path, s.opts.sync, s.opts.syncInterval)
+}
+
+// appendURLs дописывает события в журнал ссылок и запускает фоновое сжатие,
+// если журнал превысил заданный размер. Вызывается под s.wmu.
+func (s *FileStorage) appendURLs(events ...any) error {
+	if err := s.urlLog.Append(events...); err != nil {
+		return err
+	}
+
+	if s.opts.compactSize > 0 && s.urlLog.Size() >= s.opts.compactSize && s.compacting.CompareAndSwap(false, true) {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.compacting.Store(false)
+
+			if err := s.Compact(); err != nil {
+				logger.Log.Error("Failed to compact storage file", zap.String("path", s.path), zap.Error(err))
+			}
+		}()
+	}
+	return nil
+}
+
+// updateEvents возвращает события замены изменённых записей.
+func updateEvents(changed []models.URLData) []any {
+	events := make([]any, len(changed))
+	for i, data := range changed {
+		events[i] = fileRecord{Op: opUpdate, URLData: data}
+	}
+	return events
+}
+
+// Compact сжимает журнал ссылок: текущее состояние ссылок записывается в снимок,
+// а события записываются в новый журнал. Изменения ссылок приостанавливаются
+// только на время копирования состояния и переключения журнала, чтение не
+// приостанавливается. Сбой на любом шаге не приводит к потере данных: при
+// следующей загрузке прочитываются и снимок, и оба журнала, а сжатие завершается.
+// Затем вспомогательные файлы переписываются из памяти (см. compactSideLogs).
+func (s *FileStorage) Compact() error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	compactingPath := s.path + compactingFileSuffix
+
+	s.wmu.Lock()
+	s.mu.RLock()
+	urls := make([]models.URLData, 0, len(s.urls))
+	for _, data := range s.urls {
+		urls = append(urls, data)
+	}
+	s.mu.RUnlock()
+
+	// Если прошлое сжатие не завершилось, его журнал ещё не вошёл в снимок
+	// и не может быть заменён; текущий журнал сожмётся следующим.
+	_, err := os.Stat(compactingPath)
+	if errors.Is(err, os.ErrNotExist) {
+		err = s.rotate(compactingPath)
+	}
+	s.wmu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(urls, func(a, b models.URLData) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ShortURL, b.ShortURL))
+	})
+	err = file.WriteSnapshot(s.path+snapshotFileSuffix, func(enc *json.Encoder) error {
+		for _, data := range urls {
+			if err := enc.Encode(fileRecord{URLData: data}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(compactingPath); err != nil {
+		return err
+	}
+	if err := file.SyncDir(filepath.Dir(s.path)); err != nil {
+		return err
+	}
+	return s.compactSideLogs()
+}
+
+// compactSideLogs переписывает вспомогательные файлы из текущего состояния
+// в памяти, отбрасывая заменённые записи, переходы и историю окончательно
+// удалённых ссылок, удалённые ключи API, истёкшие и отозванные токены
+// обновления и истёкшие записи об отзыве токенов. Запись во вспомогательные
+// файлы на это время приостанавливается. Каждый файл заменяется атомарно,
+// поэтому сбой не приводит к потере данных.
+func (s *FileStorage) compactSideLogs() error {
+	s.sideMu.Lock()
+	defer s.sideMu.Unlock()
+
+	now := time.Now()
+	s.mu.RLock()
+	var clicks, history, jobs, tokens, accounts, apiKeys, revoked []any
+	for _, events := range s.clicks {
+		for _, click := range events {
+			clicks = append(clicks, click)
+		}
+	}
+	for _, changes := range s.history {
+		for _, change := range changes {
+			history = append(history, change)
+		}
+	}
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	for _, token := range s.tokens {
+		if token.Active(now) {
+			tokens = append(tokens, token)
+		}
+	}
+	for _, account := range s.accounts {
+		accounts = append(accounts, account)
+	}
+	for _, key := range s.apiKeys {
+		apiKeys = append(apiKeys, apiKeyRecord{APIKey: key})
+	}
+	for _, r := range s.revoked {
+		if r.ExpiresAt.After(now) {
+			revoked = append(revoked, r)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, f := range []struct {
+		log     **file.Log
+		path    string
+		records []any
+	}{
+		{&s.clickLog, s.path + clicksFileSuffix, clicks},
+		{&s.historyLog, s.path + historyFileSuffix, history},
+		{&s.jobLog, s.path + jobsFileSuffix, jobs},
+		{&s.tokenLog, s.path + tokensFileSuffix, tokens},
+		{&s.accountLog, s.path + accountsFileSuffix, accounts},
+		{&s.apiKeyLog, s.path + apiKeysFileSuffix, apiKeys},
+		{&s.revokedLog, s.path + revokedFileSuffix, revoked},
+	} {
+		if err := s.rewrite(f.log, f.path, f.records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewrite заменяет содержимое вспомогательного файла path записями records
+// и заново открывает его на дозапись. Вызывается под s.sideMu.
+func (s *FileStorage) rewrite(log **file.Log, path string, records []any) error {
+	if err := (*log).Close(); err != nil {
+		return err
+	}
+	err := file.WriteSnapshot(path, func(enc *json.Encoder) error {
+		for _, record := range records {
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	reopened, openErr := s.openLog(path)
+	if openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	*log = reopened
+	return err
+}
+
+// rotate переименовывает журнал ссылок в path и открывает новый пустой журнал.
+// Вызывается под s.wmu.
+func (s *FileStorage) rotate(path string) error {
+	if err := s.urlLog.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(s.path, path); err != nil {
+		return err
+	}
+	log, err := s.openLog(s.path)
+	if err != nil {
+		return err
+	}
+	s.urlLog = log
+	return file.SyncDir(filepath.Dir(s.path))
+}
+
+// commit дописывает события в журнал ссылок и только после успешной записи
+// применяет изменения к памяти функцией apply. Изменения планируются заранее
+// под s.mu.RLock: ссылки изменяются только под s.wmu, поэтому план остаётся
+// верным и после снятия блокировки на время записи. Вызывается под s.wmu.
+func (s *FileStorage) commit(events []any, apply func()) error {
+	if err := s.appendURLs(events...); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	apply()
+	s.mu.Unlock()
+	return nil
+}
+
+// SaveURL записывает событие создания ссылки в журнал и затем сохраняет её в памяти.
+func (s *FileStorage) SaveURL(_ context.Context, event *models.URLData) (string, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	s.mu.RLock()
+	existing, err := s.planSave(event)
+	s.mu.RUnlock()
+	if err != nil {
+		return existing, err
+	}
+	return "", s.commit([]any{fileRecord{URLData: *event}}, func() { s.put(*event) })
+}
+
+// BatchSaveURLs записывает созданные ссылки пакета в журнал одной записью
+// и затем сохраняет их в памяти. Если запись в журнал не удалась, пакет
+// не сохраняется и в памяти.
+func (s *FileStorage) BatchSaveURLs(_ context.Context, urls []*models.URLData) ([]error, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	s.mu.RLock()
+	errs, taken := s.planBatch(urls)
+	s.mu.RUnlock()
+	if taken {
+		return errs, nil
+	}
+
+	var created []any
+	for i, data := range urls {
+		if errs[i] == nil {
+			created = append(created, fileRecord{URLData: *data})
+		}
+	}
+	if err := s.commit(created, func() { s.putBatch(urls, errs) }); err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+// SaveClicks дописывает события переходов в файл и сохраняет их в памяти.
+func (s *FileStorage) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	s.sideMu.RLock()
+	defer s.sideMu.RUnlock()
+
+	records := make([]any, len(clicks))
+	for i := range clicks {
+		records[i] = clicks[i]
+	}
+	if err := s.clickLog.Append(records...); err != nil {
+		return err
+	}
+	return s.MemoryStorage.SaveClicks(ctx, clicks)
+}
+
+// BatchDeleteURLs записывает события удаления ссылок пользователя в журнал
+// одной записью и затем помечает ссылки удалёнными в памяти.
+func (s *FileStorage) BatchDeleteURLs(_ context.Context, userID string, ids []string) ([]string, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	s.mu.RLock()
+	deleted, missing := s.planDelete(userID, ids, time.Now())
+	s.mu.RUnlock()
+
+	events := make([]any, len(deleted))
+	for i, data := range deleted {
+		events[i] = fileEvent{Op: opDelete, ShortURL: data.ShortURL, DeletedAt: data.DeletedAt}
+	}
+	if err := s.commit(events, func() { s.putAll(deleted) }); err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// RestoreURLs записывает восстановленные записи ссылок пользователя
+// в журнал и затем снимает с них пометку об удалении в памяти.
+func (s *FileStorage) RestoreURLs(_ context.Context, userID string, ids []string) (int, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	s.mu.RLock()
+	restored := s.planRestore(userID, ids, time.Now())
+	s.mu.RUnlock()
+
+	if err := s.commit(updateEvents(restored), func() { s.putAll(restored) }); err != nil {
+		return 0, err
+	}
+	return len(restored), nil
+}
+
+// PurgeDeletedURLs записывает события окончательного удаления в журнал
+// и затем удаляет ссылки из памяти.
+func (s *FileStorage) PurgeDeletedURLs(_ context.Context, before time.Time) ([]string, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	s.mu.RLock()
+	purged := s.planPurge(before)
+	s.mu.RUnlock()
+
+	events := make([]any, len(purged))
+	for i, id := range purged {
+		events[i] = fileEvent{Op: opPurge, ShortURL: id}
+	}
+	if err := s.commit(events, func() { s.removeAll(purged) }); err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+
+// ExpireURLs записывает события удаления ссылок с истёкшим сроком действия
+// в журнал и затем помечает их удалёнными в памяти.
+func (s *FileStorage) ExpireURLs(_ context.Context, now time.Time) (int, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	s.mu.RLock()
+	expired := s.planExpire(now)
+	s.mu.RUnlock()
+
+	events := make([]any, len(expired))
+	for i, data := range expired {
+		events[i] = fileEvent{Op: opDelete, ShortURL: data.ShortURL, DeletedAt: data.DeletedAt}
+	}
+	if err := s.commit(events, func() { s.putAll(expired) }); err != nil {
+		return 0, err
+	}
+	return len(expired), nil
+}
+
+// UpdateOriginalURL записывает изменённую запись ссылки в журнал, затем
+// меняет оригинальный URL в памяти и дописывает предыдущий URL в файл истории.
+func (s *FileStorage) UpdateOriginalURL(_ context.Context, shortID, userID, originalURL string) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.sideMu.RLock()
+	defer s.sideMu.RUnlock()
+
+	s.mu.RLock()
+	data, change, err := s.planUpdate(shortID, userID, originalURL, time.Now())
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	err = s.commit([]any{fileRecord{Op: opUpdate, URLData: data}}, func() {
+		s.put(data)
+		s.putChange(change)
+	})
+	if err != nil {
+		return err
+	}
+	return s.historyLog.Append(change)
+}
+
+// SaveJob дописывает состояние задачи в файл и сохраняет его в памяти.
+func (s *FileStorage) SaveJob(ctx context.Context, job models.Job) error {
+	s.sideMu.RLock()
+	defer s.sideMu.RUnlock()
+
+	if err := s.jobLog.Append(job); err != nil {
+		return err
+	}
+	return s.MemoryStorage.SaveJob(ctx, job)
+}
+
+// SaveRefreshToken дописывает запись токена обновления в файл и сохраняет её в памяти.
+func (s *FileStorage) SaveRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	s.sideMu.RLock()
+	defer s.sideMu.RUnlock()
+
+	if err := s.tokenLog.Append(token); err != nil {
+		return err
+	}
+	return s.MemoryStorage.SaveRefreshToken(ctx, token)
+}
+
+// RevokeRefreshToken отзывает токен обновления в памяти и дописывает
+// изменённую запись в файл. Записи истёкших и отозванных токенов
+// отбрасываются при загрузке, поэтому PurgeRefreshTokens файл не изменяет.
+func (s *FileStorage) RevokeRefreshToken(ctx context.Context, id string, final bool) (models.RefreshToken, error) {
+	s.sideMu.RLock()
+	defer s.sideMu.RUnlock()
+
+	token, err := s.MemoryStorage.RevokeRefreshToken(ctx, id, final)
+	if err != nil {
+		return models.RefreshToken{}, err
+	}
+	return token, s.tokenLog.Append(token)
+}
+
+// CreateAccount дописывает учётную запись в файл и сохраняет её в памяти.
+func (s *FileStorage) CreateAccount(_ context.Context, account models.Account) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	s.sideMu.RLock()
+	defer s.sideMu.RUnlock()
+
+	// Учётные записи создаются только под s.wmu, поэтому проверка
+	// остаётся верной и после снятия блокировки на время записи.
+	s.mu.RLock()
+	err := s.checkAccount(account)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if err := s.accountLog.Append(account); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.putAccount(account)
+	s.mu.Unlock()
+	return nil
+}
+
+// ClaimURLs записывает переданные записи ссылок в журнал и затем передаёт
+// ссылки пользователю в памяти.
+func (s *FileStorage) ClaimURLs(_ context.Context, fromUserID, toUserID string) ([]string, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	s.mu.RLock()
+	claimed := s.planClaim(fromUserID, toUserID)
+	s.mu.RUnlock()
+
+	if err := s.commit(updateEvents(claimed), func() { s.putAll(claimed) }); err != nil {
+		return nil, err
+	}
+	return shortIDs(claimed), nil
+}
+
+// CreateAPIKey дописывает запись ключа API в файл и сохраняет её в памяти.
+func (s *FileStorage) CreateAPIKey(ctx context.Context, key models.APIKey) error {
+	s.sideMu.RLock()
+	defer s.sideMu.RUnlock()
+
+	if err := s.apiKeyLog.Append(apiKeyRecord{APIKey: key}); err != nil {
+		return err
+	}
+	return s.MemoryStorage.CreateAPIKey(ctx, key)
+}
+
+// DeleteAPIKey удаляет ключ API пользователя из памяти и дописывает событие удаления в файл.
+func (s *FileStorage) DeleteAPIKey(_ context.Context, userID, id string) error {
+	s.sideMu.RLock()
+	defer s.sideMu.RUnlock()
+
+	s.mu.Lock()
+	err := s.deleteAPIKey(userID, id)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.apiKeyLog.Append(apiKeyRecord{Deleted: true, APIKey: models.APIKey{ID: id}})
+}
+
+// SaveTokenRevocation дописывает запись об отзыве токенов в файл и сохраняет её в памяти.
+// Истёкшие записи отбрасываются при загрузке, поэтому PurgeTokenRevocations файл не изменяет.
+func (s *FileStorage) SaveTokenRevocation(ctx context.Context, revocation models.TokenRevocation) error {
+	s.sideMu.RLock()
+	defer s.sideMu.RUnlock()
+
+	if err := s.revokedLog.Append(revocation); err != nil {
+		return err
+	}
+	return s.MemoryStorage.SaveTokenRevocation(ctx, revocation)
+}
+
+// Close дожидается фонового сжатия и закрывает файлы хранилища,
+// сбрасывая их на диск, если политика это предусматривает.
+func (s *FileStorage) Close() error {
+	s.wg.Wait()
+
+	var errs []error
+	for _, log := range []*file.Log{s.urlLog, s.clickLog, s.historyLog, s.jobLog, s.tokenLog, s.accountLog, s.apiKeyLog, s.revokedLog} {
+		if log != nil {
+			errs = append(errs, log.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
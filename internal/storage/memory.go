@@ -0,0 +1,874 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+)
+
+// MemoryStorage хранит сокращённые URL в памяти процесса.
+type MemoryStorage struct {
+	mu         sync.RWMutex
+	opts       options
+	urls       map[string]models.URLData         // Ключ — короткий идентификатор.
+	byOriginal map[string]string                 // Ключ — результат options.dedupKey, значение — короткий идентификатор.
+	clicks     map[string][]models.Click         // Ключ — короткий идентификатор.
+	history    map[string][]models.URLChange     // Ключ — короткий идентификатор.
+	jobs       map[string]models.Job             // Ключ — идентификатор задачи.
+	tokens     map[string]models.RefreshToken    // Ключ — хэш токена обновления.
+	accounts   map[string]models.Account         // Ключ — идентификатор пользователя.
+	logins     map[string]string                 // Ключ — логин, значение — идентификатор пользователя.
+	apiKeys    map[string]models.APIKey          // Ключ — идентификатор ключа API.
+	revoked    map[string]models.TokenRevocation // Ключ — результат revocationKey.
+}
+
+// NewMemoryStorage создаёт пустое хранилище в памяти.
+func NewMemoryStorage(opts ...Option) *MemoryStorage {
+	return &MemoryStorage{
+		opts:       newOptions(opts),
+		urls:       make(map[string]models.URLData),
+		byOriginal: make(map[string]string),
+		clicks:     make(map[string][]models.Click),
+		history:    make(map[string][]models.URLChange),
+		jobs:       make(map[string]models.Job),
+		tokens:     make(map[string]models.RefreshToken),
+		accounts:   make(map[string]models.Account),
+		logins:     make(map[string]string),
+		apiKeys:    make(map[string]models.APIKey),
+		revoked:    make(map[string]models.TokenRevocation),
+	}
+}
+
+// SaveURL сохраняет сокращённый URL в памяти. Если оригинальный URL уже
+// сокращён, возвращает существующий идентификатор и ErrAlreadyExists,
+// а если занят короткий идентификатор — ErrShortURLTaken. Для ссылки
+// с псевдонимом (models.URLData.Alias) дубликаты не ищутся.
+func (s *MemoryStorage) SaveURL(_ context.Context, event *models.URLData) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, err := s.planSave(event); err != nil {
+		return existing, err
+	}
+	s.put(*event)
+	return "", nil
+}
+
+// planSave проверяет, что ссылку можно сохранить, и заполняет момент её
+// создания, не изменяя хранилище. Возвращает ошибку и идентификатор
+// дубликата так же, как SaveURL. Вызывается под блокировкой.
+func (s *MemoryStorage) planSave(event *models.URLData) (string, error) {
+	if key, ok := s.opts.dedupKey(event); ok && !event.Alias {
+		if existing, ok := s.byOriginal[key]; ok {
+			// Удалённая ссылка и ссылка с истёкшим сроком действия не считаются дубликатами.
+			if data := s.urls[existing]; data.Active(time.Now()) {
+				return existing, ErrAlreadyExists
+			}
+		}
+	}
+	if _, ok := s.urls[event.ShortURL]; ok {
+		return "", ErrShortURLTaken
+	}
+	setCreatedAt(event)
+	return "", nil
+}
+
+// BatchSaveURLs сохраняет пакет ссылок в памяти: либо все ссылки пакета,
+// для которых не найден дубликат, либо ни одной, если занят хотя бы один
+// короткий идентификатор.
+func (s *MemoryStorage) BatchSaveURLs(_ context.Context, urls []*models.URLData) ([]error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs, taken := s.planBatch(urls)
+	if !taken {
+		s.putBatch(urls, errs)
+	}
+	return errs, nil
+}
+
+// planBatch определяет результат сохранения каждой ссылки пакета, не изменяя
+// хранилище, и сообщает, занят ли хотя бы один короткий идентификатор.
+// Вызывается под блокировкой.
+func (s *MemoryStorage) planBatch(urls []*models.URLData) ([]error, bool) {
+	errs := make([]error, len(urls))
+	keys := make(map[string]string)   // Ключи дубликатов, добавленные пакетом.
+	shortIDs := make(map[string]bool) // Короткие идентификаторы, добавленные пакетом.
+	var taken bool
+	now := time.Now()
+
+	for i, data := range urls {
+		key, dedup := s.opts.dedupKey(data)
+		if dedup {
+			if existing, ok := s.byOriginal[key]; ok && s.urls[existing].Active(now) {
+				data.ShortURL, errs[i] = existing, ErrAlreadyExists
+				continue
+			}
+			if existing, ok := keys[key]; ok {
+				data.ShortURL, errs[i] = existing, ErrAlreadyExists
+				continue
+			}
+		}
+		if _, ok := s.urls[data.ShortURL]; ok || shortIDs[data.ShortURL] {
+			errs[i], taken = ErrShortURLTaken, true
+			continue
+		}
+		if dedup {
+			keys[key] = data.ShortURL
+		}
+		shortIDs[data.ShortURL] = true
+		setCreatedAt(data)
+	}
+	return errs, taken
+}
+
+// putBatch добавляет ссылки пакета, для которых planBatch не вернул ошибку.
+// Вызывается под блокировкой.
+func (s *MemoryStorage) putBatch(urls []*models.URLData, errs []error) {
+	for i, data := range urls {
+		if errs[i] == nil {
+			s.put(*data)
+		}
+	}
+}
+
+// putAll добавляет или заменяет записи. Вызывается под блокировкой.
+func (s *MemoryStorage) putAll(urls []models.URLData) {
+	for _, data := range urls {
+		s.put(data)
+	}
+}
+
+// put добавляет или заменяет запись и обновляет индексы. Вызывается под блокировкой.
+func (s *MemoryStorage) put(data models.URLData) {
+	if prev, ok := s.urls[data.ShortURL]; ok {
+		if key, ok := s.opts.dedupKey(&prev); ok && s.byOriginal[key] == prev.ShortURL {
+			delete(s.byOriginal, key)
+		}
+	}
+	s.urls[data.ShortURL] = data
+	if key, ok := s.opts.dedupKey(&data); ok {
+		// Индекс указывает на самую новую ссылку, если предыдущая удалена или истекла.
+		if existing, exists := s.byOriginal[key]; !exists || !s.urls[existing].Active(time.Now()) {
+			s.byOriginal[key] = data.ShortURL
+		}
+	}
+}
+
+// GetOriginalURL возвращает запись по короткому идентификатору.
+func (s *MemoryStorage) GetOriginalURL(_ context.Context, shortID string) (models.URLData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.urls[shortID]
+	if !ok {
+		return models.URLData{}, ErrNotFound
+	}
+	return data, nil
+}
+
+// GetURLsByUser возвращает все сокращённые URL пользователя.
+func (s *MemoryStorage) GetURLsByUser(_ context.Context, userID string) ([]models.URLData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var urls []models.URLData
+	for _, data := range s.urls {
+		if data.UserUUID == userID {
+			urls = append(urls, data)
+		}
+	}
+	return urls, nil
+}
+
+// ListUserURLs возвращает страницу ссылок пользователя. Ссылки фильтруются
+// и сортируются при каждом запросе.
+func (s *MemoryStorage) ListUserURLs(_ context.Context, userID string, query models.URLListQuery) (models.URLPage, error) {
+	s.mu.RLock()
+	var urls []models.UserURL
+	for _, data := range s.urls {
+		if data.UserUUID == userID && matchesListQuery(data, query) {
+			urls = append(urls, models.UserURL{URLData: data, Clicks: len(s.clicks[data.ShortURL])})
+		}
+	}
+	s.mu.RUnlock()
+
+	return pageUserURLs(urls, query), nil
+}
+
+// pageUserURLs сортирует отфильтрованные ссылки пользователя и возвращает
+// страницу после курсора запроса.
+func pageUserURLs(urls []models.UserURL, query models.URLListQuery) models.URLPage {
+	dir := 1
+	if query.Desc {
+		dir = -1
+	}
+	slices.SortFunc(urls, func(a, b models.UserURL) int {
+		return dir * compareCursors(userURLCursor(a), userURLCursor(b), query.Sort)
+	})
+
+	start := 0
+	if query.After != nil {
+		start = sort.Search(len(urls), func(i int) bool {
+			return dir*compareCursors(userURLCursor(urls[i]), *query.After, query.Sort) > 0
+		})
+	}
+
+	page := models.URLPage{Total: len(urls), URLs: urls[start:]}
+	if query.Limit > 0 && len(page.URLs) > query.Limit {
+		page.URLs = page.URLs[:query.Limit]
+		next := userURLCursor(page.URLs[query.Limit-1])
+		next.Total = page.Total
+		page.Next = &next
+	}
+	return page
+}
+
+// matchesListQuery проверяет, что ссылка удовлетворяет фильтрам списка.
+func matchesListQuery(data models.URLData, query models.URLListQuery) bool {
+	switch query.Status {
+	case models.URLStatusActive:
+		if data.DeletedFlag {
+			return false
+		}
+	case models.URLStatusDeleted:
+		if !data.DeletedFlag {
+			return false
+		}
+	}
+	return query.Search == "" || strings.Contains(strings.ToLower(data.OriginalURL), strings.ToLower(query.Search))
+}
+
+// userURLCursor возвращает позицию ссылки в списке.
+func userURLCursor(u models.UserURL) models.URLCursor {
+	return models.URLCursor{CreatedAt: u.CreatedAt, Clicks: u.Clicks, ShortURL: u.ShortURL}
+}
+
+// compareCursors сравнивает позиции по полю сортировки by,
+// а при равенстве — по короткому идентификатору.
+func compareCursors(a, b models.URLCursor, by models.URLSort) int {
+	var c int
+	if by == models.URLSortClicks {
+		c = cmp.Compare(a.Clicks, b.Clicks)
+	} else {
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(a.ShortURL, b.ShortURL)
+}
+
+// ExportUserURLs передаёт в fn ссылки пользователя в порядке создания.
+// Блокировка не удерживается во время вызовов fn, поэтому медленный
+// получатель не задерживает другие операции с хранилищем.
+func (s *MemoryStorage) ExportUserURLs(ctx context.Context, userID string, fn func(models.ExportedURL) error) error {
+	s.mu.RLock()
+	var ids []string
+	for id, data := range s.urls {
+		if data.UserUUID == userID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := s.urls[ids[i]], s.urls[ids[j]]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ShortURL < b.ShortURL
+	})
+	s.mu.RUnlock()
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		s.mu.RLock()
+		data, ok := s.urls[id]
+		clicks := len(s.clicks[id])
+		s.mu.RUnlock()
+		// Ссылка могла быть окончательно удалена после начала выгрузки.
+		if !ok {
+			continue
+		}
+
+		if err := fn(models.ExportedURL{
+			ShortURL:    data.ShortURL,
+			OriginalURL: data.OriginalURL,
+			CreatedAt:   data.CreatedAt,
+			DeletedFlag: data.DeletedFlag,
+			Clicks:      clicks,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BatchDeleteURLs помечает удалёнными URL пользователя и возвращает
+// идентификаторы, которых нет среди его ссылок.
+func (s *MemoryStorage) BatchDeleteURLs(_ context.Context, userID string, ids []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted, missing := s.planDelete(userID, ids, time.Now())
+	s.putAll(deleted)
+	return missing, nil
+}
+
+// planDelete возвращает записи ссылок пользователя, помеченные удалёнными,
+// и идентификаторы, которых нет среди ссылок пользователя, не изменяя
+// хранилище. Отсутствующие, чужие и уже удалённые ссылки пропускаются.
+// Вызывается под блокировкой.
+func (s *MemoryStorage) planDelete(userID string, ids []string, now time.Time) ([]models.URLData, []string) {
+	deletedAt := now.UTC()
+	var deleted []models.URLData
+	var missing []string
+	planned := make(map[string]bool)
+	for _, id := range ids {
+		data, ok := s.urls[id]
+		if !ok || data.UserUUID != userID {
+			missing = append(missing, id)
+			continue
+		}
+		if data.DeletedFlag || planned[id] {
+			continue
+		}
+		planned[id] = true
+		data.DeletedFlag, data.DeletedAt = true, &deletedAt
+		deleted = append(deleted, data)
+	}
+	return deleted, missing
+}
+
+// RestoreURLs снимает пометку об удалении со ссылок пользователя.
+func (s *MemoryStorage) RestoreURLs(_ context.Context, userID string, ids []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	restored := s.planRestore(userID, ids, time.Now())
+	s.putAll(restored)
+	return len(restored), nil
+}
+
+// planRestore возвращает восстановленные записи ссылок пользователя,
+// не изменяя хранилище. Вызывается под блокировкой.
+func (s *MemoryStorage) planRestore(userID string, ids []string, now time.Time) []models.URLData {
+	var restored []models.URLData
+	planned := make(map[string]bool) // Идентификаторы восстановленных ссылок.
+	keys := make(map[string]bool)    // Ключи дубликатов восстановленных ссылок.
+	for _, id := range ids {
+		data, ok := s.urls[id]
+		if !ok || data.UserUUID != userID || !data.DeletedFlag || data.Expired(now) || planned[id] {
+			continue
+		}
+		// URL уже сокращён другой действующей ссылкой.
+		if key, ok := s.opts.dedupKey(&data); ok && !data.Alias {
+			if existing, ok := s.byOriginal[key]; ok && existing != id && s.urls[existing].Active(now) || keys[key] {
+				continue
+			}
+			keys[key] = true
+		}
+		planned[id] = true
+		data.DeletedFlag, data.DeletedAt = false, nil
+		restored = append(restored, data)
+	}
+	return restored
+}
+
+// PurgeDeletedURLs окончательно удаляет ссылки, помеченные удалёнными раньше before.
+func (s *MemoryStorage) PurgeDeletedURLs(_ context.Context, before time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := s.planPurge(before)
+	s.removeAll(purged)
+	return purged, nil
+}
+
+// planPurge возвращает короткие идентификаторы ссылок, помеченных удалёнными
+// раньше before. Вызывается под блокировкой.
+func (s *MemoryStorage) planPurge(before time.Time) []string {
+	var purged []string
+	for id, data := range s.urls {
+		if data.DeletedFlag && data.DeletedAt != nil && data.DeletedAt.Before(before) {
+			purged = append(purged, id)
+		}
+	}
+	return purged
+}
+
+// removeAll удаляет ссылки. Вызывается под блокировкой.
+func (s *MemoryStorage) removeAll(ids []string) {
+	for _, id := range ids {
+		s.remove(id)
+	}
+}
+
+// remove удаляет ссылку вместе с событиями переходов и историей изменений.
+// Вызывается под блокировкой.
+func (s *MemoryStorage) remove(id string) {
+	data, ok := s.urls[id]
+	if !ok {
+		return
+	}
+	if key, ok := s.opts.dedupKey(&data); ok && s.byOriginal[key] == id {
+		delete(s.byOriginal, key)
+	}
+	delete(s.urls, id)
+	delete(s.clicks, id)
+	delete(s.history, id)
+}
+
+// UpdateOriginalURL меняет оригинальный URL ссылки пользователя
+// и сохраняет предыдущий URL в истории изменений.
+func (s *MemoryStorage) UpdateOriginalURL(_ context.Context, shortID, userID, originalURL string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, change, err := s.planUpdate(shortID, userID, originalURL, time.Now())
+	if err != nil {
+		return err
+	}
+	s.put(data)
+	s.putChange(change)
+	return nil
+}
+
+// planUpdate возвращает запись ссылки с новым оригинальным URL и запись
+// истории с предыдущим, не изменяя хранилище. Вызывается под блокировкой.
+func (s *MemoryStorage) planUpdate(shortID, userID, originalURL string, now time.Time) (models.URLData, models.URLChange, error) {
+	data, ok := s.urls[shortID]
+	if !ok || data.UserUUID != userID || data.DeletedFlag {
+		return models.URLData{}, models.URLChange{}, ErrNotFound
+	}
+
+	change := models.URLChange{
+		ShortURL:    shortID,
+		OriginalURL: data.OriginalURL,
+		ChangedAt:   now.UTC(),
+	}
+	data.OriginalURL = originalURL
+	return data, change, nil
+}
+
+// putChange добавляет запись истории изменений. Вызывается под блокировкой.
+func (s *MemoryStorage) putChange(change models.URLChange) {
+	s.history[change.ShortURL] = append(s.history[change.ShortURL], change)
+}
+
+// GetURLHistory возвращает историю изменений оригинального URL ссылки.
+func (s *MemoryStorage) GetURLHistory(_ context.Context, shortID string) ([]models.URLChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]models.URLChange(nil), s.history[shortID]...), nil
+}
+
+// ExpireURLs помечает удалёнными ссылки с истёкшим сроком действия.
+func (s *MemoryStorage) ExpireURLs(_ context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expired := s.planExpire(now)
+	s.putAll(expired)
+	return len(expired), nil
+}
+
+// planExpire возвращает записи ссылок с истёкшим сроком действия, помеченные
+// удалёнными, не изменяя хранилище. Вызывается под блокировкой.
+func (s *MemoryStorage) planExpire(now time.Time) []models.URLData {
+	deletedAt := now.UTC()
+	var expired []models.URLData
+	for _, data := range s.urls {
+		if data.DeletedFlag || !data.Expired(now) {
+			continue
+		}
+		data.DeletedFlag, data.DeletedAt = true, &deletedAt
+		expired = append(expired, data)
+	}
+	return expired
+}
+
+// SaveClicks сохраняет события переходов по ссылкам.
+func (s *MemoryStorage) SaveClicks(_ context.Context, clicks []models.Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, click := range clicks {
+		s.putClick(click)
+	}
+	return nil
+}
+
+// putClick добавляет событие перехода. Вызывается под блокировкой.
+func (s *MemoryStorage) putClick(click models.Click) {
+	s.clicks[click.ShortURL] = append(s.clicks[click.ShortURL], click)
+}
+
+// GetClickStats возвращает статистику переходов по ссылке.
+func (s *MemoryStorage) GetClickStats(_ context.Context, shortID string) (models.ClickStats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	perDay := make(map[string]int)
+	for _, click := range s.clicks[shortID] {
+		perDay[click.Timestamp.UTC().Format(time.DateOnly)]++
+	}
+
+	stats := models.ClickStats{Total: len(s.clicks[shortID]), Days: make([]models.DailyClicks, 0, len(perDay))}
+	for date, clicks := range perDay {
+		stats.Days = append(stats.Days, models.DailyClicks{Date: date, Clicks: clicks})
+	}
+	sort.Slice(stats.Days, func(i, j int) bool { return stats.Days[i].Date < stats.Days[j].Date })
+	return stats, nil
+}
+
+// SaveJob сохраняет копию состояния задачи.
+func (s *MemoryStorage) SaveJob(_ context.Context, job models.Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.putJob(job)
+	return nil
+}
+
+// putJob сохраняет копию состояния задачи. Вызывается под блокировкой.
+func (s *MemoryStorage) putJob(job models.Job) {
+	s.jobs[job.ID] = job.Clone()
+}
+
+// GetJob возвращает копию задачи по идентификатору.
+func (s *MemoryStorage) GetJob(_ context.Context, id string) (models.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return models.Job{}, ErrNotFound
+	}
+	return job.Clone(), nil
+}
+
+// GetUnfinishedJobs возвращает копии незавершённых задач в порядке создания.
+func (s *MemoryStorage) GetUnfinishedJobs(_ context.Context) ([]models.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var jobs []models.Job
+	for _, job := range s.jobs {
+		if !job.Finished() {
+			jobs = append(jobs, job.Clone())
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+// SaveRefreshToken сохраняет запись токена обновления.
+func (s *MemoryStorage) SaveRefreshToken(_ context.Context, token models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.putRefreshToken(token)
+	return nil
+}
+
+// putRefreshToken сохраняет запись токена обновления. Вызывается под блокировкой.
+func (s *MemoryStorage) putRefreshToken(token models.RefreshToken) {
+	s.tokens[token.ID] = token
+}
+
+// RevokeRefreshToken отзывает действующий токен обновления.
+func (s *MemoryStorage) RevokeRefreshToken(_ context.Context, id string, final bool) (models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.revokeRefreshToken(id, final, time.Now())
+}
+
+// revokeRefreshToken отзывает токен id, если он действителен в момент now,
+// или отмечает повторный обмен недавно отозванного токена и возвращает
+// его изменённую запись. Вызывается под блокировкой.
+func (s *MemoryStorage) revokeRefreshToken(id string, final bool, now time.Time) (models.RefreshToken, error) {
+	token, ok := s.tokens[id]
+	switch {
+	case ok && token.Active(now):
+		token.RevokedAt = &now
+		token.Spent = final
+	case ok && token.Reusable(now, RefreshReuseGrace):
+		token.Spent = true
+	default:
+		return models.RefreshToken{}, ErrNotFound
+	}
+	s.tokens[id] = token
+	return token, nil
+}
+
+// PurgeRefreshTokens удаляет записи истёкших и отозванных токенов обновления.
+func (s *MemoryStorage) PurgeRefreshTokens(_ context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for id, token := range s.tokens {
+		if token.ExpiresAt.Before(before) || (token.RevokedAt != nil && token.RevokedAt.Before(before)) {
+			delete(s.tokens, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// CreateAccount сохраняет новую учётную запись.
+func (s *MemoryStorage) CreateAccount(_ context.Context, account models.Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkAccount(account); err != nil {
+		return err
+	}
+	s.putAccount(account)
+	return nil
+}
+
+// checkAccount проверяет, что логин и идентификатор учётной записи свободны.
+// Вызывается под блокировкой.
+func (s *MemoryStorage) checkAccount(account models.Account) error {
+	if _, ok := s.logins[account.Login]; ok {
+		return ErrLoginTaken
+	}
+	if _, ok := s.accounts[account.ID]; ok {
+		return ErrAccountExists
+	}
+	return nil
+}
+
+// putAccount сохраняет учётную запись. Вызывается под блокировкой.
+func (s *MemoryStorage) putAccount(account models.Account) {
+	s.accounts[account.ID] = account
+	s.logins[account.Login] = account.ID
+}
+
+// GetAccount возвращает учётную запись по идентификатору пользователя.
+func (s *MemoryStorage) GetAccount(_ context.Context, id string) (models.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	account, ok := s.accounts[id]
+	if !ok {
+		return models.Account{}, ErrNotFound
+	}
+	return account, nil
+}
+
+// GetAccountByLogin возвращает учётную запись по логину.
+func (s *MemoryStorage) GetAccountByLogin(_ context.Context, login string) (models.Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.logins[login]
+	if !ok {
+		return models.Account{}, ErrNotFound
+	}
+	return s.accounts[id], nil
+}
+
+// ClaimURLs передаёт ссылки пользователя fromUserID пользователю toUserID.
+func (s *MemoryStorage) ClaimURLs(_ context.Context, fromUserID, toUserID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	claimed := s.planClaim(fromUserID, toUserID)
+	s.putAll(claimed)
+	return shortIDs(claimed), nil
+}
+
+// shortIDs возвращает короткие идентификаторы ссылок.
+func shortIDs(urls []models.URLData) []string {
+	ids := make([]string, len(urls))
+	for i, data := range urls {
+		ids[i] = data.ShortURL
+	}
+	return ids
+}
+
+// planClaim возвращает записи ссылок пользователя fromUserID, переданные
+// пользователю toUserID, не изменяя хранилище. Вызывается под блокировкой.
+func (s *MemoryStorage) planClaim(fromUserID, toUserID string) []models.URLData {
+	var claimed []models.URLData
+	for _, data := range s.urls {
+		if data.UserUUID != fromUserID {
+			continue
+		}
+		data.UserUUID = toUserID
+		claimed = append(claimed, data)
+	}
+	return claimed
+}
+
+// CreateAPIKey сохраняет запись ключа API в памяти.
+func (s *MemoryStorage) CreateAPIKey(_ context.Context, key models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apiKeys[key.ID]; ok {
+		return fmt.Errorf("API key %s already exists", key.ID)
+	}
+	s.putAPIKey(key)
+	return nil
+}
+
+// putAPIKey сохраняет запись ключа API. Вызывается под s.mu.
+func (s *MemoryStorage) putAPIKey(key models.APIKey) {
+	s.apiKeys[key.ID] = key
+}
+
+// GetAPIKey возвращает запись ключа API по идентификатору.
+func (s *MemoryStorage) GetAPIKey(_ context.Context, id string) (models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.apiKeys[id]
+	if !ok {
+		return models.APIKey{}, ErrNotFound
+	}
+	return key, nil
+}
+
+// ListAPIKeys возвращает ключи API пользователя в порядке создания.
+func (s *MemoryStorage) ListAPIKeys(_ context.Context, userID string) ([]models.APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []models.APIKey
+	for _, key := range s.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortFunc(keys, func(a, b models.APIKey) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return keys, nil
+}
+
+// DeleteAPIKey удаляет ключ API пользователя из памяти.
+func (s *MemoryStorage) DeleteAPIKey(_ context.Context, userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.deleteAPIKey(userID, id)
+}
+
+// deleteAPIKey удаляет ключ API пользователя. Вызывается под s.mu.
+func (s *MemoryStorage) deleteAPIKey(userID, id string) error {
+	key, ok := s.apiKeys[id]
+	if !ok || key.UserID != userID {
+		return ErrNotFound
+	}
+	delete(s.apiKeys, id)
+	return nil
+}
+
+// revocationKey возвращает ключ записи об отзыве токенов: записи одного
+// токена или всех токенов одного пользователя заменяют друг друга.
+func revocationKey(r models.TokenRevocation) string {
+	return r.TokenID + "\x00" + r.UserID
+}
+
+// SaveTokenRevocation сохраняет запись об отзыве токенов в памяти.
+func (s *MemoryStorage) SaveTokenRevocation(_ context.Context, revocation models.TokenRevocation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.putTokenRevocation(revocation)
+	return nil
+}
+
+// putTokenRevocation сохраняет запись об отзыве токенов. Вызывается под блокировкой.
+func (s *MemoryStorage) putTokenRevocation(revocation models.TokenRevocation) {
+	s.revoked[revocationKey(revocation)] = revocation
+}
+
+// ListTokenRevocations возвращает записи об отзыве токенов, не истёкшие к моменту now.
+func (s *MemoryStorage) ListTokenRevocations(_ context.Context, now time.Time) ([]models.TokenRevocation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var revocations []models.TokenRevocation
+	for _, r := range s.revoked {
+		if r.ExpiresAt.After(now) {
+			revocations = append(revocations, r)
+		}
+	}
+	return revocations, nil
+}
+
+// PurgeTokenRevocations удаляет записи об отзыве токенов, истёкшие раньше before.
+func (s *MemoryStorage) PurgeTokenRevocations(_ context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for key, r := range s.revoked {
+		if r.ExpiresAt.Before(before) {
+			delete(s.revoked, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// GetURLsCount возвращает количество сокращённых URL.
+func (s *MemoryStorage) GetURLsCount(_ context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.urls), nil
+}
+
+// MaxShortURL возвращает наибольший сгенерированный короткий идентификатор
+// длины length из символов base62. Псевдонимы не учитываются.
+func (s *MemoryStorage) MaxShortURL(_ context.Context, length int) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var maxID string
+	for id, data := range s.urls {
+		if len(id) == length && isBase62(id) && !data.Alias && id > maxID {
+			maxID = id
+		}
+	}
+	return maxID, nil
+}
+
+// GetUsersCount возвращает количество уникальных пользователей.
+func (s *MemoryStorage) GetUsersCount(_ context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make(map[string]struct{})
+	for _, data := range s.urls {
+		users[data.UserUUID] = struct{}{}
+	}
+	return len(users), nil
+}
+
+// Ping всегда успешен для хранилища в памяти.
+func (s *MemoryStorage) Ping(_ context.Context) error {
+	return nil
+}
+
+// Close ничего не делает для хранилища в памяти.
+func (s *MemoryStorage) Close() error {
+	return nil
+}
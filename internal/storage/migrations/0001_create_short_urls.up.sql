@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS short_urls (
+    id SERIAL PRIMARY KEY,
+    short_url TEXT NOT NULL UNIQUE,
+    original_url TEXT NOT NULL UNIQUE,
+    user_id TEXT NOT NULL,
+    is_deleted BOOLEAN NOT NULL
+);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS short_urls_user_id_idx;
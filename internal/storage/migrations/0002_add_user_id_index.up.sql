@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS short_urls_user_id_idx ON short_urls (user_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS short_urls_original_url_idx;
+ALTER TABLE short_urls ADD CONSTRAINT short_urls_original_url_key UNIQUE (original_url);
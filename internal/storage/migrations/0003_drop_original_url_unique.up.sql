@@ -0,0 +1,2 @@
+ALTER TABLE short_urls DROP CONSTRAINT IF EXISTS short_urls_original_url_key;
+CREATE INDEX IF NOT EXISTS short_urls_original_url_idx ON short_urls (original_url);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS short_urls_expires_at_idx;
+ALTER TABLE short_urls DROP COLUMN IF EXISTS expires_at;
@@ -0,0 +1,2 @@
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS short_urls_expires_at_idx ON short_urls (expires_at) WHERE expires_at IS NOT NULL;
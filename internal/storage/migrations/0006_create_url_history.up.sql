@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS url_history (
+    id BIGSERIAL PRIMARY KEY,
+    short_url TEXT NOT NULL,
+    original_url TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS url_history_short_url_idx ON url_history (short_url, id);
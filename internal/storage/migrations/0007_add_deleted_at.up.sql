@@ -0,0 +1,3 @@
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+UPDATE short_urls SET deleted_at = NOW() WHERE is_deleted AND deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS short_urls_deleted_at_idx ON short_urls (deleted_at) WHERE is_deleted;
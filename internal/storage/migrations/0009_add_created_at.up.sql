@@ -0,0 +1,2 @@
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+CREATE INDEX IF NOT EXISTS short_urls_user_id_created_at_idx ON short_urls (user_id, created_at);
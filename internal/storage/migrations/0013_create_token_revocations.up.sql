@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS token_revocations (
+    token_id TEXT NOT NULL DEFAULT '',
+    user_id TEXT NOT NULL DEFAULT '',
+    revoked_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (token_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS token_revocations_expires_at_idx ON token_revocations (expires_at);
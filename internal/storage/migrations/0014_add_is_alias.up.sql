@@ -0,0 +1 @@
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS is_alias BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS short_urls_user_id_click_count_idx;
+ALTER TABLE short_urls DROP COLUMN IF EXISTS click_count;
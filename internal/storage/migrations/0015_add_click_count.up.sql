@@ -0,0 +1,5 @@
+ALTER TABLE short_urls ADD COLUMN IF NOT EXISTS click_count BIGINT NOT NULL DEFAULT 0;
+UPDATE short_urls u SET click_count = c.n
+FROM (SELECT short_url, COUNT(*) AS n FROM clicks GROUP BY short_url) c
+WHERE c.short_url = u.short_url;
+CREATE INDEX IF NOT EXISTS short_urls_user_id_click_count_idx ON short_urls (user_id, click_count, short_url);
@@ -0,0 +1 @@
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS spent BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	migrations, err := Load()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.NotEmpty(t, m.Up, "migration %d has no up script", m.Version)
+		assert.NotEmpty(t, m.Down, "migration %d has no down script", m.Version)
+		if i > 0 {
+			assert.Greater(t, m.Version, migrations[i-1].Version)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		want    []Migration
+		wantErr bool
+	}{
+		{
+			name: "sorted by version",
+			fsys: fstest.MapFS{
+				"0002_second.up.sql":   {Data: []byte("up2")},
+				"0001_first.up.sql":    {Data: []byte("up1")},
+				"0001_first.down.sql":  {Data: []byte("down1")},
+				"0002_second.down.sql": {Data: []byte("down2")},
+				"README.md":            {Data: []byte("ignored")},
+			},
+			want: []Migration{
+				{Version: 1, Name: "first", Up: "up1", Down: "down1"},
+				{Version: 2, Name: "second", Up: "up2", Down: "down2"},
+			},
+		},
+		{
+			name:    "missing up script",
+			fsys:    fstest.MapFS{"0001_first.down.sql": {Data: []byte("down1")}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid version",
+			fsys:    fstest.MapFS{"first_one.up.sql": {Data: []byte("up")}},
+			wantErr: true,
+		},
+		{
+			name: "conflicting names",
+			fsys: fstest.MapFS{
+				"0001_first.up.sql":   {Data: []byte("up")},
+				"0001_other.down.sql": {Data: []byte("down")},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := load(test.fsys)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
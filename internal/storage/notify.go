@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"go.uber.org/zap"
+)
+
+// InvalidationChannel — канал PostgreSQL, в который публикуются короткие
+// идентификаторы изменённых ссылок для сброса кэшей всех экземпляров сервиса.
+const InvalidationChannel = "short_urls_invalidation"
+
+// CreationChannel — канал PostgreSQL, в который публикуются короткие
+// идентификаторы созданных ссылок, чтобы все экземпляры сервиса сбросили
+// кэшированные отметки об их отсутствии.
+const CreationChannel = "short_urls_creation"
+
+// maxNotifyPayload ограничивает размер одного уведомления: PostgreSQL
+// не принимает уведомления длиннее 8000 байт.
+const maxNotifyPayload = 7900
+
+// Задержки повторного подключения слушателя уведомлений.
+const (
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+)
+
+// Invalidator сбрасывает записи кэша. Реализуется CachedStorage.
+type Invalidator interface {
+	// Invalidate удаляет записи о ссылках с указанными короткими идентификаторами.
+	Invalidate(shortIDs ...string)
+	// ForgetMissing удаляет отметки об отсутствии ссылок с указанными
+	// короткими идентификаторами.
+	ForgetMissing(shortIDs ...string)
+	// Flush удаляет все записи.
+	Flush()
+}
+
+// encodeInvalidation разбивает идентификаторы на JSON-массивы,
+// каждый из которых помещается в одно уведомление.
+func encodeInvalidation(shortIDs []string) []string {
+	var payloads []string
+	payload := []byte{'['}
+	for _, id := range shortIDs {
+		item, _ := json.Marshal(id)
+		if len(payload) > 1 && len(payload)+len(item)+2 > maxNotifyPayload {
+			payloads = append(payloads, string(append(payload, ']')))
+			payload = []byte{'['}
+		}
+		if len(payload) > 1 {
+			payload = append(payload, ',')
+		}
+		payload = append(payload, item...)
+	}
+	if len(payload) > 1 {
+		payloads = append(payloads, string(append(payload, ']')))
+	}
+	return payloads
+}
+
+// notifyInvalidation публикует идентификаторы изменённых ссылок в InvalidationChannel.
+// Уведомления доставляются подписчикам только после фиксации транзакции tx.
+func notifyInvalidation(ctx context.Context, tx *sql.Tx, shortIDs []string) error {
+	return notify(ctx, tx, InvalidationChannel, shortIDs)
+}
+
+// notifyCreation публикует идентификаторы созданных ссылок в CreationChannel.
+// Уведомления доставляются подписчикам только после фиксации транзакции tx.
+func notifyCreation(ctx context.Context, tx *sql.Tx, shortIDs []string) error {
+	return notify(ctx, tx, CreationChannel, shortIDs)
+}
+
+// notify публикует идентификаторы ссылок в канал channel.
+func notify(ctx context.Context, tx *sql.Tx, channel string, shortIDs []string) error {
+	payloads := encodeInvalidation(shortIDs)
+	if len(payloads) == 0 {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+		SELECT pg_notify($1, payload) FROM unnest($2::text[]) AS payload
+	`, channel, payloads)
+	return err
+}
+
+// ListenInvalidations подписывается на InvalidationChannel и CreationChannel
+// через отдельное подключение к базе данных dsn и удаляет из cache ссылки,
+// изменённые любым экземпляром сервиса, и отметки об отсутствии созданных ссылок. Уведомления, отправленные без подключения, теряются,
+// поэтому при потере и восстановлении подключения кэш очищается целиком,
+// а подключение восстанавливается с растущей задержкой. Работает до отмены контекста.
+func ListenInvalidations(ctx context.Context, dsn string, cache Invalidator) {
+	delay := minReconnectDelay
+	for {
+		connected, err := listenInvalidations(ctx, dsn, cache)
+		cache.Flush()
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			delay = minReconnectDelay
+		}
+		logger.Log.Warn("Cache invalidation listener disconnected",
+			zap.Duration("retry", delay), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// listenInvalidations обрабатывает уведомления до потери подключения.
+// connected сообщает, была ли подписка установлена.
+func listenInvalidations(ctx context.Context, dsn string, cache Invalidator) (connected bool, err error) {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close(context.Background())
+
+	for _, channel := range []string{InvalidationChannel, CreationChannel} {
+		if _, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return false, err
+		}
+	}
+	// Изменения, сделанные до подписки, могли быть пропущены.
+	cache.Flush()
+	logger.Log.Info("Cache invalidation listener connected")
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+
+		var shortIDs []string
+		if err := json.Unmarshal([]byte(notification.Payload), &shortIDs); err != nil {
+			logger.Log.Error("Invalid cache invalidation payload",
+				zap.String("payload", notification.Payload), zap.Error(err))
+			cache.Flush()
+			continue
+		}
+		if notification.Channel == CreationChannel {
+			cache.ForgetMissing(shortIDs...)
+		} else {
+			cache.Invalidate(shortIDs...)
+		}
+	}
+}
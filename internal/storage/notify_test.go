@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeInvalidation(t *testing.T) {
+	assert.Empty(t, encodeInvalidation(nil))
+	assert.Equal(t, []string{`["a","b\""]`}, encodeInvalidation([]string{"a", `b"`}))
+
+	// Большие пакеты разбиваются на уведомления допустимого размера без потерь.
+	ids := make([]string, 2000)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("short-%04d", i)
+	}
+	payloads := encodeInvalidation(ids)
+	require.Greater(t, len(payloads), 1)
+
+	var decoded []string
+	for _, payload := range payloads {
+		assert.LessOrEqual(t, len(payload), maxNotifyPayload)
+		var chunk []string
+		require.NoError(t, json.Unmarshal([]byte(payload), &chunk))
+		decoded = append(decoded, chunk...)
+	}
+	assert.Equal(t, ids, decoded)
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/file"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+)
+
+// DedupMode определяет, в каких пределах повторное сокращение
+// одного и того же оригинального URL считается дубликатом.
+type DedupMode string
+
+const (
+	// DedupGlobal — оригинальный URL сокращается один раз для всех пользователей.
+	DedupGlobal DedupMode = "global"
+	// DedupPerUser — оригинальный URL сокращается один раз для каждого пользователя.
+	DedupPerUser DedupMode = "user"
+	// DedupNone — дубликаты не отслеживаются, каждый запрос создаёт новую ссылку.
+	DedupNone DedupMode = "none"
+)
+
+// ParseDedupMode разбирает строковое значение режима дедупликации.
+// Пустая строка соответствует режиму по умолчанию DedupPerUser.
+func ParseDedupMode(s string) (DedupMode, error) {
+	switch mode := DedupMode(s); mode {
+	case "":
+		return DedupPerUser, nil
+	case DedupGlobal, DedupPerUser, DedupNone:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown dedup mode %q", s)
+	}
+}
+
+// options содержит общие настройки хранилищ.
+type options struct {
+	dedup        DedupMode
+	sync         file.SyncPolicy // Политика сброса файлов на диск.
+	syncInterval time.Duration   // Период сброса для политики file.SyncInterval.
+	compactSize  int64           // Размер журнала, при котором он сжимается; 0 — без сжатия.
+}
+
+// Option изменяет настройки хранилища.
+type Option func(*options)
+
+// WithDedupMode задаёт режим дедупликации оригинальных URL.
+func WithDedupMode(mode DedupMode) Option {
+	return func(o *options) {
+		o.dedup = mode
+	}
+}
+
+// WithFileSync задаёт политику сброса файлового хранилища на диск
+// и период сброса для политики file.SyncInterval.
+func WithFileSync(policy file.SyncPolicy, interval time.Duration) Option {
+	return func(o *options) {
+		o.sync, o.syncInterval = policy, interval
+	}
+}
+
+// WithCompactSize задаёт размер журнала файлового хранилища в байтах,
+// при достижении которого журнал сжимается в фоне. Нулевое значение
+// отключает автоматическое сжатие.
+func WithCompactSize(size int64) Option {
+	return func(o *options) {
+		o.compactSize = size
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		dedup:        DedupPerUser,
+		sync:         file.SyncInterval,
+		syncInterval: file.DefaultSyncInterval,
+		compactSize:  DefaultCompactSize,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// dedupKey возвращает ключ дубликатов для записи в соответствии с режимом
+// дедупликации или false, если дедупликация отключена.
+func (o options) dedupKey(data *models.URLData) (string, bool) {
+	switch o.dedup {
+	case DedupGlobal:
+		return data.OriginalURL, true
+	case DedupPerUser:
+		return data.UserUUID + "\x00" + data.OriginalURL, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,1014 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/storage/migrations"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// uniqueViolationCode — код ошибки PostgreSQL при нарушении ограничения уникальности.
+const uniqueViolationCode = "23505"
+
+// PostgresStorage хранит сокращённые URL в базе данных PostgreSQL.
+// Изменения ссылок публикуются в канал InvalidationChannel, а созданные
+// ссылки — в CreationChannel в той же транзакции, чтобы другие экземпляры
+// сервиса сбросили их из кэша.
+type PostgresStorage struct {
+	DB   *sql.DB // Подключение к базе данных.
+	opts options
+}
+
+// NewPostgresStorage подключается к базе данных и применяет
+// ещё не применённые миграции схемы.
+func NewPostgresStorage(ctx context.Context, dsn string, opts ...Option) (*PostgresStorage, error) {
+	// Подключение к базе данных.
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database connection: %w", err)
+	}
+
+	// Приведение схемы базы данных к актуальной версии.
+	if err = migrations.Up(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return &PostgresStorage{DB: db, opts: newOptions(opts)}, nil
+}
+
+// SaveURL сохраняет сокращённый URL в таблицу. Если оригинальный URL уже
+// сокращён (с учётом режима дедупликации), возвращает существующий
+// идентификатор и ErrAlreadyExists, а если занят короткий идентификатор —
+// ErrShortURLTaken. Для ссылки с псевдонимом (models.URLData.Alias)
+// дубликаты не ищутся.
+func (s *PostgresStorage) SaveURL(ctx context.Context, event *models.URLData) (string, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if existing, err := s.findDuplicate(ctx, tx, event); err != nil {
+		return "", err
+	} else if existing != "" {
+		return existing, ErrAlreadyExists
+	}
+
+	setCreatedAt(event)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO short_urls (short_url, original_url, user_id, is_deleted, expires_at, created_at, is_alias)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, event.ShortURL, event.OriginalURL, event.UserUUID, event.DeletedFlag, event.ExpiresAt, event.CreatedAt, event.Alias)
+	if isUniqueViolation(err, "short_urls_short_url_key") {
+		return "", ErrShortURLTaken
+	}
+	if err != nil {
+		return "", err
+	}
+	// Сброс кэшированного отсутствия ссылки на других экземплярах.
+	if err = notifyCreation(ctx, tx, []string{event.ShortURL}); err != nil {
+		return "", err
+	}
+	return "", tx.Commit()
+}
+
+// batchInsertSize — максимальное количество ссылок в одном многострочном INSERT,
+// ограничивающее число параметров запроса.
+const batchInsertSize = 1000
+
+// BatchSaveURLs сохраняет пакет ссылок одной транзакцией: дубликаты ищутся
+// одним запросом, а новые ссылки вставляются многострочными INSERT.
+// Если занят хотя бы один короткий идентификатор, транзакция откатывается.
+func (s *PostgresStorage) BatchSaveURLs(ctx context.Context, urls []*models.URLData) ([]error, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	errs := make([]error, len(urls))
+	if err = s.findDuplicates(ctx, tx, urls, errs); err != nil {
+		return nil, err
+	}
+
+	// Повтор короткого идентификатора внутри пакета отклоняется до вставки,
+	// чтобы не спутать его с успешно вставленной ссылкой.
+	var pending []*models.URLData
+	shortIDs := make(map[string]bool)
+	var taken bool
+	for i, data := range urls {
+		if errs[i] != nil {
+			continue
+		}
+		if shortIDs[data.ShortURL] {
+			errs[i], taken = ErrShortURLTaken, true
+			continue
+		}
+		shortIDs[data.ShortURL] = true
+		pending = append(pending, data)
+	}
+
+	inserted := make(map[string]bool, len(pending))
+	for start := 0; start < len(pending); start += batchInsertSize {
+		end := min(start+batchInsertSize, len(pending))
+		if err = insertURLs(ctx, tx, pending[start:end], inserted); err != nil {
+			return nil, err
+		}
+	}
+	for i, data := range urls {
+		if errs[i] == nil && !inserted[data.ShortURL] {
+			errs[i], taken = ErrShortURLTaken, true
+		}
+	}
+	if taken {
+		return errs, nil
+	}
+	created := make([]string, 0, len(inserted))
+	for shortID := range inserted {
+		created = append(created, shortID)
+	}
+	if err = notifyCreation(ctx, tx, created); err != nil {
+		return nil, err
+	}
+	return errs, tx.Commit()
+}
+
+// findDuplicates ищет ранее сокращённые URL пакета в соответствии с режимом
+// дедупликации и отмечает их в errs ошибкой ErrAlreadyExists, заменяя ShortURL
+// существующим идентификатором. Повторы внутри пакета ссылаются на первую
+// ссылку с тем же URL. Оригинальные URL блокируются так же, как в findDuplicate.
+func (s *PostgresStorage) findDuplicates(ctx context.Context, tx *sql.Tx, urls []*models.URLData, errs []error) error {
+	if s.opts.dedup != DedupGlobal && s.opts.dedup != DedupPerUser {
+		return nil
+	}
+
+	originals := make([]string, 0, len(urls))
+	users := make([]string, 0, len(urls))
+	for _, data := range urls {
+		originals = append(originals, data.OriginalURL)
+		users = append(users, data.UserUUID)
+	}
+
+	// Блокировки берутся в порядке URL, чтобы параллельные пакеты не взаимоблокировались.
+	if _, err := tx.ExecContext(ctx, `
+		SELECT pg_advisory_xact_lock(hashtext(original_url))
+		FROM (SELECT DISTINCT unnest($1::text[]) AS original_url ORDER BY 1) AS locked
+	`, originals); err != nil {
+		return err
+	}
+
+	query := `
+		SELECT DISTINCT ON (original_url) user_id, original_url, short_url FROM short_urls
+		WHERE original_url = ANY($1) AND NOT is_deleted
+			AND (expires_at IS NULL OR expires_at > NOW())
+		ORDER BY original_url, id
+	`
+	args := []any{originals}
+	if s.opts.dedup == DedupPerUser {
+		query = `
+			SELECT DISTINCT ON (user_id, original_url) user_id, original_url, short_url FROM short_urls
+			WHERE original_url = ANY($1) AND user_id = ANY($2) AND NOT is_deleted
+				AND (expires_at IS NULL OR expires_at > NOW())
+			ORDER BY user_id, original_url, id
+		`
+		args = append(args, users)
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	existing := make(map[string]string)
+	for rows.Next() {
+		var data models.URLData
+		if err = rows.Scan(&data.UserUUID, &data.OriginalURL, &data.ShortURL); err != nil {
+			return err
+		}
+		key, _ := s.opts.dedupKey(&data)
+		existing[key] = data.ShortURL
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for i, data := range urls {
+		key, _ := s.opts.dedupKey(data)
+		if shortID, ok := existing[key]; ok {
+			data.ShortURL, errs[i] = shortID, ErrAlreadyExists
+			continue
+		}
+		existing[key] = data.ShortURL
+	}
+	return nil
+}
+
+// insertURLs вставляет ссылки одним многострочным INSERT, пропуская занятые
+// короткие идентификаторы, и отмечает вставленные идентификаторы в inserted.
+func insertURLs(ctx context.Context, tx *sql.Tx, urls []*models.URLData, inserted map[string]bool) error {
+	var query strings.Builder
+	query.WriteString(`INSERT INTO short_urls (short_url, original_url, user_id, is_deleted, expires_at, created_at) VALUES `)
+	args := make([]any, 0, len(urls)*6)
+	for i, data := range urls {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		setCreatedAt(data)
+		n := len(args)
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6)
+		args = append(args, data.ShortURL, data.OriginalURL, data.UserUUID, data.DeletedFlag, data.ExpiresAt, data.CreatedAt)
+	}
+	query.WriteString(` ON CONFLICT (short_url) DO NOTHING RETURNING short_url`)
+
+	rows, err := tx.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var shortID string
+		if err = rows.Scan(&shortID); err != nil {
+			return err
+		}
+		inserted[shortID] = true
+	}
+	return rows.Err()
+}
+
+// isUniqueViolation проверяет, что ошибка вызвана нарушением указанного ограничения уникальности.
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode && pgErr.ConstraintName == constraint
+}
+
+// findDuplicate возвращает идентификатор ранее сокращённого URL, который не удалён
+// и срок действия которого не истёк, в соответствии с режимом дедупликации
+// или пустую строку, если дубликата нет. Проверка
+// выполняется под транзакционной advisory-блокировкой по оригинальному URL,
+// чтобы параллельные вставки одного URL не создали дубликаты.
+func (s *PostgresStorage) findDuplicate(ctx context.Context, tx *sql.Tx, event *models.URLData) (string, error) {
+	var query string
+	args := []any{event.OriginalURL}
+	if event.Alias {
+		return "", nil
+	}
+	switch s.opts.dedup {
+	case DedupGlobal:
+		query = `
+			SELECT short_url FROM short_urls
+			WHERE original_url = $1 AND NOT is_deleted
+				AND (expires_at IS NULL OR expires_at > NOW())
+			ORDER BY id LIMIT 1
+		`
+	case DedupPerUser:
+		query = `
+			SELECT short_url FROM short_urls
+			WHERE original_url = $1 AND user_id = $2 AND NOT is_deleted
+				AND (expires_at IS NULL OR expires_at > NOW())
+			ORDER BY id LIMIT 1
+		`
+		args = append(args, event.UserUUID)
+	default:
+		return "", nil
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, event.OriginalURL); err != nil {
+		return "", err
+	}
+
+	var existing string
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&existing)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return existing, err
+}
+
+// GetOriginalURL возвращает запись по короткому идентификатору.
+func (s *PostgresStorage) GetOriginalURL(ctx context.Context, shortID string) (models.URLData, error) {
+	data := models.URLData{ShortURL: shortID}
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT original_url, user_id, is_deleted, created_at, deleted_at, expires_at, is_alias FROM short_urls WHERE short_url = $1
+	`, shortID).Scan(&data.OriginalURL, &data.UserUUID, &data.DeletedFlag, &data.CreatedAt, &data.DeletedAt, &data.ExpiresAt, &data.Alias)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.URLData{}, ErrNotFound
+	}
+	if err != nil {
+		return models.URLData{}, err
+	}
+	return data, nil
+}
+
+// GetURLsByUser возвращает все сокращённые URL пользователя.
+func (s *PostgresStorage) GetURLsByUser(ctx context.Context, userID string) ([]models.URLData, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT short_url, original_url, is_deleted, created_at, deleted_at, expires_at, is_alias FROM short_urls WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []models.URLData
+	for rows.Next() {
+		data := models.URLData{UserUUID: userID}
+		if err := rows.Scan(&data.ShortURL, &data.OriginalURL, &data.DeletedFlag, &data.CreatedAt, &data.DeletedAt, &data.ExpiresAt, &data.Alias); err != nil {
+			return nil, err
+		}
+		urls = append(urls, data)
+	}
+	return urls, rows.Err()
+}
+
+// ListUserURLs возвращает страницу ссылок пользователя. Страницы выбираются
+// по ключу сортировки (keyset), поэтому их получение не замедляется
+// с удалением от начала списка. Количество переходов берётся из столбца
+// click_count, который обновляет SaveClicks. Общее количество ссылок
+// считается только для первой страницы и переносится курсором на следующие.
+func (s *PostgresStorage) ListUserURLs(ctx context.Context, userID string, query models.URLListQuery) (models.URLPage, error) {
+	args := []any{userID}
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	conds := []string{"u.user_id = $1"}
+	switch query.Status {
+	case models.URLStatusActive:
+		conds = append(conds, "NOT u.is_deleted")
+	case models.URLStatusDeleted:
+		conds = append(conds, "u.is_deleted")
+	}
+	if query.Search != "" {
+		conds = append(conds, fmt.Sprintf("strpos(lower(u.original_url), lower(%s)) > 0", arg(query.Search)))
+	}
+
+	var page models.URLPage
+	if query.After != nil {
+		page.Total = query.After.Total
+	} else if err := s.DB.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM short_urls u WHERE `+strings.Join(conds, " AND "), args...,
+	).Scan(&page.Total); err != nil {
+		return models.URLPage{}, err
+	}
+
+	sortExpr, dir, cmpOp := "u.created_at", "ASC", ">"
+	if query.Sort == models.URLSortClicks {
+		sortExpr = "u.click_count"
+	}
+	if query.Desc {
+		dir, cmpOp = "DESC", "<"
+	}
+	if after := query.After; after != nil {
+		var value any = after.CreatedAt
+		if query.Sort == models.URLSortClicks {
+			value = after.Clicks
+		}
+		conds = append(conds, fmt.Sprintf("(%s, u.short_url) %s (%s, %s)", sortExpr, cmpOp, arg(value), arg(after.ShortURL)))
+	}
+
+	q := fmt.Sprintf(`
+		SELECT u.short_url, u.original_url, u.is_deleted, u.created_at, u.deleted_at, u.expires_at, u.is_alias, u.click_count
+		FROM short_urls u WHERE %s
+		ORDER BY %s %s, u.short_url %s
+	`, strings.Join(conds, " AND "), sortExpr, dir, dir)
+	if query.Limit > 0 {
+		// Лишняя строка показывает, есть ли следующая страница.
+		q += " LIMIT " + arg(query.Limit+1)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, q, args...)
+	if err != nil {
+		return models.URLPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		u := models.UserURL{URLData: models.URLData{UserUUID: userID}}
+		if err := rows.Scan(&u.ShortURL, &u.OriginalURL, &u.DeletedFlag, &u.CreatedAt, &u.DeletedAt, &u.ExpiresAt, &u.Alias, &u.Clicks); err != nil {
+			return models.URLPage{}, err
+		}
+		page.URLs = append(page.URLs, u)
+	}
+	if err := rows.Err(); err != nil {
+		return models.URLPage{}, err
+	}
+
+	if query.Limit > 0 && len(page.URLs) > query.Limit {
+		page.URLs = page.URLs[:query.Limit]
+		last := page.URLs[query.Limit-1]
+		page.Next = &models.URLCursor{CreatedAt: last.CreatedAt, Clicks: last.Clicks, ShortURL: last.ShortURL, Total: page.Total}
+	}
+	return page, nil
+}
+
+// ExportUserURLs передаёт в fn ссылки пользователя в порядке создания.
+// Строки читаются из результата запроса по мере обработки.
+func (s *PostgresStorage) ExportUserURLs(ctx context.Context, userID string, fn func(models.ExportedURL) error) error {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT u.short_url, u.original_url, u.created_at, u.is_deleted, u.click_count
+		FROM short_urls u WHERE u.user_id = $1
+		ORDER BY u.created_at, u.id
+	`, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row models.ExportedURL
+		if err := rows.Scan(&row.ShortURL, &row.OriginalURL, &row.CreatedAt, &row.DeletedFlag, &row.Clicks); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// BatchDeleteURLs помечает удалёнными ссылки пользователя одним запросом
+// и возвращает идентификаторы, которых нет среди его ссылок.
+func (s *PostgresStorage) BatchDeleteURLs(ctx context.Context, userID string, ids []string) ([]string, error) {
+	if _, err := s.execInvalidating(ctx, `
+		UPDATE short_urls SET is_deleted = TRUE, deleted_at = NOW()
+		WHERE short_url = ANY($1) AND user_id = $2 AND NOT is_deleted
+		RETURNING short_url
+	`, ids, userID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT id FROM unnest($1::text[]) AS id
+		WHERE NOT EXISTS (SELECT 1 FROM short_urls WHERE short_url = id AND user_id = $2)
+	`, ids, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var missing []string
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		missing = append(missing, id)
+	}
+	return missing, rows.Err()
+}
+
+// RestoreURLs снимает пометку об удалении со ссылок пользователя,
+// срок действия которых не истёк и URL которых не сокращён другой
+// действующей ссылкой. Из нескольких восстанавливаемых ссылок на один URL
+// восстанавливается созданная первой.
+func (s *PostgresStorage) RestoreURLs(ctx context.Context, userID string, ids []string) (int, error) {
+	// Ключ дедупликации ссылки; у ссылок с псевдонимом он свой у каждой.
+	key := "CASE WHEN u.is_alias THEN u.short_url ELSE u.original_url END"
+	var conflict string
+	switch s.opts.dedup {
+	case DedupGlobal:
+		conflict = `AND (u.is_alias OR NOT EXISTS (
+			SELECT 1 FROM short_urls o
+			WHERE o.original_url = u.original_url AND NOT o.is_deleted
+				AND (o.expires_at IS NULL OR o.expires_at > NOW())
+		))`
+	case DedupPerUser:
+		conflict = `AND (u.is_alias OR NOT EXISTS (
+			SELECT 1 FROM short_urls o
+			WHERE o.original_url = u.original_url AND o.user_id = u.user_id AND NOT o.is_deleted
+				AND (o.expires_at IS NULL OR o.expires_at > NOW())
+		))`
+	default:
+		key = "u.short_url"
+	}
+	restored, err := s.execInvalidating(ctx, fmt.Sprintf(`
+		UPDATE short_urls SET is_deleted = FALSE, deleted_at = NULL
+		WHERE short_url IN (
+			SELECT DISTINCT ON (%[1]s) u.short_url FROM short_urls u
+			WHERE u.short_url = ANY($1) AND u.user_id = $2 AND u.is_deleted
+				AND (u.expires_at IS NULL OR u.expires_at > NOW()) %[2]s
+			ORDER BY %[1]s, u.id
+		)
+		RETURNING short_url
+	`, key, conflict), ids, userID)
+	return len(restored), err
+}
+
+// PurgeDeletedURLs окончательно удаляет ссылки, помеченные удалёнными раньше
+// before, вместе с событиями переходов и историей изменений.
+func (s *PostgresStorage) PurgeDeletedURLs(ctx context.Context, before time.Time) ([]string, error) {
+	return s.execInvalidating(ctx, `
+		WITH purged AS (
+			DELETE FROM short_urls WHERE is_deleted AND deleted_at < $1
+			RETURNING short_url
+		), purged_clicks AS (
+			DELETE FROM clicks WHERE short_url IN (SELECT short_url FROM purged)
+		), purged_history AS (
+			DELETE FROM url_history WHERE short_url IN (SELECT short_url FROM purged)
+		)
+		SELECT short_url FROM purged
+	`, before)
+}
+
+// UpdateOriginalURL меняет оригинальный URL ссылки пользователя
+// и сохраняет предыдущий URL в таблице url_history в одной транзакции.
+func (s *PostgresStorage) UpdateOriginalURL(ctx context.Context, shortID, userID, originalURL string) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.QueryRowContext(ctx, `
+		SELECT original_url FROM short_urls
+		WHERE short_url = $1 AND user_id = $2 AND NOT is_deleted
+		FOR UPDATE
+	`, shortID, userID).Scan(&previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO url_history (short_url, original_url) VALUES ($1, $2)
+	`, shortID, previous); err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, `
+		UPDATE short_urls SET original_url = $1 WHERE short_url = $2
+	`, originalURL, shortID); err != nil {
+		return err
+	}
+	if err = notifyInvalidation(ctx, tx, []string{shortID}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetURLHistory возвращает историю изменений оригинального URL ссылки.
+func (s *PostgresStorage) GetURLHistory(ctx context.Context, shortID string) ([]models.URLChange, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT original_url, changed_at FROM url_history WHERE short_url = $1 ORDER BY id
+	`, shortID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.URLChange
+	for rows.Next() {
+		change := models.URLChange{ShortURL: shortID}
+		if err := rows.Scan(&change.OriginalURL, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+	return history, rows.Err()
+}
+
+// ExpireURLs помечает удалёнными ссылки с истёкшим сроком действия.
+func (s *PostgresStorage) ExpireURLs(ctx context.Context, now time.Time) (int, error) {
+	expired, err := s.execInvalidating(ctx, `
+		UPDATE short_urls SET is_deleted = TRUE, deleted_at = $1
+		WHERE expires_at <= $1 AND NOT is_deleted
+		RETURNING short_url
+	`, now)
+	return len(expired), err
+}
+
+// execInvalidating выполняет в транзакции запрос, возвращающий короткие
+// идентификаторы изменённых ссылок, и публикует их для сброса кэшей.
+// Возвращает идентификаторы изменённых ссылок.
+func (s *PostgresStorage) execInvalidating(ctx context.Context, query string, args ...any) ([]string, error) {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var shortIDs []string
+	for rows.Next() {
+		var shortID string
+		if err = rows.Scan(&shortID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		shortIDs = append(shortIDs, shortID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err = notifyInvalidation(ctx, tx, shortIDs); err != nil {
+		return nil, err
+	}
+	return shortIDs, tx.Commit()
+}
+
+// SaveClicks сохраняет пакет событий переходов одним многострочным INSERT
+// и тем же запросом увеличивает счётчики click_count их ссылок.
+func (s *PostgresStorage) SaveClicks(ctx context.Context, clicks []models.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	var query strings.Builder
+	query.WriteString(`WITH inserted AS (INSERT INTO clicks (short_url, clicked_at, referrer, user_agent, ip_hash) VALUES `)
+	args := make([]any, 0, len(clicks)*5)
+	for i, click := range clicks {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5)
+		args = append(args, click.ShortURL, click.Timestamp, click.Referrer, click.UserAgent, click.IPHash)
+	}
+	query.WriteString(` RETURNING short_url)
+		UPDATE short_urls u SET click_count = u.click_count + c.n
+		FROM (SELECT short_url, COUNT(*) AS n FROM inserted GROUP BY short_url) c
+		WHERE u.short_url = c.short_url`)
+
+	_, err := s.DB.ExecContext(ctx, query.String(), args...)
+	return err
+}
+
+// GetClickStats возвращает статистику переходов по ссылке.
+func (s *PostgresStorage) GetClickStats(ctx context.Context, shortID string) (models.ClickStats, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, COUNT(*)
+		FROM clicks WHERE short_url = $1
+		GROUP BY day ORDER BY day
+	`, shortID)
+	if err != nil {
+		return models.ClickStats{}, err
+	}
+	defer rows.Close()
+
+	stats := models.ClickStats{Days: []models.DailyClicks{}}
+	for rows.Next() {
+		var day models.DailyClicks
+		if err := rows.Scan(&day.Date, &day.Clicks); err != nil {
+			return models.ClickStats{}, err
+		}
+		stats.Total += day.Clicks
+		stats.Days = append(stats.Days, day)
+	}
+	return stats, rows.Err()
+}
+
+// SaveJob сохраняет состояние задачи в таблице jobs.
+func (s *PostgresStorage) SaveJob(ctx context.Context, job models.Job) error {
+	ids, err := json.Marshal(job.IDs)
+	if err != nil {
+		return err
+	}
+	failures, err := json.Marshal(job.Failures)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DB.ExecContext(ctx, `
+		INSERT INTO jobs (id, kind, user_id, ids, status, processed, failures, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			processed = EXCLUDED.processed,
+			failures = EXCLUDED.failures,
+			updated_at = EXCLUDED.updated_at
+	`, job.ID, job.Kind, job.UserID, ids, string(job.Status), job.Processed, failures, job.CreatedAt, job.UpdatedAt)
+	return err
+}
+
+// jobColumns — столбцы таблицы jobs в порядке, ожидаемом scanJob.
+const jobColumns = `id, kind, user_id, ids, status, processed, failures, created_at, updated_at`
+
+// scanJob читает задачу из строки результата запроса.
+func scanJob(row interface{ Scan(...any) error }) (models.Job, error) {
+	var (
+		job      models.Job
+		ids      []byte
+		failures []byte
+	)
+	err := row.Scan(&job.ID, &job.Kind, &job.UserID, &ids, &job.Status, &job.Processed, &failures, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return models.Job{}, err
+	}
+	if err := json.Unmarshal(ids, &job.IDs); err != nil {
+		return models.Job{}, err
+	}
+	if err := json.Unmarshal(failures, &job.Failures); err != nil {
+		return models.Job{}, err
+	}
+	return job, nil
+}
+
+// GetJob возвращает задачу по идентификатору.
+func (s *PostgresStorage) GetJob(ctx context.Context, id string) (models.Job, error) {
+	job, err := scanJob(s.DB.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Job{}, ErrNotFound
+	}
+	return job, err
+}
+
+// GetUnfinishedJobs возвращает незавершённые задачи в порядке создания.
+func (s *PostgresStorage) GetUnfinishedJobs(ctx context.Context) ([]models.Job, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+jobColumns+` FROM jobs
+		WHERE status IN ('pending', 'running')
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// SaveRefreshToken сохраняет запись токена обновления в таблице refresh_tokens.
+func (s *PostgresStorage) SaveRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO refresh_tokens (id, user_id, created_at, expires_at, revoked_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, token.ID, token.UserID, token.CreatedAt, token.ExpiresAt, token.RevokedAt)
+	return err
+}
+
+// RevokeRefreshToken отзывает действующий токен обновления или отмечает
+// повторный обмен недавно отозванного одним запросом, поэтому токен
+// не может быть обменян больше двух раз.
+func (s *PostgresStorage) RevokeRefreshToken(ctx context.Context, id string, final bool) (models.RefreshToken, error) {
+	token := models.RefreshToken{ID: id}
+	now := time.Now()
+	err := s.DB.QueryRowContext(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = COALESCE(revoked_at, $2), spent = revoked_at IS NOT NULL OR $4
+		WHERE id = $1 AND expires_at > $2
+			AND (revoked_at IS NULL OR (NOT spent AND revoked_at > $3))
+		RETURNING user_id, created_at, expires_at, revoked_at, spent
+	`, id, now, now.Add(-RefreshReuseGrace), final).Scan(&token.UserID, &token.CreatedAt, &token.ExpiresAt, &token.RevokedAt, &token.Spent)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.RefreshToken{}, ErrNotFound
+	}
+	if err != nil {
+		return models.RefreshToken{}, err
+	}
+	return token, nil
+}
+
+// PurgeRefreshTokens удаляет записи истёкших и отозванных токенов обновления.
+func (s *PostgresStorage) PurgeRefreshTokens(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.DB.ExecContext(ctx, `
+		DELETE FROM refresh_tokens WHERE expires_at < $1 OR revoked_at < $1
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// CreateAccount сохраняет новую учётную запись в таблице accounts.
+func (s *PostgresStorage) CreateAccount(ctx context.Context, account models.Account) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO accounts (id, login, password_hash, created_at)
+		VALUES ($1, $2, $3, $4)
+	`, account.ID, account.Login, account.PasswordHash, account.CreatedAt)
+	switch {
+	case isUniqueViolation(err, "accounts_login_key"):
+		return ErrLoginTaken
+	case isUniqueViolation(err, "accounts_pkey"):
+		return ErrAccountExists
+	}
+	return err
+}
+
+// getAccount возвращает учётную запись, удовлетворяющую условию where с аргументом arg.
+func (s *PostgresStorage) getAccount(ctx context.Context, where string, arg string) (models.Account, error) {
+	var account models.Account
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT id, login, password_hash, created_at FROM accounts WHERE `+where+` = $1
+	`, arg).Scan(&account.ID, &account.Login, &account.PasswordHash, &account.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Account{}, ErrNotFound
+	}
+	return account, err
+}
+
+// GetAccount возвращает учётную запись по идентификатору пользователя.
+func (s *PostgresStorage) GetAccount(ctx context.Context, id string) (models.Account, error) {
+	return s.getAccount(ctx, "id", id)
+}
+
+// GetAccountByLogin возвращает учётную запись по логину.
+func (s *PostgresStorage) GetAccountByLogin(ctx context.Context, login string) (models.Account, error) {
+	return s.getAccount(ctx, "login", login)
+}
+
+// ClaimURLs передаёт ссылки пользователя fromUserID пользователю toUserID
+// и публикует их идентификаторы для сброса кэшей.
+func (s *PostgresStorage) ClaimURLs(ctx context.Context, fromUserID, toUserID string) ([]string, error) {
+	return s.execInvalidating(ctx, `
+		UPDATE short_urls SET user_id = $2
+		WHERE user_id = $1
+		RETURNING short_url
+	`, fromUserID, toUserID)
+}
+
+// CreateAPIKey сохраняет запись ключа API в таблице api_keys.
+// Права хранятся строкой через запятую.
+func (s *PostgresStorage) CreateAPIKey(ctx context.Context, key models.APIKey) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO api_keys (id, user_id, name, hash, scopes, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, key.ID, key.UserID, key.Name, key.Hash, strings.Join(key.Scopes, ","), key.CreatedAt, key.ExpiresAt)
+	return err
+}
+
+// apiKeyColumns — столбцы таблицы api_keys в порядке scanAPIKey.
+const apiKeyColumns = "id, user_id, name, hash, scopes, created_at, expires_at"
+
+// scanAPIKey читает запись ключа API из строки результата.
+func scanAPIKey(row interface{ Scan(...any) error }) (models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	if err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Hash, &scopes, &key.CreatedAt, &key.ExpiresAt); err != nil {
+		return models.APIKey{}, err
+	}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	return key, nil
+}
+
+// GetAPIKey возвращает запись ключа API по идентификатору.
+func (s *PostgresStorage) GetAPIKey(ctx context.Context, id string) (models.APIKey, error) {
+	key, err := scanAPIKey(s.DB.QueryRowContext(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1
+	`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIKey{}, ErrNotFound
+	}
+	return key, err
+}
+
+// ListAPIKeys возвращает ключи API пользователя в порядке создания.
+func (s *PostgresStorage) ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys WHERE user_id = $1 ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey удаляет ключ API пользователя.
+func (s *PostgresStorage) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	res, err := s.DB.ExecContext(ctx, `
+		DELETE FROM api_keys WHERE id = $1 AND user_id = $2
+	`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SaveTokenRevocation сохраняет запись об отзыве токенов в таблице token_revocations.
+func (s *PostgresStorage) SaveTokenRevocation(ctx context.Context, revocation models.TokenRevocation) error {
+	_, err := s.DB.ExecContext(ctx, `
+		INSERT INTO token_revocations (token_id, user_id, revoked_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (token_id, user_id) DO UPDATE
+		SET revoked_at = EXCLUDED.revoked_at, expires_at = EXCLUDED.expires_at
+	`, revocation.TokenID, revocation.UserID, revocation.RevokedAt, revocation.ExpiresAt)
+	return err
+}
+
+// ListTokenRevocations возвращает записи об отзыве токенов, не истёкшие к моменту now.
+func (s *PostgresStorage) ListTokenRevocations(ctx context.Context, now time.Time) ([]models.TokenRevocation, error) {
+	rows, err := s.DB.QueryContext(ctx, `
+		SELECT token_id, user_id, revoked_at, expires_at FROM token_revocations WHERE expires_at > $1
+	`, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revocations []models.TokenRevocation
+	for rows.Next() {
+		var r models.TokenRevocation
+		if err := rows.Scan(&r.TokenID, &r.UserID, &r.RevokedAt, &r.ExpiresAt); err != nil {
+			return nil, err
+		}
+		revocations = append(revocations, r)
+	}
+	return revocations, rows.Err()
+}
+
+// PurgeTokenRevocations удаляет записи об отзыве токенов, истёкшие раньше before.
+func (s *PostgresStorage) PurgeTokenRevocations(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.DB.ExecContext(ctx, `
+		DELETE FROM token_revocations WHERE expires_at < $1
+	`, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// GetURLsCount возвращает количество сокращённых URL.
+func (s *PostgresStorage) GetURLsCount(ctx context.Context) (int, error) {
+	var count int
+	err := s.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM short_urls").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get urls count: %w", err)
+	}
+	return count, nil
+}
+
+// MaxShortURL возвращает наибольший сгенерированный короткий идентификатор
+// длины length из символов base62. Псевдонимы не учитываются.
+func (s *PostgresStorage) MaxShortURL(ctx context.Context, length int) (string, error) {
+	var maxID string
+	err := s.DB.QueryRowContext(ctx, `
+		SELECT short_url FROM short_urls
+		WHERE length(short_url) = $1 AND short_url ~ '^[0-9A-Za-z]+$' AND NOT is_alias
+		ORDER BY short_url COLLATE "C" DESC LIMIT 1
+	`, length).Scan(&maxID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get max short url: %w", err)
+	}
+	return maxID, nil
+}
+
+// GetUsersCount возвращает количество уникальных пользователей.
+func (s *PostgresStorage) GetUsersCount(ctx context.Context) (int, error) {
+	var count int
+	err := s.DB.QueryRowContext(ctx, "SELECT COUNT(DISTINCT user_id) FROM short_urls").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get users count: %w", err)
+	}
+	return count, nil
+}
+
+// Ping проверяет подключение к базе данных.
+func (s *PostgresStorage) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
+
+// Close закрывает подключение к базе данных.
+func (s *PostgresStorage) Close() error {
+	return s.DB.Close()
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"go.uber.org/zap"
+)
+
+// RunReaper периодически помечает удалёнными ссылки с истёкшим сроком действия,
+// удаляет записи истёкших и отозванных токенов обновления, истёкшие записи
+// об отзыве токенов доступа и, если retention больше нуля, окончательно удаляет
+// ссылки, помеченные удалёнными раньше чем retention назад. Работает до отмены контекста.
+func RunReaper(ctx context.Context, s Storage, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			reap(ctx, s, now, retention)
+		}
+	}
+}
+
+// reap выполняет один проход очистки.
+func reap(ctx context.Context, s Storage, now time.Time, retention time.Duration) {
+	expired, err := s.ExpireURLs(ctx, now)
+	if err != nil {
+		logger.Log.Error("Failed to expire URLs", zap.Error(err))
+	} else if expired > 0 {
+		logger.Log.Info("Expired URLs marked as deleted", zap.Int("count", expired))
+	}
+
+	// Недавно отозванные токены остаются, пока их можно обменять повторно.
+	tokens, err := s.PurgeRefreshTokens(ctx, now.Add(-RefreshReuseGrace))
+	if err != nil {
+		logger.Log.Error("Failed to purge refresh tokens", zap.Error(err))
+	} else if tokens > 0 {
+		logger.Log.Info("Expired refresh tokens purged", zap.Int("count", tokens))
+	}
+
+	revocations, err := s.PurgeTokenRevocations(ctx, now)
+	if err != nil {
+		logger.Log.Error("Failed to purge token revocations", zap.Error(err))
+	} else if revocations > 0 {
+		logger.Log.Info("Expired token revocations purged", zap.Int("count", revocations))
+	}
+
+	if retention <= 0 {
+		return
+	}
+	purged, err := s.PurgeDeletedURLs(ctx, now.Add(-retention))
+	if err != nil {
+		logger.Log.Error("Failed to purge deleted URLs", zap.Error(err))
+	} else if len(purged) > 0 {
+		logger.Log.Info("Deleted URLs purged", zap.Int("count", len(purged)))
+	}
+}
@@ -1,267 +1,240 @@
-// Package storage предоставляет функции для работы с хранилищем данных
-// для сокращённых URL. В зависимости от конфигурации используется либо база данных,
-// либо файловое хранилище для сохранения, получения и управления сокращёнными ссылками.
+// Package storage предоставляет хранилища данных для сокращённых URL.
+// Все хранилища реализуют интерфейс Storage; конкретная реализация
+// (память, файл или база данных) выбирается при запуске приложения
+// в зависимости от конфигурации.
 package storage
 
 import (
 	"context"
-	"database/sql"
 	"errors"
-	"fmt"
-	"sync"
+	"time"
 
-	"github.com/jackc/pgx/v5"
 	"github.com/sol1corejz/go-url-shortener/cmd/config"
 	"github.com/sol1corejz/go-url-shortener/internal/file"
-	"github.com/sol1corejz/go-url-shortener/internal/logger"
 	"github.com/sol1corejz/go-url-shortener/internal/models"
-	"go.uber.org/zap"
-
-	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
-// URLStore представляет собой мапу для хранения сокращённых URL в памяти.
-// Ключом является сокращённый URL, значением - оригинальный URL.
-var URLStore = make(map[string]string)
-
-// Mu — мьютекс для синхронизации доступа к URLStore.
-var Mu sync.Mutex
-
-// DB представляет собой подключение к базе данных.
-var DB *sql.DB
-
-// ExistingShortURL используется для хранения найденного сокращённого URL в базе данных.
-var ExistingShortURL string
-
 // ErrAlreadyExists — ошибка, которая возвращается, если сокращённый URL уже существует.
 var ErrAlreadyExists = errors.New("ссылка уже сокращена")
 
-// InitializeStorage инициализирует хранилище данных, подключая либо базу данных,
-// либо файловое хранилище в зависимости от конфигурации.
-// В случае использования базы данных создаёт таблицу для хранения сокращённых URL,
-// а затем загружает существующие данные из базы данных или файла.
-func InitializeStorage(ctx context.Context) {
-	if config.DatabaseDSN != "" {
+// ErrShortURLTaken — ошибка, которая возвращается, если короткий идентификатор уже занят.
+var ErrShortURLTaken = errors.New("короткий идентификатор уже занят")
+
+// ErrNotFound — ошибка, которая возвращается, если сокращённый URL не найден.
+var ErrNotFound = errors.New("ссылка не найдена")
+
+// ErrLoginTaken — ошибка, которая возвращается, если логин учётной записи уже занят.
+var ErrLoginTaken = errors.New("логин уже занят")
+
+// ErrAccountExists — ошибка, которая возвращается, если у пользователя уже есть учётная запись.
+var ErrAccountExists = errors.New("учётная запись пользователя уже существует")
+
+// RefreshReuseGrace — время после отзыва токена обновления, в течение
+// которого токен можно обменять ещё один раз. Так параллельные запросы
+// с одним и тем же токеном из cookies не теряют сессию.
+const RefreshReuseGrace = 10 * time.Second
+
+// Storage описывает хранилище сокращённых URL.
+type Storage interface {
+	// SaveURL сохраняет сокращённый URL. Если оригинальный URL уже был сокращён
+	// (с учётом режима дедупликации) и срок действия ссылки не истёк, возвращает существующий идентификатор
+	// и ошибку ErrAlreadyExists. Если занят короткий идентификатор,
+	// возвращает ErrShortURLTaken.
+	SaveURL(ctx context.Context, event *models.URLData) (string, error)
+
+	// BatchSaveURLs сохраняет пакет ссылок одной транзакцией и возвращает
+	// результат для каждой ссылки в порядке пакета: nil, если ссылка создана,
+	// ErrAlreadyExists, если оригинальный URL уже сокращён (в том числе ранее
+	// в этом же пакете) — тогда ShortURL ссылки заменяется существующим
+	// идентификатором, или ErrShortURLTaken, если занят короткий идентификатор.
+	// Если занят хотя бы один идентификатор, ни одна ссылка не сохраняется.
+	BatchSaveURLs(ctx context.Context, urls []*models.URLData) ([]error, error)
+
+	// GetOriginalURL возвращает запись по короткому идентификатору
+	// или ошибку ErrNotFound, если запись отсутствует.
+	GetOriginalURL(ctx context.Context, shortID string) (models.URLData, error)
+
+	// GetURLsByUser возвращает все сокращённые URL указанного пользователя.
+	GetURLsByUser(ctx context.Context, userID string) ([]models.URLData, error)
+
+	// ListUserURLs возвращает страницу ссылок пользователя, отфильтрованных
+	// и упорядоченных в соответствии с query, вместе с количеством переходов.
+	ListUserURLs(ctx context.Context, userID string, query models.URLListQuery) (models.URLPage, error)
+
+	// ExportUserURLs передаёт в fn по одной все ссылки пользователя вместе
+	// с количеством переходов в порядке создания, не загружая их в память
+	// целиком. Ошибка fn прерывает выгрузку и возвращается вызывающему.
+	ExportUserURLs(ctx context.Context, userID string, fn func(models.ExportedURL) error) error
+
+	// BatchDeleteURLs помечает удалёнными одной операцией все перечисленные
+	// сокращённые URL, принадлежащие указанному пользователю. Возвращает
+	// идентификаторы, которых нет среди ссылок пользователя.
+	BatchDeleteURLs(ctx context.Context, userID string, ids []string) ([]string, error)
 
-		// Подключение к базе данных.
-		db, err := sql.Open("pgx", config.DatabaseDSN)
-		if err != nil {
-			logger.Log.Error("Error opening database connection", zap.Error(err))
-			return
-		}
+	// RestoreURLs снимает пометку об удалении со ссылок пользователя, которые
+	// ещё не удалены окончательно и срок действия которых не истёк. Ссылка не
+	// восстанавливается, если её URL с учётом режима дедупликации уже сокращён
+	// другой действующей ссылкой: у одного URL не может быть двух действующих
+	// ссылок. На ссылки с псевдонимом это ограничение не распространяется.
+	// Возвращает количество восстановленных ссылок.
+	RestoreURLs(ctx context.Context, userID string, ids []string) (int, error)
+
+	// PurgeDeletedURLs окончательно удаляет ссылки, помеченные удалёнными
+	// раньше момента before, вместе с их статистикой и историей изменений.
+	// Возвращает короткие идентификаторы удалённых ссылок.
+	PurgeDeletedURLs(ctx context.Context, before time.Time) ([]string, error)
+
+	// UpdateOriginalURL меняет оригинальный URL ссылки, если она принадлежит
+	// указанному пользователю и не удалена, иначе возвращает ErrNotFound.
+	// Предыдущий URL сохраняется в истории изменений.
+	UpdateOriginalURL(ctx context.Context, shortID, userID, originalURL string) error
+
+	// GetURLHistory возвращает предыдущие оригинальные URL ссылки
+	// в порядке их замены.
+	GetURLHistory(ctx context.Context, shortID string) ([]models.URLChange, error)
+
+	// ExpireURLs помечает удалёнными ссылки, срок действия которых истёк
+	// к моменту now, и возвращает количество помеченных ссылок.
+	ExpireURLs(ctx context.Context, now time.Time) (int, error)
+
+	// SaveClicks сохраняет пакет событий перехода по ссылкам.
+	SaveClicks(ctx context.Context, clicks []models.Click) error
+
+	// GetClickStats возвращает статистику переходов по короткому идентификатору:
+	// общее количество и распределение по дням (UTC).
+	GetClickStats(ctx context.Context, shortID string) (models.ClickStats, error)
+
+	// SaveJob сохраняет фоновую задачу, заменяя ранее сохранённое состояние
+	// задачи с тем же идентификатором.
+	SaveJob(ctx context.Context, job models.Job) error
+
+	// GetJob возвращает задачу по идентификатору или ErrNotFound.
+	GetJob(ctx context.Context, id string) (models.Job, error)
+
+	// GetUnfinishedJobs возвращает незавершённые задачи в порядке создания.
+	GetUnfinishedJobs(ctx context.Context) ([]models.Job, error)
+
+	// SaveRefreshToken сохраняет запись выданного токена обновления.
+	SaveRefreshToken(ctx context.Context, token models.RefreshToken) error
+
+	// RevokeRefreshToken отзывает действующий токен обновления и возвращает
+	// его запись. Токен, отозванный меньше чем RefreshReuseGrace назад,
+	// обменивается повторно один раз; если final, окно повторного обмена
+	// закрывается сразу. Если токена нет, он истёк или уже отозван
+	// и повторно не обменивается, возвращает ErrNotFound.
+	RevokeRefreshToken(ctx context.Context, id string, final bool) (models.RefreshToken, error)
+
+	// PurgeRefreshTokens удаляет записи токенов обновления, истёкших или
+	// отозванных раньше момента before, и возвращает их количество.
+	PurgeRefreshTokens(ctx context.Context, before time.Time) (int, error)
+
+	// CreateAccount сохраняет новую учётную запись. Если логин уже занят,
+	// возвращает ErrLoginTaken, а если у пользователя уже есть учётная
+	// запись — ErrAccountExists.
+	CreateAccount(ctx context.Context, account models.Account) error
+
+	// GetAccount возвращает учётную запись по идентификатору пользователя или ErrNotFound.
+	GetAccount(ctx context.Context, id string) (models.Account, error)
+
+	// GetAccountByLogin возвращает учётную запись по логину или ErrNotFound.
+	GetAccountByLogin(ctx context.Context, login string) (models.Account, error)
+
+	// ClaimURLs передаёт все ссылки пользователя fromUserID пользователю toUserID
+	// и возвращает короткие идентификаторы переданных ссылок. Дедупликация при этом
+	// не применяется: у пользователя могут оказаться две ссылки на один URL.
+	ClaimURLs(ctx context.Context, fromUserID, toUserID string) ([]string, error)
+
+	// CreateAPIKey сохраняет запись нового ключа API.
+	CreateAPIKey(ctx context.Context, key models.APIKey) error
 
-		DB = db
-
-		// Создание таблицы для хранения сокращённых URL, если она не существует.
-		_, err = DB.ExecContext(ctx, `
-			CREATE TABLE IF NOT EXISTS short_urls (
-				id SERIAL PRIMARY KEY,
-				short_url TEXT NOT NULL UNIQUE,
-				original_url TEXT NOT NULL UNIQUE,
-			    user_id TEXT NOT NULL,
-			    is_deleted BOOLEAN NOT NULL
-			)
-		`)
-		if err != nil {
-			logger.Log.Error("Error creating table", zap.Error(err))
-			return
-		}
+	// GetAPIKey возвращает запись ключа API по идентификатору или ErrNotFound.
+	GetAPIKey(ctx context.Context, id string) (models.APIKey, error)
 
-		// Загрузка существующих URL из базы данных.
-		err = loadURLsFromDB()
-		if err != nil {
-			logger.Log.Error("Error loading URLs from DB", zap.Error(err))
-			return
-		}
+	// ListAPIKeys возвращает ключи API пользователя в порядке создания.
+	ListAPIKeys(ctx context.Context, userID string) ([]models.APIKey, error)
 
-	} else if config.FileStoragePath != "" {
-		// Загрузка существующих URL из файлового хранилища.
-		err := loadURLsFromFile()
-		if err != nil {
-			logger.Log.Error("Error loading URLs from file", zap.Error(err))
-			return
-		}
-	}
-}
+	// DeleteAPIKey удаляет ключ API пользователя. Если у пользователя
+	// нет такого ключа, возвращает ErrNotFound.
+	DeleteAPIKey(ctx context.Context, userID, id string) error
 
-// loadURLsFromDB загружает данные сокращённых URL из базы данных в память.
-func loadURLsFromDB() error {
-	rows, err := DB.Query("SELECT short_url, original_url FROM short_urls")
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
+	// SaveTokenRevocation сохраняет запись об отзыве токенов. Запись с теми же
+	// TokenID и UserID заменяет предыдущую.
+	SaveTokenRevocation(ctx context.Context, revocation models.TokenRevocation) error
 
-	// Преобразуем каждую запись в мапу.
-	for rows.Next() {
-		var shortURL, originalURL string
-		if err = rows.Scan(&shortURL, &originalURL); err != nil {
-			return err
-		}
-		URLStore[shortURL] = originalURL
-	}
-	return rows.Err()
-}
+	// ListTokenRevocations возвращает записи об отзыве токенов, которые ещё не истекли к моменту now.
+	ListTokenRevocations(ctx context.Context, now time.Time) ([]models.TokenRevocation, error)
 
-// loadURLsFromFile загружает данные сокращённых URL из файла в память.
-func loadURLsFromFile() error {
-	consumer, err := file.NewConsumer(config.FileStoragePath)
-	if err != nil {
-		return err
-	}
-	defer consumer.File.Close()
+	// PurgeTokenRevocations удаляет записи об отзыве токенов, истёкшие раньше before.
+	// Возвращает количество удалённых записей.
+	PurgeTokenRevocations(ctx context.Context, before time.Time) (int, error)
 
-	// Чтение каждого события из файла и добавление его в мапу.
-	for {
-		event, err := consumer.ReadEvent()
-		if err != nil {
-			break
-		}
-		URLStore[event.ShortURL] = event.OriginalURL
-	}
-	return nil
-}
+	// GetURLsCount возвращает количество сокращённых URL.
+	GetURLsCount(ctx context.Context) (int, error)
 
-// SaveURL сохраняет новый или обновлённый сокращённый URL в хранилище.
-// В случае использования базы данных данные записываются в таблицу,
-// в случае файлового хранилища — в файл. Возвращает сокращённый URL или ошибку,
-// если URL уже существует.
-func SaveURL(event *models.URLData) (string, error) {
-	if DB != nil {
+	// MaxShortURL возвращает наибольший короткий идентификатор длины length,
+	// состоящий из символов base62, или пустую строку, если таких нет.
+	// Идентификаторы сравниваются посимвольно в порядке байтов. Псевдонимы
+	// (models.URLData.Alias) не учитываются: их выбирает пользователь.
+	MaxShortURL(ctx context.Context, length int) (string, error)
 
-		// Проверяем, существует ли уже сокращённый URL для данного оригинального URL.
-		err := DB.QueryRow(`
-			SELECT short_url FROM short_urls WHERE original_url=$1
-		`, event.OriginalURL).Scan(&ExistingShortURL)
+	// GetUsersCount возвращает количество уникальных пользователей.
+	GetUsersCount(ctx context.Context) (int, error)
 
-		if err != nil {
-			if !errors.Is(err, pgx.ErrNoRows) {
-			} else {
-				return "", err
-			}
-		}
+	// Ping проверяет доступность хранилища.
+	Ping(ctx context.Context) error
 
-		if ExistingShortURL != "" {
-			event.ShortURL = ExistingShortURL
-			return ExistingShortURL, ErrAlreadyExists
-		}
+	// Close освобождает ресурсы хранилища.
+	Close() error
+}
 
-		// Вставка нового URL в таблицу, с обновлением в случае конфликта.
-		_, err = DB.Exec(`
-			INSERT INTO short_urls (short_url, original_url, user_id, is_deleted) 
-			VALUES ($1, $2, $3, $4) 
-			ON CONFLICT (original_url)
-			DO UPDATE SET short_url = short_urls.short_url
-		`, event.ShortURL, event.OriginalURL, event.UserUUID, event.DeletedFlag)
+// New создаёт хранилище в зависимости от конфигурации: базу данных,
+// если задана строка подключения, встроенную базу bbolt или файл,
+// если задан путь к ним, и хранилище в памяти в остальных случаях. Перед базой данных
+// размещается кэш переходов, если он включён.
+func New(ctx context.Context) (Storage, error) {
+	dedup, err := ParseDedupMode(config.DedupMode)
+	if err != nil {
+		return nil, err
+	}
+	opts := []Option{WithDedupMode(dedup)}
 
+	if config.DatabaseDSN != "" {
+		store, err := NewPostgresStorage(ctx, config.DatabaseDSN, opts...)
 		if err != nil {
-			return "", err
+			return nil, err
 		}
-
-		return "", nil
-	} else if config.FileStoragePath != "" {
-		// Сохранение URL в файл при использовании файлового хранилища.
-		producer, err := file.NewProducer(config.FileStoragePath)
-		if err != nil {
-			return "", err
+		if config.CacheSize <= 0 {
+			return store, nil
 		}
-		defer producer.File.Close()
-
-		// Блокировка для синхронизации работы с памятью.
-		Mu.Lock()
-		URLStore[event.ShortURL] = event.OriginalURL
-		Mu.Unlock()
-
-		return "", producer.WriteEvent(event)
+		return NewCachedStorage(store, config.CacheSize, config.CacheTTL, config.CacheNegativeTTL), nil
 	}
-
-	// Сохранение URL в память, если нет базы данных или файлового хранилища.
-	Mu.Lock()
-	URLStore[event.ShortURL] = event.OriginalURL
-	Mu.Unlock()
-	return "", nil
-}
-
-// GetOriginalURL возвращает оригинальный URL для сокращённого URL,
-// а также флаг, указывающий, был ли он удалён.
-func GetOriginalURL(shortID string) (string, bool, bool) {
-	if DB != nil {
-		var originalURL string
-		var deleted bool
-		err := DB.QueryRow("SELECT original_url, is_deleted FROM short_urls WHERE short_url = $1", shortID).Scan(&originalURL, &deleted)
-
-		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				return "", false, false
-			}
-			return "", false, false
-		}
-		return originalURL, deleted, true
+	if config.BoltStoragePath != "" {
+		return NewBoltStorage(config.BoltStoragePath, opts...)
 	}
-
-	// Получение URL из памяти, если нет базы данных.
-	Mu.Lock()
-	defer Mu.Unlock()
-	originalURL, ok := URLStore[shortID]
-	return originalURL, false, ok
-}
-
-// GetURLsByUser возвращает все сокращённые URL для указанного пользователя.
-func GetURLsByUser(userID string) ([]models.URLData, error) {
-	if DB != nil {
-		rows, err := DB.Query("SELECT short_url, original_url FROM short_urls WHERE user_id = $1", userID)
+	if config.FileStoragePath != "" {
+		sync, err := file.ParseSyncPolicy(config.FileSync)
 		if err != nil {
 			return nil, err
 		}
-		defer rows.Close()
-
-		var urls []models.URLData
-		for rows.Next() {
-			var shortURL, originalURL string
-			if err := rows.Scan(&shortURL, &originalURL); err != nil {
-				return nil, err
-			}
-			urls = append(urls, models.URLData{ShortURL: config.FlagBaseURL + "/" + shortURL, OriginalURL: originalURL})
-		}
-		return urls, rows.Err()
+		opts = append(opts, WithFileSync(sync, config.FileSyncInterval), WithCompactSize(config.FileCompactSize))
+		return NewFileStorage(config.FileStoragePath, opts...)
 	}
-	return nil, nil
-}
-
-// BatchUpdateDeleteFlag обновляет флаг is_deleted для указанного сокращённого URL,
-// если он принадлежит указанному пользователю.
-func BatchUpdateDeleteFlag(urlID string, userID string) error {
-	query := `UPDATE short_urls SET is_deleted = TRUE WHERE short_url = $1 AND user_id = $2`
-	_, err := DB.Exec(query, urlID, userID)
-	return err
+	return NewMemoryStorage(opts...), nil
 }
 
-// GetURLsCount возвращает количество сокращенных адресов.
-func GetURLsCount() (int, error) {
-	// Проверка на наличие соединения с бд
-	if DB == nil {
-		return 0, fmt.Errorf("database connection is not initialized")
-	}
-
-	var count int
-	err := DB.QueryRow("SELECT COUNT(*) FROM short_urls").Scan(&count)
-	if err != nil {
-		return 0, err
+// isBase62 сообщает, состоит ли идентификатор только из латинских букв и цифр.
+func isBase62(id string) bool {
+	for i := 0; i < len(id); i++ {
+		if c := id[i]; !(c >= '0' && c <= '9' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z') {
+			return false
+		}
 	}
-	return count, nil
+	return true
 }
 
-// GetUsersCount возвращает количество уникальных пользователей.
-func GetUsersCount() (int, error) {
-	// Проверка на наличие соединения с бд
-	if DB == nil {
-		return 0, fmt.Errorf("database connection is not initialized")
-	}
-
-	var count int
-	err := DB.QueryRow("SELECT COUNT(DISTINCT user_id) FROM short_urls").Scan(&count)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get users count: %w", err)
+// setCreatedAt заполняет момент создания ссылки, если он не задан.
+func setCreatedAt(data *models.URLData) {
+	if data.CreatedAt.IsZero() {
+		data.CreatedAt = time.Now().UTC()
 	}
-	return count, nil
 }
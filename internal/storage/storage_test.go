@@ -0,0 +1,755 @@
+package storage_test
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/sol1corejz/go-url-shortener/internal/file"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	"github.com/sol1corejz/go-url-shortener/internal/storage/storagetest"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, opts ...storage.Option) storage.Storage {
+		return storage.NewMemoryStorage(opts...)
+	})
+}
+
+func TestFileStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, opts ...storage.Option) storage.Storage {
+		s, err := storage.NewFileStorage(filepath.Join(t.TempDir(), "storage.json"), opts...)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestBoltStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, opts ...storage.Option) storage.Storage {
+		s, err := storage.NewBoltStorage(filepath.Join(t.TempDir(), "storage.db"), opts...)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+// TestPostgresStorage запускается только при заданной переменной TEST_DATABASE_DSN.
+func TestPostgresStorage(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	storagetest.Run(t, func(t *testing.T, opts ...storage.Option) storage.Storage {
+		s, err := storage.NewPostgresStorage(context.Background(), dsn, opts...)
+		require.NoError(t, err)
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestCachedStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T, opts ...storage.Option) storage.Storage {
+		return storage.NewCachedStorage(storage.NewMemoryStorage(opts...), 100, time.Minute, time.Minute)
+	})
+}
+
+func TestCachedStorageHitsAndInvalidation(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewCachedStorage(storage.NewMemoryStorage(), 2, time.Minute, time.Minute)
+
+	// Отсутствие ссылки кэшируется и сбрасывается при её создании.
+	data := storagetest.NewURL(uuid.New().String())
+	_, err := s.GetOriginalURL(ctx, data.ShortURL)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.GetOriginalURL(ctx, data.ShortURL)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Equal(t, models.CacheStats{Hits: 1, Misses: 1, Size: 1}, s.CacheStats())
+
+	_, err = s.SaveURL(ctx, data)
+	require.NoError(t, err)
+	got, err := s.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, data.OriginalURL, got.OriginalURL)
+
+	// Изменение и удаление видны сразу.
+	updated := data.OriginalURL + "/updated"
+	require.NoError(t, s.UpdateOriginalURL(ctx, data.ShortURL, data.UserUUID, updated))
+	got, err = s.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, updated, got.OriginalURL)
+
+	_, err = s.BatchDeleteURLs(ctx, data.UserUUID, []string{data.ShortURL})
+	require.NoError(t, err)
+	got, err = s.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.True(t, got.DeletedFlag)
+
+	// Размер кэша ограничен: давно не использованная запись вытесняется.
+	for i := 0; i < 2; i++ {
+		_, err = s.GetOriginalURL(ctx, uuid.New().String())
+		require.ErrorIs(t, err, storage.ErrNotFound)
+	}
+	stats := s.CacheStats()
+	assert.Equal(t, 2, stats.Size)
+	assert.Equal(t, int64(1), stats.Evictions)
+
+	s.Flush()
+	assert.Equal(t, 0, s.CacheStats().Size)
+}
+
+func TestCachedStorageTargetedInvalidation(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewCachedStorage(storage.NewMemoryStorage(), 10, time.Minute, time.Minute)
+
+	anonID, other := uuid.New().String(), uuid.New().String()
+	claimed, kept := storagetest.NewURL(anonID), storagetest.NewURL(other)
+	for _, data := range []*models.URLData{claimed, kept} {
+		_, err := s.SaveURL(ctx, data)
+		require.NoError(t, err)
+		_, err = s.GetOriginalURL(ctx, data.ShortURL)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, s.CacheStats().Size)
+
+	// Сохранение других ссылок не вытесняет найденные записи.
+	_, err := s.SaveURL(ctx, storagetest.NewURL(other))
+	require.NoError(t, err)
+	_, err = s.BatchSaveURLs(ctx, []*models.URLData{storagetest.NewURL(other)})
+	require.NoError(t, err)
+	assert.Equal(t, 2, s.CacheStats().Size)
+
+	// Передача ссылок удаляет из кэша только переданные ссылки.
+	accountID := uuid.New().String()
+	_, err = s.ClaimURLs(ctx, anonID, accountID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.CacheStats().Size)
+	got, err := s.GetOriginalURL(ctx, claimed.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, accountID, got.UserUUID)
+
+	// Окончательное удаление тоже удаляет только удалённые ссылки.
+	_, err = s.BatchDeleteURLs(ctx, accountID, []string{claimed.ShortURL})
+	require.NoError(t, err)
+	_, err = s.GetOriginalURL(ctx, claimed.ShortURL)
+	require.NoError(t, err)
+	_, err = s.PurgeDeletedURLs(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.CacheStats().Size)
+	_, err = s.GetOriginalURL(ctx, claimed.ShortURL)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestCachedStorageExpiry(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewCachedStorage(storage.NewMemoryStorage(), 10, time.Minute, 0)
+
+	// Запись о ссылке хранится не дольше срока её действия.
+	data := storagetest.NewURL(uuid.New().String())
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	data.ExpiresAt = &expiresAt
+	_, err := s.SaveURL(ctx, data)
+	require.NoError(t, err)
+
+	_, err = s.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	_, err = s.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), s.CacheStats().Hits)
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = s.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), s.CacheStats().Misses)
+
+	// Без negativeTTL отсутствие ссылки не кэшируется.
+	_, err = s.GetOriginalURL(ctx, "missing")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.GetOriginalURL(ctx, "missing")
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	assert.Equal(t, int64(4), s.CacheStats().Misses)
+}
+
+// TestPostgresCacheInvalidation проверяет, что изменение ссылки через одно
+// подключение сбрасывает кэш экземпляра, подписанного на уведомления.
+func TestPostgresCacheInvalidation(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	writer, err := storage.NewPostgresStorage(ctx, dsn)
+	require.NoError(t, err)
+	defer writer.Close()
+	reader, err := storage.NewPostgresStorage(ctx, dsn)
+	require.NoError(t, err)
+	defer reader.Close()
+	cache := storage.NewCachedStorage(reader, 100, time.Minute, time.Minute)
+
+	done := make(chan struct{})
+	go func() {
+		storage.ListenInvalidations(ctx, dsn, cache)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	data := storagetest.NewURL(uuid.New().String())
+	_, err = writer.SaveURL(ctx, data)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		got, err := cache.GetOriginalURL(ctx, data.ShortURL)
+		return err == nil && got.OriginalURL == data.OriginalURL
+	}, 5*time.Second, 50*time.Millisecond)
+
+	_, err = writer.BatchDeleteURLs(ctx, data.UserUUID, []string{data.ShortURL})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		got, err := cache.GetOriginalURL(ctx, data.ShortURL)
+		return err == nil && got.DeletedFlag
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestFileStorageReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	s, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	data := storagetest.NewURL(uuid.New().String())
+	_, err = s.SaveURL(ctx, data)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	reopened, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	got, err := reopened.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, data.OriginalURL, got.OriginalURL)
+
+	_, err = reopened.SaveURL(ctx, storagetest.NewURL(uuid.New().String()))
+	require.NoError(t, err)
+
+	dup := storagetest.NewURL(data.UserUUID)
+	dup.OriginalURL = data.OriginalURL
+	existing, err := reopened.SaveURL(ctx, dup)
+	assert.ErrorIs(t, err, storage.ErrAlreadyExists)
+	assert.Equal(t, data.ShortURL, existing)
+}
+
+func TestFileStorageReopenRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	s, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	userID := uuid.New().String()
+	active := storagetest.NewRefreshToken(userID, time.Now().Add(time.Hour))
+	revoked := storagetest.NewRefreshToken(userID, time.Now().Add(time.Hour))
+	require.NoError(t, s.SaveRefreshToken(ctx, active))
+	require.NoError(t, s.SaveRefreshToken(ctx, revoked))
+	_, err = s.RevokeRefreshToken(ctx, revoked.ID, false)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	reopened, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	_, err = reopened.RevokeRefreshToken(ctx, revoked.ID, false)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	got, err := reopened.RevokeRefreshToken(ctx, active.ID, false)
+	require.NoError(t, err)
+	assert.Equal(t, userID, got.UserID)
+}
+
+func TestFileStorageReopenAccounts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	s, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	anonID, accountID := uuid.New().String(), uuid.New().String()
+	data := storagetest.NewURL(anonID)
+	_, err = s.SaveURL(ctx, data)
+	require.NoError(t, err)
+	require.NoError(t, s.CreateAccount(ctx, models.Account{ID: accountID, Login: "alice", PasswordHash: "hash"}))
+	_, err = s.ClaimURLs(ctx, anonID, accountID)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	reopened, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	account, err := reopened.GetAccountByLogin(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, accountID, account.ID)
+	assert.ErrorIs(t, reopened.CreateAccount(ctx, models.Account{ID: uuid.New().String(), Login: "alice"}), storage.ErrLoginTaken)
+
+	got, err := reopened.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, accountID, got.UserUUID)
+}
+
+func TestFileStorageReopenAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	s, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	userID := uuid.New().String()
+	kept := models.APIKey{ID: uuid.New().String(), UserID: userID, Name: "kept", Scopes: models.Scopes}
+	deleted := models.APIKey{ID: uuid.New().String(), UserID: userID, Name: "deleted", Scopes: models.Scopes}
+	require.NoError(t, s.CreateAPIKey(ctx, kept))
+	require.NoError(t, s.CreateAPIKey(ctx, deleted))
+	require.NoError(t, s.DeleteAPIKey(ctx, userID, deleted.ID))
+	require.NoError(t, s.Close())
+
+	reopened, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	keys, err := reopened.ListAPIKeys(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, kept.ID, keys[0].ID)
+}
+
+func TestFileStorageReopenTokenRevocations(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	s, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	now := time.Now().UTC()
+	active := models.TokenRevocation{TokenID: uuid.New().String(), UserID: uuid.New().String(), RevokedAt: now, ExpiresAt: now.Add(time.Hour)}
+	expired := models.TokenRevocation{TokenID: uuid.New().String(), UserID: active.UserID, RevokedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)}
+	require.NoError(t, s.SaveTokenRevocation(ctx, active))
+	require.NoError(t, s.SaveTokenRevocation(ctx, expired))
+	require.NoError(t, s.Close())
+
+	reopened, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	// Истёкшая запись отбрасывается при загрузке.
+	list, err := reopened.ListTokenRevocations(ctx, now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, active.TokenID, list[0].TokenID)
+}
+
+func TestFileStorageReopenAfterUpdate(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	s, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	data := storagetest.NewURL(uuid.New().String())
+	_, err = s.SaveURL(ctx, data)
+	require.NoError(t, err)
+	updated := data.OriginalURL + "/updated"
+	require.NoError(t, s.UpdateOriginalURL(ctx, data.ShortURL, data.UserUUID, updated))
+	require.NoError(t, s.Close())
+
+	reopened, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	got, err := reopened.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, updated, got.OriginalURL)
+
+	history, err := reopened.GetURLHistory(ctx, data.ShortURL)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, data.OriginalURL, history[0].OriginalURL)
+
+	// Прежний оригинальный URL больше не считается дубликатом.
+	dup := storagetest.NewURL(data.UserUUID)
+	dup.OriginalURL = data.OriginalURL
+	_, err = reopened.SaveURL(ctx, dup)
+	assert.NoError(t, err)
+}
+
+func TestBoltStorageReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.db")
+
+	s, err := storage.NewBoltStorage(path)
+	require.NoError(t, err)
+	data := storagetest.NewURL(uuid.New().String())
+	_, err = s.SaveURL(ctx, data)
+	require.NoError(t, err)
+	require.NoError(t, s.UpdateOriginalURL(ctx, data.ShortURL, data.UserUUID, data.OriginalURL+"/updated"))
+	require.NoError(t, s.Close())
+
+	reopened, err := storage.NewBoltStorage(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	urls, err := reopened.GetURLsByUser(ctx, data.UserUUID)
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, data.OriginalURL+"/updated", urls[0].OriginalURL)
+
+	// Индекс оригинальных URL обновлён вместе с записью.
+	dup := storagetest.NewURL(data.UserUUID)
+	dup.OriginalURL = data.OriginalURL + "/updated"
+	existing, err := reopened.SaveURL(ctx, dup)
+	assert.ErrorIs(t, err, storage.ErrAlreadyExists)
+	assert.Equal(t, data.ShortURL, existing)
+
+	dup = storagetest.NewURL(data.UserUUID)
+	dup.OriginalURL = data.OriginalURL
+	_, err = reopened.SaveURL(ctx, dup)
+	assert.NoError(t, err)
+}
+
+func TestBoltStorageClicks(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.db")
+
+	s, err := storage.NewBoltStorage(path)
+	require.NoError(t, err)
+	data := storagetest.NewURL(uuid.New().String())
+	_, err = s.SaveURL(ctx, data)
+	require.NoError(t, err)
+	click := models.Click{ShortURL: data.ShortURL, Timestamp: time.Now().UTC(), Referrer: "https://example.org", UserAgent: "test", IPHash: "hash"}
+	require.NoError(t, s.SaveClicks(ctx, []models.Click{click}))
+
+	stats, err := s.GetClickStats(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Total)
+	require.Len(t, stats.Days, 1)
+	assert.Equal(t, click.Timestamp.Format(time.DateOnly), stats.Days[0].Date)
+	require.NoError(t, s.Close())
+
+	// Событие сохраняется целиком.
+	db, err := bolt.Open(path, 0600, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("clicks")).Bucket([]byte(data.ShortURL))
+		var got models.Click
+		require.NoError(t, json.Unmarshal(b.Get(binary.BigEndian.AppendUint64(nil, 1)), &got))
+		assert.Equal(t, click.Referrer, got.Referrer)
+		assert.Equal(t, click.UserAgent, got.UserAgent)
+		assert.Equal(t, click.IPHash, got.IPHash)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestBoltStorageBuildsTimeIndexes(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.db")
+
+	s, err := storage.NewBoltStorage(path)
+	require.NoError(t, err)
+	expiring := storagetest.NewURL(uuid.New().String())
+	expiresAt := time.Now().Add(time.Minute)
+	expiring.ExpiresAt = &expiresAt
+	deleted := storagetest.NewURL(expiring.UserUUID)
+	for _, data := range []*models.URLData{expiring, deleted} {
+		_, err = s.SaveURL(ctx, data)
+		require.NoError(t, err)
+	}
+	_, err = s.BatchDeleteURLs(ctx, deleted.UserUUID, []string{deleted.ShortURL})
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// В базе прежнего формата индексов моментов нет; они строятся при открытии.
+	db, err := bolt.Open(path, 0600, nil)
+	require.NoError(t, err)
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{"by_expires_at", "by_deleted_at"} {
+			if err := tx.DeleteBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	s, err = storage.NewBoltStorage(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	n, err := s.ExpireURLs(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	purged, err := s.PurgeDeletedURLs(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []string{deleted.ShortURL}, purged)
+
+	// Ссылка с истёкшим сроком помечена удалённой моментом now из ExpireURLs
+	// и попадает в индекс удаления.
+	purged, err = s.PurgeDeletedURLs(ctx, time.Now().Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{expiring.ShortURL}, purged)
+}
+
+func TestFileStorageRecoversTornTail(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	s, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	first := storagetest.NewURL(uuid.New().String())
+	_, err = s.SaveURL(ctx, first)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// Запись, оборванная сбоем.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"short_url":"torn","original_u`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = storage.NewFileStorage(path)
+	require.NoError(t, err)
+	second := storagetest.NewURL(uuid.New().String())
+	_, err = s.SaveURL(ctx, second)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// Новая запись не склеилась с оборванной.
+	s, err = storage.NewFileStorage(path)
+	require.NoError(t, err)
+	defer s.Close()
+	for _, data := range []*models.URLData{first, second} {
+		_, err = s.GetOriginalURL(ctx, data.ShortURL)
+		assert.NoError(t, err)
+	}
+	_, err = s.GetOriginalURL(ctx, "torn")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func TestFileStorageReopenAfterDelete(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	s, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	deleted := storagetest.NewURL(uuid.New().String())
+	purged := storagetest.NewURL(deleted.UserUUID)
+	for _, data := range []*models.URLData{deleted, purged} {
+		_, err = s.SaveURL(ctx, data)
+		require.NoError(t, err)
+	}
+	_, err = s.BatchDeleteURLs(ctx, deleted.UserUUID, []string{deleted.ShortURL, purged.ShortURL})
+	require.NoError(t, err)
+	require.NoError(t, s.SaveClicks(ctx, []models.Click{{ShortURL: purged.ShortURL, Timestamp: time.Now()}}))
+	_, err = s.RestoreURLs(ctx, deleted.UserUUID, []string{deleted.ShortURL})
+	require.NoError(t, err)
+	_, err = s.BatchDeleteURLs(ctx, deleted.UserUUID, []string{deleted.ShortURL})
+	require.NoError(t, err)
+	purgedIDs, err := s.PurgeDeletedURLs(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{deleted.ShortURL, purged.ShortURL}, purgedIDs)
+	require.NoError(t, s.Close())
+
+	s, err = storage.NewFileStorage(path)
+	require.NoError(t, err)
+	defer s.Close()
+	for _, data := range []*models.URLData{deleted, purged} {
+		_, err = s.GetOriginalURL(ctx, data.ShortURL)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	}
+	stats, err := s.GetClickStats(ctx, purged.ShortURL)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Total)
+}
+
+func TestFileStorageKeepsMemoryOnWriteFailure(t *testing.T) {
+	ctx := context.Background()
+	s, err := storage.NewFileStorage(filepath.Join(t.TempDir(), "storage.json"))
+	require.NoError(t, err)
+	data := storagetest.NewURL(uuid.New().String())
+	_, err = s.SaveURL(ctx, data)
+	require.NoError(t, err)
+
+	// После закрытия файлов запись в журнал не удаётся, и память не меняется.
+	require.NoError(t, s.Close())
+
+	created := storagetest.NewURL(data.UserUUID)
+	_, err = s.SaveURL(ctx, created)
+	require.Error(t, err)
+	_, err = s.GetOriginalURL(ctx, created.ShortURL)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	_, err = s.BatchDeleteURLs(ctx, data.UserUUID, []string{data.ShortURL})
+	require.Error(t, err)
+	require.Error(t, s.UpdateOriginalURL(ctx, data.ShortURL, data.UserUUID, data.OriginalURL+"/updated"))
+	_, err = s.ClaimURLs(ctx, data.UserUUID, uuid.New().String())
+	require.Error(t, err)
+
+	got, err := s.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.False(t, got.DeletedFlag)
+	assert.Equal(t, data.OriginalURL, got.OriginalURL)
+	assert.Equal(t, data.UserUUID, got.UserUUID)
+}
+
+func TestFileStorageCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	s, err := storage.NewFileStorage(path, storage.WithFileSync(file.SyncAlways, 0))
+	require.NoError(t, err)
+	kept := storagetest.NewURL(uuid.New().String())
+	deleted := storagetest.NewURL(kept.UserUUID)
+	for _, data := range []*models.URLData{kept, deleted} {
+		_, err = s.SaveURL(ctx, data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.UpdateOriginalURL(ctx, kept.ShortURL, kept.UserUUID, kept.OriginalURL+"/updated"))
+	_, err = s.BatchDeleteURLs(ctx, deleted.UserUUID, []string{deleted.ShortURL})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Compact())
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	// Изменения после сжатия попадают в новый журнал.
+	added := storagetest.NewURL(kept.UserUUID)
+	_, err = s.SaveURL(ctx, added)
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+
+	// Сбой после переключения журнала: сжатие завершается при загрузке.
+	require.NoError(t, os.Rename(path, path+".compacting"))
+
+	s, err = storage.NewFileStorage(path)
+	require.NoError(t, err)
+	defer s.Close()
+	_, err = os.Stat(path + ".compacting")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	got, err := s.GetOriginalURL(ctx, kept.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, kept.OriginalURL+"/updated", got.OriginalURL)
+	got, err = s.GetOriginalURL(ctx, deleted.ShortURL)
+	require.NoError(t, err)
+	assert.True(t, got.DeletedFlag)
+	_, err = s.GetOriginalURL(ctx, added.ShortURL)
+	assert.NoError(t, err)
+}
+
+func TestFileStorageCompactSideLogs(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	s, err := storage.NewFileStorage(path)
+	require.NoError(t, err)
+	userID := uuid.New().String()
+	data := storagetest.NewURL(userID)
+	_, err = s.SaveURL(ctx, data)
+	require.NoError(t, err)
+	require.NoError(t, s.UpdateOriginalURL(ctx, data.ShortURL, userID, data.OriginalURL+"/updated"))
+	click := models.Click{ShortURL: data.ShortURL, Timestamp: time.Now().UTC(), Referrer: "https://example.com"}
+	require.NoError(t, s.SaveClicks(ctx, []models.Click{click}))
+
+	key := models.APIKey{ID: uuid.New().String(), UserID: userID, Name: "kept", Scopes: models.Scopes}
+	deletedKey := models.APIKey{ID: uuid.New().String(), UserID: userID, Name: "deleted", Scopes: models.Scopes}
+	require.NoError(t, s.CreateAPIKey(ctx, key))
+	require.NoError(t, s.CreateAPIKey(ctx, deletedKey))
+	require.NoError(t, s.DeleteAPIKey(ctx, userID, deletedKey.ID))
+
+	token := storagetest.NewRefreshToken(userID, time.Now().Add(time.Hour))
+	revokedToken := storagetest.NewRefreshToken(userID, time.Now().Add(time.Hour))
+	require.NoError(t, s.SaveRefreshToken(ctx, token))
+	require.NoError(t, s.SaveRefreshToken(ctx, revokedToken))
+	_, err = s.RevokeRefreshToken(ctx, revokedToken.ID, false)
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	revocation := models.TokenRevocation{TokenID: uuid.New().String(), UserID: userID, RevokedAt: now, ExpiresAt: now.Add(time.Hour)}
+	expired := models.TokenRevocation{TokenID: uuid.New().String(), UserID: userID, RevokedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)}
+	require.NoError(t, s.SaveTokenRevocation(ctx, revocation))
+	require.NoError(t, s.SaveTokenRevocation(ctx, expired))
+
+	require.NoError(t, s.Compact())
+
+	// В файлах остаются только действующие записи.
+	for suffix, lines := range map[string]int{".clicks": 1, ".history": 1, ".keys": 1, ".tokens": 1, ".revoked": 1} {
+		content, err := os.ReadFile(path + suffix)
+		require.NoError(t, err)
+		assert.Equal(t, lines, strings.Count(string(content), "\n"), suffix)
+	}
+
+	// Запись после сжатия попадает в новый файл.
+	require.NoError(t, s.SaveClicks(ctx, []models.Click{{ShortURL: data.ShortURL, Timestamp: time.Now().UTC()}}))
+	require.NoError(t, s.Close())
+
+	s, err = storage.NewFileStorage(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	stats, err := s.GetClickStats(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Total)
+	history, err := s.GetURLHistory(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Len(t, history, 1)
+	keys, err := s.ListAPIKeys(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, key.ID, keys[0].ID)
+	_, err = s.RevokeRefreshToken(ctx, token.ID, false)
+	assert.NoError(t, err)
+	list, err := s.ListTokenRevocations(ctx, now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, revocation.TokenID, list[0].TokenID)
+}
+
+func TestFileStorageAutoCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "storage.json")
+
+	s, err := storage.NewFileStorage(path, storage.WithCompactSize(1024))
+	require.NoError(t, err)
+	var urls []*models.URLData
+	for i := 0; i < 50; i++ {
+		data := storagetest.NewURL(uuid.New().String())
+		_, err = s.SaveURL(ctx, data)
+		require.NoError(t, err)
+		urls = append(urls, data)
+	}
+	require.NoError(t, s.Close())
+
+	_, err = os.Stat(path + ".snapshot")
+	require.NoError(t, err)
+
+	s, err = storage.NewFileStorage(path)
+	require.NoError(t, err)
+	defer s.Close()
+	for _, data := range urls {
+		_, err = s.GetOriginalURL(ctx, data.ShortURL)
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,936 @@
+// Package storagetest содержит общий набор тестов, которому должна
+// соответствовать каждая реализация storage.Storage.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+)
+
+// Factory создаёт новое хранилище с указанными настройками для очередного теста.
+// Освобождение ресурсов следует регистрировать через t.Cleanup.
+type Factory func(t *testing.T, opts ...storage.Option) storage.Storage
+
+// Run запускает набор тестов соответствия для хранилища, созданного фабрикой.
+// Тесты используют уникальные URL и пользователей, поэтому допускают
+// хранилища, в которых уже есть данные.
+func Run(t *testing.T, newStorage Factory) {
+	t.Run("SaveAndGet", func(t *testing.T) { testSaveAndGet(t, newStorage(t)) })
+	t.Run("GetNotFound", func(t *testing.T) { testGetNotFound(t, newStorage(t)) })
+	t.Run("DedupGlobal", func(t *testing.T) {
+		testDedupGlobal(t, newStorage(t, storage.WithDedupMode(storage.DedupGlobal)))
+	})
+	t.Run("DedupPerUser", func(t *testing.T) {
+		testDedupPerUser(t, newStorage(t, storage.WithDedupMode(storage.DedupPerUser)))
+	})
+	t.Run("DedupNone", func(t *testing.T) {
+		testDedupNone(t, newStorage(t, storage.WithDedupMode(storage.DedupNone)))
+	})
+	t.Run("DedupSkipped", func(t *testing.T) {
+		testDedupAlias(t, newStorage(t, storage.WithDedupMode(storage.DedupGlobal)))
+	})
+	t.Run("DedupDeleted", func(t *testing.T) {
+		testDedupDeleted(t, newStorage(t, storage.WithDedupMode(storage.DedupPerUser)))
+	})
+	t.Run("ShortURLTaken", func(t *testing.T) { testShortURLTaken(t, newStorage(t)) })
+	t.Run("BatchSave", func(t *testing.T) { testBatchSave(t, newStorage(t)) })
+	t.Run("URLsByUser", func(t *testing.T) { testURLsByUser(t, newStorage(t)) })
+	t.Run("ListUserURLs", func(t *testing.T) { testListUserURLs(t, newStorage(t)) })
+	t.Run("Export", func(t *testing.T) { testExport(t, newStorage(t)) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, newStorage(t)) })
+	t.Run("BatchDelete", func(t *testing.T) { testBatchDelete(t, newStorage(t)) })
+	t.Run("UpdateOriginalURL", func(t *testing.T) { testUpdateOriginalURL(t, newStorage(t)) })
+	t.Run("RestoreAndPurge", func(t *testing.T) { testRestoreAndPurge(t, newStorage(t)) })
+	t.Run("RestoreDuplicate", func(t *testing.T) {
+		testRestoreDuplicate(t, newStorage(t, storage.WithDedupMode(storage.DedupPerUser)))
+	})
+	t.Run("Expire", func(t *testing.T) { testExpire(t, newStorage(t)) })
+	t.Run("Clicks", func(t *testing.T) { testClicks(t, newStorage(t)) })
+	t.Run("Jobs", func(t *testing.T) { testJobs(t, newStorage(t)) })
+	t.Run("RefreshTokens", func(t *testing.T) { testRefreshTokens(t, newStorage(t)) })
+	t.Run("Accounts", func(t *testing.T) { testAccounts(t, newStorage(t)) })
+	t.Run("APIKeys", func(t *testing.T) { testAPIKeys(t, newStorage(t)) })
+	t.Run("TokenRevocations", func(t *testing.T) { testTokenRevocations(t, newStorage(t)) })
+	t.Run("Stats", func(t *testing.T) { testStats(t, newStorage(t)) })
+	t.Run("MaxShortURL", func(t *testing.T) { testMaxShortURL(t, newStorage(t)) })
+	t.Run("Ping", func(t *testing.T) { testPing(t, newStorage(t)) })
+}
+
+// NewURL возвращает запись с уникальными идентификатором и оригинальным URL.
+func NewURL(userID string) *models.URLData {
+	id := uuid.New().String()
+	return &models.URLData{
+		UUID:        id,
+		ShortURL:    id[:8],
+		OriginalURL: "https://example.com/" + id,
+		UserUUID:    userID,
+	}
+}
+
+// DeleteURL помечает удалённой одну ссылку пользователя отдельной операцией
+// хранилища. Так ссылки удалялись до появления пакетного удаления.
+func DeleteURL(ctx context.Context, s storage.Storage, id, userID string) error {
+	_, err := s.BatchDeleteURLs(ctx, userID, []string{id})
+	return err
+}
+
+func save(t *testing.T, s storage.Storage, data *models.URLData) {
+	t.Helper()
+	_, err := s.SaveURL(context.Background(), data)
+	require.NoError(t, err)
+}
+
+func testSaveAndGet(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	data := NewURL(uuid.New().String())
+	save(t, s, data)
+
+	got, err := s.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, data.ShortURL, got.ShortURL)
+	assert.Equal(t, data.OriginalURL, got.OriginalURL)
+	assert.Equal(t, data.UserUUID, got.UserUUID)
+	assert.False(t, got.DeletedFlag)
+}
+
+func testGetNotFound(t *testing.T, s storage.Storage) {
+	_, err := s.GetOriginalURL(context.Background(), uuid.New().String())
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+// duplicateOf возвращает новую запись пользователя userID с тем же оригинальным URL.
+func duplicateOf(data *models.URLData, userID string) *models.URLData {
+	dup := NewURL(userID)
+	dup.OriginalURL = data.OriginalURL
+	return dup
+}
+
+func assertDuplicate(t *testing.T, s storage.Storage, first, dup *models.URLData) {
+	t.Helper()
+	ctx := context.Background()
+	existing, err := s.SaveURL(ctx, dup)
+	require.ErrorIs(t, err, storage.ErrAlreadyExists)
+	assert.Equal(t, first.ShortURL, existing)
+
+	// Дубликат не должен сохраниться под новым идентификатором.
+	_, err = s.GetOriginalURL(ctx, dup.ShortURL)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testDedupGlobal(t *testing.T, s storage.Storage) {
+	userID := uuid.New().String()
+	first := NewURL(userID)
+	save(t, s, first)
+
+	assertDuplicate(t, s, first, duplicateOf(first, userID))
+	assertDuplicate(t, s, first, duplicateOf(first, uuid.New().String()))
+}
+
+func testDedupPerUser(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID, otherID := uuid.New().String(), uuid.New().String()
+	first := NewURL(userID)
+	save(t, s, first)
+
+	assertDuplicate(t, s, first, duplicateOf(first, userID))
+
+	// Другой пользователь получает собственную ссылку на тот же URL.
+	other := duplicateOf(first, otherID)
+	save(t, s, other)
+	assertDuplicate(t, s, other, duplicateOf(first, otherID))
+
+	urls, err := s.GetURLsByUser(ctx, otherID)
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, other.ShortURL, urls[0].ShortURL)
+}
+
+func testDedupNone(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	first := NewURL(userID)
+	save(t, s, first)
+
+	dup := duplicateOf(first, userID)
+	save(t, s, dup)
+
+	got, err := s.GetOriginalURL(ctx, dup.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, first.OriginalURL, got.OriginalURL)
+
+	urls, err := s.GetURLsByUser(ctx, userID)
+	require.NoError(t, err)
+	assert.Len(t, urls, 2)
+}
+
+func testDedupAlias(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	first := NewURL(userID)
+	save(t, s, first)
+
+	// Ссылка с псевдонимом сохраняется, даже если URL уже сокращён.
+	alias := duplicateOf(first, userID)
+	alias.Alias = true
+	_, err := s.SaveURL(ctx, alias)
+	require.NoError(t, err)
+	got, err := s.GetOriginalURL(ctx, alias.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, first.OriginalURL, got.OriginalURL)
+
+	assertDuplicate(t, s, first, duplicateOf(first, userID))
+}
+
+func testDedupDeleted(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	deleted := NewURL(userID)
+	save(t, s, deleted)
+	require.NoError(t, DeleteURL(ctx, s, deleted.ShortURL, userID))
+
+	// Удалённая ссылка не участвует в дедупликации.
+	recreated := duplicateOf(deleted, userID)
+	save(t, s, recreated)
+	assertDuplicate(t, s, recreated, duplicateOf(deleted, userID))
+
+	require.NoError(t, DeleteURL(ctx, s, recreated.ShortURL, userID))
+	batched := duplicateOf(deleted, userID)
+	errs, err := s.BatchSaveURLs(ctx, []*models.URLData{batched})
+	require.NoError(t, err)
+	assert.NoError(t, errs[0])
+}
+
+func testShortURLTaken(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	first := NewURL(uuid.New().String())
+	save(t, s, first)
+
+	taken := NewURL(uuid.New().String())
+	taken.ShortURL = first.ShortURL
+	_, err := s.SaveURL(ctx, taken)
+	require.ErrorIs(t, err, storage.ErrShortURLTaken)
+
+	got, err := s.GetOriginalURL(ctx, first.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, first.OriginalURL, got.OriginalURL)
+}
+
+func testBatchSave(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	existing := NewURL(userID)
+	save(t, s, existing)
+
+	created := NewURL(userID)
+	dupStored := duplicateOf(existing, userID)
+	dupInBatch := duplicateOf(created, userID)
+	errs, err := s.BatchSaveURLs(ctx, []*models.URLData{created, dupStored, dupInBatch})
+	require.NoError(t, err)
+	require.Len(t, errs, 3)
+	assert.NoError(t, errs[0])
+	assert.ErrorIs(t, errs[1], storage.ErrAlreadyExists)
+	assert.Equal(t, existing.ShortURL, dupStored.ShortURL)
+	assert.ErrorIs(t, errs[2], storage.ErrAlreadyExists)
+	assert.Equal(t, created.ShortURL, dupInBatch.ShortURL)
+
+	urls, err := s.GetURLsByUser(ctx, userID)
+	require.NoError(t, err)
+	assert.Len(t, urls, 2)
+
+	// Занятый идентификатор отменяет сохранение всего пакета.
+	fresh := NewURL(userID)
+	taken := NewURL(userID)
+	taken.ShortURL = existing.ShortURL
+	errs, err = s.BatchSaveURLs(ctx, []*models.URLData{fresh, taken})
+	require.NoError(t, err)
+	assert.NoError(t, errs[0])
+	assert.ErrorIs(t, errs[1], storage.ErrShortURLTaken)
+
+	_, err = s.GetOriginalURL(ctx, fresh.ShortURL)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testURLsByUser(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID, otherID := uuid.New().String(), uuid.New().String()
+
+	mine := []*models.URLData{NewURL(userID), NewURL(userID)}
+	for _, data := range mine {
+		save(t, s, data)
+	}
+	save(t, s, NewURL(otherID))
+
+	urls, err := s.GetURLsByUser(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, urls, len(mine))
+
+	got := make(map[string]string)
+	for _, data := range urls {
+		assert.Equal(t, userID, data.UserUUID)
+		got[data.ShortURL] = data.OriginalURL
+	}
+	for _, data := range mine {
+		assert.Equal(t, data.OriginalURL, got[data.ShortURL])
+	}
+
+	urls, err = s.GetURLsByUser(ctx, uuid.New().String())
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+}
+
+func testListUserURLs(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	base := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+	// Ссылки созданы по порядку; у ссылки i — i переходов.
+	var urls []*models.URLData
+	for i := 0; i < 5; i++ {
+		data := NewURL(userID)
+		data.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		if i%2 == 0 {
+			data.OriginalURL += "/Even"
+		}
+		save(t, s, data)
+		urls = append(urls, data)
+
+		var clicks []models.Click
+		for j := 0; j < i; j++ {
+			clicks = append(clicks, models.Click{ShortURL: data.ShortURL, Timestamp: time.Now()})
+		}
+		require.NoError(t, s.SaveClicks(ctx, clicks))
+	}
+	save(t, s, NewURL(uuid.New().String()))
+	_, err := s.BatchDeleteURLs(ctx, userID, []string{urls[1].ShortURL})
+	require.NoError(t, err)
+
+	// list собирает все страницы и возвращает короткие идентификаторы по порядку.
+	list := func(query models.URLListQuery) []string {
+		t.Helper()
+		var ids []string
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 10, "pagination does not terminate")
+			page, err := s.ListUserURLs(ctx, userID, query)
+			require.NoError(t, err)
+			require.LessOrEqual(t, len(page.URLs), query.Limit)
+			for _, u := range page.URLs {
+				ids = append(ids, u.ShortURL)
+			}
+			if page.Next == nil {
+				assert.Equal(t, page.Total, len(ids))
+				return ids
+			}
+			query.After = page.Next
+		}
+	}
+	ids := func(idx ...int) []string {
+		var res []string
+		for _, i := range idx {
+			res = append(res, urls[i].ShortURL)
+		}
+		return res
+	}
+
+	assert.Equal(t, ids(0, 1, 2, 3, 4), list(models.URLListQuery{Limit: 2, Sort: models.URLSortCreated}))
+	assert.Equal(t, ids(4, 3, 2, 1, 0), list(models.URLListQuery{Limit: 2, Sort: models.URLSortCreated, Desc: true}))
+	assert.Equal(t, ids(4, 3, 2, 1, 0), list(models.URLListQuery{Limit: 3, Sort: models.URLSortClicks, Desc: true}))
+	assert.Equal(t, ids(0, 2, 3, 4), list(models.URLListQuery{Limit: 2, Status: models.URLStatusActive}))
+	assert.Equal(t, ids(1), list(models.URLListQuery{Limit: 2, Status: models.URLStatusDeleted}))
+	assert.Equal(t, ids(0, 2, 4), list(models.URLListQuery{Limit: 2, Search: "/even"}))
+
+	page, err := s.ListUserURLs(ctx, userID, models.URLListQuery{Limit: 1, Sort: models.URLSortClicks, Desc: true})
+	require.NoError(t, err)
+	require.Len(t, page.URLs, 1)
+	assert.Equal(t, 4, page.URLs[0].Clicks)
+	assert.Equal(t, urls[4].OriginalURL, page.URLs[0].OriginalURL)
+	assert.Equal(t, 5, page.Total)
+}
+
+func testExport(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	first, second := NewURL(userID), NewURL(userID)
+	first.CreatedAt = time.Now().Add(-time.Hour).UTC().Truncate(time.Microsecond)
+	second.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	save(t, s, second)
+	save(t, s, first)
+	save(t, s, NewURL(uuid.New().String()))
+
+	require.NoError(t, s.SaveClicks(ctx, []models.Click{
+		{ShortURL: first.ShortURL, Timestamp: time.Now()},
+		{ShortURL: first.ShortURL, Timestamp: time.Now()},
+	}))
+	_, err := s.BatchDeleteURLs(ctx, userID, []string{second.ShortURL})
+	require.NoError(t, err)
+
+	var rows []models.ExportedURL
+	require.NoError(t, s.ExportUserURLs(ctx, userID, func(row models.ExportedURL) error {
+		rows = append(rows, row)
+		return nil
+	}))
+	require.Len(t, rows, 2)
+	rows[0].CreatedAt = rows[0].CreatedAt.UTC()
+	assert.Equal(t, models.ExportedURL{
+		ShortURL:    first.ShortURL,
+		OriginalURL: first.OriginalURL,
+		CreatedAt:   first.CreatedAt,
+		Clicks:      2,
+	}, rows[0])
+	assert.Equal(t, second.ShortURL, rows[1].ShortURL)
+	assert.True(t, rows[1].DeletedFlag)
+
+	// Ошибка получателя прерывает выгрузку.
+	stop := errors.New("stop")
+	calls := 0
+	err = s.ExportUserURLs(ctx, userID, func(models.ExportedURL) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
+
+func testDelete(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	data := NewURL(userID)
+	save(t, s, data)
+
+	// Чужой пользователь не может удалить ссылку.
+	require.NoError(t, DeleteURL(ctx, s, data.ShortURL, uuid.New().String()))
+	got, err := s.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.False(t, got.DeletedFlag)
+
+	require.NoError(t, DeleteURL(ctx, s, data.ShortURL, userID))
+	got, err = s.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.True(t, got.DeletedFlag)
+	assert.Equal(t, data.OriginalURL, got.OriginalURL)
+
+	urls, err := s.GetURLsByUser(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.True(t, urls[0].DeletedFlag)
+
+	// Удаление несуществующей ссылки не является ошибкой.
+	assert.NoError(t, DeleteURL(ctx, s, uuid.New().String(), userID))
+}
+
+func testStats(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	urlsBefore, err := s.GetURLsCount(ctx)
+	require.NoError(t, err)
+	usersBefore, err := s.GetUsersCount(ctx)
+	require.NoError(t, err)
+
+	userID := uuid.New().String()
+	save(t, s, NewURL(userID))
+	save(t, s, NewURL(userID))
+	save(t, s, NewURL(uuid.New().String()))
+
+	urlsAfter, err := s.GetURLsCount(ctx)
+	require.NoError(t, err)
+	usersAfter, err := s.GetUsersCount(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, urlsBefore+3, urlsAfter)
+	assert.Equal(t, usersBefore+2, usersAfter)
+}
+
+func testMaxShortURL(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+
+	// Идентификаторы из 32 символов не пересекаются с другими тестами.
+	hexID := func(first string) string {
+		return first + strings.ReplaceAll(uuid.New().String(), "-", "")[len(first):]
+	}
+	lower, upper, invalid := NewURL(userID), NewURL(userID), NewURL(userID)
+	lower.ShortURL, upper.ShortURL, invalid.ShortURL = hexID("0"), hexID("z"), hexID("z~")
+	save(t, s, lower)
+	save(t, s, upper)
+	save(t, s, invalid)
+
+	got, err := s.MaxShortURL(ctx, len(upper.ShortURL))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, got, upper.ShortURL)
+	assert.NotContains(t, got, "~")
+
+	// Псевдонимы не учитываются, даже если состоят из символов base62.
+	generated, alias := NewURL(userID), NewURL(userID)
+	generated.ShortURL, alias.ShortURL = hexID("0")+"0", hexID("z")+"z"
+	alias.Alias = true
+	save(t, s, generated)
+	save(t, s, alias)
+
+	got, err = s.MaxShortURL(ctx, len(alias.ShortURL))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, got, generated.ShortURL)
+	assert.NotEqual(t, alias.ShortURL, got)
+}
+
+func testPing(t *testing.T, s storage.Storage) {
+	assert.NoError(t, s.Ping(context.Background()))
+}
+
+func testRestoreDuplicate(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	old := NewURL(userID)
+	save(t, s, old)
+	_, err := s.BatchDeleteURLs(ctx, userID, []string{old.ShortURL})
+	require.NoError(t, err)
+	newer := duplicateOf(old, userID)
+	save(t, s, newer)
+
+	// URL уже сокращён действующей ссылкой, поэтому старая ссылка не восстанавливается.
+	n, err := s.RestoreURLs(ctx, userID, []string{old.ShortURL})
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	got, err := s.GetOriginalURL(ctx, old.ShortURL)
+	require.NoError(t, err)
+	assert.True(t, got.DeletedFlag)
+
+	// Из двух удалённых ссылок на один URL восстанавливается одна.
+	_, err = s.BatchDeleteURLs(ctx, userID, []string{newer.ShortURL})
+	require.NoError(t, err)
+	n, err = s.RestoreURLs(ctx, userID, []string{old.ShortURL, newer.ShortURL})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assertDuplicate(t, s, old, duplicateOf(old, userID))
+}
+
+func testExpire(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	past := now.Add(-time.Minute)
+	expired := NewURL(userID)
+	expired.ExpiresAt = &past
+	save(t, s, expired)
+
+	future := now.Add(time.Hour)
+	active := NewURL(userID)
+	active.ExpiresAt = &future
+	save(t, s, active)
+
+	got, err := s.GetOriginalURL(ctx, active.ShortURL)
+	require.NoError(t, err)
+	require.NotNil(t, got.ExpiresAt)
+	assert.True(t, future.Equal(*got.ExpiresAt))
+
+	// Истёкшая ссылка не участвует в дедупликации.
+	dup := NewURL(userID)
+	dup.OriginalURL = expired.OriginalURL
+	_, err = s.SaveURL(ctx, dup)
+	require.NoError(t, err)
+
+	n, err := s.ExpireURLs(ctx, now)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, 1)
+
+	got, err = s.GetOriginalURL(ctx, expired.ShortURL)
+	require.NoError(t, err)
+	assert.True(t, got.DeletedFlag)
+
+	got, err = s.GetOriginalURL(ctx, active.ShortURL)
+	require.NoError(t, err)
+	assert.False(t, got.DeletedFlag)
+}
+
+func testClicks(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	data := NewURL(uuid.New().String())
+	save(t, s, data)
+
+	stats, err := s.GetClickStats(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Total)
+	assert.Empty(t, stats.Days)
+
+	day := time.Date(2024, 3, 1, 23, 30, 0, 0, time.UTC)
+	clicks := []models.Click{
+		{ShortURL: data.ShortURL, Timestamp: day, Referrer: "https://example.org", UserAgent: "test", IPHash: "hash"},
+		{ShortURL: data.ShortURL, Timestamp: day.Add(20 * time.Minute)},
+		{ShortURL: data.ShortURL, Timestamp: day.Add(time.Hour)},
+	}
+	require.NoError(t, s.SaveClicks(ctx, clicks))
+	require.NoError(t, s.SaveClicks(ctx, nil))
+
+	stats, err = s.GetClickStats(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Total)
+	assert.Equal(t, []models.DailyClicks{
+		{Date: "2024-03-01", Clicks: 2},
+		{Date: "2024-03-02", Clicks: 1},
+	}, stats.Days)
+}
+
+func testUpdateOriginalURL(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	data := NewURL(userID)
+	save(t, s, data)
+	first := data.OriginalURL
+
+	second := first + "/second"
+	require.NoError(t, s.UpdateOriginalURL(ctx, data.ShortURL, userID, second))
+	third := first + "/third"
+	require.NoError(t, s.UpdateOriginalURL(ctx, data.ShortURL, userID, third))
+
+	got, err := s.GetOriginalURL(ctx, data.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, third, got.OriginalURL)
+
+	history, err := s.GetURLHistory(ctx, data.ShortURL)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, first, history[0].OriginalURL)
+	assert.Equal(t, second, history[1].OriginalURL)
+	assert.False(t, history[0].ChangedAt.IsZero())
+
+	// Чужую, отсутствующую и удалённую ссылки изменить нельзя.
+	assert.ErrorIs(t, s.UpdateOriginalURL(ctx, data.ShortURL, uuid.New().String(), first), storage.ErrNotFound)
+	assert.ErrorIs(t, s.UpdateOriginalURL(ctx, uuid.New().String(), userID, first), storage.ErrNotFound)
+	require.NoError(t, DeleteURL(ctx, s, data.ShortURL, userID))
+	assert.ErrorIs(t, s.UpdateOriginalURL(ctx, data.ShortURL, userID, first), storage.ErrNotFound)
+}
+
+func testRestoreAndPurge(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	restored, purged, active := NewURL(userID), NewURL(userID), NewURL(userID)
+	for _, data := range []*models.URLData{restored, purged, active} {
+		save(t, s, data)
+	}
+	require.NoError(t, DeleteURL(ctx, s, restored.ShortURL, userID))
+	require.NoError(t, DeleteURL(ctx, s, purged.ShortURL, userID))
+
+	got, err := s.GetOriginalURL(ctx, restored.ShortURL)
+	require.NoError(t, err)
+	require.NotNil(t, got.DeletedAt)
+
+	// Чужие, активные и отсутствующие ссылки не восстанавливаются.
+	n, err := s.RestoreURLs(ctx, uuid.New().String(), []string{restored.ShortURL})
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	n, err = s.RestoreURLs(ctx, userID, []string{restored.ShortURL, active.ShortURL, uuid.New().String()})
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	got, err = s.GetOriginalURL(ctx, restored.ShortURL)
+	require.NoError(t, err)
+	assert.False(t, got.DeletedFlag)
+	assert.Nil(t, got.DeletedAt)
+
+	// Ссылки, удалённые позже before, остаются.
+	_, err = s.PurgeDeletedURLs(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	_, err = s.GetOriginalURL(ctx, purged.ShortURL)
+	require.NoError(t, err)
+
+	purgedIDs, err := s.PurgeDeletedURLs(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Contains(t, purgedIDs, purged.ShortURL)
+	_, err = s.GetOriginalURL(ctx, purged.ShortURL)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	for _, data := range []*models.URLData{restored, active} {
+		_, err = s.GetOriginalURL(ctx, data.ShortURL)
+		assert.NoError(t, err)
+	}
+}
+
+func testJobs(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	job := models.Job{
+		ID:        uuid.New().String(),
+		Kind:      models.JobKindDelete,
+		UserID:    uuid.New().String(),
+		IDs:       []string{"a", "b", "c"},
+		Status:    models.JobPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	require.NoError(t, s.SaveJob(ctx, job))
+
+	unfinished, err := s.GetUnfinishedJobs(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, jobIDs(unfinished), job.ID)
+
+	job.Status = models.JobFailed
+	job.Processed = 3
+	job.Failures = map[string]string{"b": "boom"}
+	job.UpdatedAt = now.Add(time.Second)
+	require.NoError(t, s.SaveJob(ctx, job))
+
+	got, err := s.GetJob(ctx, job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, job.IDs, got.IDs)
+	assert.Equal(t, models.JobFailed, got.Status)
+	assert.Equal(t, 3, got.Processed)
+	assert.Equal(t, job.Failures, got.Failures)
+	assert.True(t, job.UpdatedAt.Equal(got.UpdatedAt))
+
+	unfinished, err = s.GetUnfinishedJobs(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, jobIDs(unfinished), job.ID)
+
+	_, err = s.GetJob(ctx, uuid.New().String())
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func jobIDs(jobs []models.Job) []string {
+	ids := make([]string, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	return ids
+}
+
+// NewRefreshToken возвращает запись токена обновления пользователя userID,
+// истекающего в момент expiresAt.
+func NewRefreshToken(userID string, expiresAt time.Time) models.RefreshToken {
+	return models.RefreshToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		ExpiresAt: expiresAt.UTC().Truncate(time.Second),
+	}
+}
+
+func testRefreshTokens(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	now := time.Now()
+	userID := uuid.New().String()
+
+	active := NewRefreshToken(userID, now.Add(time.Hour))
+	expired := NewRefreshToken(userID, now.Add(-time.Hour))
+	kept := NewRefreshToken(userID, now.Add(time.Hour))
+	for _, token := range []models.RefreshToken{active, expired, kept} {
+		require.NoError(t, s.SaveRefreshToken(ctx, token))
+	}
+
+	got, err := s.RevokeRefreshToken(ctx, active.ID, false)
+	require.NoError(t, err)
+	assert.Equal(t, userID, got.UserID)
+	assert.True(t, active.ExpiresAt.Equal(got.ExpiresAt))
+	require.NotNil(t, got.RevokedAt)
+
+	// Недавно отозванный токен обменивается повторно только один раз.
+	again, err := s.RevokeRefreshToken(ctx, active.ID, false)
+	require.NoError(t, err)
+	assert.Equal(t, userID, again.UserID)
+	assert.True(t, again.Spent)
+	_, err = s.RevokeRefreshToken(ctx, active.ID, false)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.RevokeRefreshToken(ctx, expired.ID, false)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.RevokeRefreshToken(ctx, uuid.New().String(), false)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// Удаляются отозванные и истёкшие токены, действующие остаются.
+	purged, err := s.PurgeRefreshTokens(ctx, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, purged, 2)
+
+	// Окончательно отозванный токен повторно не обменивается.
+	_, err = s.RevokeRefreshToken(ctx, kept.ID, true)
+	require.NoError(t, err)
+	_, err = s.RevokeRefreshToken(ctx, kept.ID, false)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testAccounts(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	id := uuid.New().String()
+	account := models.Account{
+		ID:           id,
+		Login:        "user-" + id[:8],
+		PasswordHash: "hash",
+		CreatedAt:    time.Now().UTC().Truncate(time.Second),
+	}
+	require.NoError(t, s.CreateAccount(ctx, account))
+
+	taken := account
+	taken.ID = uuid.New().String()
+	assert.ErrorIs(t, s.CreateAccount(ctx, taken), storage.ErrLoginTaken)
+
+	// Вторая учётная запись того же пользователя не создаётся.
+	duplicate := account
+	duplicate.Login = "other-" + id[:8]
+	assert.ErrorIs(t, s.CreateAccount(ctx, duplicate), storage.ErrAccountExists)
+	_, err := s.GetAccountByLogin(ctx, duplicate.Login)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	got, err := s.GetAccount(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, account.Login, got.Login)
+	assert.Equal(t, account.PasswordHash, got.PasswordHash)
+	assert.True(t, account.CreatedAt.Equal(got.CreatedAt))
+
+	got, err = s.GetAccountByLogin(ctx, account.Login)
+	require.NoError(t, err)
+	assert.Equal(t, id, got.ID)
+
+	_, err = s.GetAccount(ctx, taken.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = s.GetAccountByLogin(ctx, "missing-"+id[:8])
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// Ссылки анонимного пользователя переходят в учётную запись.
+	anonID := uuid.New().String()
+	first, second := NewURL(anonID), NewURL(anonID)
+	save(t, s, first)
+	save(t, s, second)
+
+	claimed, err := s.ClaimURLs(ctx, anonID, id)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{first.ShortURL, second.ShortURL}, claimed)
+
+	urls, err := s.GetURLsByUser(ctx, id)
+	require.NoError(t, err)
+	assert.Len(t, urls, 2)
+	urls, err = s.GetURLsByUser(ctx, anonID)
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+
+	claimed, err = s.ClaimURLs(ctx, anonID, id)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+}
+
+func testAPIKeys(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	now := time.Now().UTC().Truncate(time.Second)
+	expiresAt := now.Add(time.Hour)
+
+	first := models.APIKey{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      "backend",
+		Hash:      "hash",
+		Scopes:    []string{models.ScopeCreate, models.ScopeRead},
+		CreatedAt: now,
+		ExpiresAt: &expiresAt,
+	}
+	second := first
+	second.ID, second.Name, second.Scopes, second.ExpiresAt = uuid.New().String(), "reports", []string{models.ScopeRead}, nil
+	second.CreatedAt = now.Add(time.Second)
+	other := second
+	other.ID, other.UserID = uuid.New().String(), uuid.New().String()
+	for _, key := range []models.APIKey{second, first, other} {
+		require.NoError(t, s.CreateAPIKey(ctx, key))
+	}
+
+	got, err := s.GetAPIKey(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, userID, got.UserID)
+	assert.Equal(t, first.Hash, got.Hash)
+	assert.Equal(t, first.Scopes, got.Scopes)
+	require.NotNil(t, got.ExpiresAt)
+	assert.True(t, expiresAt.Equal(*got.ExpiresAt))
+
+	keys, err := s.ListAPIKeys(ctx, userID)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, first.ID, keys[0].ID)
+	assert.Equal(t, second.ID, keys[1].ID)
+	assert.Nil(t, keys[1].ExpiresAt)
+
+	// Ключ удаляется только владельцем.
+	assert.ErrorIs(t, s.DeleteAPIKey(ctx, userID, other.ID), storage.ErrNotFound)
+	require.NoError(t, s.DeleteAPIKey(ctx, userID, first.ID))
+	assert.ErrorIs(t, s.DeleteAPIKey(ctx, userID, first.ID), storage.ErrNotFound)
+	_, err = s.GetAPIKey(ctx, first.ID)
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	keys, err = s.ListAPIKeys(ctx, userID)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
+
+func testTokenRevocations(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	token := models.TokenRevocation{TokenID: uuid.New().String(), UserID: userID, RevokedAt: now, ExpiresAt: now.Add(time.Minute)}
+	user := models.TokenRevocation{UserID: userID, RevokedAt: now, ExpiresAt: now.Add(time.Hour)}
+	expired := models.TokenRevocation{TokenID: uuid.New().String(), UserID: userID, RevokedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)}
+	for _, r := range []models.TokenRevocation{token, user, expired} {
+		require.NoError(t, s.SaveTokenRevocation(ctx, r))
+	}
+	// Повторный отзыв всех токенов пользователя заменяет предыдущую запись.
+	user.RevokedAt, user.ExpiresAt = now.Add(time.Second), now.Add(2*time.Hour)
+	require.NoError(t, s.SaveTokenRevocation(ctx, user))
+
+	userRevocations := func(list []models.TokenRevocation) map[string]models.TokenRevocation {
+		found := make(map[string]models.TokenRevocation)
+		for _, r := range list {
+			if r.UserID == userID {
+				found[r.TokenID] = r
+			}
+		}
+		return found
+	}
+
+	list, err := s.ListTokenRevocations(ctx, now)
+	require.NoError(t, err)
+	found := userRevocations(list)
+	require.Len(t, found, 2)
+	assert.Contains(t, found, token.TokenID)
+	require.Contains(t, found, "")
+	assert.True(t, user.RevokedAt.Equal(found[""].RevokedAt))
+	assert.True(t, user.ExpiresAt.Equal(found[""].ExpiresAt))
+
+	purged, err := s.PurgeTokenRevocations(ctx, now.Add(30*time.Minute))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, purged, 2)
+
+	list, err = s.ListTokenRevocations(ctx, now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	found = userRevocations(list)
+	require.Len(t, found, 1)
+	assert.Contains(t, found, "")
+}
+
+func testBatchDelete(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	userID := uuid.New().String()
+	mine, other, kept := NewURL(userID), NewURL(uuid.New().String()), NewURL(userID)
+	for _, data := range []*models.URLData{mine, other, kept} {
+		save(t, s, data)
+	}
+
+	unknown := uuid.New().String()
+	missing, err := s.BatchDeleteURLs(ctx, userID, []string{mine.ShortURL, other.ShortURL, unknown})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{other.ShortURL, unknown}, missing)
+
+	// Повторное удаление своей ссылки не считается отсутствием.
+	missing, err = s.BatchDeleteURLs(ctx, userID, []string{mine.ShortURL})
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+
+	for data, deleted := range map[*models.URLData]bool{mine: true, other: false, kept: false} {
+		got, err := s.GetOriginalURL(ctx, data.ShortURL)
+		require.NoError(t, err)
+		assert.Equal(t, deleted, got.DeletedFlag, data.ShortURL)
+	}
+}
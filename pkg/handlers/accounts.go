@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sol1corejz/go-url-shortener/internal/auth"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	pb "github.com/sol1corejz/go-url-shortener/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Ограничения на длину логина учётной записи.
+const (
+	minLoginLength = 3
+	maxLoginLength = 64
+)
+
+// ErrInvalidLogin ошибка некорректного логина учётной записи
+var ErrInvalidLogin = errors.New("invalid login")
+
+// ErrWeakPassword ошибка слишком короткого пароля учётной записи
+var ErrWeakPassword = errors.New("password is too short")
+
+// ErrInvalidCredentials ошибка входа с неверным логином или паролем
+var ErrInvalidCredentials = errors.New("invalid login or password")
+
+// dummyPasswordHash возвращает хэш, с которым сверяется пароль при входе
+// под несуществующим логином, чтобы время ответа не выдавало, есть ли
+// такая учётная запись.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := auth.HashPassword(uuid.New().String())
+	return hash
+})
+
+// normalizeLogin приводит логин к нижнему регистру и проверяет его длину
+// и допустимые символы (латинские буквы, цифры, «.», «-», «_», «@» и «+»).
+func normalizeLogin(login string) (string, error) {
+	login = strings.ToLower(strings.TrimSpace(login))
+	if len(login) < minLoginLength || len(login) > maxLoginLength {
+		return "", ErrInvalidLogin
+	}
+	for _, c := range login {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', strings.ContainsRune(".-_@+", c):
+		default:
+			return "", ErrInvalidLogin
+		}
+	}
+	return login, nil
+}
+
+// anonymousUserID возвращает идентификатор пользователя из токена доступа,
+// если токен действителен и у пользователя нет учётной записи, иначе пустую строку.
+func (h *Handler) anonymousUserID(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return "", nil
+	}
+	claims, err := auth.ParseToken(token)
+	if err != nil {
+		return "", nil
+	}
+	_, err = h.Storage.GetAccount(ctx, claims.UserID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return claims.UserID, nil
+	}
+	return "", err
+}
+
+// Register регистрирует учётную запись с логином login и паролем password.
+// Если anonToken — действующий токен анонимного пользователя, учётная запись
+// получает его идентификатор, а вместе с ним и все его ссылки.
+// Если логин занят, возвращает storage.ErrLoginTaken, а если учётную запись
+// этого пользователя одновременно создал другой запрос — storage.ErrAccountExists.
+func (h *Handler) Register(ctx context.Context, login, password, anonToken string) (models.Account, error) {
+	login, err := normalizeLogin(login)
+	if err != nil {
+		return models.Account{}, err
+	}
+	if len(password) < auth.MinPasswordLength {
+		return models.Account{}, ErrWeakPassword
+	}
+
+	userID, err := h.anonymousUserID(ctx, anonToken)
+	if err != nil {
+		return models.Account{}, err
+	}
+	if userID == "" {
+		userID = uuid.New().String()
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return models.Account{}, err
+	}
+	account := models.Account{ID: userID, Login: login, PasswordHash: hash, CreatedAt: time.Now().UTC()}
+	if err := h.Storage.CreateAccount(ctx, account); err != nil {
+		return models.Account{}, err
+	}
+	return account, nil
+}
+
+// Login проверяет логин и пароль учётной записи. Если claimToken — действующий
+// токен анонимного пользователя, его ссылки переходят в учётную запись;
+// возвращается их количество. При неверном логине или пароле возвращает
+// ErrInvalidCredentials.
+func (h *Handler) Login(ctx context.Context, login, password, claimToken string) (models.Account, int, error) {
+	login, err := normalizeLogin(login)
+	if err != nil {
+		return models.Account{}, 0, ErrInvalidCredentials
+	}
+
+	account, err := h.Storage.GetAccountByLogin(ctx, login)
+	if errors.Is(err, storage.ErrNotFound) {
+		auth.CheckPassword(dummyPasswordHash(), password)
+		return models.Account{}, 0, ErrInvalidCredentials
+	}
+	if err != nil {
+		return models.Account{}, 0, err
+	}
+	ok, err := auth.CheckPassword(account.PasswordHash, password)
+	if err != nil {
+		return models.Account{}, 0, err
+	}
+	if !ok {
+		return models.Account{}, 0, ErrInvalidCredentials
+	}
+
+	anonID, err := h.anonymousUserID(ctx, claimToken)
+	if err != nil || anonID == "" {
+		return account, 0, err
+	}
+	claimed, err := h.Storage.ClaimURLs(ctx, anonID, account.ID)
+	if err != nil {
+		return models.Account{}, 0, err
+	}
+	return account, len(claimed), nil
+}
+
+// decodeCredentials читает из тела запроса логин и пароль.
+// При ошибке отправляет ответ клиенту и возвращает false.
+func decodeCredentials(w http.ResponseWriter, r *http.Request) (models.Credentials, bool) {
+	var creds models.Credentials
+	if err := json.NewDecoder(r.Body).Decode(&creds); err != nil {
+		logger.Log.Info("cannot decode credentials JSON", zap.Error(err))
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return models.Credentials{}, false
+	}
+	return creds, true
+}
+
+// anonymousToken возвращает токен доступа из cookies, по которому
+// определяется анонимный пользователь. Если токен доступа отсутствует или
+// истёк, сессия продолжается по токену обновления: возвращается новый токен
+// доступа, а новая пара токенов — в renewed. Её нужно установить в cookies,
+// если запрос завершится ошибкой, иначе клиент потеряет анонимную сессию.
+func (h *Handler) anonymousToken(ctx context.Context, r *http.Request) (token string, renewed *session, err error) {
+	token = accessToken(r)
+	if _, err := auth.ParseToken(token); err == nil {
+		return token, nil, nil
+	}
+	cookie, err := r.Cookie(auth.RefreshCookieName)
+	if err != nil {
+		return "", nil, nil
+	}
+	sess, err := h.rotateSession(ctx, cookie.Value)
+	if errors.Is(err, errNoRefreshToken) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return sess.access.Token, &sess, nil
+}
+
+// accessToken возвращает токен доступа из cookies или пустую строку.
+func accessToken(r *http.Request) string {
+	if cookie, err := r.Cookie("token"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// writeAuthResponse начинает сессию пользователя учётной записи
+// и отправляет клиенту ответ с кодом code.
+func (h *Handler) writeAuthResponse(w http.ResponseWriter, r *http.Request, code int, account models.Account, claimed int) {
+	sess, err := h.startSession(r.Context(), w, account.ID)
+	if err != nil {
+		logger.Log.Error("Failed to start session", zap.Error(err))
+		http.Error(w, "Unable to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	res := models.AuthResponse{UserID: account.ID, Claimed: claimed, RefreshResponse: sess.access}
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logger.Log.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// HandleRegister обрабатывает запрос на регистрацию учётной записи.
+// Если у клиента есть действующий токен доступа или токен обновления
+// анонимного пользователя, учётная запись получает его идентификатор
+// вместе со всеми созданными ссылками.
+//
+// Поддерживаемый метод HTTP: POST
+// Тело запроса: JSON-объект с полями login и password.
+// Ответы:
+// - 201 Created: идентификатор пользователя и токен доступа в формате JSON; токены устанавливаются в cookies.
+// - 400 Bad Request: неверный формат JSON, некорректный логин или слишком короткий пароль.
+// - 409 Conflict: логин уже занят или у пользователя уже есть учётная запись.
+// - 500 Internal Server Error: ошибка хранилища.
+func (h *Handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
+	creds, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	anonToken, renewed, err := h.anonymousToken(r.Context(), r)
+	if err != nil {
+		logger.Log.Error("Failed to refresh session", zap.Error(err))
+		http.Error(w, "Failed to register", http.StatusInternalServerError)
+		return
+	}
+	account, err := h.Register(r.Context(), creds.Login, creds.Password, anonToken)
+	if err != nil && renewed != nil {
+		setSessionCookies(w, *renewed)
+	}
+	switch {
+	case errors.Is(err, ErrInvalidLogin):
+		http.Error(w, "Invalid login", http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrWeakPassword):
+		http.Error(w, "Password is too short", http.StatusBadRequest)
+		return
+	case errors.Is(err, storage.ErrLoginTaken):
+		http.Error(w, "Login is already taken", http.StatusConflict)
+		return
+	case errors.Is(err, storage.ErrAccountExists):
+		http.Error(w, "Account already exists", http.StatusConflict)
+		return
+	case err != nil:
+		logger.Log.Error("Failed to register account", zap.Error(err))
+		http.Error(w, "Failed to register", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeAuthResponse(w, r, http.StatusCreated, account, 0)
+}
+
+// HandleLogin обрабатывает запрос на вход в учётную запись.
+// Если в запросе указано claim и у клиента есть действующий токен доступа
+// или токен обновления анонимного пользователя, его ссылки переходят
+// в учётную запись.
+//
+// Поддерживаемый метод HTTP: POST
+// Тело запроса: JSON-объект с полями login, password и необязательным claim.
+// Ответы:
+// - 200 OK: идентификатор пользователя, токен доступа и количество перенесённых ссылок в формате JSON;
+// токены устанавливаются в cookies.
+// - 400 Bad Request: неверный формат JSON.
+// - 401 Unauthorized: неверный логин или пароль.
+// - 500 Internal Server Error: ошибка хранилища.
+func (h *Handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	creds, ok := decodeCredentials(w, r)
+	if !ok {
+		return
+	}
+
+	var (
+		claimToken string
+		renewed    *session
+		err        error
+	)
+	if creds.Claim {
+		claimToken, renewed, err = h.anonymousToken(r.Context(), r)
+		if err != nil {
+			logger.Log.Error("Failed to refresh session", zap.Error(err))
+			http.Error(w, "Failed to log in", http.StatusInternalServerError)
+			return
+		}
+	}
+	account, claimed, err := h.Login(r.Context(), creds.Login, creds.Password, claimToken)
+	if err != nil && renewed != nil {
+		setSessionCookies(w, *renewed)
+	}
+	if errors.Is(err, ErrInvalidCredentials) {
+		http.Error(w, "Invalid login or password", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		logger.Log.Error("Failed to log in", zap.Error(err))
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	h.writeAuthResponse(w, r, http.StatusOK, account, claimed)
+}
+
+// Register обрабатывает gRPC-запрос на регистрацию учётной записи.
+// Если claim_token — действующий токен анонимного пользователя, учётная
+// запись получает его идентификатор вместе со всеми созданными ссылками.
+func (s *ShortenerServer) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	account, err := s.Handler.Register(ctx, req.Login, req.Password, req.ClaimToken)
+	switch {
+	case errors.Is(err, ErrInvalidLogin):
+		return &pb.RegisterResponse{Error: "Invalid login"}, status.Error(codes.InvalidArgument, "Invalid login")
+	case errors.Is(err, ErrWeakPassword):
+		return &pb.RegisterResponse{Error: "Password is too short"}, status.Error(codes.InvalidArgument, "Password is too short")
+	case errors.Is(err, storage.ErrLoginTaken):
+		return &pb.RegisterResponse{Error: "Login is already taken"}, status.Error(codes.AlreadyExists, "Login is already taken")
+	case errors.Is(err, storage.ErrAccountExists):
+		return &pb.RegisterResponse{Error: "Account already exists"}, status.Error(codes.AlreadyExists, "Account already exists")
+	case err != nil:
+		logger.Log.Error("Failed to register account", zap.Error(err))
+		return &pb.RegisterResponse{Error: "Failed to register"}, status.Error(codes.Internal, "Failed to register")
+	}
+
+	sess, err := s.newSession(ctx, account.ID)
+	if err != nil {
+		logger.Log.Error("Failed to start session", zap.Error(err))
+		return &pb.RegisterResponse{Error: "Unable to generate token"}, status.Error(codes.Internal, "Unable to generate token")
+	}
+	return &pb.RegisterResponse{
+		UserId:       account.ID,
+		Token:        sess.access.Token,
+		ExpiresAt:    timestamppb.New(sess.access.ExpiresAt),
+		RefreshToken: sess.refreshToken,
+	}, nil
+}
+
+// Login обрабатывает gRPC-запрос на вход в учётную запись. Если claim_token —
+// действующий токен анонимного пользователя, его ссылки переходят в учётную запись.
+func (s *ShortenerServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
+	account, claimed, err := s.Handler.Login(ctx, req.Login, req.Password, req.ClaimToken)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return &pb.LoginResponse{Error: "Invalid login or password"}, status.Error(codes.Unauthenticated, "Invalid login or password")
+	}
+	if err != nil {
+		logger.Log.Error("Failed to log in", zap.Error(err))
+		return &pb.LoginResponse{Error: "Failed to log in"}, status.Error(codes.Internal, "Failed to log in")
+	}
+
+	sess, err := s.newSession(ctx, account.ID)
+	if err != nil {
+		logger.Log.Error("Failed to start session", zap.Error(err))
+		return &pb.LoginResponse{Error: "Unable to generate token"}, status.Error(codes.Internal, "Unable to generate token")
+	}
+	return &pb.LoginResponse{
+		UserId:       account.ID,
+		Token:        sess.access.Token,
+		ExpiresAt:    timestamppb.New(sess.access.ExpiresAt),
+		RefreshToken: sess.refreshToken,
+		Claimed:      int32(claimed),
+	}, nil
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+)
+
+// Ограничения на длину пользовательского псевдонима короткой ссылки.
+const (
+	minAliasLength = 3
+	maxAliasLength = 64
+)
+
+// reservedAliases содержит псевдонимы, совпадающие с путями сервиса.
+var reservedAliases = map[string]struct{}{
+	"api":   {},
+	"ping":  {},
+	"debug": {},
+}
+
+// ErrInvalidAlias ошибка некорректного псевдонима короткой ссылки
+var ErrInvalidAlias = errors.New("invalid alias")
+
+// ErrReservedAlias ошибка использования зарезервированного псевдонима
+var ErrReservedAlias = errors.New("alias is reserved")
+
+// validateAlias проверяет пользовательский псевдоним: длину, допустимые символы
+// (латинские буквы, цифры, «-» и «_») и отсутствие в списке зарезервированных слов.
+func validateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return ErrInvalidAlias
+	}
+	for _, c := range alias {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return ErrInvalidAlias
+		}
+	}
+	if _, ok := reservedAliases[strings.ToLower(alias)]; ok {
+		return ErrReservedAlias
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sol1corejz/go-url-shortener/internal/auth"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	"go.uber.org/zap"
+)
+
+// maxAPIKeyNameLength — максимальная длина названия ключа API.
+const maxAPIKeyNameLength = 100
+
+// ErrInvalidAPIKeyName ошибка пустого или слишком длинного названия ключа API
+var ErrInvalidAPIKeyName = errors.New("invalid API key name")
+
+// ErrInvalidScope ошибка неизвестного права ключа API
+var ErrInvalidScope = errors.New("invalid API key scope")
+
+// CreateAPIKey создаёт ключ API пользователя userID. Ключ без указанных прав
+// получает все права. Возвращает сам ключ, который больше нигде не хранится,
+// и его запись.
+func (h *Handler) CreateAPIKey(ctx context.Context, userID string, req models.APIKeyRequest) (string, models.APIKey, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxAPIKeyNameLength {
+		return "", models.APIKey{}, ErrInvalidAPIKeyName
+	}
+
+	scopes := slices.Clone(models.Scopes)
+	if len(req.Scopes) > 0 {
+		scopes = nil
+		for _, scope := range req.Scopes {
+			if !slices.Contains(models.Scopes, scope) {
+				return "", models.APIKey{}, ErrInvalidScope
+			}
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	expiresAt, err := resolveExpiry(req.TTL, req.ExpiresAt, time.Now())
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+
+	key, record, err := auth.NewAPIKey(userID, name, scopes, expiresAt)
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+	if err := h.Storage.CreateAPIKey(ctx, record); err != nil {
+		return "", models.APIKey{}, err
+	}
+	return key, record, nil
+}
+
+// AuthenticateAPIKey проверяет ключ API и его право scope и возвращает
+// идентификатор пользователя, от имени которого действует ключ.
+// Если ключ не найден, истёк или неверен, возвращает auth.ErrInvalidAPIKey,
+// а если у ключа нет права scope — auth.ErrInsufficientScope.
+func (h *Handler) AuthenticateAPIKey(ctx context.Context, key, scope string) (string, error) {
+	id, secret, err := auth.ParseAPIKey(key)
+	if err != nil {
+		return "", err
+	}
+	record, err := h.Storage.GetAPIKey(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", auth.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return "", err
+	}
+	if !auth.CheckAPIKey(record, secret) || record.Expired(time.Now()) {
+		return "", auth.ErrInvalidAPIKey
+	}
+	if !record.HasScope(scope) {
+		return "", auth.ErrInsufficientScope
+	}
+	return record.UserID, nil
+}
+
+// apiKeyFromRequest возвращает ключ API из заголовка X-API-Key
+// или Authorization со схемой Bearer либо пустую строку.
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	scheme, key, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
+
+// apiKeyUserID возвращает идентификатор пользователя по ключу API из заголовков
+// запроса, если у ключа есть право scope. При ошибке отправляет ответ клиенту
+// и возвращает false.
+func (h *Handler) apiKeyUserID(w http.ResponseWriter, r *http.Request, key, scope string) (string, bool) {
+	userID, err := h.AuthenticateAPIKey(r.Context(), key, scope)
+	switch {
+	case errors.Is(err, auth.ErrInvalidAPIKey):
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return "", false
+	case errors.Is(err, auth.ErrInsufficientScope):
+		http.Error(w, "Insufficient API key scope", http.StatusForbidden)
+		return "", false
+	case err != nil:
+		logger.Log.Error("Failed to check API key", zap.Error(err))
+		http.Error(w, "Failed to check API key", http.StatusInternalServerError)
+		return "", false
+	}
+	return userID, true
+}
+
+// authorizedUserID возвращает идентификатор пользователя по ключу API с правом
+// scope или, если ключ не передан, по сессии в cookies (см. cookieUserID).
+// При ошибке отправляет ответ клиенту и возвращает false.
+func (h *Handler) authorizedUserID(w http.ResponseWriter, r *http.Request, scope string) (string, bool) {
+	if key := apiKeyFromRequest(r); key != "" {
+		return h.apiKeyUserID(w, r, key, scope)
+	}
+	return h.cookieUserID(w, r)
+}
+
+// apiKeyResponse преобразует запись ключа API в ответ без секрета.
+func apiKeyResponse(record models.APIKey) models.APIKeyResponse {
+	return models.APIKeyResponse{
+		ID:        record.ID,
+		Name:      record.Name,
+		Scopes:    record.Scopes,
+		CreatedAt: record.CreatedAt,
+		ExpiresAt: record.ExpiresAt,
+	}
+}
+
+// HandleCreateAPIKey обрабатывает запрос на создание ключа API.
+// Ключами управляет только пользователь с сессией в cookies:
+// ключ API не может создавать другие ключи.
+//
+// Поддерживаемый метод HTTP: POST
+// Тело запроса: JSON-объект с названием name, необязательными правами scopes
+// (create, read, delete; по умолчанию все) и сроком действия ttl или expires_at.
+// Ответы:
+// - 201 Created: ключ в формате JSON. Сам ключ передаётся только в этом ответе.
+// - 400 Bad Request: неверный формат JSON, название, права или срок действия.
+// - 401 Unauthorized: пользователь не авторизован.
+// - 500 Internal Server Error: ошибка хранилища.
+func (h *Handler) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.cookieUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Log.Info("cannot decode API key request JSON", zap.Error(err))
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	key, record, err := h.CreateAPIKey(r.Context(), userID, req)
+	switch {
+	case errors.Is(err, ErrInvalidAPIKeyName):
+		http.Error(w, "Invalid API key name", http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrInvalidScope):
+		http.Error(w, "Invalid API key scope", http.StatusBadRequest)
+		return
+	case errors.Is(err, ErrInvalidExpiry):
+		http.Error(w, "Invalid expiry", http.StatusBadRequest)
+		return
+	case err != nil:
+		logger.Log.Error("Failed to create API key", zap.Error(err))
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	res := apiKeyResponse(record)
+	res.Key = key
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logger.Log.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// HandleListAPIKeys обрабатывает запрос на получение ключей API пользователя.
+// Сами ключи не возвращаются.
+//
+// Поддерживаемый метод HTTP: GET
+// Ответы:
+// - 200 OK: JSON-массив ключей в порядке создания.
+// - 204 No Content: у пользователя нет ключей.
+// - 401 Unauthorized: пользователь не авторизован.
+// - 500 Internal Server Error: ошибка хранилища.
+func (h *Handler) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.cookieUserID(w, r)
+	if !ok {
+		return
+	}
+
+	records, err := h.Storage.ListAPIKeys(r.Context(), userID)
+	if err != nil {
+		logger.Log.Error("Failed to list API keys", zap.Error(err))
+		http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+	if len(records) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	res := make([]models.APIKeyResponse, len(records))
+	for i, record := range records {
+		res[i] = apiKeyResponse(record)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logger.Log.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// HandleDeleteAPIKey обрабатывает запрос на отзыв ключа API.
+// Отозванный ключ сразу перестаёт действовать.
+//
+// Поддерживаемый метод HTTP: DELETE
+// Ответы:
+// - 204 No Content: ключ отозван.
+// - 401 Unauthorized: пользователь не авторизован.
+// - 404 Not Found: ключ не найден или принадлежит другому пользователю.
+// - 500 Internal Server Error: ошибка хранилища.
+func (h *Handler) HandleDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.cookieUserID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Storage.DeleteAPIKey(r.Context(), userID, chi.URLParam(r, "id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Log.Error("Failed to delete API key", zap.Error(err))
+		http.Error(w, "Failed to delete API key", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sol1corejz/go-url-shortener/internal/auth"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	pb "github.com/sol1corejz/go-url-shortener/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// errNoRefreshToken — у запроса нет действующего токена обновления.
+var errNoRefreshToken = errors.New("no valid refresh token")
+
+// HandleRefresh обменивает токен обновления из cookie на новый токен доступа.
+// Токен обновления одноразовый: предъявленный токен отзывается, а вместе
+// с токеном доступа выдаётся новый токен обновления.
+//
+// Поддерживаемый метод HTTP: POST
+// Ответы:
+// - 200 OK: новый токен доступа и момент его истечения в формате JSON; оба токена устанавливаются в cookies.
+// - 401 Unauthorized: токен обновления отсутствует, истёк, отозван или уже использован.
+// - 500 Internal Server Error: ошибка хранилища или подписи токена.
+func (h *Handler) HandleRefresh(w http.ResponseWriter, r *http.Request) {
+	sess, err := h.refreshSession(r.Context(), w, r)
+	if errors.Is(err, errNoRefreshToken) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		logger.Log.Error("Failed to refresh session", zap.Error(err))
+		http.Error(w, "Unable to refresh token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(sess.access); err != nil {
+		logger.Log.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// RefreshToken обрабатывает gRPC-запрос на обмен токена обновления на новую пару токенов.
+func (s *ShortenerServer) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
+	sess, err := s.rotateSession(ctx, req.RefreshToken)
+	if errors.Is(err, errNoRefreshToken) {
+		return &pb.RefreshTokenResponse{Error: "Invalid refresh token"}, status.Error(codes.Unauthenticated, "Invalid refresh token")
+	}
+	if err != nil {
+		logger.Log.Error("Failed to refresh session", zap.Error(err))
+		return &pb.RefreshTokenResponse{Error: "Unable to refresh token"}, status.Error(codes.Internal, "Unable to refresh token")
+	}
+
+	return &pb.RefreshTokenResponse{
+		Token:        sess.access.Token,
+		ExpiresAt:    timestamppb.New(sess.access.ExpiresAt),
+		RefreshToken: sess.refreshToken,
+	}, nil
+}
+
+// sessionUserID возвращает идентификатор пользователя сессии из cookies
+// (см. cookieUserID). Клиенту без cookies сессии выдаётся новая анонимная
+// сессия; недействительные токены отклоняются, чтобы клиент не потерял
+// свои ссылки, незаметно получив новый идентификатор.
+// Запрос с ключом API выполняется от имени владельца ключа, если у ключа
+// есть право create; cookies сессии при этом не устанавливаются.
+// При ошибке отправляет ответ клиенту и возвращает false.
+func (h *Handler) sessionUserID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if key := apiKeyFromRequest(r); key != "" {
+		return h.apiKeyUserID(w, r, key, models.ScopeCreate)
+	}
+
+	if hasSessionCookies(r) {
+		return h.cookieUserID(w, r)
+	}
+
+	// Новый пользователь.
+	sess, err := h.startSession(r.Context(), w, uuid.New().String())
+	if err != nil {
+		logger.Log.Error("Failed to start session", zap.Error(err))
+		http.Error(w, "Unable to generate token", http.StatusInternalServerError)
+		return "", false
+	}
+	return sess.userID, true
+}
+
+// cookieUserID возвращает идентификатор пользователя из токена доступа
+// в cookies и продлевает токен, срок действия которого подходит к концу.
+// Если токена доступа нет или он недействителен, сессия продолжается
+// по токену обновления. При ошибке отправляет ответ клиенту и возвращает false.
+func (h *Handler) cookieUserID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if cookie, err := r.Cookie("token"); err == nil {
+		if claims, err := auth.ParseToken(cookie.Value); err == nil {
+			if claims.ExpiresAt != nil && time.Until(claims.ExpiresAt.Time) < auth.RenewBefore {
+				if _, err := setAccessToken(w, claims.UserID); err != nil {
+					logger.Log.Warn("Failed to renew access token", zap.Error(err))
+				}
+			}
+			return claims.UserID, true
+		}
+	}
+
+	sess, err := h.refreshSession(r.Context(), w, r)
+	if errors.Is(err, errNoRefreshToken) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	if err != nil {
+		logger.Log.Error("Failed to refresh session", zap.Error(err))
+		http.Error(w, "Unable to generate token", http.StatusInternalServerError)
+		return "", false
+	}
+	return sess.userID, true
+}
+
+// hasSessionCookies сообщает, передал ли клиент токен доступа или токен обновления.
+func hasSessionCookies(r *http.Request) bool {
+	for _, name := range []string{"token", auth.RefreshCookieName} {
+		if _, err := r.Cookie(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// session — пара токенов, выданная пользователю.
+type session struct {
+	userID string
+	// access — токен доступа и момент его истечения.
+	access models.RefreshResponse
+	// refreshToken — токен обновления, истекающий в момент refreshExpiresAt.
+	refreshToken     string
+	refreshExpiresAt time.Time
+}
+
+// newSession выдаёт пользователю userID токен доступа и токен обновления
+// и сохраняет запись токена обновления.
+func (h *Handler) newSession(ctx context.Context, userID string) (session, error) {
+	refreshToken, record, err := auth.NewRefreshToken(userID)
+	if err != nil {
+		return session{}, err
+	}
+	if err := h.Storage.SaveRefreshToken(ctx, record); err != nil {
+		return session{}, err
+	}
+
+	token, expiresAt, err := auth.IssueAccessToken(userID)
+	if err != nil {
+		return session{}, err
+	}
+	return session{
+		userID:           userID,
+		access:           models.RefreshResponse{Token: token, ExpiresAt: expiresAt.UTC()},
+		refreshToken:     refreshToken,
+		refreshExpiresAt: record.ExpiresAt,
+	}, nil
+}
+
+// rotateSession отзывает токен обновления refreshToken и выдаёт его владельцу
+// новую пару токенов. Только что отозванный токен обменивается ещё один раз
+// (см. storage.RefreshReuseGrace): так параллельные запросы с одними cookies
+// не теряют сессию. Если токен недействителен или все токены владельца
+// отозваны после его выдачи, возвращает errNoRefreshToken.
+func (h *Handler) rotateSession(ctx context.Context, refreshToken string) (session, error) {
+	if refreshToken == "" {
+		return session{}, errNoRefreshToken
+	}
+	token, err := h.Storage.RevokeRefreshToken(ctx, auth.HashRefreshToken(refreshToken), false)
+	if errors.Is(err, storage.ErrNotFound) {
+		return session{}, errNoRefreshToken
+	}
+	if err != nil {
+		return session{}, err
+	}
+	if rv := auth.CurrentRevocations(); rv != nil && rv.UserRevoked(token.UserID, token.CreatedAt) {
+		return session{}, errNoRefreshToken
+	}
+	return h.newSession(ctx, token.UserID)
+}
+
+// startSession выдаёт пользователю userID новую пару токенов и устанавливает её в cookies.
+func (h *Handler) startSession(ctx context.Context, w http.ResponseWriter, userID string) (session, error) {
+	sess, err := h.newSession(ctx, userID)
+	if err != nil {
+		return session{}, err
+	}
+	setSessionCookies(w, sess)
+	return sess, nil
+}
+
+// refreshSession обменивает токен обновления из cookies на новую пару токенов
+// и устанавливает её в cookies. Если токена нет или он недействителен,
+// возвращает errNoRefreshToken.
+func (h *Handler) refreshSession(ctx context.Context, w http.ResponseWriter, r *http.Request) (session, error) {
+	cookie, err := r.Cookie(auth.RefreshCookieName)
+	if err != nil {
+		return session{}, errNoRefreshToken
+	}
+	sess, err := h.rotateSession(ctx, cookie.Value)
+	if err != nil {
+		return session{}, err
+	}
+	setSessionCookies(w, sess)
+	return sess, nil
+}
+
+// setSessionCookies устанавливает токен доступа и токен обновления в cookies.
+func setSessionCookies(w http.ResponseWriter, sess session) {
+	setAccessCookie(w, sess.access)
+	http.SetCookie(w, &http.Cookie{
+		Name:     auth.RefreshCookieName,
+		Value:    sess.refreshToken,
+		Path:     "/",
+		Expires:  sess.refreshExpiresAt,
+		HttpOnly: true,
+	})
+}
+
+// setAccessToken выдаёт пользователю userID новый токен доступа и устанавливает его в cookie.
+func setAccessToken(w http.ResponseWriter, userID string) (models.RefreshResponse, error) {
+	token, expiresAt, err := auth.IssueAccessToken(userID)
+	if err != nil {
+		return models.RefreshResponse{}, err
+	}
+	access := models.RefreshResponse{Token: token, ExpiresAt: expiresAt.UTC()}
+	setAccessCookie(w, access)
+	return access, nil
+}
+
+// setAccessCookie устанавливает токен доступа в cookie.
+func setAccessCookie(w http.ResponseWriter, access models.RefreshResponse) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Value:    access.Token,
+		Path:     "/",
+		Expires:  access.ExpiresAt,
+		HttpOnly: true,
+	})
+}
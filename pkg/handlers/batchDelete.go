@@ -4,36 +4,40 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	pb "github.com/sol1corejz/go-url-shortener/proto"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"io"
 	"net/http"
-	"sync"
 
 	"github.com/sol1corejz/go-url-shortener/internal/auth"
+	"github.com/sol1corejz/go-url-shortener/internal/jobs"
 	"github.com/sol1corejz/go-url-shortener/internal/logger"
-	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
 	"go.uber.org/zap"
 )
 
 // HandleDeleteURLs обрабатывает запросы на удаление списка сокращённых URL.
 // Проверяет авторизацию пользователя, извлекает список идентификаторов из тела запроса
-// и инициирует асинхронный процесс удаления.
+// и ставит в очередь задачу удаления. Состояние задачи доступно по адресу
+// из заголовка Location (GET /api/jobs/{id}).
 //
 // Поддерживаемый метод HTTP: DELETE
 // Тело запроса: JSON-массив идентификаторов сокращённых URL (например, ["abc123", "xyz456"]).
 // Ответы:
-// - 202 Accepted: Удаление батча начато.
+// - 202 Accepted: Задача удаления поставлена в очередь, в теле — её состояние в формате JSON.
 // - 401 Unauthorized: Пользователь не авторизован.
+// - 403 Forbidden: у ключа API нет права delete.
 // - 400 Bad Request: Неверный формат JSON или пустой батч.
-// - 500 Internal Server Error: Ошибка чтения тела запроса.
-func HandleDeleteURLs(w http.ResponseWriter, r *http.Request) {
+// - 500 Internal Server Error: Ошибка чтения тела запроса или сохранения задачи.
+// - 503 Service Unavailable: Сервис останавливается и не принимает новые задачи.
+func (h *Handler) HandleDeleteURLs(w http.ResponseWriter, r *http.Request) {
 	// Проверка авторизации пользователя с помощью функции CheckIsAuthorized.
 	// Если авторизация не пройдена, возвращаем ошибку 401 (Unauthorized).
-	userID, err := auth.CheckIsAuthorized(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	userID, ok := h.authorizedUserID(w, r, models.ScopeDelete)
+	if !ok {
 		return
 	}
 
@@ -61,102 +65,32 @@ func HandleDeleteURLs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Устанавливаем код ответа 202 (Accepted), так как процесс удаления будет выполнен асинхронно.
-	w.WriteHeader(http.StatusAccepted)
-
-	// Запуск асинхронного процесса удаления URL.
-	// В процессе удаления будет использован список идентификаторов и идентификатор пользователя.
-	go processDeleteBatch(ids, userID)
-}
-
-func processDeleteBatch(ids []string, userID string) {
-	doneCh := make(chan struct{})
-	defer close(doneCh)
-
-	inputCh := generatorDeleteBatch(doneCh, ids)
-	channels := fanOutDeleteBatch(doneCh, inputCh, userID)
-	errorCh := fanInDeleteBatch(doneCh, channels...)
-
-	for err := range errorCh {
-		if err != nil {
-			logger.Log.Error("Не удалось удалить URL", zap.Error(err))
-		}
+	// Постановка задачи удаления в очередь. Задача сохраняется в хранилище
+	// и будет выполнена даже после перезапуска сервиса.
+	job, err := h.Jobs.EnqueueDelete(r.Context(), userID, ids)
+	if errors.Is(err, jobs.ErrClosed) {
+		http.Error(w, "Сервис останавливается", http.StatusServiceUnavailable)
+		return
 	}
-}
-
-func deleteURL(doneCh chan struct{}, inputCh chan string, userID string) chan error {
-	resultCh := make(chan error)
-	go func() {
-		defer close(resultCh)
-		for id := range inputCh {
-			err := storage.BatchUpdateDeleteFlag(id, userID)
-			select {
-			case <-doneCh:
-				return
-			case resultCh <- err:
-			}
-		}
-	}()
-	return resultCh
-}
-
-func generatorDeleteBatch(doneCh chan struct{}, ids []string) chan string {
-	inputCh := make(chan string)
-	go func() {
-		defer close(inputCh)
-		for _, id := range ids {
-			select {
-			case <-doneCh:
-				return
-			case inputCh <- id:
-			}
-		}
-	}()
-	return inputCh
-}
-
-func fanOutDeleteBatch(doneCh chan struct{}, inputCh chan string, userID string) []chan error {
-	numWorkers := 5
-	channels := make([]chan error, numWorkers)
-	for i := 0; i < numWorkers; i++ {
-		channels[i] = deleteURL(doneCh, inputCh, userID)
+	if err != nil {
+		logger.Log.Error("Не удалось поставить задачу удаления в очередь", zap.Error(err))
+		http.Error(w, "Не удалось поставить задачу в очередь", http.StatusInternalServerError)
+		return
 	}
-	return channels
-}
-
-func fanInDeleteBatch(doneCh chan struct{}, resultChs ...chan error) chan error {
-	finalCh := make(chan error)
-	var wg sync.WaitGroup
 
-	for _, ch := range resultChs {
-		wg.Add(1)
-
-		chClosure := ch
-
-		go func() {
-			defer wg.Done()
+	// Устанавливаем код ответа 202 (Accepted), так как удаление будет выполнено асинхронно.
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/api/jobs/%s", job.ID))
+	w.WriteHeader(http.StatusAccepted)
 
-			for err := range chClosure {
-				select {
-				case <-doneCh:
-					return
-				case finalCh <- err:
-				}
-			}
-		}()
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		logger.Log.Error("Failed to encode response", zap.Error(err))
 	}
-
-	go func() {
-		wg.Wait()
-		close(finalCh)
-	}()
-
-	return finalCh
 }
 
 // BatchDelete обрабатывает gRPC-запрос на удаление списка сокращённых URL.
 func (s *ShortenerServer) BatchDelete(ctx context.Context, req *pb.BatchDeleteRequest) (*pb.BatchDeleteResponse, error) {
-	userID := req.UserId
+	userID := auth.UserIDFromContext(ctx)
 
 	// Проверка, что список идентификаторов не пустой.
 	if len(req.Ids) == 0 {
@@ -165,11 +99,22 @@ func (s *ShortenerServer) BatchDelete(ctx context.Context, req *pb.BatchDeleteRe
 		}, status.Error(codes.InvalidArgument, "Batch cannot be empty")
 	}
 
-	// Запуск асинхронного процесса удаления.
-	go processDeleteBatch(req.Ids, userID)
+	// Постановка задачи удаления в очередь.
+	job, err := s.Jobs.EnqueueDelete(ctx, userID, req.Ids)
+	if errors.Is(err, jobs.ErrClosed) {
+		return &pb.BatchDeleteResponse{
+			Error: "Service is shutting down",
+		}, status.Error(codes.Unavailable, "Service is shutting down")
+	}
+	if err != nil {
+		return &pb.BatchDeleteResponse{
+			Error: "Failed to enqueue deletion",
+		}, status.Error(codes.Internal, "Failed to enqueue deletion")
+	}
 
 	// Возврат успешного ответа.
 	return &pb.BatchDeleteResponse{
 		Message: "Batch deletion started",
+		JobId:   job.ID,
 	}, nil
 }
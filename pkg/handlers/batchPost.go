@@ -10,7 +10,8 @@ import (
 	"google.golang.org/grpc/status"
 	"io"
 	"net/http"
-	"sync"
+	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,55 +19,36 @@ import (
 	"github.com/sol1corejz/go-url-shortener/internal/auth"
 	"github.com/sol1corejz/go-url-shortener/internal/logger"
 	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/shortid"
 	"github.com/sol1corejz/go-url-shortener/internal/storage"
 	"go.uber.org/zap"
 )
 
 // HandleBatchPost обрабатывает HTTP-запросы на пакетное сокращение URL.
 //
-// Эта функция извлекает токен аутентификации из cookies, если он существует, и создает новый,
-// если его нет. Затем она обрабатывает пакет запросов на сокращение URL и отправляет ответы в формате JSON.
+// Эта функция извлекает токен аутентификации из cookies, продлевая его при необходимости,
+// и начинает новую сессию, если токена нет. Затем она обрабатывает пакет запросов на сокращение URL и отправляет ответы в формате JSON.
 //
 // Поддерживаемые HTTP-методы: POST
-// Тело запроса: JSON-массив объектов с полями `OriginalURL` и `CorrelationID`.
+// Тело запроса: JSON-массив объектов с полями `OriginalURL` и `CorrelationID`
+// и необязательными полями `ttl` или `expires_at`.
+// Параметр запроса `atomic=true` включает режим «всё или ничего»: пакет
+// с хотя бы одним некорректным элементом не сохраняется.
+// Все элементы сохраняются одной транзакцией.
 // Ответ:
-//   - 201 Created: Возвращает JSON-массив с сокращенными URL и их корреляционными идентификаторами.
-//   - 400 Bad Request: Ошибка при разборе тела запроса или пустой запрос.
+//   - 201 Created: Возвращает JSON-массив в порядке запроса с сокращенными URL, корреляционными
+//     идентификаторами и статусом каждого элемента (created, existing или invalid).
+//   - 400 Bad Request: Ошибка при разборе тела запроса, пустой запрос или некорректный параметр atomic.
+//   - 422 Unprocessable Entity: Пакет отклонён в режиме «всё или ничего»; некорректные элементы
+//     имеют статус invalid, остальные — skipped.
 //   - 401 Unauthorized: Невалидный или отсутствующий токен аутентификации.
+//   - 403 Forbidden: у ключа API нет права create.
 //   - 500 Internal Server Error: Ошибка при обработке запроса.
-func HandleBatchPost(w http.ResponseWriter, r *http.Request) {
-	// Проверка и извлечение токена из cookies
-	cookie, err := r.Cookie("token")
-	var userID string
-	if errors.Is(err, http.ErrNoCookie) {
-		var token string
-		// Если токен отсутствует, генерируем новый
-		token, err = auth.GenerateToken()
-		if err != nil {
-			http.Error(w, "Unable to generate token", http.StatusInternalServerError)
-			return
-		}
-
-		// Устанавливаем токен в cookies
-		http.SetCookie(w, &http.Cookie{
-			Name:     "token",
-			Value:    token,
-			Expires:  time.Now().Add(auth.TokenExp),
-			HttpOnly: true,
-		})
-
-		// Извлекаем ID пользователя
-		userID = auth.GetUserID(token)
-	} else if err != nil {
-		http.Error(w, "Error retrieving cookie", http.StatusBadRequest)
+func (h *Handler) HandleBatchPost(w http.ResponseWriter, r *http.Request) {
+	// Извлечение пользователя из токена в cookies или начало новой сессии
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
 		return
-	} else {
-		// Извлекаем ID пользователя из токена
-		userID = auth.GetUserID(cookie.Value)
-		if userID == "" {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
 	}
 
 	// Чтение тела запроса
@@ -91,13 +73,29 @@ func HandleBatchPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Режим «всё или ничего»
+	atomic := false
+	if v := r.URL.Query().Get("atomic"); v != "" {
+		if atomic, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "Invalid atomic parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Обработка запроса
-	var res []models.BatchResponse
-	processBatchPost(req, userID, &res)
+	res, err := h.SaveBatch(r.Context(), req, userID, atomic)
+	code := http.StatusCreated
+	if errors.Is(err, ErrBatchRejected) {
+		code = http.StatusUnprocessableEntity
+	} else if err != nil {
+		logger.Log.Error("Failed to save batch", zap.Error(err))
+		http.Error(w, "Failed to save URLs", http.StatusInternalServerError)
+		return
+	}
 
 	// Установка заголовков и отправка ответа
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(code)
 
 	// Кодирование и отправка ответа
 	if err := json.NewEncoder(w).Encode(res); err != nil {
@@ -106,116 +104,123 @@ func HandleBatchPost(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func processBatchPost(req []models.BatchRequest, userID string, res *[]models.BatchResponse) {
-	doneCh := make(chan struct{})
-	defer close(doneCh)
-
-	inputCh := generatorBatchPost(doneCh, req, userID)
-
-	channels := fanOutBatchPost(doneCh, inputCh)
-
-	resultCh := fanInBatchPost(doneCh, channels...)
-
-	for result := range resultCh {
-		*res = append(*res, result)
+// ErrBatchRejected ошибка отклонения пакета в режиме «всё или ничего»
+var ErrBatchRejected = errors.New("batch rejected")
+
+// ErrInvalidURL ошибка некорректного оригинального URL
+var ErrInvalidURL = errors.New("invalid URL")
+
+// SaveBatch содержит бизнес-логику пакетного сокращения URL. Все корректные
+// элементы пакета сохраняются одной транзакцией, а результат возвращается
+// в порядке запроса со статусом каждого элемента. Если atomic и хотя бы один
+// элемент некорректен, ничего не сохраняется, остальные элементы получают
+// статус models.BatchSkipped и возвращается ErrBatchRejected.
+func (h *Handler) SaveBatch(ctx context.Context, req []models.BatchRequest, userID string, atomic bool) ([]models.BatchResponse, error) {
+	res := make([]models.BatchResponse, len(req))
+	events := make([]*models.URLData, 0, len(req))
+	positions := make([]int, 0, len(req)) // Позиции элементов events в запросе.
+	now := time.Now()
+
+	for i, item := range req {
+		res[i].CorrelationID = item.CorrelationID
+		expiresAt, err := validateBatchItem(item, now)
+		if err != nil {
+			res[i].Status, res[i].Error = models.BatchInvalid, err.Error()
+			continue
+		}
+		events = append(events, &models.URLData{
+			UUID:          uuid.New().String(),
+			OriginalURL:   item.OriginalURL,
+			UserUUID:      userID,
+			CorrelationID: item.CorrelationID,
+			ExpiresAt:     expiresAt,
+		})
+		positions = append(positions, i)
 	}
-}
 
-func postURL(doneCh chan struct{}, inputCh chan models.URLData) chan models.BatchResponse {
-	resultCh := make(chan models.BatchResponse)
-	go func() {
-		defer close(resultCh)
-		for event := range inputCh {
-			batchResponse := models.BatchResponse{
-				CorrelationID: event.CorrelationID,
-				ShortURL:      "",
-			}
-			shortURL, err := storage.SaveURL(&event)
-			if err != nil {
-				if errors.Is(err, storage.ErrAlreadyExists) {
-					batchResponse.ShortURL = fmt.Sprintf("%s/%s", config.FlagBaseURL, shortURL)
-				}
-			} else {
-				batchResponse.ShortURL = fmt.Sprintf("%s/%s", config.FlagBaseURL, event.ShortURL)
-			}
-
-			select {
-			case <-doneCh:
-				return
-			case resultCh <- batchResponse:
-			}
+	if atomic && len(events) < len(req) {
+		for _, i := range positions {
+			res[i].Status = models.BatchSkipped
 		}
-	}()
-	return resultCh
-}
+		return res, ErrBatchRejected
+	}
 
-func generatorBatchPost(doneCh chan struct{}, data []models.BatchRequest, userID string) chan models.URLData {
-	inputCh := make(chan models.URLData)
-	go func() {
-		defer close(inputCh)
-		for _, event := range data {
-			ev := models.URLData{
-				UUID:          uuid.New().String(),
-				ShortURL:      generateShortID(),
-				OriginalURL:   event.OriginalURL,
-				DeletedFlag:   false,
-				UserUUID:      userID,
-				CorrelationID: event.CorrelationID,
-			}
-			select {
-			case <-doneCh:
-				return
-			case inputCh <- ev:
-			}
+	errs, err := h.saveBatch(ctx, events)
+	if err != nil {
+		return nil, err
+	}
+	for j, event := range events {
+		i := positions[j]
+		res[i].ShortURL = fmt.Sprintf("%s/%s", config.FlagBaseURL, event.ShortURL)
+		res[i].Status = models.BatchCreated
+		if errors.Is(errs[j], storage.ErrAlreadyExists) {
+			res[i].Status = models.BatchExisting
 		}
-	}()
-	return inputCh
+	}
+	return res, nil
 }
 
-func fanOutBatchPost(doneCh chan struct{}, inputCh chan models.URLData) []chan models.BatchResponse {
-	numWorkers := 5
-	channels := make([]chan models.BatchResponse, numWorkers)
-
-	for i := 0; i < numWorkers; i++ {
-		channels[i] = postURL(doneCh, inputCh)
+// validateBatchItem проверяет оригинальный URL и срок действия элемента пакета
+// и возвращает момент истечения срока действия ссылки.
+func validateBatchItem(item models.BatchRequest, now time.Time) (*time.Time, error) {
+	if item.OriginalURL == "" {
+		return nil, ErrEmptyURL
+	}
+	if u, err := url.ParseRequestURI(item.OriginalURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, ErrInvalidURL
 	}
-	return channels
+	return resolveExpiry(item.TTL, item.ExpiresAt, now)
 }
 
-func fanInBatchPost(doneCh chan struct{}, resultChs ...chan models.BatchResponse) chan models.BatchResponse {
-	finalCh := make(chan models.BatchResponse)
-	var wg sync.WaitGroup
-
-	for _, ch := range resultChs {
-		wg.Add(1)
+// saveBatch генерирует короткие идентификаторы и сохраняет пакет ссылок одной
+// транзакцией. Если идентификаторы части ссылок заняты, хранилище отклоняет
+// пакет целиком: для этих ссылок генерируются новые идентификаторы, и пакет
+// сохраняется повторно, но не более shortid.MaxAttempts раз для каждой ссылки.
+func (h *Handler) saveBatch(ctx context.Context, events []*models.URLData) ([]error, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
 
-		chClosure := ch
+	attempts := make([]int, len(events))
+	for _, event := range events {
+		shortID, err := h.Generator.Generate(event.OriginalURL, 0)
+		if err != nil {
+			return nil, err
+		}
+		event.ShortURL = shortID
+	}
 
-		go func() {
-			defer wg.Done()
+	for {
+		errs, err := h.Storage.BatchSaveURLs(ctx, events)
+		if err != nil {
+			return nil, err
+		}
 
-			for res := range chClosure {
-				select {
-				case <-doneCh:
-					return
-				case finalCh <- res:
-				}
+		retry := false
+		for i, err := range errs {
+			if !errors.Is(err, storage.ErrShortURLTaken) {
+				continue
 			}
-		}()
+			logger.Log.Debug("Short ID collision", zap.String("id", events[i].ShortURL), zap.Int("attempt", attempts[i]))
+			attempts[i]++
+			if attempts[i] >= shortid.MaxAttempts {
+				return nil, shortid.ErrExhausted
+			}
+			if events[i].ShortURL, err = h.Generator.Generate(events[i].OriginalURL, attempts[i]); err != nil {
+				return nil, err
+			}
+			retry = true
+		}
+		if !retry {
+			return errs, nil
+		}
 	}
-
-	go func() {
-		wg.Wait()
-		close(finalCh)
-	}()
-
-	return finalCh
 }
 
 // BatchPost обрабатывает gRPC-запрос на сокращение массива URL.
 func (s *ShortenerServer) BatchPost(ctx context.Context, req *pb.BatchPostRequest) (*pb.BatchPostResponse, error) {
 	// Проверяем аутентификацию
-	userID := req.UserId
+	userID := auth.UserIDFromContext(ctx)
 	if userID == "" {
 		return &pb.BatchPostResponse{
 			Error: "Invalid or missing token",
@@ -234,22 +239,40 @@ func (s *ShortenerServer) BatchPost(ctx context.Context, req *pb.BatchPostReques
 		batchRequests = append(batchRequests, models.BatchRequest{
 			OriginalURL:   url.OriginalUrl,
 			CorrelationID: url.CorrelationId,
+			ExpiresAt:     timestampPtr(url.ExpiresAt),
+			TTL:           url.TtlSeconds,
 		})
 	}
 
 	// Обрабатываем запрос
-	var res []*pb.BatchResponse
-	var batchResponse []models.BatchResponse
-	processBatchPost(batchRequests, userID, &batchResponse)
+	batchResponse, err := s.SaveBatch(ctx, batchRequests, userID, req.Atomic)
+	if err != nil && !errors.Is(err, ErrBatchRejected) {
+		return &pb.BatchPostResponse{
+			Error: "Internal server error",
+		}, status.Error(codes.Internal, "Internal server error")
+	}
 
+	var res []*pb.BatchResponse
 	for _, batchRes := range batchResponse {
 		res = append(res, &pb.BatchResponse{
 			CorrelationId: batchRes.CorrelationID,
 			ShortUrl:      batchRes.ShortURL,
+			Status:        string(batchRes.Status),
+			Error:         batchRes.Error,
 		},
 		)
 	}
 
+	// Отклонённый пакет возвращается без ошибки gRPC: иначе клиент
+	// не получит статусы элементов.
+	if err != nil {
+		return &pb.BatchPostResponse{
+			Urls:     res,
+			Error:    "Batch rejected",
+			Rejected: true,
+		}, nil
+	}
+
 	return &pb.BatchPostResponse{
 		Urls: res,
 	}, nil
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/sol1corejz/go-url-shortener/internal/auth"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	pb "github.com/sol1corejz/go-url-shortener/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// HandleRestoreURLs обрабатывает запросы на восстановление удалённых ссылок.
+// Восстанавливаются только ссылки текущего пользователя, которые ещё не удалены
+// окончательно и срок действия которых не истёк; остальные идентификаторы пропускаются.
+//
+// Поддерживаемый метод HTTP: POST
+// Тело запроса: JSON-массив идентификаторов сокращённых URL (например, ["abc123", "xyz456"]).
+// Ответы:
+// - 200 OK: количество восстановленных ссылок в формате JSON.
+// - 400 Bad Request: неверный формат JSON или пустой батч.
+// - 401 Unauthorized: пользователь не авторизован.
+// - 403 Forbidden: у ключа API нет права delete.
+// - 500 Internal Server Error: ошибка хранилища.
+func (h *Handler) HandleRestoreURLs(w http.ResponseWriter, r *http.Request) {
+	// Проверка авторизации пользователя.
+	userID, ok := h.authorizedUserID(w, r, models.ScopeDelete)
+	if !ok {
+		return
+	}
+
+	var ids []string
+	if err := json.NewDecoder(r.Body).Decode(&ids); err != nil {
+		logger.Log.Info("cannot decode restore batch JSON", zap.Error(err))
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if len(ids) == 0 {
+		http.Error(w, "Batch cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	restored, err := h.Storage.RestoreURLs(r.Context(), userID, ids)
+	if err != nil {
+		logger.Log.Error("Failed to restore URLs", zap.Error(err))
+		http.Error(w, "Failed to restore URLs", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(models.RestoreResponse{Restored: restored}); err != nil {
+		logger.Log.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// BatchRestore обрабатывает gRPC-запрос на восстановление удалённых ссылок.
+// Пользователь определяется по токену из метаданных (см. middlewares.AuthInterceptor).
+func (s *ShortenerServer) BatchRestore(ctx context.Context, req *pb.BatchRestoreRequest) (*pb.BatchRestoreResponse, error) {
+	// Проверка, что список идентификаторов не пустой.
+	if len(req.Ids) == 0 {
+		return &pb.BatchRestoreResponse{
+			Error: "Batch cannot be empty",
+		}, status.Error(codes.InvalidArgument, "Batch cannot be empty")
+	}
+
+	restored, err := s.Storage.RestoreURLs(ctx, auth.UserIDFromContext(ctx), req.Ids)
+	if err != nil {
+		return &pb.BatchRestoreResponse{
+			Error: "Failed to restore URLs",
+		}, status.Error(codes.Internal, "Failed to restore URLs")
+	}
+
+	return &pb.BatchRestoreResponse{
+		Restored: int32(restored),
+	}, nil
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/analytics"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+)
+
+// recordClick ставит в очередь событие перехода по короткой ссылке shortID.
+// IP-адрес клиента сохраняется только в виде хеша.
+func (h *Handler) recordClick(r *http.Request, shortID string) {
+	if h.Clicks == nil {
+		return
+	}
+	h.Clicks.Record(models.Click{
+		ShortURL:  shortID,
+		Timestamp: time.Now().UTC(),
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IPHash:    analytics.HashIP(clientIP(r)),
+	})
+}
+
+// clientIP возвращает IP-адрес клиента из заголовков X-Real-IP или
+// X-Forwarded-For, а при их отсутствии — адрес соединения.
+func clientIP(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		ip, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(ip)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
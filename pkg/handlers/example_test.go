@@ -11,18 +11,21 @@ import (
 	"testing"
 
 	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
 )
 
 func BenchmarkHandlePost(b *testing.B) {
-	requestBody := []byte("https://example.com")
+	h := NewHandler(storage.NewMemoryStorage())
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
+		// Каждая итерация сокращает новый URL, иначе хранилище вернёт конфликт.
+		requestBody := []byte(fmt.Sprintf("https://example.com/%d", i))
 		req := httptest.NewRequest(http.MethodPost, "/shorten", bytes.NewReader(requestBody))
 		req.Header.Set("Content-Type", "text/plain")
 
 		w := httptest.NewRecorder()
-		HandlePost(w, req)
+		h.HandlePost(w, req)
 
 		if w.Code != http.StatusCreated {
 			b.Errorf("unexpected status code: got %d, want %d", w.Code, http.StatusCreated)
@@ -31,6 +34,7 @@ func BenchmarkHandlePost(b *testing.B) {
 }
 
 func BenchmarkHandleJSONPost(b *testing.B) {
+	h := NewHandler(storage.NewMemoryStorage())
 
 	requestBody := []byte(`{"url": "https://example.com"}`)
 
@@ -44,7 +48,7 @@ func BenchmarkHandleJSONPost(b *testing.B) {
 		response := w.Result()
 		defer response.Body.Close()
 
-		HandleJSONPost(w, req)
+		h.HandleJSONPost(w, req)
 
 		if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusConflict && response.StatusCode != http.StatusOK {
 			b.Errorf("Unexpected status code: %d", response.StatusCode)
@@ -54,6 +58,7 @@ func BenchmarkHandleJSONPost(b *testing.B) {
 }
 
 func BenchmarkHandleBatchPost(b *testing.B) {
+	h := NewHandler(storage.NewMemoryStorage())
 	batchRequest := []models.BatchRequest{
 		{OriginalURL: "http://example.com/1", CorrelationID: "cor1"},
 		{OriginalURL: "http://example.com/2", CorrelationID: "cor2"},
@@ -72,7 +77,7 @@ func BenchmarkHandleBatchPost(b *testing.B) {
 
 		w := httptest.NewRecorder()
 
-		HandleBatchPost(w, req)
+		h.HandleBatchPost(w, req)
 
 		if w.Code != http.StatusCreated {
 			b.Errorf("expected status %d, got %d", http.StatusCreated, w.Code)
@@ -80,8 +85,11 @@ func BenchmarkHandleBatchPost(b *testing.B) {
 	}
 }
 
-// ExampleHandlePost демонстрирует использование обработчика HandlePost.
-func ExampleHandlePost() {
+// ExampleHandler_HandlePost демонстрирует использование обработчика HandlePost.
+func ExampleHandler_HandlePost() {
+	// Создаём обработчики с хранилищем в памяти.
+	h := NewHandler(storage.NewMemoryStorage())
+
 	// Создаем HTTP-запрос с POST-методом.
 	body := strings.NewReader("https://example.com")
 	req, err := http.NewRequest(http.MethodPost, "/", body)
@@ -93,7 +101,7 @@ func ExampleHandlePost() {
 	rec := httptest.NewRecorder()
 
 	// Вызов обработчика.
-	HandlePost(rec, req)
+	h.HandlePost(rec, req)
 
 	// Проверяем статус-код ответа.
 	resp := rec.Result()
@@ -106,8 +114,11 @@ func ExampleHandlePost() {
 	// HTTP Status: 201
 }
 
-// ExampleHandleJSONPost демонстрирует использование обработчика HandleJSONPost.
-func ExampleHandleJSONPost() {
+// ExampleHandler_HandleJSONPost демонстрирует использование обработчика HandleJSONPost.
+func ExampleHandler_HandleJSONPost() {
+	// Создаём обработчики с хранилищем в памяти.
+	h := NewHandler(storage.NewMemoryStorage())
+
 	// Подготовка данных запроса.
 	requestData := models.Request{
 		URL: "http://example.com",
@@ -122,7 +133,7 @@ func ExampleHandleJSONPost() {
 	rec := httptest.NewRecorder()
 
 	// Вызов обработчика.
-	HandleJSONPost(rec, req)
+	h.HandleJSONPost(rec, req)
 
 	// Проверяем статус-код ответа.
 	resp := rec.Result()
@@ -135,8 +146,11 @@ func ExampleHandleJSONPost() {
 	// HTTP Status: 201
 }
 
-// ExampleHandleBatchPost демонстрирует использование обработчика HandleBatchPost.
-func ExampleHandleBatchPost() {
+// ExampleHandler_HandleBatchPost демонстрирует использование обработчика HandleBatchPost.
+func ExampleHandler_HandleBatchPost() {
+	// Создаём обработчики с хранилищем в памяти.
+	h := NewHandler(storage.NewMemoryStorage())
+
 	// Подготовка данных запроса
 	requestData := []models.BatchRequest{
 		{OriginalURL: "http://example.com/1", CorrelationID: "1"},
@@ -152,7 +166,7 @@ func ExampleHandleBatchPost() {
 	rec := httptest.NewRecorder()
 
 	// Вызов обработчика
-	HandleBatchPost(rec, req)
+	h.HandleBatchPost(rec, req)
 
 	// Проверяем статус-код ответа.
 	resp := rec.Result()
@@ -165,8 +179,11 @@ func ExampleHandleBatchPost() {
 	// HTTP Status: 201
 }
 
-// ExampleHandleDeleteURLs демонстрирует использование обработчика HandleDeleteURLs.
-func ExampleHandleDeleteURLs() {
+// ExampleHandler_HandleDeleteURLs демонстрирует использование обработчика HandleDeleteURLs.
+func ExampleHandler_HandleDeleteURLs() {
+	// Создаём обработчики с хранилищем в памяти.
+	h := NewHandler(storage.NewMemoryStorage())
+
 	// Подготовка тестовых данных
 	idsToDelete := []string{"abc123", "xyz456"}
 	body, _ := json.Marshal(idsToDelete)
@@ -179,7 +196,7 @@ func ExampleHandleDeleteURLs() {
 	rec := httptest.NewRecorder()
 
 	// Вызов обработчика
-	HandleDeleteURLs(rec, req)
+	h.HandleDeleteURLs(rec, req)
 
 	// Проверяем статус-код ответа.
 	resp := rec.Result()
@@ -192,8 +209,11 @@ func ExampleHandleDeleteURLs() {
 	// HTTP Status: 401
 }
 
-// ExampleHandleGet демонстрирует использование обработчика HandleGet.
-func ExampleHandleGet() {
+// ExampleHandler_HandleGet демонстрирует использование обработчика HandleGet.
+func ExampleHandler_HandleGet() {
+	// Создаём обработчики с хранилищем в памяти.
+	h := NewHandler(storage.NewMemoryStorage())
+
 	// Подготовка тестового запроса
 	req := httptest.NewRequest(http.MethodGet, "/abc123", nil)
 
@@ -201,7 +221,7 @@ func ExampleHandleGet() {
 	rec := httptest.NewRecorder()
 
 	// Вызов обработчика
-	HandleGet(rec, req)
+	h.HandleGet(rec, req)
 
 	// Получаем результат
 	resp := rec.Result()
@@ -214,8 +234,11 @@ func ExampleHandleGet() {
 	// HTTP Status: 400
 }
 
-// ExampleHandleGetUserURLs демонстрирует использование обработчика HandleGetUserURLs.
-func ExampleHandleGetUserURLs() {
+// ExampleHandler_HandleGetUserURLs демонстрирует использование обработчика HandleGetUserURLs.
+func ExampleHandler_HandleGetUserURLs() {
+	// Создаём обработчики с хранилищем в памяти.
+	h := NewHandler(storage.NewMemoryStorage())
+
 	// Создаём тестовый HTTP-запрос
 	req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
 
@@ -226,7 +249,7 @@ func ExampleHandleGetUserURLs() {
 	rec := httptest.NewRecorder()
 
 	// Вызов обработчика
-	HandleGetUserURLs(rec, req)
+	h.HandleGetUserURLs(rec, req)
 
 	// Получаем результат
 	resp := rec.Result()
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ErrInvalidExpiry ошибка некорректного срока действия ссылки
+var ErrInvalidExpiry = errors.New("invalid expiry")
+
+// maxTTL — наибольший срок действия ссылки. Ограничение не даёт
+// time.Duration переполниться при больших значениях ttl.
+const maxTTL = 100 * 365 * 24 * time.Hour
+
+// resolveExpiry вычисляет момент истечения срока действия ссылки по времени
+// жизни ttl (в секундах) или абсолютному моменту expiresAt. Возвращает nil,
+// если срок не задан. Одновременное указание обоих параметров, отрицательное
+// время жизни, момент в прошлом и срок больше maxTTL считаются ошибкой.
+func resolveExpiry(ttl int64, expiresAt *time.Time, now time.Time) (*time.Time, error) {
+	switch {
+	case ttl != 0 && expiresAt != nil:
+		return nil, ErrInvalidExpiry
+	case ttl < 0 || ttl > int64(maxTTL/time.Second):
+		return nil, ErrInvalidExpiry
+	case ttl > 0:
+		at := now.Add(time.Duration(ttl) * time.Second).UTC()
+		return &at, nil
+	case expiresAt != nil:
+		if !expiresAt.After(now) || expiresAt.After(now.Add(maxTTL)) {
+			return nil, ErrInvalidExpiry
+		}
+		at := expiresAt.UTC()
+		return &at, nil
+	default:
+		return nil, nil
+	}
+}
+
+// timestampPtr преобразует необязательную метку времени gRPC в *time.Time.
+func timestampPtr(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+// timestampOrNil преобразует необязательный момент времени в метку времени gRPC.
+func timestampOrNil(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
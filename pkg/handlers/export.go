@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/cmd/config"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"go.uber.org/zap"
+)
+
+// exportCSVHeader — заголовок выгрузки в формате CSV.
+var exportCSVHeader = []string{"short_url", "original_url", "created_at", "is_deleted", "clicks"}
+
+// exportWriter записывает строки выгрузки в одном из поддерживаемых форматов.
+type exportWriter interface {
+	// Write записывает очередную строку выгрузки.
+	Write(row models.ExportedURL) error
+	// Close завершает выгрузку.
+	Close() error
+}
+
+// jsonExportWriter записывает выгрузку JSON-массивом, не накапливая его в памяти.
+// Каждый элемент массива записывается на отдельной строке.
+type jsonExportWriter struct {
+	w     http.ResponseWriter
+	count int
+}
+
+func (e *jsonExportWriter) Write(row models.ExportedURL) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if e.count == 0 {
+		sep = "[\n"
+	}
+	e.count++
+	_, err = e.w.Write(append([]byte(sep), data...))
+	return err
+}
+
+func (e *jsonExportWriter) Close() error {
+	closing := "\n]\n"
+	if e.count == 0 {
+		closing = "[]\n"
+	}
+	_, err := e.w.Write([]byte(closing))
+	return err
+}
+
+// ndjsonExportWriter записывает выгрузку по одному JSON-объекту в строке.
+type ndjsonExportWriter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExportWriter) Write(row models.ExportedURL) error {
+	return e.enc.Encode(row)
+}
+
+func (e *ndjsonExportWriter) Close() error {
+	return nil
+}
+
+// csvExportWriter записывает выгрузку в формате CSV с заголовком exportCSVHeader.
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (e *csvExportWriter) Write(row models.ExportedURL) error {
+	return e.w.Write([]string{
+		row.ShortURL,
+		row.OriginalURL,
+		row.CreatedAt.UTC().Format(time.RFC3339),
+		strconv.FormatBool(row.DeletedFlag),
+		strconv.Itoa(row.Clicks),
+	})
+}
+
+func (e *csvExportWriter) Close() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// HandleExportUserURLs выгружает все ссылки пользователя, включая удалённые,
+// с моментом создания и количеством переходов. Ссылки читаются из хранилища
+// и отправляются клиенту по одной, поэтому объём выгрузки не ограничен памятью.
+//
+// Поддерживаемые HTTP-методы: GET
+// Параметры запроса: format — json (по умолчанию), ndjson или csv.
+// Ответы:
+// - 200 OK: выгрузка в запрошенном формате.
+// - 400 Bad Request: неподдерживаемый формат.
+// - 401 Unauthorized: пользователь не авторизован.
+// - 403 Forbidden: у ключа API нет права read.
+//
+// Если выгрузка прерывается ошибкой хранилища после начала ответа,
+// соединение разрывается, чтобы клиент не принял неполные данные за полные.
+func (h *Handler) HandleExportUserURLs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.authorizedUserID(w, r, models.ScopeRead)
+	if !ok {
+		return
+	}
+
+	var out exportWriter
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		out = &jsonExportWriter{w: w}
+	case "ndjson":
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		out = &ndjsonExportWriter{enc: json.NewEncoder(w)}
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="urls.csv"`)
+		csvWriter := csv.NewWriter(w)
+		if err := csvWriter.Write(exportCSVHeader); err != nil {
+			logger.Log.Error("Failed to write CSV header", zap.Error(err))
+			return
+		}
+		out = &csvExportWriter{w: csvWriter}
+	default:
+		http.Error(w, "Unsupported format", http.StatusBadRequest)
+		return
+	}
+
+	err := h.Storage.ExportUserURLs(r.Context(), userID, func(row models.ExportedURL) error {
+		row.ShortURL = fmt.Sprintf("%s/%s", config.FlagBaseURL, row.ShortURL)
+		return out.Write(row)
+	})
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		logger.Log.Error("Failed to export URLs", zap.String("user", userID), zap.Error(err))
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"github.com/sol1corejz/go-url-shortener/internal/analytics"
+	"github.com/sol1corejz/go-url-shortener/internal/jobs"
+	"github.com/sol1corejz/go-url-shortener/internal/shortid"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	pb "github.com/sol1corejz/go-url-shortener/proto"
+)
+
+// Handler содержит зависимости HTTP-обработчиков сервиса.
+type Handler struct {
+	// Storage — хранилище сокращённых URL.
+	Storage storage.Storage
+	// Generator — генератор коротких идентификаторов.
+	Generator shortid.Generator
+	// Clicks — очередь записи событий переходов по ссылкам.
+	// Если nil, переходы не учитываются.
+	Clicks *analytics.Recorder
+	// Jobs — очередь фоновых задач пакетного удаления.
+	Jobs *jobs.Queue
+}
+
+// NewHandler создаёт обработчики, работающие с указанным хранилищем.
+// По умолчанию используются случайные идентификаторы длины shortid.DefaultLength
+// и очередь задач с jobs.DefaultWorkers обработчиками.
+func NewHandler(store storage.Storage) *Handler {
+	return &Handler{
+		Storage:   store,
+		Generator: &shortid.RandomGenerator{Length: shortid.DefaultLength},
+		Jobs:      jobs.NewQueue(store, jobs.DefaultWorkers),
+	}
+}
+
+// ShortenerServer представляет сервер для обработки gRPC-запросов.
+// Включает методы, соответствующие gRPC-интерфейсу, и использует
+// те же зависимости, что и HTTP-обработчики.
+type ShortenerServer struct {
+	pb.UnimplementedShortenerServer
+	*Handler
+}
+
+// NewShortenerServer создаёт gRPC-сервер на основе HTTP-обработчиков.
+func NewShortenerServer(h *Handler) *ShortenerServer {
+	return &ShortenerServer{
+		Handler: h,
+	}
+}
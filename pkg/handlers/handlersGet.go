@@ -2,35 +2,31 @@ package handlers
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	pb "github.com/sol1corejz/go-url-shortener/proto"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/sol1corejz/go-url-shortener/cmd/config"
 	"github.com/sol1corejz/go-url-shortener/internal/auth"
 	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
 	"github.com/sol1corejz/go-url-shortener/internal/storage"
 	"go.uber.org/zap"
 )
 
-func generateShortID() string {
-	b := make([]byte, 6)
-	_, err := rand.Read(b)
-	if err != nil {
-		panic(err)
-	}
-	return base64.RawURLEncoding.EncodeToString(b)
-}
-
 // HandleGet обрабатывает запрос на получение оригинального URL по короткому идентификатору.
 // При получении запроса с коротким URL, сервер проверяет его существование
-// в хранилище и выполняет редирект на оригинальный URL, если он существует
-// и не был удалён. В случае ошибки возвращает соответствующий статус.
-func HandleGet(w http.ResponseWriter, r *http.Request) {
+// в хранилище и выполняет редирект на оригинальный URL, если он существует,
+// не был удалён и срок его действия не истёк. В случае ошибки возвращает соответствующий статус.
+func (h *Handler) HandleGet(w http.ResponseWriter, r *http.Request) {
 
 	// Извлекаем короткий URL из параметров запроса.
 	id := chi.URLParam(r, "shortURL")
@@ -40,25 +36,38 @@ func HandleGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Получаем оригинальный URL, флаг удаления и статус существования из хранилища.
-	originalURL, deleted, ok := storage.GetOriginalURL(id)
-
-	if !ok {
-		// Если URL не найден, возвращаем ошибку 404 (Not Found).
-		http.Error(w, "URL not found", http.StatusNotFound)
+	// Получаем запись об оригинальном URL из хранилища.
+	data, err := h.Storage.GetOriginalURL(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			// Если URL не найден, возвращаем ошибку 404 (Not Found).
+			http.Error(w, "URL not found", http.StatusNotFound)
+			return
+		}
+		logger.Log.Error("Failed to get URL", zap.Error(err))
+		http.Error(w, "Failed to get URL", http.StatusInternalServerError)
 		return
 	}
 
 	// Если URL был удалён, возвращаем ошибку 410 (Gone).
-	if deleted {
+	if data.DeletedFlag {
 		http.Error(w, "URL deleted", http.StatusGone)
 		return
 	}
 
+	// Если срок действия ссылки истёк, также возвращаем ошибку 410 (Gone).
+	if data.Expired(time.Now()) {
+		http.Error(w, "URL expired", http.StatusGone)
+		return
+	}
+
+	// Учитываем переход, не задерживая ответ.
+	h.recordClick(r, id)
+
 	// Если URL существует и не был удалён, выполняем редирект на оригинальный URL.
-	w.Header().Set("Location", originalURL)
+	w.Header().Set("Location", data.OriginalURL)
 	w.WriteHeader(http.StatusTemporaryRedirect)
-	w.Write([]byte(originalURL))
+	w.Write([]byte(data.OriginalURL))
 }
 
 // GetURL обрабатывает gRPC-запрос на получение полной ссылки.
@@ -66,9 +75,8 @@ func (s *ShortenerServer) GetURL(ctx context.Context, req *pb.GetURLRequest) (*p
 
 	id := req.ShortUrl
 
-	originalURL, deleted, ok := storage.GetOriginalURL(id)
-
-	if !ok {
+	data, err := s.Storage.GetOriginalURL(ctx, id)
+	if err != nil {
 		// Если URL не найден, возвращаем ошибку 404 (Not Found).
 		return &pb.GetURLResponse{
 			Error: fmt.Sprintf("URL not found: %s", id),
@@ -76,46 +84,106 @@ func (s *ShortenerServer) GetURL(ctx context.Context, req *pb.GetURLRequest) (*p
 	}
 
 	// Если URL был удалён, возвращаем ошибку 410 (Gone).
-	if deleted {
+	if data.DeletedFlag {
 		return &pb.GetURLResponse{
 			Error: fmt.Sprintf("URL deleted: %s", id),
 		}, status.Errorf(http.StatusNotFound, "URL deleted: %s", id)
 	}
 
+	// Если срок действия ссылки истёк, возвращаем ошибку.
+	if data.Expired(time.Now()) {
+		return &pb.GetURLResponse{
+			Error: fmt.Sprintf("URL expired: %s", id),
+		}, status.Errorf(http.StatusNotFound, "URL expired: %s", id)
+	}
+
 	return &pb.GetURLResponse{
-		Url: originalURL,
+		Url: data.OriginalURL,
 	}, nil
 }
 
-// HandleGetUserURLs обрабатывает запрос на получение всех URL-адресов,
-// сокращённых пользователем, который прошёл аутентификацию. В случае успешного
-// запроса возвращает список URL в формате JSON. В случае отсутствия URL
-// или ошибки возвращаются соответствующие статусы.
-func HandleGetUserURLs(w http.ResponseWriter, r *http.Request) {
+// HandleGetUserURLs обрабатывает запрос на получение URL-адресов,
+// сокращённых пользователем, который прошёл аутентификацию. Ссылки
+// возвращаются постранично JSON-массивом вместе с количеством переходов.
+//
+// Параметры запроса (все необязательные):
+//   - page_size: размер страницы, по умолчанию DefaultPageSize, не больше MaxPageSize;
+//   - cursor: курсор следующей страницы из заголовка X-Next-Cursor;
+//   - sort: created (по умолчанию) или clicks;
+//   - order: desc (по умолчанию) или asc;
+//   - status: all (по умолчанию), active или deleted;
+//   - search: подстрока оригинального URL без учёта регистра.
+//
+// Метаданные страницы передаются в заголовках, чтобы тело ответа оставалось
+// совместимым с клиентами без поддержки постраничного вывода:
+// X-Total-Count — количество ссылок на всех страницах, X-Next-Cursor
+// и Link с rel="next" — курсор и адрес следующей страницы, если она есть.
+//
+// Ответы:
+//   - 200 OK: страница ссылок.
+//   - 204 No Content: на странице нет ссылок.
+//   - 400 Bad Request: некорректные параметры запроса.
+//   - 401 Unauthorized: пользователь не авторизован.
+//   - 403 Forbidden: у ключа API нет права read.
+//   - 500 Internal Server Error: ошибка хранилища.
+func (h *Handler) HandleGetUserURLs(w http.ResponseWriter, r *http.Request) {
 
 	// Проверяем, авторизован ли пользователь.
-	userID, err := auth.CheckIsAuthorized(r)
-
-	if err != nil {
-		// Если пользователь не авторизован, возвращаем ошибку 401 (Unauthorized).
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	userID, ok := h.authorizedUserID(w, r, models.ScopeRead)
+	if !ok {
 		return
 	}
 
-	// Получаем список URL, сокращённых пользователем, из хранилища.
-	urls, err := storage.GetURLsByUser(userID)
+	values := r.URL.Query()
+	params := URLListParams{
+		Cursor: values.Get("cursor"),
+		Sort:   values.Get("sort"),
+		Order:  values.Get("order"),
+		Status: values.Get("status"),
+		Search: values.Get("search"),
+	}
+	if pageSize := values.Get("page_size"); pageSize != "" {
+		var err error
+		if params.PageSize, err = strconv.Atoi(pageSize); err != nil {
+			http.Error(w, "Invalid page size", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Получаем страницу URL, сокращённых пользователем, из хранилища.
+	page, next, err := h.ListUserURLs(r.Context(), userID, params)
+	if errors.Is(err, ErrInvalidListQuery) {
+		http.Error(w, "Invalid list parameters", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		// Если произошла ошибка при получении данных, возвращаем ошибку 500 (Internal Server Error).
+		logger.Log.Error("Failed to list URLs", zap.Error(err))
 		http.Error(w, "Failed to retrieve URLs", http.StatusInternalServerError)
 		return
 	}
 
-	// Если у пользователя нет сокращённых URL, возвращаем статус 204 (No Content).
-	if len(urls) == 0 {
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if next != "" {
+		nextURL := *r.URL
+		values.Set("cursor", next)
+		nextURL.RawQuery = values.Encode()
+		w.Header().Set("X-Next-Cursor", next)
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, nextURL.RequestURI()))
+	}
+
+	// Если на странице нет сокращённых URL, возвращаем статус 204 (No Content).
+	if len(page.URLs) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
+	// Формируем полные сокращённые URL.
+	urls := page.URLs
+	for i := range urls {
+		urls[i].ShortURL = fmt.Sprintf("%s/%s", config.FlagBaseURL, urls[i].ShortURL)
+	}
+
 	// Устанавливаем заголовок ответа для JSON.
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -128,11 +196,24 @@ func HandleGetUserURLs(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// GetUserURLs обрабатывает gRPC-запрос для получения ссылок пользователя.
+// GetUserURLs обрабатывает gRPC-запрос для получения страницы ссылок пользователя.
+// Параметры и значения по умолчанию совпадают с HandleGetUserURLs.
 func (s *ShortenerServer) GetUserURLs(ctx context.Context, req *pb.GetUserURLsRequest) (*pb.GetUserURLsResponse, error) {
-	userID := req.UserId
+	userID := auth.UserIDFromContext(ctx)
 
-	urls, err := storage.GetURLsByUser(userID)
+	page, next, err := s.ListUserURLs(ctx, userID, URLListParams{
+		PageSize: int(req.PageSize),
+		Cursor:   req.Cursor,
+		Sort:     req.Sort,
+		Order:    req.Order,
+		Status:   req.Status,
+		Search:   req.Search,
+	})
+	if errors.Is(err, ErrInvalidListQuery) {
+		return &pb.GetUserURLsResponse{
+			Error: "Invalid list parameters",
+		}, status.Error(codes.InvalidArgument, "Invalid list parameters")
+	}
 	if err != nil {
 		// Если произошла ошибка при получении данных, возвращаем ошибку 500 (Internal Server Error).
 		return &pb.GetUserURLsResponse{
@@ -140,37 +221,42 @@ func (s *ShortenerServer) GetUserURLs(ctx context.Context, req *pb.GetUserURLsRe
 		}, status.Errorf(http.StatusInternalServerError, "Failed to retrieve URLs: %v", err)
 	}
 
-	// Если у пользователя нет сокращённых URL, возвращаем статус 204 (No Content).
-	if len(urls) == 0 {
+	// Если на странице нет сокращённых URL, возвращаем статус 204 (No Content).
+	if len(page.URLs) == 0 {
 		return &pb.GetUserURLsResponse{
 			Error: "No content",
 		}, status.Error(http.StatusNotFound, "No content")
 	}
 
-	// Преобразование []models.URLData в []*pb.URLData
+	// Преобразование []models.UserURL в []*pb.URLData
 	var pbURLs []*pb.URLData
-	for _, url := range urls {
+	for _, url := range page.URLs {
 		pbURLs = append(pbURLs, &pb.URLData{
 			Uuid:          url.UUID,
-			ShortUrl:      url.ShortURL,
+			ShortUrl:      fmt.Sprintf("%s/%s", config.FlagBaseURL, url.ShortURL),
 			OriginalUrl:   url.OriginalURL,
 			UserUuid:      url.UserUUID,
 			CorrelationId: url.CorrelationID,
 			IsDeleted:     url.DeletedFlag,
+			ExpiresAt:     timestampOrNil(url.ExpiresAt),
+			CreatedAt:     timestamppb.New(url.CreatedAt),
+			Clicks:        int64(url.Clicks),
 		})
 	}
 
 	return &pb.GetUserURLsResponse{
-		Urls: pbURLs,
+		Urls:       pbURLs,
+		NextCursor: next,
+		Total:      int64(page.Total),
 	}, nil
 }
 
 // HandlePing обрабатывает запрос на проверку состояния базы данных.
 // Если подключение к базе данных работает, возвращает статус 200 OK с ответом "pong".
 // В случае ошибки подключения возвращается статус 500.
-func HandlePing(w http.ResponseWriter, r *http.Request) {
-	// Пингует базу данных для проверки её состояния.
-	if err := storage.DB.Ping(); err != nil {
+func (h *Handler) HandlePing(w http.ResponseWriter, r *http.Request) {
+	// Пингует хранилище для проверки его состояния.
+	if err := h.Storage.Ping(r.Context()); err != nil {
 		// Если ошибка подключения, возвращаем ошибку 500 (Internal Server Error).
 		http.Error(w, "Database connection error", http.StatusInternalServerError)
 		return
@@ -183,7 +269,7 @@ func HandlePing(w http.ResponseWriter, r *http.Request) {
 
 // PingServer обрабатывает gRPC-запрос для проверки работы сервера.
 func (s *ShortenerServer) PingServer(ctx context.Context, req *pb.PingServerRequest) (*pb.PingServerResponse, error) {
-	if err := storage.DB.Ping(); err != nil {
+	if err := s.Storage.Ping(ctx); err != nil {
 		return &pb.PingServerResponse{
 			Error: "Database connection error",
 		}, status.Errorf(http.StatusInternalServerError, "Database connection error: %v", err)
@@ -6,7 +6,6 @@ import (
 	"errors"
 	"github.com/sol1corejz/go-url-shortener/internal/logger"
 	"github.com/sol1corejz/go-url-shortener/internal/models"
-	"github.com/sol1corejz/go-url-shortener/internal/storage"
 	pb "github.com/sol1corejz/go-url-shortener/proto"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/status"
@@ -16,17 +15,17 @@ import (
 // ErrFailedToCount - ошибка подсчета из бд
 var ErrFailedToCount = errors.New("failed to count error")
 
-// GetStats получает информацию из бд
-func GetStats() (int, int, error) {
+// GetStats получает информацию из хранилища
+func (h *Handler) GetStats(ctx context.Context) (int, int, error) {
 	// Получаем количество сокращённых URL
-	countURLs, err := storage.GetURLsCount()
+	countURLs, err := h.Storage.GetURLsCount(ctx)
 	if err != nil {
 		logger.Log.Error("Failed to count URLs", zap.Error(err))
 		return 0, 0, ErrFailedToCount
 	}
 
 	// Получаем количество пользователей
-	countUsers, err := storage.GetUsersCount()
+	countUsers, err := h.Storage.GetUsersCount(ctx)
 	if err != nil {
 		logger.Log.Error("Failed to count users", zap.Error(err))
 		return 0, 0, ErrFailedToCount
@@ -35,19 +34,36 @@ func GetStats() (int, int, error) {
 	return countURLs, countUsers, nil
 }
 
+// cacheStatser реализуется хранилищами с кэшем переходов.
+type cacheStatser interface {
+	CacheStats() models.CacheStats
+}
+
+// CacheStats возвращает счётчики кэша переходов или nil, если кэш не используется.
+func (h *Handler) CacheStats() *models.CacheStats {
+	cached, ok := h.Storage.(cacheStatser)
+	if !ok {
+		return nil
+	}
+	stats := cached.CacheStats()
+	return &stats
+}
+
 // HandleGetInternalStats обрабатывает запрос на получение статистики.
 // Количество сокращенных URL и количество уникальных пользователей
 // В случае ошибки возвращает соответствующий статус.
-func HandleGetInternalStats(w http.ResponseWriter, r *http.Request) {
-	countURLs, countUsers, err := GetStats()
+func (h *Handler) HandleGetInternalStats(w http.ResponseWriter, r *http.Request) {
+	countURLs, countUsers, err := h.GetStats(r.Context())
 	// Если произошла ошибка при получении данных, возвращаем ошибку 500 (Internal Server Error).
 	if err != nil {
 		http.Error(w, "Failed to count stats", http.StatusInternalServerError)
+		return
 	}
 
 	stats := models.InternalStatsResponse{
 		URLs:  countURLs,
 		Users: countUsers,
+		Cache: h.CacheStats(),
 	}
 
 	// Устанавливаем заголовок ответа для JSON.
@@ -64,7 +80,7 @@ func HandleGetInternalStats(w http.ResponseWriter, r *http.Request) {
 
 // GetInternalStats обрабатывает gRPC-запрос для получения статистики.
 func (s *ShortenerServer) GetInternalStats(ctx context.Context, req *pb.GetInternalStatsRequest) (*pb.GetInternalStatsResponse, error) {
-	countURLs, countUsers, err := GetStats()
+	countURLs, countUsers, err := s.GetStats(ctx)
 
 	if err != nil {
 		return &pb.GetInternalStatsResponse{
@@ -72,8 +88,17 @@ func (s *ShortenerServer) GetInternalStats(ctx context.Context, req *pb.GetInter
 		}, status.Error(http.StatusInternalServerError, "Failed to count stats")
 	}
 
-	return &pb.GetInternalStatsResponse{
+	resp := &pb.GetInternalStatsResponse{
 		Urls:  int32(countURLs),
 		Users: int32(countUsers),
-	}, nil
+	}
+	if cache := s.CacheStats(); cache != nil {
+		resp.Cache = &pb.CacheStats{
+			Hits:      cache.Hits,
+			Misses:    cache.Misses,
+			Evictions: cache.Evictions,
+			Size:      int32(cache.Size),
+		}
+	}
+	return resp, nil
 }
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sol1corejz/go-url-shortener/internal/auth"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	pb "github.com/sol1corejz/go-url-shortener/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// UserJob возвращает задачу jobID, созданную пользователем userID.
+// Если задача не найдена или создана другим пользователем, возвращает storage.ErrNotFound.
+func (h *Handler) UserJob(ctx context.Context, userID, jobID string) (models.Job, error) {
+	job, err := h.Storage.GetJob(ctx, jobID)
+	if err != nil {
+		return models.Job{}, err
+	}
+	if job.UserID != userID {
+		return models.Job{}, storage.ErrNotFound
+	}
+	return job, nil
+}
+
+// HandleGetJob обрабатывает запрос на получение состояния фоновой задачи
+// текущего пользователя: статуса, прогресса и ошибок по отдельным идентификаторам.
+//
+// Ответ:
+//   - 200 OK: состояние задачи в формате JSON.
+//   - 401 Unauthorized: пользователь не авторизован.
+//   - 403 Forbidden: у ключа API нет права read.
+//   - 404 Not Found: задача не найдена или создана другим пользователем.
+//   - 500 Internal Server Error: ошибка хранилища.
+func (h *Handler) HandleGetJob(w http.ResponseWriter, r *http.Request) {
+	// Проверяем, авторизован ли пользователь.
+	userID, ok := h.authorizedUserID(w, r, models.ScopeRead)
+	if !ok {
+		return
+	}
+
+	job, err := h.UserJob(r.Context(), userID, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		logger.Log.Error("Failed to get job", zap.Error(err))
+		http.Error(w, "Failed to get job", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		logger.Log.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// GetJob обрабатывает gRPC-запрос на получение состояния фоновой задачи.
+// Пользователь определяется по токену из метаданных (см. middlewares.AuthInterceptor).
+func (s *ShortenerServer) GetJob(ctx context.Context, req *pb.GetJobRequest) (*pb.GetJobResponse, error) {
+	job, err := s.UserJob(ctx, auth.UserIDFromContext(ctx), req.JobId)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return &pb.GetJobResponse{Error: "Job not found"}, status.Error(codes.NotFound, "Job not found")
+		}
+		return &pb.GetJobResponse{Error: "Failed to get job"}, status.Error(codes.Internal, "Failed to get job")
+	}
+
+	failures := make([]*pb.JobFailure, 0, len(job.Failures))
+	for _, id := range job.IDs {
+		if reason, ok := job.Failures[id]; ok {
+			failures = append(failures, &pb.JobFailure{Id: id, Error: reason})
+		}
+	}
+
+	return &pb.GetJobResponse{
+		Job: &pb.Job{
+			Id:        job.ID,
+			Kind:      job.Kind,
+			Status:    string(job.Status),
+			Ids:       job.IDs,
+			Processed: int32(job.Processed),
+			Failures:  failures,
+			CreatedAt: timestamppb.New(job.CreatedAt),
+			UpdatedAt: timestamppb.New(job.UpdatedAt),
+		},
+	}, nil
+}
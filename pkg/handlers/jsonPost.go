@@ -4,14 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	pb "github.com/sol1corejz/go-url-shortener/proto"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"net/http"
 	"time"
 
-	"github.com/google/uuid"
-	"github.com/sol1corejz/go-url-shortener/cmd/config"
 	"github.com/sol1corejz/go-url-shortener/internal/auth"
 	"github.com/sol1corejz/go-url-shortener/internal/logger"
 	"github.com/sol1corejz/go-url-shortener/internal/models"
@@ -23,47 +21,23 @@ import (
 // Функция выполняет следующие действия:
 // 1. Проверяет наличие токена в cookies. Если токен отсутствует, генерирует новый токен и устанавливает его в cookie.
 // 2. Декодирует JSON-данные из тела запроса и извлекает URL.
-// 3. Генерирует короткий URL, связывая его с оригинальным URL.
-// 4. Сохраняет данные URL в хранилище. Если URL уже существует, возвращает существующий короткий URL с кодом 409 (Conflict).
+// 3. Генерирует короткий URL или использует переданный псевдоним (поле alias), связывая его с оригинальным URL.
+// Необязательные поля ttl (в секундах) или expires_at задают срок действия ссылки.
+// 4. Сохраняет данные URL в хранилище. Если URL уже сокращён (в пределах, заданных режимом дедупликации), возвращает существующий короткий URL с кодом 409 (Conflict).
+// Ссылка с псевдонимом создаётся и для уже сокращённого URL.
 // 5. Если все прошло успешно, возвращает короткий URL в формате JSON с кодом 201 (Created).
 //
-// В случае ошибок возвращаются соответствующие HTTP-статусы, например, 400 (Bad Request) при неверных данных или 500 (Internal Server Error)
+// В случае ошибок возвращаются соответствующие HTTP-статусы, например, 400 (Bad Request) при неверных данных,
+// недопустимом псевдониме или сроке действия, 409 (Conflict), если псевдоним уже занят, или 500 (Internal Server Error)
 // при проблемах с сервером.
-func HandleJSONPost(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandleJSONPost(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	// Проверка наличия токена в cookie.
-	cookie, err := r.Cookie("token")
-	var userID string
-	if errors.Is(err, http.ErrNoCookie) {
-		var token string
-		// Если токен отсутствует, генерируется новый токен и устанавливается в cookie.
-		token, err = auth.GenerateToken()
-		if err != nil {
-			http.Error(w, "Unable to generate token", http.StatusInternalServerError)
-			return
-		}
-
-		http.SetCookie(w, &http.Cookie{
-			Name:     "token",
-			Value:    token,
-			Expires:  time.Now().Add(auth.TokenExp),
-			HttpOnly: true,
-		})
-
-		// Получаем идентификатор пользователя из токена.
-		userID = auth.GetUserID(token)
-	} else if err != nil {
-		http.Error(w, "Error retrieving cookie", http.StatusBadRequest)
+	// Получаем идентификатор пользователя из токена в cookie или начинаем новую сессию.
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
 		return
-	} else {
-		// Получаем идентификатор пользователя из cookie.
-		userID = auth.GetUserID(cookie.Value)
-		if userID == "" {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
 	}
 
 	// Декодирование тела запроса в структуру models.Request.
@@ -81,51 +55,39 @@ func HandleJSONPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Генерация короткого идентификатора и формирования короткого URL.
-	shortID := generateShortID()
-	shortURL := fmt.Sprintf("%s/%s", config.FlagBaseURL, shortID)
-
-	// Подготовка ответа.
-	resp := models.Response{
-		Result: shortURL,
-	}
-
-	// Создание объекта с данными для сохранения.
-	event := models.URLData{
-		OriginalURL: req.URL,
-		ShortURL:    shortID,
-		UUID:        uuid.New().String(),
-		UserUUID:    userID,
-		DeletedFlag: false,
-	}
-
-	// Ожидание завершения операции сохранения URL или тайм-аута.
-	select {
-	case <-ctx.Done():
-		http.Error(w, "Request canceled or timed out", http.StatusRequestTimeout)
+	// Вычисление срока действия ссылки.
+	expiresAt, err := resolveExpiry(req.TTL, req.ExpiresAt, time.Now())
+	if err != nil {
+		http.Error(w, "Invalid expiry", http.StatusBadRequest)
 		return
-	default:
-		// Попытка сохранить URL в хранилище.
-		if existURL, err := storage.SaveURL(&event); err != nil {
+	}
 
+	// Сохранение URL с использованием общей бизнес-логики.
+	shortURL, err := h.SaveShortURL(ctx, req.URL, userID, req.Alias, expiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrAlreadyExists):
 			// Если URL уже существует, возвращаем существующий короткий URL с кодом 409.
-			if errors.Is(err, storage.ErrAlreadyExists) {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusConflict)
-
-				resp = models.Response{
-					Result: fmt.Sprintf("%s/%s", config.FlagBaseURL, existURL),
-				}
-				json.NewEncoder(w).Encode(resp)
-
-				storage.ExistingShortURL = ""
-				return
-			}
-
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(models.Response{Result: shortURL})
+		case errors.Is(err, storage.ErrShortURLTaken):
+			// Псевдоним уже занят другой ссылкой.
+			http.Error(w, "Alias is already taken", http.StatusConflict)
+		case errors.Is(err, ErrInvalidAlias), errors.Is(err, ErrReservedAlias):
+			http.Error(w, "Invalid alias", http.StatusBadRequest)
+		case errors.Is(err, ErrTimeOut):
+			http.Error(w, "Request canceled or timed out", http.StatusRequestTimeout)
+		default:
 			// Ошибка при сохранении URL.
 			http.Error(w, "Failed to save URL", http.StatusInternalServerError)
-			return
 		}
+		return
+	}
+
+	// Подготовка ответа.
+	resp := models.Response{
+		Result: shortURL,
 	}
 
 	// Устанавливаем заголовок и возвращаем успешный ответ с созданным коротким URL.
@@ -141,7 +103,7 @@ func HandleJSONPost(w http.ResponseWriter, r *http.Request) {
 
 // CreateJSONShortURL обрабатывает gRPC-запрос для создания короткого URL из JSON-запроса.
 func (s *ShortenerServer) CreateJSONShortURL(ctx context.Context, req *pb.CreateJSONShortURLRequest) (*pb.CreateJSONShortURLResponse, error) {
-	userID := req.UserId
+	userID := auth.UserIDFromContext(ctx)
 	originalURL := req.OriginalUrl
 
 	// Проверка на пустой URL.
@@ -151,15 +113,32 @@ func (s *ShortenerServer) CreateJSONShortURL(ctx context.Context, req *pb.Create
 		}, status.Error(http.StatusBadRequest, "Empty URL")
 	}
 
+	expiresAt, err := resolveExpiry(req.TtlSeconds, timestampPtr(req.ExpiresAt), time.Now())
+	if err != nil {
+		return &pb.CreateJSONShortURLResponse{
+			Error: "Invalid expiry",
+		}, status.Error(codes.InvalidArgument, "Invalid expiry")
+	}
+
 	// Используем общую бизнес-логику для сохранения URL.
-	shortURL, err := SaveShortURL(ctx, originalURL, userID)
+	shortURL, err := s.SaveShortURL(ctx, originalURL, userID, req.Alias, expiresAt)
 	if err != nil {
 		if errors.Is(err, storage.ErrAlreadyExists) {
 			return &pb.CreateJSONShortURLResponse{
-				ShortUrl: fmt.Sprintf("%s/%s", config.FlagBaseURL, shortURL),
+				ShortUrl: shortURL,
 				Error:    "URL already exists",
 			}, status.Error(http.StatusBadRequest, "URL already exists")
 		}
+		if errors.Is(err, storage.ErrShortURLTaken) {
+			return &pb.CreateJSONShortURLResponse{
+				Error: "Alias is already taken",
+			}, status.Error(codes.AlreadyExists, "Alias is already taken")
+		}
+		if errors.Is(err, ErrInvalidAlias) || errors.Is(err, ErrReservedAlias) {
+			return &pb.CreateJSONShortURLResponse{
+				Error: "Invalid alias",
+			}, status.Error(codes.InvalidArgument, "Invalid alias")
+		}
 		if errors.Is(err, ErrTimeOut) {
 			return &pb.CreateJSONShortURLResponse{
 				Error: "Request timed out",
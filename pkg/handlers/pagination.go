@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+)
+
+// Размеры страницы списка ссылок пользователя.
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// ErrInvalidListQuery ошибка некорректных параметров списка ссылок
+var ErrInvalidListQuery = errors.New("invalid list query")
+
+// URLListParams — параметры списка ссылок пользователя в том виде,
+// в котором их передаёт клиент. Пустые значения заменяются значениями
+// по умолчанию: первая страница размера DefaultPageSize, сортировка
+// по убыванию момента создания, все ссылки без поиска.
+type URLListParams struct {
+	// PageSize — размер страницы, не больше MaxPageSize.
+	PageSize int
+	// Cursor — курсор, полученный вместе с предыдущей страницей.
+	Cursor string
+	// Sort — поле сортировки: created или clicks.
+	Sort string
+	// Order — направление сортировки: asc или desc.
+	Order string
+	// Status — фильтр по удалению: all, active или deleted.
+	Status string
+	// Search — подстрока оригинального URL.
+	Search string
+}
+
+// cursorToken — содержимое курсора страницы. Курсор передаётся клиенту
+// непрозрачной строкой и применим только с той же сортировкой.
+type cursorToken struct {
+	Sort      models.URLSort `json:"s"`
+	Desc      bool           `json:"d,omitempty"`
+	CreatedAt time.Time      `json:"c"`
+	Clicks    int            `json:"n,omitempty"`
+	ShortURL  string         `json:"id"`
+	Total     int            `json:"t,omitempty"`
+}
+
+// query проверяет параметры и преобразует их в запрос к хранилищу.
+func (p URLListParams) query() (models.URLListQuery, error) {
+	query := models.URLListQuery{
+		Limit:  p.PageSize,
+		Sort:   models.URLSort(p.Sort),
+		Status: models.URLStatusFilter(p.Status),
+		Search: p.Search,
+	}
+
+	switch {
+	case query.Limit == 0:
+		query.Limit = DefaultPageSize
+	case query.Limit < 0 || query.Limit > MaxPageSize:
+		return models.URLListQuery{}, ErrInvalidListQuery
+	}
+
+	switch query.Sort {
+	case "":
+		query.Sort = models.URLSortCreated
+	case models.URLSortCreated, models.URLSortClicks:
+	default:
+		return models.URLListQuery{}, ErrInvalidListQuery
+	}
+
+	switch p.Order {
+	case "", "desc":
+		query.Desc = true
+	case "asc":
+	default:
+		return models.URLListQuery{}, ErrInvalidListQuery
+	}
+
+	switch query.Status {
+	case "":
+		query.Status = models.URLStatusAll
+	case models.URLStatusAll, models.URLStatusActive, models.URLStatusDeleted:
+	default:
+		return models.URLListQuery{}, ErrInvalidListQuery
+	}
+
+	if p.Cursor != "" {
+		after, err := decodeCursor(p.Cursor, query)
+		if err != nil {
+			return models.URLListQuery{}, err
+		}
+		query.After = after
+	}
+	return query, nil
+}
+
+// encodeCursor кодирует позицию страницы в непрозрачный курсор.
+func encodeCursor(cursor models.URLCursor, query models.URLListQuery) string {
+	data, _ := json.Marshal(cursorToken{
+		Sort:      query.Sort,
+		Desc:      query.Desc,
+		CreatedAt: cursor.CreatedAt,
+		Clicks:    cursor.Clicks,
+		ShortURL:  cursor.ShortURL,
+		Total:     cursor.Total,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor разбирает курсор и проверяет, что он выдан для той же сортировки.
+func decodeCursor(s string, query models.URLListQuery) (*models.URLCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidListQuery
+	}
+	var token cursorToken
+	if err := json.Unmarshal(data, &token); err != nil || token.ShortURL == "" {
+		return nil, ErrInvalidListQuery
+	}
+	if token.Sort != query.Sort || token.Desc != query.Desc {
+		return nil, ErrInvalidListQuery
+	}
+	return &models.URLCursor{CreatedAt: token.CreatedAt, Clicks: token.Clicks, ShortURL: token.ShortURL, Total: token.Total}, nil
+}
+
+// ListUserURLs содержит бизнес-логику постраничного списка ссылок пользователя.
+// Возвращает страницу и курсор следующей страницы (пустой для последней)
+// или ErrInvalidListQuery при некорректных параметрах.
+func (h *Handler) ListUserURLs(ctx context.Context, userID string, params URLListParams) (models.URLPage, string, error) {
+	query, err := params.query()
+	if err != nil {
+		return models.URLPage{}, "", err
+	}
+
+	page, err := h.Storage.ListUserURLs(ctx, userID, query)
+	if err != nil {
+		return models.URLPage{}, "", err
+	}
+
+	var next string
+	if page.Next != nil {
+		next = encodeCursor(*page.Next, query)
+	}
+	return page, next, nil
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sol1corejz/go-url-shortener/internal/auth"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	pb "github.com/sol1corejz/go-url-shortener/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errRevocationsDisabled — список отозванных токенов не задан (см. auth.SetRevocations).
+var errRevocationsDisabled = errors.New("token revocation is disabled")
+
+// Logout завершает сессию: отзывает токен доступа token, если он действителен,
+// и токен обновления refreshToken, если он ещё не использован, без окна
+// повторного обмена.
+func (h *Handler) Logout(ctx context.Context, token, refreshToken string) error {
+	if rv := auth.CurrentRevocations(); rv != nil && token != "" {
+		if claims, err := auth.ParseToken(token); err == nil && claims.ID != "" {
+			if err := rv.RevokeToken(ctx, claims); err != nil {
+				return err
+			}
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+	_, err := h.Storage.RevokeRefreshToken(ctx, auth.HashRefreshToken(refreshToken), true)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// RevokeUserTokens отзывает все токены доступа и обновления, выданные
+// пользователю userID, и удаляет его ключи API, чтобы у пользователя
+// не осталось действующих учётных данных.
+func (h *Handler) RevokeUserTokens(ctx context.Context, userID string) error {
+	rv := auth.CurrentRevocations()
+	if rv == nil {
+		return errRevocationsDisabled
+	}
+	if err := rv.RevokeUser(ctx, userID); err != nil {
+		return err
+	}
+
+	keys, err := h.Storage.ListAPIKeys(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		// Ключ мог быть удалён одновременно с отзывом.
+		if err := h.Storage.DeleteAPIKey(ctx, userID, key.ID); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleLogout обрабатывает запрос на выход: отзывает токены из cookies
+// и удаляет cookies сессии.
+//
+// Поддерживаемый метод HTTP: POST
+// Ответы:
+// - 204 No Content: сессия завершена (в том числе если токенов нет или они уже недействительны).
+// - 500 Internal Server Error: ошибка хранилища.
+func (h *Handler) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	var refreshToken string
+	if cookie, err := r.Cookie(auth.RefreshCookieName); err == nil {
+		refreshToken = cookie.Value
+	}
+	if err := h.Logout(r.Context(), accessToken(r), refreshToken); err != nil {
+		logger.Log.Error("Failed to log out", zap.Error(err))
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	for _, name := range []string{"token", auth.RefreshCookieName} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+		})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRevokeUserTokens обрабатывает запрос администратора на отзыв всех
+// токенов и ключей API пользователя. Маршрут доступен только из доверенной подсети.
+//
+// Поддерживаемый метод HTTP: POST
+// Ответы:
+// - 204 No Content: токены пользователя отозваны, ключи API удалены.
+// - 500 Internal Server Error: ошибка хранилища или отзыв токенов не настроен.
+func (h *Handler) HandleRevokeUserTokens(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "id")
+	if err := h.RevokeUserTokens(r.Context(), userID); err != nil {
+		logger.Log.Error("Failed to revoke user tokens", zap.String("user", userID), zap.Error(err))
+		http.Error(w, "Failed to revoke tokens", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Logout обрабатывает gRPC-запрос на выход с отзывом переданных токенов.
+func (s *ShortenerServer) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.LogoutResponse, error) {
+	if err := s.Handler.Logout(ctx, req.Token, req.RefreshToken); err != nil {
+		logger.Log.Error("Failed to log out", zap.Error(err))
+		return &pb.LogoutResponse{Error: "Failed to log out"}, status.Error(codes.Internal, "Failed to log out")
+	}
+	return &pb.LogoutResponse{}, nil
+}
+
+// RevokeUserTokens обрабатывает gRPC-запрос администратора на отзыв всех токенов и ключей API пользователя.
+func (s *ShortenerServer) RevokeUserTokens(ctx context.Context, req *pb.RevokeUserTokensRequest) (*pb.RevokeUserTokensResponse, error) {
+	if req.UserId == "" {
+		return &pb.RevokeUserTokensResponse{Error: "User ID is required"}, status.Error(codes.InvalidArgument, "User ID is required")
+	}
+	if err := s.Handler.RevokeUserTokens(ctx, req.UserId); err != nil {
+		logger.Log.Error("Failed to revoke user tokens", zap.String("user", req.UserId), zap.Error(err))
+		return &pb.RevokeUserTokensResponse{Error: "Failed to revoke tokens"}, status.Error(codes.Internal, "Failed to revoke tokens")
+	}
+	return &pb.RevokeUserTokensResponse{}, nil
+}
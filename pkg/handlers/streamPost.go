@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sol1corejz/go-url-shortener/internal/auth"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	pb "github.com/sol1corejz/go-url-shortener/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// streamChunkSize — количество строк потокового импорта, сохраняемых одной транзакцией.
+	streamChunkSize = 500
+	// maxStreamLineSize — максимальная длина строки потокового импорта.
+	maxStreamLineSize = 64 * 1024
+)
+
+// ErrLineTooLong ошибка слишком длинной строки потокового импорта
+var ErrLineTooLong = errors.New("line too long")
+
+// errInvalidRow ошибка строки потокового импорта, которую не удалось разобрать
+var errInvalidRow = errors.New("invalid row")
+
+// rowError — ошибка разбора отдельной строки импорта. Такая строка
+// отмечается некорректной, а импорт продолжается со следующей строки.
+type rowError struct {
+	line          int
+	correlationID string
+	err           error // Причина ошибки; по умолчанию errInvalidRow.
+}
+
+func (e *rowError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.Unwrap())
+}
+
+func (e *rowError) Unwrap() error {
+	if e.err == nil {
+		return errInvalidRow
+	}
+	return e.err
+}
+
+// rowDecoder последовательно читает строки потокового импорта.
+// Next возвращает io.EOF по окончании данных и *rowError для строк,
+// которые не удалось разобрать; остальные ошибки прерывают импорт.
+type rowDecoder interface {
+	Next() (models.BatchRequest, error)
+	// Buffered сообщает, есть ли уже прочитанные, но не разобранные данные.
+	Buffered() bool
+}
+
+// ndjsonDecoder читает строки импорта в формате NDJSON: по одному
+// JSON-объекту models.BatchRequest в строке.
+type ndjsonDecoder struct {
+	r    *bufio.Reader
+	line int
+}
+
+func (d *ndjsonDecoder) Next() (models.BatchRequest, error) {
+	for {
+		data, err := d.r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// Слишком длинная строка пропускается до конца, чтобы продолжить импорт.
+			d.line++
+			if err := d.skipLine(); err != nil {
+				return models.BatchRequest{}, err
+			}
+			return models.BatchRequest{}, &rowError{line: d.line, err: ErrLineTooLong}
+		}
+		if err != nil && (!errors.Is(err, io.EOF) || len(data) == 0) {
+			return models.BatchRequest{}, err
+		}
+		d.line++
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		var item models.BatchRequest
+		if err := json.Unmarshal(data, &item); err != nil {
+			return models.BatchRequest{}, &rowError{line: d.line}
+		}
+		return item, nil
+	}
+}
+
+// skipLine пропускает остаток текущей строки вместе с переводом строки.
+func (d *ndjsonDecoder) skipLine() error {
+	for {
+		_, err := d.r.ReadSlice('\n')
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case errors.Is(err, io.EOF):
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+func (d *ndjsonDecoder) Buffered() bool {
+	return d.r.Buffered() > 0
+}
+
+// csvDecoder читает строки импорта в формате CSV. Первая строка содержит
+// названия колонок: correlation_id, original_url и необязательные ttl и expires_at
+// (в формате RFC 3339).
+type csvDecoder struct {
+	br      *bufio.Reader
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func newCSVDecoder(br *bufio.Reader) (*csvDecoder, error) {
+	r := csv.NewReader(br)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["original_url"]; !ok {
+		return nil, errors.New("missing original_url column")
+	}
+	return &csvDecoder{br: br, r: r, columns: columns}, nil
+}
+
+func (d *csvDecoder) Next() (models.BatchRequest, error) {
+	record, err := d.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return models.BatchRequest{}, &rowError{line: parseErr.Line}
+		}
+		return models.BatchRequest{}, err
+	}
+	line, _ := d.r.FieldPos(0)
+
+	field := func(name string) string {
+		if i, ok := d.columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	item := models.BatchRequest{
+		CorrelationID: field("correlation_id"),
+		OriginalURL:   field("original_url"),
+	}
+	if ttl := field("ttl"); ttl != "" {
+		if item.TTL, err = strconv.ParseInt(ttl, 10, 64); err != nil {
+			return models.BatchRequest{}, &rowError{line: line, correlationID: item.CorrelationID}
+		}
+	}
+	if expiresAt := field("expires_at"); expiresAt != "" {
+		at, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return models.BatchRequest{}, &rowError{line: line, correlationID: item.CorrelationID}
+		}
+		item.ExpiresAt = &at
+	}
+	return item, nil
+}
+
+func (d *csvDecoder) Buffered() bool {
+	return d.br.Buffered() > 0
+}
+
+// HandleStreamPost обрабатывает потоковый импорт ссылок.
+//
+// Строки читаются по мере поступления и сохраняются пакетами по streamChunkSize
+// одной транзакцией; следующий пакет читается только после отправки результатов
+// предыдущего, поэтому медленный клиент или хранилище притормаживают чтение запроса.
+// Неполный пакет сохраняется, как только клиент перестаёт присылать данные.
+//
+// Поддерживаемые HTTP-методы: POST
+// Тело запроса: NDJSON (application/x-ndjson, по умолчанию) с объектами
+// в формате пакетного запроса или CSV (text/csv) с заголовком из названий колонок
+// correlation_id, original_url, ttl и expires_at.
+// Ответ: 200 OK и поток NDJSON с результатом каждой строки в порядке запроса,
+// как в HandleBatchPost. Строки, которые не удалось разобрать или которые длиннее
+// maxStreamLineSize, получают статус invalid и номер строки в поле error. Элемент без статуса сообщает об ошибке,
+// прервавшей импорт.
+// Ошибки до начала импорта:
+//   - 400 Bad Request: некорректный заголовок CSV.
+//   - 401 Unauthorized: невалидный токен аутентификации.
+//   - 403 Forbidden: у ключа API нет права create.
+//   - 415 Unsupported Media Type: неподдерживаемый формат тела запроса.
+func (h *Handler) HandleStreamPost(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
+		return
+	}
+	defer r.Body.Close()
+
+	br := bufio.NewReaderSize(r.Body, maxStreamLineSize)
+	var dec rowDecoder
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "", "application/x-ndjson", "application/ndjson", "application/jsonl":
+		dec = &ndjsonDecoder{r: br}
+	case "text/csv":
+		csvDec, err := newCSVDecoder(br)
+		if err != nil {
+			http.Error(w, "Invalid CSV header", http.StatusBadRequest)
+			return
+		}
+		dec = csvDec
+	default:
+		http.Error(w, "Unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Ответ отправляется до окончания чтения запроса.
+	rc := http.NewResponseController(w)
+	if err := rc.EnableFullDuplex(); err != nil {
+		logger.Log.Debug("Full duplex is not supported", zap.Error(err))
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+
+	err := h.importRows(r.Context(), dec, userID, func(res []models.BatchResponse) error {
+		for _, item := range res {
+			if err := enc.Encode(item); err != nil {
+				return err
+			}
+		}
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Error("Stream import failed", zap.Error(err))
+		enc.Encode(models.BatchResponse{Error: err.Error()})
+		rc.Flush()
+	}
+}
+
+// importRows читает строки из dec, сохраняет их пакетами через SaveBatch
+// и передаёт результаты каждого пакета в emit в порядке строк.
+func (h *Handler) importRows(ctx context.Context, dec rowDecoder, userID string, emit func([]models.BatchResponse) error) error {
+	chunk := make([]models.BatchRequest, 0, streamChunkSize)
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		res, err := h.SaveBatch(ctx, chunk, userID, false)
+		if err != nil {
+			return err
+		}
+		chunk = chunk[:0]
+		return emit(res)
+	}
+
+	for {
+		// Пока клиент не прислал новых данных, накопленные строки сохраняются
+		// без ожидания заполнения пакета.
+		if !dec.Buffered() {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+
+		item, err := dec.Next()
+		var rowErr *rowError
+		switch {
+		case errors.Is(err, io.EOF):
+			return flush()
+		case errors.As(err, &rowErr):
+			if err := flush(); err != nil {
+				return err
+			}
+			if err := emit([]models.BatchResponse{{
+				CorrelationID: rowErr.correlationID,
+				Status:        models.BatchInvalid,
+				Error:         rowErr.Error(),
+			}}); err != nil {
+				return err
+			}
+			continue
+		case err != nil:
+			return err
+		}
+
+		chunk = append(chunk, item)
+		if len(chunk) == streamChunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// grpcRecv — результат чтения очередного сообщения из потока gRPC.
+type grpcRecv struct {
+	req *pb.StreamPostRequest
+	err error
+}
+
+// grpcRowDecoder читает строки импорта из потока gRPC. Сообщения читаются
+// отдельной горутиной, чтобы Buffered мог сообщить, прислал ли клиент
+// следующие строки.
+type grpcRowDecoder struct {
+	ctx   context.Context
+	first *pb.StreamPostRequest // Первое сообщение, полученное до начала импорта.
+	recv  chan grpcRecv
+}
+
+func newGRPCRowDecoder(stream grpc.BidiStreamingServer[pb.StreamPostRequest, pb.StreamPostResponse], first *pb.StreamPostRequest) *grpcRowDecoder {
+	d := &grpcRowDecoder{ctx: stream.Context(), first: first, recv: make(chan grpcRecv, streamChunkSize)}
+	go func() {
+		for {
+			req, err := stream.Recv()
+			select {
+			case d.recv <- grpcRecv{req: req, err: err}:
+			case <-d.ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return d
+}
+
+func (d *grpcRowDecoder) Next() (models.BatchRequest, error) {
+	req := d.first
+	d.first = nil
+	if req == nil {
+		select {
+		case r := <-d.recv:
+			if r.err != nil {
+				return models.BatchRequest{}, r.err
+			}
+			req = r.req
+		case <-d.ctx.Done():
+			return models.BatchRequest{}, d.ctx.Err()
+		}
+	}
+	url := req.GetUrl()
+	return models.BatchRequest{
+		OriginalURL:   url.GetOriginalUrl(),
+		CorrelationID: url.GetCorrelationId(),
+		ExpiresAt:     timestampPtr(url.GetExpiresAt()),
+		TTL:           url.GetTtlSeconds(),
+	}, nil
+}
+
+func (d *grpcRowDecoder) Buffered() bool {
+	return d.first != nil || len(d.recv) > 0
+}
+
+// StreamPost обрабатывает двунаправленный поток gRPC с импортом ссылок.
+// Пользователь определяется по метаданным потока
+// (см. middlewares.AuthStreamInterceptor). На каждую строку, как и в
+// HandleStreamPost, в порядке запроса отправляется результат с correlation_id
+// и сокращённой ссылкой либо статусом invalid и причиной ошибки.
+func (s *ShortenerServer) StreamPost(stream grpc.BidiStreamingServer[pb.StreamPostRequest, pb.StreamPostResponse]) error {
+	first, err := stream.Recv()
+	if errors.Is(err, io.EOF) {
+		return status.Error(codes.InvalidArgument, "Stream cannot be empty")
+	}
+	if err != nil {
+		return err
+	}
+	userID := auth.UserIDFromContext(stream.Context())
+	if userID == "" {
+		return status.Error(codes.Unauthenticated, "Invalid or missing token")
+	}
+
+	err = s.importRows(stream.Context(), newGRPCRowDecoder(stream, first), userID, func(res []models.BatchResponse) error {
+		for _, item := range res {
+			if err := stream.Send(&pb.StreamPostResponse{Url: &pb.BatchResponse{
+				CorrelationId: item.CorrelationID,
+				ShortUrl:      item.ShortURL,
+				Status:        string(item.Status),
+				Error:         item.Error,
+			}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Log.Error("Stream import failed", zap.Error(err))
+		return status.Error(codes.Internal, "Internal server error")
+	}
+	return nil
+}
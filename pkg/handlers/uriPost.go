@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	pb "github.com/sol1corejz/go-url-shortener/proto"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"io"
 	"net/http"
@@ -14,100 +15,108 @@ import (
 	"github.com/google/uuid"
 	"github.com/sol1corejz/go-url-shortener/cmd/config"
 	"github.com/sol1corejz/go-url-shortener/internal/auth"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
 	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/shortid"
 	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	"go.uber.org/zap"
 )
 
-// ShortenerServer представляет сервер для обработки gRPC-запросов.
-// Включает методы, соответствующие gRPC-интерфейсу.
-type ShortenerServer struct {
-	pb.UnimplementedShortenerServer
-}
-
 // ErrTimeOut ошибка времени выполнения
 var ErrTimeOut = errors.New("request timed out")
 
+// ErrEmptyURL ошибка пустого URL в запросе
+var ErrEmptyURL = errors.New("empty URL")
+
 // SaveShortURL содержит бизнес-логику обработки и сохранения URL.
-func SaveShortURL(ctx context.Context, originalURL, userID string) (string, error) {
+// Если alias не пуст, он проверяется и используется в качестве короткого
+// идентификатора вместо сгенерированного. Если expiresAt не nil, ссылка
+// перестаёт действовать в указанный момент.
+func (h *Handler) SaveShortURL(ctx context.Context, originalURL, userID, alias string, expiresAt *time.Time) (string, error) {
 	select {
 	case <-ctx.Done():
 		return "", ErrTimeOut
 	default:
 		// Проверка на пустой URL
 		if originalURL == "" {
-			return "", errors.New("empty URL")
+			return "", ErrEmptyURL
 		}
 
-		// Генерация короткого идентификатора
-		shortID := generateShortID()
-		shortURL := fmt.Sprintf("%s/%s", config.FlagBaseURL, shortID)
-
 		// Создание структуры с данными для сохранения
 		event := models.URLData{
 			OriginalURL: originalURL,
-			ShortURL:    shortID,
 			UUID:        uuid.New().String(),
 			UserUUID:    userID,
 			DeletedFlag: false,
+			ExpiresAt:   expiresAt,
 		}
 
 		// Попытка сохранить URL в хранилище
-		if existURL, err := storage.SaveURL(&event); err != nil {
+		if existURL, err := h.saveURL(ctx, &event, alias); err != nil {
 			if errors.Is(err, storage.ErrAlreadyExists) {
 				return fmt.Sprintf("%s/%s", config.FlagBaseURL, existURL), storage.ErrAlreadyExists
 			}
 			return "", err
 		}
 
-		return shortURL, nil
+		return fmt.Sprintf("%s/%s", config.FlagBaseURL, event.ShortURL), nil
+	}
+}
+
+// saveURL сохраняет запись под псевдонимом alias либо под сгенерированным
+// идентификатором. Ссылка с псевдонимом создаётся, даже если URL уже сокращён:
+// дубликаты ищутся только для сгенерированных идентификаторов. При коллизии
+// сгенерированного идентификатора с существующей ссылкой генерирует новый,
+// но не более shortid.MaxAttempts раз.
+func (h *Handler) saveURL(ctx context.Context, event *models.URLData, alias string) (string, error) {
+	if alias != "" {
+		if err := validateAlias(alias); err != nil {
+			return "", err
+		}
+		event.ShortURL, event.Alias = alias, true
+		return h.Storage.SaveURL(ctx, event)
+	}
+
+	for attempt := 0; attempt < shortid.MaxAttempts; attempt++ {
+		shortID, err := h.Generator.Generate(event.OriginalURL, attempt)
+		if err != nil {
+			return "", err
+		}
+		event.ShortURL = shortID
+
+		existURL, err := h.Storage.SaveURL(ctx, event)
+		if errors.Is(err, storage.ErrShortURLTaken) {
+			logger.Log.Debug("Short ID collision", zap.String("id", shortID), zap.Int("attempt", attempt))
+			continue
+		}
+		return existURL, err
 	}
+	return "", shortid.ErrExhausted
 }
 
 // HandlePost обрабатывает POST-запрос, содержащий оригинальный URL, и генерирует для него короткий URL.
 // Функция выполняет следующие действия:
-// 1. Проверяет наличие токена в cookies. Если токен отсутствует, генерирует новый токен и устанавливает его в cookie.
+// 1. Проверяет токен в cookies и продлевает его при необходимости. Если токена нет, продолжает сессию по токену обновления или начинает новую.
 // 2. Читает тело запроса, ожидая, что в нем будет содержаться оригинальный URL.
 // 3. Генерирует короткий идентификатор для URL и формирует короткий URL.
 // 4. Создает структуру данных с информацией о URL и сохраняет ее в хранилище.
-// 5. Если URL уже существует, возвращает существующий короткий URL с кодом 409 (Conflict).
+// 5. Если URL уже сокращён (в пределах, заданных режимом дедупликации), возвращает существующий короткий URL с кодом 409 (Conflict).
 // 6. В случае успешного создания короткого URL, возвращает его с кодом 201 (Created).
 //
 // В случае ошибок возвращаются соответствующие HTTP-статусы:
 // - 400 (Bad Request) для пустого URL,
 // - 401 (Unauthorized) для невалидного токена,
+// - 403 (Forbidden) если у ключа API нет права create,
 // - 409 (Conflict) если короткий URL уже существует,
 // - 500 (Internal Server Error) в случае проблем на сервере.
-func HandlePost(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HandlePost(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	// Проверка наличия токена в cookie
-	cookie, err := r.Cookie("token")
-	var userID string
-	if errors.Is(err, http.ErrNoCookie) {
-		// Генерация нового токена
-		token, err := auth.GenerateToken()
-		if err != nil {
-			http.Error(w, "Unable to generate token", http.StatusInternalServerError)
-			return
-		}
-
-		http.SetCookie(w, &http.Cookie{
-			Name:     "token",
-			Value:    token,
-			Expires:  time.Now().Add(auth.TokenExp),
-			HttpOnly: true,
-		})
-		userID = auth.GetUserID(token)
-	} else if err != nil {
-		http.Error(w, "Error retrieving cookie", http.StatusBadRequest)
+	// Проверка токена в cookie, его продление или начало новой сессии
+	userID, ok := h.sessionUserID(w, r)
+	if !ok {
 		return
-	} else {
-		userID = auth.GetUserID(cookie.Value)
-		if userID == "" {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
-		}
 	}
 
 	// Чтение тела запроса
@@ -121,16 +130,21 @@ func HandlePost(w http.ResponseWriter, r *http.Request) {
 	originalURL := strings.TrimSpace(string(body))
 
 	// Используем общую бизнес-логику
-	shortURL, err := SaveShortURL(ctx, originalURL, userID)
+	shortURL, err := h.SaveShortURL(ctx, originalURL, userID, "", nil)
 	if err != nil {
 		if errors.Is(err, storage.ErrAlreadyExists) {
-			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 			w.WriteHeader(http.StatusConflict)
 			w.Write([]byte(shortURL))
 			return
 		}
+		if errors.Is(err, ErrEmptyURL) {
+			http.Error(w, "Empty URL", http.StatusBadRequest)
+			return
+		}
 		if errors.Is(err, ErrTimeOut) {
 			http.Error(w, "Request timed out", http.StatusRequestTimeout)
+			return
 		}
 		http.Error(w, "Failed to save URL", http.StatusInternalServerError)
 		return
@@ -143,11 +157,16 @@ func HandlePost(w http.ResponseWriter, r *http.Request) {
 
 // CreateShortURL обрабатывает gRPC-запрос для создания короткого URL.
 func (s *ShortenerServer) CreateShortURL(ctx context.Context, req *pb.CreateShortURLRequest) (*pb.CreateShortURLResponse, error) {
-	userID := req.UserId
+	userID := auth.UserIDFromContext(ctx)
 	originalURL := req.OriginalUrl
 
+	expiresAt, err := resolveExpiry(req.TtlSeconds, timestampPtr(req.ExpiresAt), time.Now())
+	if err != nil {
+		return &pb.CreateShortURLResponse{Error: "Invalid expiry"}, status.Error(codes.InvalidArgument, "Invalid expiry")
+	}
+
 	// Используем общую бизнес-логику
-	shortURL, err := SaveShortURL(ctx, originalURL, userID)
+	shortURL, err := s.SaveShortURL(ctx, originalURL, userID, "", expiresAt)
 	if err != nil {
 		if errors.Is(err, storage.ErrAlreadyExists) {
 			return &pb.CreateShortURLResponse{ShortUrl: shortURL, Error: "URL already exists"}, status.Error(http.StatusConflict, "URL already exists")
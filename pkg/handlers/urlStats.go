@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sol1corejz/go-url-shortener/internal/auth"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	pb "github.com/sol1corejz/go-url-shortener/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ClickStats возвращает статистику переходов по ссылке shortID,
+// принадлежащей пользователю userID. Если ссылка не найдена или
+// принадлежит другому пользователю, возвращает storage.ErrNotFound.
+func (h *Handler) ClickStats(ctx context.Context, userID, shortID string) (models.ClickStats, error) {
+	data, err := h.Storage.GetOriginalURL(ctx, shortID)
+	if err != nil {
+		return models.ClickStats{}, err
+	}
+	if data.UserUUID != userID {
+		return models.ClickStats{}, storage.ErrNotFound
+	}
+
+	stats, err := h.Storage.GetClickStats(ctx, shortID)
+	if err != nil {
+		return models.ClickStats{}, err
+	}
+	if stats.Days == nil {
+		stats.Days = []models.DailyClicks{}
+	}
+	return stats, nil
+}
+
+// HandleGetURLStats обрабатывает запрос на получение статистики переходов
+// по ссылке текущего пользователя: общего количества и распределения по дням.
+//
+// Ответ:
+//   - 200 OK: статистика в формате JSON.
+//   - 401 Unauthorized: пользователь не авторизован.
+//   - 403 Forbidden: у ключа API нет права read.
+//   - 404 Not Found: ссылка не найдена или принадлежит другому пользователю.
+//   - 500 Internal Server Error: ошибка хранилища.
+func (h *Handler) HandleGetURLStats(w http.ResponseWriter, r *http.Request) {
+	// Проверяем, авторизован ли пользователь.
+	userID, ok := h.authorizedUserID(w, r, models.ScopeRead)
+	if !ok {
+		return
+	}
+
+	stats, err := h.ClickStats(r.Context(), userID, chi.URLParam(r, "id"))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "URL not found", http.StatusNotFound)
+			return
+		}
+		logger.Log.Error("Failed to get URL stats", zap.Error(err))
+		http.Error(w, "Failed to get URL stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		logger.Log.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// GetURLStats обрабатывает gRPC-запрос на получение статистики переходов по ссылке.
+// Пользователь определяется по токену из метаданных (см. middlewares.AuthInterceptor).
+func (s *ShortenerServer) GetURLStats(ctx context.Context, req *pb.GetURLStatsRequest) (*pb.GetURLStatsResponse, error) {
+	stats, err := s.ClickStats(ctx, auth.UserIDFromContext(ctx), req.ShortUrl)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return &pb.GetURLStatsResponse{
+				Error: "URL not found",
+			}, status.Error(codes.NotFound, "URL not found")
+		}
+		return &pb.GetURLStatsResponse{
+			Error: "Failed to get URL stats",
+		}, status.Error(codes.Internal, "Failed to get URL stats")
+	}
+
+	days := make([]*pb.DailyClicks, 0, len(stats.Days))
+	for _, day := range stats.Days {
+		days = append(days, &pb.DailyClicks{Date: day.Date, Clicks: int64(day.Clicks)})
+	}
+
+	return &pb.GetURLStatsResponse{
+		Total: int64(stats.Total),
+		Days:  days,
+	}, nil
+}
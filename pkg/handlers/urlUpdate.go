@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/sol1corejz/go-url-shortener/cmd/config"
+	"github.com/sol1corejz/go-url-shortener/internal/auth"
+	"github.com/sol1corejz/go-url-shortener/internal/logger"
+	"github.com/sol1corejz/go-url-shortener/internal/models"
+	"github.com/sol1corejz/go-url-shortener/internal/storage"
+	pb "github.com/sol1corejz/go-url-shortener/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ChangeOriginalURL меняет оригинальный URL ссылки shortID, принадлежащей пользователю
+// userID, и возвращает результат вместе с историей предыдущих URL.
+// Если ссылка не найдена, удалена или принадлежит другому пользователю,
+// возвращает storage.ErrNotFound.
+func (h *Handler) ChangeOriginalURL(ctx context.Context, userID, shortID, originalURL string) (models.UpdateURLResponse, error) {
+	originalURL = strings.TrimSpace(originalURL)
+	if originalURL == "" {
+		return models.UpdateURLResponse{}, ErrEmptyURL
+	}
+
+	if err := h.Storage.UpdateOriginalURL(ctx, shortID, userID, originalURL); err != nil {
+		return models.UpdateURLResponse{}, err
+	}
+
+	history, err := h.Storage.GetURLHistory(ctx, shortID)
+	if err != nil {
+		return models.UpdateURLResponse{}, err
+	}
+	if history == nil {
+		history = []models.URLChange{}
+	}
+
+	return models.UpdateURLResponse{
+		ShortURL:    fmt.Sprintf("%s/%s", config.FlagBaseURL, shortID),
+		OriginalURL: originalURL,
+		History:     history,
+	}, nil
+}
+
+// HandleUpdateURL обрабатывает запрос на изменение оригинального URL ссылки
+// текущего пользователя. Тело запроса: JSON-объект с полем url.
+//
+// Ответ:
+//   - 200 OK: новая ссылка и история предыдущих URL в формате JSON.
+//   - 400 Bad Request: некорректное тело запроса или пустой URL.
+//   - 401 Unauthorized: пользователь не авторизован.
+//   - 403 Forbidden: у ключа API нет права create.
+//   - 404 Not Found: ссылка не найдена, удалена или принадлежит другому пользователю.
+//   - 500 Internal Server Error: ошибка хранилища.
+func (h *Handler) HandleUpdateURL(w http.ResponseWriter, r *http.Request) {
+	// Проверяем, авторизован ли пользователь.
+	userID, ok := h.authorizedUserID(w, r, models.ScopeCreate)
+	if !ok {
+		return
+	}
+
+	var req models.Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logger.Log.Debug("cannot decode request JSON body", zap.Error(err))
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.ChangeOriginalURL(r.Context(), userID, chi.URLParam(r, "id"), req.URL)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEmptyURL):
+			http.Error(w, "Empty URL", http.StatusBadRequest)
+		case errors.Is(err, storage.ErrNotFound):
+			http.Error(w, "URL not found", http.StatusNotFound)
+		default:
+			logger.Log.Error("Failed to update URL", zap.Error(err))
+			http.Error(w, "Failed to update URL", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Log.Error("Failed to encode response", zap.Error(err))
+	}
+}
+
+// UpdateURL обрабатывает gRPC-запрос на изменение оригинального URL ссылки.
+// Пользователь определяется по токену из метаданных (см. middlewares.AuthInterceptor).
+func (s *ShortenerServer) UpdateURL(ctx context.Context, req *pb.UpdateURLRequest) (*pb.UpdateURLResponse, error) {
+	resp, err := s.ChangeOriginalURL(ctx, auth.UserIDFromContext(ctx), req.ShortUrl, req.OriginalUrl)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEmptyURL):
+			return &pb.UpdateURLResponse{Error: "Empty URL"}, status.Error(codes.InvalidArgument, "Empty URL")
+		case errors.Is(err, storage.ErrNotFound):
+			return &pb.UpdateURLResponse{Error: "URL not found"}, status.Error(codes.NotFound, "URL not found")
+		default:
+			return &pb.UpdateURLResponse{Error: "Failed to update URL"}, status.Error(codes.Internal, "Failed to update URL")
+		}
+	}
+
+	history := make([]*pb.URLChange, 0, len(resp.History))
+	for _, change := range resp.History {
+		history = append(history, &pb.URLChange{
+			OriginalUrl: change.OriginalURL,
+			ChangedAt:   timestamppb.New(change.ChangedAt),
+		})
+	}
+
+	return &pb.UpdateURLResponse{
+		ShortUrl:    resp.ShortURL,
+		OriginalUrl: resp.OriginalURL,
+		History:     history,
+	}, nil
+}